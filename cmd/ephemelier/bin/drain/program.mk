@@ -0,0 +1,7 @@
+DRAIN_SRCS = $(wildcard bin/drain/*.mpcl)
+DRAIN_DSRCS = $(wildcard bin/drain/*.dmpcl)
+DRAIN_CIRUITS = $(patsubst %.mpcl,%.mpclc,$(DRAIN_SRCS))
+DRAIN_STAMPS = $(patsubst %.dmpcl,%.stamp,$(DRAIN_DSRCS))
+
+ALL_TARGETS += $(DRAIN_CIRUITS) $(DRAIN_STAMPS)
+CLEANFILES  += $(DRAIN_CIRUITS) $(DRAIN_STAMPS) bin/drain/symtab
@@ -0,0 +1,288 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/markkurossi/ephemelier/crypto/spdz"
+	"github.com/markkurossi/ephemelier/kernel"
+)
+
+// Config defines the node configuration. The configuration is read
+// from a JSON file and the command line flags override the file
+// values.
+type Config struct {
+	Evaluator   bool   `json:"evaluator"`
+	Verbose     bool   `json:"verbose"`
+	Diagnostics bool   `json:"diagnostics"`
+	Trace       bool   `json:"ktrace"`
+	TraceHex    bool   `json:"ktrace_hex"`
+	Console     bool   `json:"console"`
+	ConsolePort string `json:"console_port"`
+	MPCPort     string `json:"mpc_port"`
+	Filesystem  string `json:"fs"`
+	Vault       string `json:"vault"`
+
+	// TraceFormat specifies the ktrace output format: text (default)
+	// or json.
+	TraceFormat string `json:"ktrace_format"`
+
+	// ProgramCacheSize specifies how many parsed programs the kernel
+	// caches. The value 0 disables the program cache.
+	ProgramCacheSize int `json:"progcache"`
+
+	// MaxProcMem specifies the maximum size of the process'
+	// in-memory files in bytes. The value 0 disables the limit.
+	MaxProcMem int `json:"max_proc_mem"`
+
+	// MaxProcesses specifies the maximum number of live processes.
+	// The value 0 disables the limit.
+	MaxProcesses int `json:"max_processes"`
+
+	// MaxFDs specifies the maximum number of open file descriptors
+	// per process. The value 0 disables the limit.
+	MaxFDs int `json:"max_fds"`
+
+	// MaxMem specifies the maximum size of the program memory in
+	// bytes. The value 0 disables the limit.
+	MaxMem int `json:"max_mem"`
+
+	// AllowCIDRs specify the client IP prefixes the listening
+	// programs accept connections from.
+	AllowCIDRs []string `json:"allow_cidrs"`
+
+	// PortCipher specifies the cipher for the messages between the
+	// processes: none, aes-128-gcm, or chacha20-poly1305.
+	PortCipher string `json:"port_cipher"`
+
+	// OT specifies the base OT protocol: co (default) or insecure.
+	// The insecure OT is only for testing and benchmarking. Both
+	// nodes must use the same OT.
+	OT string `json:"ot"`
+
+	// TriplePool specifies the SPDZ triple pool file generated with
+	// the triples command. The pool's MAC key share is read from the
+	// file with the .key suffix and its consumption state from the
+	// file with the .used suffix.
+	TriplePool string `json:"triple_pool"`
+
+	// UID specifies the user identity of the processes. The file
+	// permissions of the encrypted files are checked against the
+	// identity; the uid 0 bypasses the checks.
+	UID uint `json:"uid"`
+
+	// ConsoleUID specifies the user identity of the console shells.
+	// The console drain command requires the uid 0.
+	ConsoleUID uint `json:"console_uid"`
+
+	// HealthPort specifies the address of the HTTP health check
+	// endpoint. The endpoint returns 503 when the node is draining.
+	// The empty value disables the endpoint.
+	HealthPort string `json:"health_port"`
+
+	// Programs specify the programs the garbler runs on startup.
+	Programs []string `json:"programs"`
+}
+
+// NewConfig creates a new configuration with the default values.
+func NewConfig() *Config {
+	return &Config{
+		ConsolePort:      ":2323",
+		MPCPort:          ":9000",
+		ProgramCacheSize: 16,
+		UID:              uint(kernel.NobodyUID),
+		ConsoleUID:       uint(kernel.NobodyUID),
+	}
+}
+
+// ReadConfig reads the configuration file into config. Unknown
+// configuration keys are errors.
+func (config *Config) ReadConfig(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(config)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// Flags defines the command line flags for the configuration values.
+// The flag default values are taken from config.
+func (config *Config) Flags(fs *flag.FlagSet) {
+	fs.BoolVar(&config.Evaluator, "e", config.Evaluator,
+		"evaluator / garbler mode")
+	fs.BoolVar(&config.Verbose, "v", config.Verbose, "verbose output")
+	fs.BoolVar(&config.Diagnostics, "d", config.Diagnostics,
+		"diagnostics output")
+	fs.BoolVar(&config.Console, "console", config.Console, "start console")
+	fs.BoolVar(&config.Trace, "ktrace", config.Trace, "kernel trace")
+	fs.BoolVar(&config.TraceHex, "x", config.TraceHex,
+		"hexdump ktrace data fields")
+	fs.StringVar(&config.Filesystem, "fs", config.Filesystem,
+		"filesystem root directory")
+	fs.StringVar(&config.Vault, "vault", config.Vault,
+		"keyvault root directory")
+	fs.IntVar(&config.ProgramCacheSize, "progcache", config.ProgramCacheSize,
+		"number of parsed programs to cache (0 disables cache)")
+	fs.UintVar(&config.UID, "uid", config.UID, "process user id")
+}
+
+// Override sets the configuration values from the flags which were
+// set on the command line.
+func (config *Config) Override(fs *flag.FlagSet, flags *Config) {
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "e":
+			config.Evaluator = flags.Evaluator
+		case "v":
+			config.Verbose = flags.Verbose
+		case "d":
+			config.Diagnostics = flags.Diagnostics
+		case "console":
+			config.Console = flags.Console
+		case "ktrace":
+			config.Trace = flags.Trace
+		case "x":
+			config.TraceHex = flags.TraceHex
+		case "fs":
+			config.Filesystem = flags.Filesystem
+		case "vault":
+			config.Vault = flags.Vault
+		case "progcache":
+			config.ProgramCacheSize = flags.ProgramCacheSize
+		case "uid":
+			config.UID = flags.UID
+		}
+	})
+	if len(fs.Args()) > 0 {
+		config.Programs = fs.Args()
+	}
+}
+
+// Validate validates the configuration and sets the default values
+// for the role-specific settings.
+func (config *Config) Validate() error {
+	if len(config.Filesystem) == 0 {
+		if config.Evaluator {
+			config.Filesystem = "data/fs1"
+		} else {
+			config.Filesystem = "data/fs0"
+		}
+	}
+	if len(config.Vault) == 0 {
+		if config.Evaluator {
+			config.Vault = "data/vault1"
+		} else {
+			config.Vault = "data/vault0"
+		}
+	}
+	if config.ProgramCacheSize < 0 {
+		return fmt.Errorf("invalid progcache %v: must be non-negative",
+			config.ProgramCacheSize)
+	}
+	_, _, err := net.SplitHostPort(config.MPCPort)
+	if err != nil {
+		return fmt.Errorf("invalid mpc_port %q: %w", config.MPCPort, err)
+	}
+	if config.MaxProcMem < 0 {
+		return fmt.Errorf("invalid max_proc_mem %v: must be non-negative",
+			config.MaxProcMem)
+	}
+	if config.MaxProcesses < 0 {
+		return fmt.Errorf("invalid max_processes %v: must be non-negative",
+			config.MaxProcesses)
+	}
+	if config.MaxFDs < 0 {
+		return fmt.Errorf("invalid max_fds %v: must be non-negative",
+			config.MaxFDs)
+	}
+	if config.MaxMem < 0 {
+		return fmt.Errorf("invalid max_mem %v: must be non-negative",
+			config.MaxMem)
+	}
+	if config.UID > 0xffffffff {
+		return fmt.Errorf("invalid uid %v: must be a 32-bit value",
+			config.UID)
+	}
+	if config.ConsoleUID > 0xffffffff {
+		return fmt.Errorf("invalid console_uid %v: must be a 32-bit value",
+			config.ConsoleUID)
+	}
+	_, err = kernel.ParseCIDRs(config.AllowCIDRs)
+	if err != nil {
+		return fmt.Errorf("invalid allow_cidrs: %w", err)
+	}
+	_, err = kernel.ParsePortCipher(config.PortCipher)
+	if err != nil {
+		return fmt.Errorf("invalid port_cipher: %w", err)
+	}
+	_, err = spdz.ParseOTType(config.OT)
+	if err != nil {
+		return fmt.Errorf("invalid ot: %w", err)
+	}
+	_, err = kernel.ParseTraceFormat(config.TraceFormat)
+	if err != nil {
+		return fmt.Errorf("invalid ktrace_format: %w", err)
+	}
+	if config.Console {
+		_, _, err = net.SplitHostPort(config.ConsolePort)
+		if err != nil {
+			return fmt.Errorf("invalid console_port %q: %w",
+				config.ConsolePort, err)
+		}
+	}
+	if len(config.HealthPort) > 0 {
+		_, _, err = net.SplitHostPort(config.HealthPort)
+		if err != nil {
+			return fmt.Errorf("invalid health_port %q: %w",
+				config.HealthPort, err)
+		}
+	}
+	return nil
+}
+
+// Params returns the kernel parameters for the configuration.
+func (config *Config) Params() *kernel.Params {
+	// The port cipher, OT, and trace format are checked in Validate.
+	portCipher, _ := kernel.ParsePortCipher(config.PortCipher)
+	oti, _ := spdz.ParseOTType(config.OT)
+	traceFormat, _ := kernel.ParseTraceFormat(config.TraceFormat)
+
+	return &kernel.Params{
+		Trace:       config.Trace,
+		TraceHex:    config.TraceHex,
+		TraceFormat: traceFormat,
+		Verbose:     config.Verbose,
+		Diagnostics: config.Diagnostics,
+		Filesystem:  config.Filesystem,
+		Vault:       config.Vault,
+		Port:        config.MPCPort,
+
+		ProgramCacheSize: config.ProgramCacheSize,
+		MaxProcMem:       config.MaxProcMem,
+		MaxProcesses:     config.MaxProcesses,
+		MaxFDs:           config.MaxFDs,
+		MaxMem:           config.MaxMem,
+		AllowCIDRs:       config.AllowCIDRs,
+		PortCipher:       portCipher,
+		OT:               oti,
+		TriplePool:       config.TriplePool,
+		UID:              kernel.UID(config.UID),
+	}
+}
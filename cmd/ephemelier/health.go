@@ -0,0 +1,47 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+)
+
+// health runs the health check endpoint at addr. The /health request
+// returns 200 when the node accepts new work and 503 when the node is
+// draining. The endpoint keeps running during the drain so that the
+// load balancers see the node going out of service.
+func health(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Health check running at %s", addr)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", healthHandler)
+
+	go func() {
+		err := http.Serve(listener, mux)
+		if err != nil {
+			log.Printf("health check: %s", err)
+		}
+	}()
+	return nil
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if kern.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "draining")
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
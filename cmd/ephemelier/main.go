@@ -14,14 +14,20 @@ import (
 	"net"
 	"os"
 	"runtime/pprof"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/markkurossi/ephemelier/kernel"
 )
 
+// procLimitBackoff specifies how long the console waits before
+// accepting new connections when the kernel is at its process limit.
+const procLimitBackoff = time.Second
+
 var (
-	mpcPort     = ":9000"
-	consolePort = ":2323"
+	consolePort string
+	consoleUID  kernel.UID
 	bo          = binary.BigEndian
 	kern        *kernel.Kernel
 	stdin       = kernel.NewFileFD(os.Stdin)
@@ -31,14 +37,9 @@ var (
 )
 
 func main() {
-	evaluator := flag.Bool("e", false, "evaluator / garbler mode")
-	fVerbose := flag.Bool("v", false, "verbose output")
-	fDiagnostics := flag.Bool("d", false, "diagnostics output")
-	fConsole := flag.Bool("console", false, "start console")
-	ktrace := flag.Bool("ktrace", false, "kernel trace")
-	ktraceHex := flag.Bool("x", false, "hexdump ktrace data fields")
-	fs := flag.String("fs", "", "filesystem root directory")
-	vault := flag.String("vault", "", "keyvault root directory")
+	flags := NewConfig()
+	flags.Flags(flag.CommandLine)
+	configFile := flag.String("config", "", "read configuration from `file`")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to `file`")
 	memprofile := flag.String("memprofile", "",
 		"write memory profile to `file`")
@@ -46,6 +47,21 @@ func main() {
 
 	log.SetFlags(0)
 
+	config := NewConfig()
+	if len(*configFile) > 0 {
+		err := config.ReadConfig(*configFile)
+		if err != nil {
+			log.Fatalf("could not read config: %s", err)
+		}
+	}
+	config.Override(flag.CommandLine, flags)
+	err := config.Validate()
+	if err != nil {
+		log.Fatalf("invalid config: %s", err)
+	}
+	consolePort = config.ConsolePort
+	consoleUID = kernel.UID(config.ConsoleUID)
+
 	if len(*cpuprofile) > 0 {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -58,62 +74,53 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	params := &kernel.Params{
-		Trace:       *ktrace,
-		TraceHex:    *ktraceHex,
-		Verbose:     *fVerbose,
-		Diagnostics: *fDiagnostics,
-		Filesystem:  *fs,
-		Vault:       *vault,
-		Port:        mpcPort,
-		Stdin:       stdin,
-		Stdout:      stdout,
-		Stderr:      stderr,
-	}
-	if len(params.Filesystem) == 0 {
-		if *evaluator {
-			params.Filesystem = "data/fs1"
-		} else {
-			params.Filesystem = "data/fs0"
-		}
-	}
-	if len(params.Vault) == 0 {
-		if *evaluator {
-			params.Vault = "data/vault1"
-		} else {
-			params.Vault = "data/vault0"
-		}
-	}
+	params := config.Params()
+	params.Stdin = stdin
+	params.Stdout = stdout
+	params.Stderr = stderr
 
 	// Make sure filesystem root exists.
-	err := os.MkdirAll(params.Filesystem, 0755)
+	err = os.MkdirAll(params.Filesystem, 0755)
 	if err != nil {
 		log.Fatalf("could not create filesystem root '%s': %s",
 			params.Filesystem, err)
 	}
 
-	kern = kernel.New(params)
+	kern, err = kernel.New(params)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	mode := "Garbler"
-	if *evaluator {
+	if config.Evaluator {
 		mode = "Evaluator"
 	}
 
 	fmt.Printf("Ephemelier %v Node\n", mode)
 
-	if *evaluator {
+	if len(config.HealthPort) > 0 {
+		err = health(config.HealthPort)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if config.Evaluator {
 		err = kern.Evaluator(devNull, devNull, stderr)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if config.Verbose {
+			printStateStats()
+		}
 		return
 	}
 
 	// Run all programs as Garbler.
 
 	var wg sync.WaitGroup
-	for _, arg := range flag.Args() {
-		proc, err := kern.Spawn(arg, nil, stdin.Copy(), stdout.Copy(),
+	for _, arg := range config.Programs {
+		proc, err := kern.Spawn(arg, nil, nil, stdin.Copy(), stdout.Copy(),
 			stderr.Copy())
 		if err != nil {
 			log.Print(err)
@@ -128,7 +135,7 @@ func main() {
 	}
 
 	// Start console.
-	if *fConsole {
+	if config.Console {
 		err = console(&wg)
 		if err != nil {
 			log.Print(err)
@@ -137,6 +144,12 @@ func main() {
 
 	// Wait for all programs to terminate.
 	wg.Wait()
+	if kern.Draining() {
+		log.Printf("Node drained")
+	}
+	if config.Verbose {
+		printStateStats()
+	}
 
 	if len(*memprofile) > 0 {
 		f, err := os.Create(*memprofile)
@@ -150,6 +163,22 @@ func main() {
 	}
 }
 
+// printStateStats prints the kernel's program state statistics.
+func printStateStats() {
+	stats := kern.StateStats()
+	var keys []kernel.StateKey
+	for k := range stats {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	for _, k := range keys {
+		log.Printf("%v: %v", k, stats[k])
+	}
+}
+
+// console runs the console until the kernel is drained.
 func console(wg *sync.WaitGroup) error {
 	// Create command listener.
 	listener, err := net.Listen("tcp", consolePort)
@@ -157,17 +186,40 @@ func console(wg *sync.WaitGroup) error {
 		return err
 	}
 	log.Printf("Console running at %s", consolePort)
+
+	go func() {
+		<-kern.Drained()
+		listener.Close()
+	}()
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if kern.Draining() {
+				return nil
+			}
 			return err
 		}
 		log.Printf("New console connection from %s", conn.RemoteAddr())
 		fd := kernel.NewSocketFD(conn)
-		proc, err := kern.Spawn("bin/sh", nil, fd, fd.Copy(), fd.Copy())
+		proc, err := kern.Spawn("bin/sh", nil, nil, fd, fd.Copy(),
+			fd.Copy())
+		if err == kernel.EPROCLIM {
+			log.Printf("Process limit reached, rejecting %s",
+				conn.RemoteAddr())
+			fmt.Fprintf(conn, "%v\n", err)
+			conn.Close()
+			time.Sleep(procLimitBackoff)
+			continue
+		}
 		if err != nil {
+			conn.Close()
+			if kern.Draining() {
+				return nil
+			}
 			return err
 		}
+		proc.SetUID(consoleUID)
 		wg.Go(func() {
 			err := proc.Run()
 			conn.Close()
@@ -9,20 +9,47 @@
 // readable. If the locations are different (or on different
 // machines), you must write an Ephemelier program to do the proper
 // MPC import.
+//
+// The filesystem key is stored as two XOR shares in the vaults of the
+// nodes. Create the shares with the vault tool:
+//
+//	vault -t ChaCha20 -o data/vault/fs split [keyfile]
+//
+// The key type selects the file encryption algorithm: ChaCha20 keys
+// use ChaCha20-Poly1305 and AES keys use AES-GCM.
+//
+// The imported files are owned by the -owner uid and have the -mode
+// permissions. The kernel denies the processes without the
+// permissions from opening the files.
+//
+// The -compress flag compresses the blocks of the imported files. The
+// compressed files can only be exported; the kernel programs can't
+// open them.
+//
+// The rekey command re-encrypts the files with the -newkey key:
+//
+//	fs-tool -vault data/vault/ -fs data/fs -key fs -newkey fs2 rekey [files...]
+//
+// Create the new key shares with the vault tool before rekeying. The
+// rekey decrypts the files block by block with the old key and writes
+// the re-encrypted blocks to a temporary file which replaces the
+// file. The plaintext is never written to disk.
 package main
 
 import (
+	"crypto/cipher"
 	"crypto/rand"
 	"encoding/binary"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/markkurossi/ephemelier/kernel"
-	"golang.org/x/crypto/chacha20poly1305"
 )
 
 var (
@@ -33,8 +60,13 @@ func main() {
 	vault := flag.String("vault", "", "vault prefix")
 	fs := flag.String("fs", "", "filesystem directory")
 	key := flag.String("key", "", "filesystem encryption key")
+	newkey := flag.String("newkey", "", "new filesystem encryption key")
 	prefix := flag.String("prefix", "", "source/destination file prefix")
 	bs := flag.Int("bs", 1024, "block size")
+	owner := flag.Uint("owner", 0, "imported file owner uid")
+	mode := flag.String("mode", "0644", "imported file permissions")
+	compress := flag.Bool("compress", false, "compress imported files")
+	out := flag.String("out", ".", "export destination directory")
 	flag.Parse()
 
 	if len(*vault) == 0 {
@@ -48,40 +80,69 @@ func main() {
 	}
 
 	if len(flag.Args()) == 0 {
-		log.Fatalf("usage: fs-tool import/export filename...")
+		log.Fatalf("usage: fs-tool import/export/stat/rekey filename...")
 	}
 
 	switch flag.Args()[0] {
 	case "import":
-		err := importFiles(*vault, *fs, *key, *prefix, *bs, flag.Args()[1:])
+		perm, err := strconv.ParseUint(*mode, 8, 16)
+		if err != nil || kernel.FileMode(perm)&^kernel.ModePerm != 0 {
+			log.Fatalf("invalid file mode: %s", *mode)
+		}
+		if *owner > 0xffffffff {
+			log.Fatalf("invalid file owner: %v", *owner)
+		}
+		opts := importOptions{
+			blockSize: *bs,
+			owner:     kernel.UID(*owner),
+			mode:      kernel.FileMode(perm),
+			compress:  *compress,
+		}
+		err = importFiles(*vault, *fs, *key, *prefix, opts, flag.Args()[1:])
 		if err != nil {
 			log.Fatalf("could not import files: %s", err)
 		}
 	case "export":
-		err := exportFiles(*vault, *fs, *key, flag.Args()[1:])
+		err := exportFiles(*vault, *fs, *key, *out, flag.Args()[1:])
 		if err != nil {
 			log.Fatalf("could not export files: %s", err)
 		}
 	case "stat":
 		err := statFiles(*vault, *fs, *key, flag.Args()[1:])
 		if err != nil {
-			log.Fatalf("could not export files: %s", err)
+			log.Fatalf("could not stat files: %s", err)
+		}
+	case "rekey":
+		if len(*newkey) == 0 {
+			log.Fatal("new filesystem encryption key unspecified")
+		}
+		err := rekeyFiles(*vault, *fs, *key, *newkey, flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("could not rekey files: %s", err)
 		}
 	default:
 		log.Fatalf("invalid command: %s", flag.Args()[0])
 	}
 }
 
-func importFiles(vault, fs, keyname, prefix string, blockSize int,
+// importOptions define the options for the imported files.
+type importOptions struct {
+	blockSize int
+	owner     kernel.UID
+	mode      kernel.FileMode
+	compress  bool
+}
+
+func importFiles(vault, fs, keyname, prefix string, opts importOptions,
 	files []string) error {
 
-	key, err := makeKey(vault, keyname)
+	key, keyType, err := makeKey(vault, keyname)
 	if err != nil {
 		return err
 	}
 
 	for _, file := range files {
-		err := encryptFile(fs, file, prefix, key, blockSize)
+		err := encryptFile(fs, file, prefix, key, keyType, opts)
 		if err != nil {
 			return err
 		}
@@ -90,12 +151,28 @@ func importFiles(vault, fs, keyname, prefix string, blockSize int,
 	return nil
 }
 
-func encryptFile(fs, file, prefix string, key []byte, blockSize int) error {
-	if blockSize <= chacha20poly1305.Overhead {
-		return fmt.Errorf("bock sizes must be bigger than cipher overhead %v",
-			chacha20poly1305.Overhead)
+func encryptFile(fs, file, prefix string, key []byte, keyType kernel.KeyType,
+	opts importOptions) error {
+
+	blockSize := opts.blockSize
+	hdr := &kernel.FileHeader{
+		Magic:     kernel.EncrFileMagicCRC,
+		BlockSize: uint16(blockSize),
+		Algorithm: keyType,
+		Owner:     opts.owner,
+		Mode:      opts.mode,
+	}
+	if opts.compress {
+		hdr.Flags |= kernel.FileFlagCompressed
+	}
+	aead, err := hdr.NewAEAD(key)
+	if err != nil {
+		return err
+	}
+	if blockSize <= aead.Overhead() || blockSize > 0xffff {
+		return fmt.Errorf("invalid block size %v: must be in range (%v,%v]",
+			blockSize, aead.Overhead(), 0xffff)
 	}
-	buf := make([]byte, blockSize)
 
 	// Make sure the directory exists.
 	if !strings.HasPrefix(file, prefix) {
@@ -104,7 +181,7 @@ func encryptFile(fs, file, prefix string, key []byte, blockSize int) error {
 	}
 
 	dst := filepath.Join(fs, file[len(prefix):])
-	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
 	if err != nil {
 		return err
 	}
@@ -116,21 +193,12 @@ func encryptFile(fs, file, prefix string, key []byte, blockSize int) error {
 		return err
 	}
 
-	hdr := &kernel.FileHeader{
-		Magic:     kernel.EncrFileMagic,
-		BlockSize: uint16(blockSize),
-		Algorithm: kernel.KeyTypeChaCha20,
-		PlainSize: fi.Size(),
-	}
+	hdr.PlainSize = fi.Size()
 	_, err = rand.Read(hdr.Nonce[:])
 	if err != nil {
 		return err
 	}
 
-	var aad [14]byte
-	bo.PutUint64(aad[4:], uint64(hdr.PlainSize))
-	bo.PutUint16(aad[:12], uint16(hdr.Flags))
-
 	out, err := os.Create(dst)
 	if err != nil {
 		return err
@@ -148,19 +216,32 @@ func encryptFile(fs, file, prefix string, key []byte, blockSize int) error {
 	}
 	defer in.Close()
 
-	// Encrypt blocks.
-	aead, err := chacha20poly1305.New(key)
-	if err != nil {
-		return err
-	}
+	return encryptBlocks(out, in, hdr, aead)
+}
+
+// encryptBlocks encrypts the plaintext from in and writes the
+// encrypted blocks to out. The blocks are compressed if the header
+// has the FileFlagCompressed flag.
+func encryptBlocks(out io.Writer, in io.Reader, hdr *kernel.FileHeader,
+	aead cipher.AEAD) error {
+
+	compress := hdr.Flags&kernel.FileFlagCompressed != 0
+	psize := int(hdr.BlockSize) - aead.Overhead()
+	buf := make([]byte, kernel.CompressedRecordHdrSize+int(hdr.BlockSize)+1)
+
+	var aad [14]byte
+	bo.PutUint64(aad[4:], uint64(hdr.PlainSize))
+	bo.PutUint16(aad[12:], uint16(hdr.Flags))
+
 	for i := 0; ; i++ {
-		n, err := in.Read(buf[:blockSize-chacha20poly1305.Overhead])
-		if n == 0 {
+		n, err := io.ReadFull(in, buf[:psize])
+		if err == io.EOF {
 			break
 		}
-		if err != nil {
+		if err != nil && err != io.ErrUnexpectedEOF {
 			return err
 		}
+		plain := buf[:n]
 
 		// Create nonce.
 
@@ -176,8 +257,17 @@ func encryptFile(fs, file, prefix string, key []byte, blockSize int) error {
 		// Update AAD.
 		bo.PutUint32(aad[0:], uint32(i))
 
-		cipher := aead.Seal(buf[:0], nonce[:], buf[:n], aad[:])
-		_, err = out.Write(cipher)
+		var data []byte
+		if compress {
+			// Store the block as a length-prefixed record.
+			rec := buf[:kernel.CompressedRecordHdrSize]
+			rec = aead.Seal(rec, nonce[:], kernel.CompressBlock(plain), aad[:])
+			bo.PutUint32(rec, uint32(len(rec)-kernel.CompressedRecordHdrSize))
+			data = rec
+		} else {
+			data = aead.Seal(buf[:0], nonce[:], plain, aad[:])
+		}
+		_, err = out.Write(data)
 		if err != nil {
 			return err
 		}
@@ -186,14 +276,14 @@ func encryptFile(fs, file, prefix string, key []byte, blockSize int) error {
 	return nil
 }
 
-func exportFiles(vault, fs, keyname string, files []string) error {
-	key, err := makeKey(vault, keyname)
+func exportFiles(vault, fs, keyname, out string, files []string) error {
+	key, keyType, err := makeKey(vault, keyname)
 	if err != nil {
 		return err
 	}
 
 	for _, file := range files {
-		err := decryptFile(fs, file, key)
+		err := decryptFile(fs, out, file, key, keyType)
 		if err != nil {
 			return err
 		}
@@ -202,7 +292,11 @@ func exportFiles(vault, fs, keyname string, files []string) error {
 	return nil
 }
 
-func decryptFile(fs, file string, key []byte) error {
+// decryptFile decrypts the filesystem file to the same relative path
+// under the destination directory out.
+func decryptFile(fs, out, file string, key []byte,
+	keyType kernel.KeyType) error {
+
 	// Open input file and read file header.
 	src := filepath.Join(fs, file)
 	in, err := os.Open(src)
@@ -211,73 +305,128 @@ func decryptFile(fs, file string, key []byte) error {
 	}
 	defer in.Close()
 
-	var hdrbuf [kernel.EncrFileHdrSize]byte
-	_, err = in.Read(hdrbuf[:])
+	hdr, err := kernel.ReadFileHeader(in)
 	if err != nil {
 		return err
 	}
-	hdr, err := kernel.NewFileHeader(hdrbuf[:])
+	if hdr.Algorithm != keyType {
+		return fmt.Errorf("%v: file algorithm %v does not match key type %v",
+			file, hdr.Algorithm, keyType)
+	}
+	r, err := kernel.NewReader(in, hdr, key)
 	if err != nil {
 		return err
 	}
-	// XXX check KeyType
-
-	buf := make([]byte, hdr.BlockSize)
 
-	var aad [14]byte
-	bo.PutUint64(aad[4:], uint64(hdr.PlainSize))
-	bo.PutUint16(aad[:12], uint16(hdr.Flags))
-
-	dst := filepath.Join("x", file)
+	dst := filepath.Join(out, file)
+	if dst == filepath.Clean(src) {
+		return fmt.Errorf("%v: export would overwrite the encrypted file", file)
+	}
 	err = os.MkdirAll(filepath.Dir(dst), 0755)
 	if err != nil {
 		return err
 	}
-	out, err := os.Create(dst)
+	f, err := os.Create(dst)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
 
-	// Decrypt blocks.
-	aead, err := chacha20poly1305.New(key)
+func rekeyFiles(vault, fs, keyname, newkeyname string, files []string) error {
+	key, keyType, err := makeKey(vault, keyname)
 	if err != nil {
 		return err
 	}
-	for i := 0; ; i++ {
-		n, err := in.Read(buf[:])
-		if n == 0 {
-			break
-		}
+	newKey, newKeyType, err := makeKey(vault, newkeyname)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err := rekeyFile(fs, file, key, keyType, newKey, newKeyType)
 		if err != nil {
 			return err
 		}
+	}
 
-		var nonce [12]byte
-		copy(nonce[:], hdr.Nonce[:])
-		var seq [8]byte
-		bo.PutUint64(seq[:], uint64(i))
-		for i := 0; i < len(seq); i++ {
-			nonce[4+i] ^= seq[i]
-		}
+	return nil
+}
 
-		bo.PutUint32(aad[0:], uint32(i))
+// rekeyFile re-encrypts the filesystem file with the new key. The
+// file gets a new header nonce and the new key's algorithm; the other
+// header fields are kept. The file is replaced only after all blocks
+// are successfully decrypted and re-encrypted.
+func rekeyFile(fs, file string, key []byte, keyType kernel.KeyType,
+	newKey []byte, newKeyType kernel.KeyType) error {
 
-		plain, err := aead.Open(buf[:0], nonce[:], buf[:n], aad[:])
-		if err != nil {
-			return err
-		}
-		_, err = out.Write(plain)
-		if err != nil {
-			return err
-		}
+	src := filepath.Join(fs, file)
+	in, err := os.Open(src)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	return nil
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := kernel.ReadFileHeader(in)
+	if err != nil {
+		return fmt.Errorf("%v: %w", file, err)
+	}
+	if hdr.Algorithm != keyType {
+		return fmt.Errorf("%v: file algorithm %v does not match key type %v",
+			file, hdr.Algorithm, keyType)
+	}
+	r, err := kernel.NewReader(in, hdr, key)
+	if err != nil {
+		return err
+	}
+
+	nhdr := *hdr
+	nhdr.Algorithm = newKeyType
+	_, err = rand.Read(nhdr.Nonce[:])
+	if err != nil {
+		return err
+	}
+	aead, err := nhdr.NewAEAD(newKey)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(src), "."+filepath.Base(src)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	err = out.Chmod(fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(nhdr.Bytes())
+	if err != nil {
+		return err
+	}
+	err = encryptBlocks(out, r, &nhdr, aead)
+	if err != nil {
+		return fmt.Errorf("%v: %w", file, err)
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, src)
 }
 
 func statFiles(vault, fs, keyname string, files []string) error {
-	key, err := makeKey(vault, keyname)
+	key, _, err := makeKey(vault, keyname)
 	if err != nil {
 		return err
 	}
@@ -301,51 +450,62 @@ func statFile(fs, file string, key []byte) error {
 	}
 	defer in.Close()
 
-	var hdrbuf [kernel.EncrFileHdrSize]byte
-	_, err = in.Read(hdrbuf[:])
+	hdr, err := kernel.ReadFileHeader(in)
 	if err != nil {
-		return err
+		return fmt.Errorf("%v: %w", file, err)
 	}
-	hdr, err := kernel.NewFileHeader(hdrbuf[:])
-	if err != nil {
-		return err
+	checksum := "none"
+	if hdr.Version() >= 3 {
+		checksum = "valid"
 	}
 
 	fmt.Printf("file %v:\n", file)
 	fmt.Printf(" - magic    : %08x\n", hdr.Magic)
+	fmt.Printf(" - version  : %v\n", hdr.Version())
+	fmt.Printf(" - checksum : %v\n", checksum)
 	fmt.Printf(" - blockSize: %v\n", hdr.BlockSize)
 	fmt.Printf(" - algorithm: %v\n", hdr.Algorithm)
 	fmt.Printf(" - flags    : %04x\n", hdr.Flags)
 	fmt.Printf(" - plainSize: %v\n", hdr.PlainSize)
 	fmt.Printf(" - nonce    : %x\n", hdr.Nonce)
+	fmt.Printf(" - owner    : %v\n", hdr.Owner)
+	fmt.Printf(" - mode     : %v\n", hdr.Perm())
 
 	return nil
 }
 
-func makeKey(vault, keyname string) ([]byte, error) {
+// makeKey combines the key shares from the vaults. The function
+// returns the key and its type.
+func makeKey(vault, keyname string) ([]byte, kernel.KeyType, error) {
 	path := filepath.Join(fmt.Sprintf("%s0", vault), keyname)
 	gkey, err := kernel.OpenKey(path)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	path = filepath.Join(fmt.Sprintf("%s1", vault), keyname)
 	ekey, err := kernel.OpenKey(path)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	gtype := gkey.Impl.(*kernel.Key).Type
+	etype := ekey.Impl.(*kernel.Key).Type
+	if gtype != etype {
+		return nil, 0, fmt.Errorf("key share types differ: %v and %v",
+			gtype, etype)
 	}
 	gdata := make([]byte, 512)
 	gn := gkey.Read(gdata)
 	if gn <= 0 {
-		return nil, fmt.Errorf("failed to read gkey: %v", kernel.Errno(-gn))
+		return nil, 0, fmt.Errorf("failed to read gkey: %v", kernel.Errno(-gn))
 	}
 	edata := make([]byte, 512)
 	en := ekey.Read(edata)
 	if en != gn {
-		return nil, fmt.Errorf("invalid ekey: read %v, expected %v", en, gn)
+		return nil, 0, fmt.Errorf("invalid ekey: read %v, expected %v", en, gn)
 	}
 
 	for i := 0; i < gn; i++ {
 		gdata[i] ^= edata[i]
 	}
-	return gdata[:gn], nil
+	return gdata[:gn], gtype, nil
 }
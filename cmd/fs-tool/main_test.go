@@ -0,0 +1,480 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/kernel"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	tests := []struct {
+		keyType kernel.KeyType
+		keySize int
+	}{
+		{kernel.KeyTypeChaCha20, 32},
+		{kernel.KeyTypeAES, 16},
+		{kernel.KeyTypeAES, 32},
+	}
+	data := bytes.Repeat([]byte("Hello, world!\n"), 100)
+
+	for idx, test := range tests {
+		dir := t.TempDir()
+		t.Chdir(dir)
+
+		err := os.MkdirAll(filepath.Join("in", "www"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join("in", "www", "index.html")
+		err = os.WriteFile(file, data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := bytes.Repeat([]byte{byte(idx + 1)}, test.keySize)
+
+		err = encryptFile("fs", file, "in", key, test.keyType,
+			importOptions{blockSize: 256, mode: 0644})
+		if err != nil {
+			t.Fatalf("test%d: encrypt: %v", idx, err)
+		}
+		name := filepath.Join("www", "index.html")
+		err = decryptFile("fs", "out", name, key, test.keyType)
+		if err != nil {
+			t.Fatalf("test%d: decrypt: %v", idx, err)
+		}
+		plain, err := os.ReadFile(filepath.Join("out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plain, data) {
+			t.Errorf("test%d: decrypted data does not match", idx)
+		}
+
+		// The file algorithm must match the key type.
+		other := kernel.KeyTypeAES
+		if test.keyType == kernel.KeyTypeAES {
+			other = kernel.KeyTypeChaCha20
+		}
+		err = decryptFile("fs", "out", name, key, other)
+		if err == nil {
+			t.Errorf("test%d: decrypt with %v key succeeded", idx, other)
+		}
+	}
+}
+
+// writeKeyShares writes the key as random XOR shares to the vaults
+// <vault>0 and <vault>1.
+func writeKeyShares(t *testing.T, vault, name string, keyType kernel.KeyType,
+	key []byte) {
+
+	mask := make([]byte, len(key))
+	_, err := rand.Read(mask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		share := make([]byte, len(key))
+		copy(share, mask)
+		if i == 0 {
+			for j := range share {
+				share[j] ^= key[j]
+			}
+		}
+		k := &kernel.Key{
+			Type: keyType,
+			Data: share,
+		}
+		data, err := k.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := fmt.Sprintf("%s%d", vault, i)
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	vault := filepath.Join(dir, "vault")
+	fs := filepath.Join(dir, "fs")
+	out := filepath.Join(dir, "export", "files")
+
+	writeKeyShares(t, vault, "fs", kernel.KeyTypeChaCha20,
+		bytes.Repeat([]byte{0x42}, 32))
+
+	src := filepath.Join(dir, "src")
+	files := []string{
+		"index.html",
+		filepath.Join("a", "b", "data.bin"),
+	}
+	contents := [][]byte{
+		[]byte("<html></html>\n"),
+		bytes.Repeat([]byte{0, 1, 2, 0xff}, 1000),
+	}
+	var inputs []string
+	for idx, file := range files {
+		path := filepath.Join(src, file)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, contents[idx], 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, path)
+	}
+
+	err := importFiles(vault, fs, "fs", src,
+		importOptions{blockSize: 128, mode: 0644}, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exportFiles(vault, fs, "fs", out, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, file := range files {
+		data, err := os.ReadFile(filepath.Join(out, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, contents[idx]) {
+			t.Errorf("%v: exported data does not match", file)
+		}
+	}
+
+	// Exporting over the filesystem file fails.
+	err = exportFiles(vault, fs, "fs", fs, files[:1])
+	if err == nil {
+		t.Errorf("export over the encrypted file succeeded")
+	}
+}
+
+func TestEncryptBlockSize(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	err := os.WriteFile("data", []byte("data"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := make([]byte, 32)
+	for _, blockSize := range []int{0, kernel.TagSize, 0x10000} {
+		err = encryptFile("fs", "data", "", key, kernel.KeyTypeAES,
+			importOptions{blockSize: blockSize})
+		if err == nil {
+			t.Errorf("encrypt with block size %v succeeded", blockSize)
+		}
+	}
+}
+
+func TestDecryptInvalidHeader(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	err := os.Mkdir("fs", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := &kernel.FileHeader{
+		Magic:     kernel.EncrFileMagic,
+		BlockSize: 8,
+		Algorithm: kernel.KeyTypeChaCha20,
+		PlainSize: 4,
+	}
+	data := append(hdr.Bytes(), make([]byte, 8)...)
+	err = os.WriteFile(filepath.Join("fs", "data"), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = decryptFile("fs", "out", "data", make([]byte, 32),
+		kernel.KeyTypeChaCha20)
+	if !errors.Is(err, kernel.EINVAL) {
+		t.Fatalf("got %v, expected %v", err, kernel.EINVAL)
+	}
+	if !strings.Contains(err.Error(), "block size") {
+		t.Errorf("error %q does not describe the block size", err)
+	}
+}
+
+func TestImportPermissions(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	data := []byte("secret key material\n")
+	err := os.WriteFile("key.pem", data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{0x42}, 32)
+	err = encryptFile("fs", "key.pem", "", key, kernel.KeyTypeChaCha20,
+		importOptions{blockSize: 256, owner: 1000, mode: 0600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join("fs", "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	hdr, err := kernel.ReadFileHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Owner != 1000 || hdr.Perm() != 0600 {
+		t.Errorf("got owner %v mode %v, expected 1000 0600", hdr.Owner,
+			hdr.Perm())
+	}
+	if err := hdr.Access(1000, kernel.ReadOnly); err != nil {
+		t.Errorf("owner access: %v", err)
+	}
+	if err := hdr.Access(2000, kernel.ReadOnly); err != kernel.EACCES {
+		t.Errorf("unauthorized access: got %v, expected %v", err,
+			kernel.EACCES)
+	}
+
+	// The permissions do not affect the decryption with the key.
+	err = decryptFile("fs", "out", "key.pem", key, kernel.KeyTypeChaCha20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := os.ReadFile(filepath.Join("out", "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, data) {
+		t.Errorf("decrypted data does not match")
+	}
+}
+
+func TestStatChecksum(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	err := os.WriteFile("data", []byte("data"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := make([]byte, 32)
+	err = encryptFile("fs", "data", "", key, kernel.KeyTypeChaCha20,
+		importOptions{blockSize: 256, mode: 0644})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = statFile("fs", "data", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the block size.
+	path := filepath.Join("fs", "data")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[4] ^= 0x01
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = statFile("fs", "data", key)
+	if !errors.Is(err, kernel.EBADMSG) {
+		t.Errorf("got %v, expected %v", err, kernel.EBADMSG)
+	}
+}
+
+func TestImportCompressed(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// Compressible data with an incompressible tail.
+	data := bytes.Repeat([]byte("ephemelier compressed block\n"), 200)
+	tail := make([]byte, 500)
+	_, err := rand.Read(tail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, tail...)
+	err = os.WriteFile("data", data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{0x42}, 32)
+	err = encryptFile("fs", "data", "", key, kernel.KeyTypeChaCha20,
+		importOptions{blockSize: 256, mode: 0644, compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join("fs", "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() >= int64(len(data)) {
+		t.Errorf("compressed file size %v, plaintext %v", fi.Size(), len(data))
+	}
+
+	err = decryptFile("fs", "out", "data", key, kernel.KeyTypeChaCha20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := os.ReadFile(filepath.Join("out", "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, data) {
+		t.Errorf("decrypted data does not match")
+	}
+
+	// Random access reads.
+	f, err := os.Open(filepath.Join("fs", "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	hdr, err := kernel.ReadFileHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Flags&kernel.FileFlagCompressed == 0 {
+		t.Errorf("compressed flag not set: %04x", hdr.Flags)
+	}
+	r, err := kernel.NewReader(f, hdr, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ofs := range []int64{int64(len(data)) - 10, 0, 1000, 5700} {
+		buf := make([]byte, 10)
+		_, err := r.ReadAt(buf, ofs)
+		if err != nil {
+			t.Fatalf("ReadAt(%v): %v", ofs, err)
+		}
+		if !bytes.Equal(buf, data[ofs:ofs+10]) {
+			t.Errorf("ReadAt(%v): data mismatch", ofs)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	writeKeyShares(t, "vault", "old", kernel.KeyTypeChaCha20,
+		bytes.Repeat([]byte{0x42}, 32))
+	writeKeyShares(t, "vault", "new", kernel.KeyTypeAES,
+		bytes.Repeat([]byte{0x17}, 32))
+
+	data := bytes.Repeat([]byte("rekeyed data\n"), 100)
+	err := os.WriteFile("plain", data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile("compressed", data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = importFiles("vault", "fs", "old", "",
+		importOptions{blockSize: 128, owner: 1000, mode: 0600},
+		[]string{"plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = importFiles("vault", "fs", "old", "",
+		importOptions{blockSize: 128, mode: 0644, compress: true},
+		[]string{"compressed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"plain", "compressed"}
+
+	readHeader := func(file string) *kernel.FileHeader {
+		f, err := os.Open(filepath.Join("fs", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		hdr, err := kernel.ReadFileHeader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hdr
+	}
+	var hdrs []*kernel.FileHeader
+	for _, file := range files {
+		hdrs = append(hdrs, readHeader(file))
+	}
+
+	err = rekeyFiles("vault", "fs", "old", "new", files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, file := range files {
+		hdr := readHeader(file)
+		if hdr.Nonce == hdrs[idx].Nonce {
+			t.Errorf("%v: nonce not changed", file)
+		}
+		if hdr.Algorithm != kernel.KeyTypeAES {
+			t.Errorf("%v: algorithm %v, expected %v", file, hdr.Algorithm,
+				kernel.KeyTypeAES)
+		}
+		if hdr.Owner != hdrs[idx].Owner || hdr.Perm() != hdrs[idx].Perm() ||
+			hdr.Flags != hdrs[idx].Flags {
+			t.Errorf("%v: header changed: %v, expected %v", file, hdr,
+				hdrs[idx])
+		}
+	}
+
+	err = exportFiles("vault", "fs", "new", "out", files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		plain, err := os.ReadFile(filepath.Join("out", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plain, data) {
+			t.Errorf("%v: decrypted data does not match", file)
+		}
+	}
+
+	// The old key no longer decrypts the files.
+	err = exportFiles("vault", "fs", "old", "out", files[:1])
+	if err == nil {
+		t.Errorf("export with the old key succeeded")
+	}
+	key, _, err := makeKey("vault", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		err = decryptFile("fs", "old", file, key, kernel.KeyTypeAES)
+		if err == nil {
+			t.Errorf("%v: decrypt with the old key succeeded", file)
+		}
+	}
+
+	// Only the rekeyed files remain in the filesystem directory.
+	entries, err := os.ReadDir("fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(files) {
+		t.Errorf("got %v files, expected %v", len(entries), len(files))
+	}
+}
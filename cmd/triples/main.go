@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"log"
+	"net"
+	"os"
+
+	"github.com/markkurossi/ephemelier/crypto/spdz"
+	"github.com/markkurossi/ephemelier/kernel"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// The triples command pre-generates SPDZ Beaver triple pools. Each
+// node runs its own peer and the peers generate the triples over the
+// network so each node sees only its own shares of the triples and
+// of the MAC key. The evaluator listens for the garbler's connection:
+//
+//	triples -e -addr :9100 -o data/triples1/p256
+//	triples -addr evaluator:9100 -o data/triples0/p256
+//
+// The node's pool is saved to the output filename, its MAC key share
+// to the output filename with the .key suffix, and the pool's
+// consumption state to the output filename with the .used suffix. The
+// triple files hold 32-byte fields so only curves up to 256 bits are
+// supported.
+func main() {
+	evaluator := flag.Bool("e", false, "evaluator / garbler mode")
+	addr := flag.String("addr", ":9100", "evaluator address")
+	curve := flag.String("curve", "P-256", "curve name")
+	adds := flag.Int("n", 1, "number of point additions")
+	out := flag.String("o", "", "output filename")
+	flag.Parse()
+
+	log.SetFlags(0)
+
+	if len(*out) == 0 {
+		log.Fatalf("no output filename")
+	}
+	params, ok := spdz.CurveByName(*curve)
+	if !ok {
+		log.Fatalf("unknown curve %v", *curve)
+	}
+	if params.P.BitLen() > 256 {
+		log.Fatalf("unsupported curve %v: triple files hold 256-bit fields",
+			*curve)
+	}
+	if *adds <= 0 {
+		log.Fatalf("invalid number of point additions: %v", *adds)
+	}
+	n := *adds * spdz.AddTriples
+
+	var conn net.Conn
+	var role spdz.Role
+	if *evaluator {
+		role = spdz.Receiver
+		listener, err := net.Listen("tcp", *addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Listening for garbler at %s", listener.Addr())
+		conn, err = listener.Accept()
+		listener.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		role = spdz.Sender
+		var err error
+		conn, err = net.Dial("tcp", *addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	defer conn.Close()
+
+	err := generate(params, p2p.NewConn(conn), role, n, *out)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate generates 2n triples, verifies them with spdz.Sacrifice,
+// and saves the verified n triples, the MAC key share, and the
+// pool's consumption state.
+func generate(params *spdz.Params, conn *p2p.Conn, role spdz.Role, n int,
+	filename string) error {
+
+	session, err := spdz.NewSession(conn, role, spdz.OTCO.New(rand.Reader))
+	if err != nil {
+		return err
+	}
+	params = params.WithMACKey(session.MACKey())
+	triples, err := params.GenerateBeaverTriplesSession(session, 2*n)
+	if err != nil {
+		return err
+	}
+	triples, err = params.Sacrifice(conn, role, triples)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = spdz.SaveTriples(f, triples)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	key := make([]byte, 32)
+	session.MACKey().FillBytes(key)
+	err = os.WriteFile(filename+".key", key, 0600)
+	if err != nil {
+		return err
+	}
+	return kernel.WriteTripleState(filename)
+}
@@ -20,7 +20,7 @@ import (
 func main() {
 	flag.Parse()
 	if len(flag.Args()) != 1 {
-		log.Fatalf("usage: tss keygen/sign\n")
+		log.Fatalf("usage: tss keygen/sign/reshare\n")
 	}
 
 	pG, pE := p2p.Pipe()
@@ -93,6 +93,16 @@ func main() {
 			verifySignature(key.ECDSAPub.ToECDSAPubKey(), hash, signature)
 		}()
 
+	case "reshare":
+		go func() {
+			defer wg.Done()
+			reshare(e)
+		}()
+		go func() {
+			defer wg.Done()
+			reshare(g)
+		}()
+
 	default:
 		log.Fatalf("invalid operation: %v\n", flag.Args()[0])
 	}
@@ -104,6 +114,21 @@ func shareName(peer *tss.Peer) string {
 	return fmt.Sprintf("peer-%v.share", peer.PartyID.Id)
 }
 
+func reshare(peer *tss.Peer) {
+	key, err := tss.ReadSaveData(shareName(peer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	save, err := peer.Reshare(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = tss.WriteSaveData(shareName(peer), save)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func verifySignature(key *ecdsa.PublicKey, hash, signature []byte) {
 	fmt.Printf("verifySignature:\n")
 	keyBytes, err := key.Bytes()
@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/markkurossi/ephemelier/crypto/tss"
@@ -46,7 +47,7 @@ func main() {
 	}
 
 	if len(flag.Args()) == 0 {
-		log.Fatalf("usage: vault import/create arg...")
+		log.Fatalf("usage: vault import/create/split arg...")
 	}
 
 	switch flag.Args()[0] {
@@ -62,6 +63,19 @@ func main() {
 			log.Fatal(err)
 		}
 
+	case "split":
+		if len(flag.Args()) > 2 {
+			log.Fatalf("usage: vault split [keyfile]")
+		}
+		var keyfile string
+		if len(flag.Args()) == 2 {
+			keyfile = flag.Args()[1]
+		}
+		err := split(*out, keyType, keyfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 	default:
 		log.Fatalf("invalid command: %v\n", flag.Args()[0])
 	}
@@ -123,6 +137,77 @@ func create(filename string, keyType kernel.KeyType) error {
 	return saveKey(key, filename)
 }
 
+// split splits the symmetric key into two XOR shares and saves the
+// shares into the vaults of the garbler and evaluator nodes. The key
+// is read from keyfile as raw bytes. If keyfile is empty, split
+// creates a new random key. The filename specifies the vault prefix
+// and key name: the filename data/vault/fs saves the shares as
+// data/vault0/fs and data/vault1/fs.
+func split(filename string, keyType kernel.KeyType, keyfile string) error {
+	switch keyType {
+	case kernel.KeyTypeAES, kernel.KeyTypeChaCha20:
+	default:
+		return fmt.Errorf("key type %v not supported", keyType)
+	}
+	bits, err := keyType.BitSize()
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if len(keyfile) > 0 {
+		data, err = os.ReadFile(keyfile)
+		if err != nil {
+			return err
+		}
+		if len(data) != bits/8 {
+			return fmt.Errorf("invalid %v key size %v, expected %v",
+				keyType, len(data), bits/8)
+		}
+	} else {
+		data = make([]byte, bits/8)
+		_, err = rand.Read(data)
+		if err != nil {
+			return err
+		}
+	}
+	shares, err := splitKey(data)
+	if err != nil {
+		return err
+	}
+	for idx, share := range shares {
+		err = saveKey(&kernel.Key{
+			Type: keyType,
+			Data: share,
+		}, sharePath(filename, idx))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitKey splits the key into two shares whose XOR is the key.
+func splitKey(key []byte) ([2][]byte, error) {
+	var shares [2][]byte
+
+	shares[0] = make([]byte, len(key))
+	_, err := rand.Read(shares[0])
+	if err != nil {
+		return shares, err
+	}
+	shares[1] = make([]byte, len(key))
+	for i := range key {
+		shares[1][i] = shares[0][i] ^ key[i]
+	}
+	return shares, nil
+}
+
+// sharePath returns the key share path for the node idx.
+func sharePath(filename string, idx int) string {
+	dir, name := filepath.Split(filepath.Clean(filename))
+	return filepath.Join(fmt.Sprintf("%s%d", filepath.Clean(dir), idx), name)
+}
+
 func saveKey(key *kernel.Key, filename string) error {
 	data, err := key.Bytes()
 	if err != nil {
@@ -0,0 +1,86 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/kernel"
+)
+
+func TestSharePath(t *testing.T) {
+	tests := []struct {
+		filename string
+		idx      int
+		expected string
+	}{
+		{"data/vault/fs", 0, "data/vault0/fs"},
+		{"data/vault/fs", 1, "data/vault1/fs"},
+		{"vault/fs/", 1, "vault1/fs"},
+	}
+	for _, test := range tests {
+		got := sharePath(test.filename, test.idx)
+		if got != filepath.FromSlash(test.expected) {
+			t.Errorf("sharePath(%q, %v)=%q, expected %q",
+				test.filename, test.idx, got, test.expected)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "vault", "fs")
+	for i := 0; i < 2; i++ {
+		err := os.MkdirAll(filepath.Join(dir, fmt.Sprintf("vault%d", i)),
+			0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := bytes.Repeat([]byte{0x42}, 32)
+	keyfile := filepath.Join(dir, "key")
+	err := os.WriteFile(keyfile, key, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = split(filename, kernel.KeyTypeChaCha20, keyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var shares [2][]byte
+	for i := range shares {
+		fd, err := kernel.OpenKey(sharePath(filename, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 64)
+		n := fd.Read(buf)
+		if n != len(key) {
+			t.Fatalf("share %v: read %v, expected %v", i, n, len(key))
+		}
+		shares[i] = buf[:n]
+	}
+	if bytes.Equal(shares[0], key) || bytes.Equal(shares[1], key) {
+		t.Errorf("share equals key")
+	}
+	for i := range key {
+		if shares[0][i]^shares[1][i] != key[i] {
+			t.Fatalf("shares do not XOR to key")
+		}
+	}
+
+	// Invalid key size.
+	err = split(filename, kernel.KeyTypeAES, keyfile)
+	if err == nil {
+		t.Errorf("split succeeded with invalid key size")
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -9,6 +9,8 @@ package hkdf
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"hash"
+	"io"
 )
 
 var (
@@ -52,3 +54,37 @@ func ExpandTLS13(pseudorandomKey, info, out []byte) {
 		out = out[n:]
 	}
 }
+
+// ExpandLabel implements the TLS 1.3 HKDF-Expand-Label function:
+// RFC-8446: 7.1. Key Schedule, page 91. The function panics if the
+// label or context is too long for the HkdfLabel encoding or if the
+// length is too big for the hash function.
+func ExpandLabel(secret []byte, label string, context []byte, length int,
+	hash func() hash.Hash) []byte {
+
+	// struct {
+	//     uint16 length = Length;
+	//     opaque label<7..255> = "tls13 " + Label;
+	//     opaque context<0..255> = Context;
+	// } HkdfLabel;
+
+	const tls13 = "tls13 "
+
+	if len(tls13)+len(label) > 255 || len(context) > 255 || length > 0xffff {
+		panic("hkdf: invalid HkdfLabel")
+	}
+	hkdfLabel := make([]byte, 0, 2+1+len(tls13)+len(label)+1+len(context))
+	hkdfLabel = append(hkdfLabel, byte(length>>8), byte(length))
+	hkdfLabel = append(hkdfLabel, byte(len(tls13)+len(label)))
+	hkdfLabel = append(hkdfLabel, tls13...)
+	hkdfLabel = append(hkdfLabel, label...)
+	hkdfLabel = append(hkdfLabel, byte(len(context)))
+	hkdfLabel = append(hkdfLabel, context...)
+
+	out := make([]byte, length)
+	_, err := io.ReadFull(Expand(hash, secret, hkdfLabel), out)
+	if err != nil {
+		panic("hkdf: " + err.Error())
+	}
+	return out
+}
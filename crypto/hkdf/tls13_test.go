@@ -7,6 +7,7 @@ package hkdf
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"hash"
 	"testing"
@@ -179,3 +180,65 @@ func TestHKDFTLS13(t *testing.T) {
 		}
 	}
 }
+
+func unhex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// RFC 8448: 3. Simple 1-RTT Handshake.
+var expandLabelTests = []struct {
+	secret  string
+	label   string
+	context string
+	out     string
+}{
+	{
+		// Early secret, derived.
+		secret:  "33ad0a1c607ec03b09e6cd9893680ce210adf300aa1f2660e1b22e10f170f92a",
+		label:   "derived",
+		context: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		out:     "6f2615a108c702c5678f54fc9dbab69716c076189c48250cebeac3576c3611ba",
+	},
+	{
+		// Handshake secret, client handshake traffic secret.
+		secret:  "1dc826e93606aa6fdc0aadc12f741b01046aa6b99f691ed221a9f0ca043fbeac",
+		label:   "c hs traffic",
+		context: "860c06edc07858ee8e78f0e7428c58edd6b43f2ca3e6e95f02ed063cf0e1cad8",
+		out:     "b3eddb126e067f35a780b3abf45e2d8f3b1a950738f52e9600746a0e27a55a21",
+	},
+	{
+		// Handshake secret, server handshake traffic secret.
+		secret:  "1dc826e93606aa6fdc0aadc12f741b01046aa6b99f691ed221a9f0ca043fbeac",
+		label:   "s hs traffic",
+		context: "860c06edc07858ee8e78f0e7428c58edd6b43f2ca3e6e95f02ed063cf0e1cad8",
+		out:     "b67b7d690cc16c4e75e54213cb2d37b4e9c912bcded9105d42befd59d391ad38",
+	},
+	{
+		// Server handshake write key.
+		secret: "b67b7d690cc16c4e75e54213cb2d37b4e9c912bcded9105d42befd59d391ad38",
+		label:  "key",
+		out:    "3fce516009c21727d0f2e4e86ee403bc",
+	},
+	{
+		// Server handshake write IV.
+		secret: "b67b7d690cc16c4e75e54213cb2d37b4e9c912bcded9105d42befd59d391ad38",
+		label:  "iv",
+		out:    "5d313eb2671276ee13000b30",
+	},
+}
+
+func TestExpandLabel(t *testing.T) {
+	for idx, test := range expandLabelTests {
+		expected := unhex(t, test.out)
+		out := ExpandLabel(unhex(t, test.secret), test.label,
+			unhex(t, test.context), len(expected), sha256.New)
+		if !bytes.Equal(out, expected) {
+			t.Errorf("test %d (%s): got %x, expected %x",
+				idx, test.label, out, expected)
+		}
+	}
+}
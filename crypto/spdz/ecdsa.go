@@ -0,0 +1,194 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// ECDSASign creates a P-256 ECDSA signature for the hash with the
+// secret-shared private key. See Params.ECDSASign for details.
+func ECDSASign(conn *p2p.Conn, role Role, keyShare *big.Int, hash []byte) (
+	r, s *big.Int, err error) {
+	return P256.ECDSASign(conn, role, keyShare, hash)
+}
+
+// ECDSASign creates an ECDSA signature for the hash with the private
+// key d that is additively shared between the peers. The function
+// uses the Chou-Orlandi base OT; see ECDSASignSession for details and
+// for selecting the base OT.
+func (params *Params) ECDSASign(conn *p2p.Conn, role Role, keyShare *big.Int,
+	hash []byte) (r, s *big.Int, err error) {
+
+	session, err := NewSession(conn, role, ot.NewCO(rand.Reader))
+	if err != nil {
+		return nil, nil, err
+	}
+	return params.ECDSASignSession(session, keyShare, hash)
+}
+
+// ECDSASignSession creates an ECDSA signature for the hash with the
+// private key d that is additively shared between the peers, d =
+// d0+d1 mod N. The keyShare is the peer's share of d. The hash is a
+// public input, such as the TLS CertificateVerify transcript hash,
+// and it is known to both peers. Both peers return the same
+// signature (r, s). The Beaver triples are generated with the
+// session's OT extension.
+//
+// The peers create the nonce k = k0+k1 by sampling their nonce
+// shares and exchanging the public nonce points Ri = ki*G. The peers
+// commit to their nonce points before opening them so neither peer
+// can choose its point based on the peer's point to bias R. The
+// signature s = k^-1*(z+r*d) is computed with a random secret-shared
+// mask m:
+//
+//	u = k*m
+//	w = m*(z+r*d)
+//	s = w/u
+//
+// The opened values u and w are uniformly random and reveal nothing
+// about k and d. One signing attempt consumes two Beaver triples.
+func (params *Params) ECDSASignSession(session *Session, keyShare *big.Int,
+	hash []byte) (r, s *big.Int, err error) {
+
+	if params.Curve == nil {
+		return nil, nil, fmt.Errorf("ECDSA not supported for curve %s",
+			params.Name)
+	}
+	scalar := params.scalarField()
+	z := params.hashToInt(hash)
+	d := scalar.NewShare(keyShare)
+
+	err = session.run(func() error {
+		for {
+			triples, err := scalar.generateBeaverTriples(session, 2)
+			if err != nil {
+				return err
+			}
+			r, s, err = params.ecdsaSign(session.conn, session.role, d, z,
+				triples)
+			if err != nil {
+				return err
+			}
+			// Both peers see the same r and s so they retry in sync.
+			if r.Sign() != 0 && s.Sign() != 0 {
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, s, nil
+}
+
+// ecdsaSign runs one signing attempt with the key share d and the
+// public hash value z. The function returns zero r or s if the
+// attempt must be retried with a new nonce.
+func (params *Params) ecdsaSign(conn *p2p.Conn, role Role, d *Share,
+	z *big.Int, triples []*Triple) (*big.Int, *big.Int, error) {
+
+	scalar := params.scalarField()
+
+	k, err := scalar.randomFieldElement(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := scalar.randomFieldElement(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Exchange the nonce points and compute R = R0+R1.
+	kx, ky := params.Curve.ScalarBaseMult(scalar.fieldBytes(k))
+	px, py, err := params.exchangePoint(conn, role, kx, ky)
+	if err != nil {
+		return nil, nil, err
+	}
+	rx, _ := params.Curve.Add(kx, ky, px, py)
+	r := scalar.modReduce(rx)
+	if r.Sign() == 0 {
+		return r, r, nil
+	}
+
+	kShare := scalar.NewShare(k)
+	mShare := scalar.NewShare(m)
+
+	// [z+r*d]; only the sender adds the public z.
+	v := new(big.Int).Mul(r, d.V)
+	if role == Sender {
+		v.Add(v, z)
+	}
+	zrd := scalar.NewShare(v)
+
+	tripleIndex := 0
+	u, err := scalar.safeMul(conn, role, kShare, mShare, triples, &tripleIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := scalar.safeMul(conn, role, mShare, zrd, triples, &tripleIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	uv, wv, err := scalar.openTwoShares(conn, role, u, w)
+	if err != nil {
+		return nil, nil, err
+	}
+	if uv.Sign() == 0 {
+		return r, uv, nil
+	}
+	s := new(big.Int).ModInverse(uv, params.N)
+	s.Mul(s, wv)
+	s.Mod(s, params.N)
+
+	return r, s, nil
+}
+
+// exchangePoint exchanges the point (x, y) with the peer with
+// commitments from both peers and returns the peer's point.
+func (params *Params) exchangePoint(conn *p2p.Conn, role Role, x, y *big.Int) (
+	*big.Int, *big.Int, error) {
+
+	size := params.size()
+	data := append(params.fieldBytes(x), params.fieldBytes(y)...)
+	peer, err := exchangeMutualCommitted(conn, role, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(peer) != 2*size {
+		return nil, nil, fmt.Errorf("invalid peer point: %d bytes", len(peer))
+	}
+	px := readField(peer[:size])
+	py := readField(peer[size:])
+	if !params.Curve.IsOnCurve(px, py) {
+		return nil, nil, errors.New("peer point is not on curve")
+	}
+	return px, py, nil
+}
+
+// hashToInt converts the hash value to an integer as specified in
+// FIPS 186-4: the hash is truncated to the bit length of the curve
+// order N.
+func (params *Params) hashToInt(hash []byte) *big.Int {
+	orderBits := params.N.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+	ret := new(big.Int).SetBytes(hash)
+	excess := len(hash)*8 - orderBits
+	if excess > 0 {
+		ret.Rsh(ret, uint(excess))
+	}
+	return ret
+}
@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+func testECDSASign(t *testing.T, params *Params) {
+	d0, err := rand.Int(rand.Reader, params.N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d1, err := rand.Int(rand.Reader, params.N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := new(big.Int).Add(d0, d1)
+	d.Mod(d, params.N)
+
+	pub := &ecdsa.PublicKey{
+		Curve: params.Curve,
+	}
+	pub.X, pub.Y = params.Curve.ScalarBaseMult(d.Bytes())
+
+	hash := sha256.Sum256([]byte("CertificateVerify transcript"))
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var eErr error
+	var er, es *big.Int
+
+	wg.Go(func() {
+		er, es, eErr = params.ECDSASign(eConn, Receiver, d1, hash[:])
+	})
+	gr, gs, err := params.ECDSASign(gConn, Sender, d0, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+
+	if gr.Cmp(er) != 0 || gs.Cmp(es) != 0 {
+		t.Errorf("signature mismatch: (%x,%x) != (%x,%x)", gr, gs, er, es)
+	}
+	if !ecdsa.Verify(pub, hash[:], gr, gs) {
+		t.Errorf("signature verification failed")
+	}
+}
+
+func TestECDSASign(t *testing.T) {
+	testECDSASign(t, P256)
+}
+
+func TestSecp256k1ECDSASign(t *testing.T) {
+	testECDSASign(t, Secp256k1)
+}
+
+func TestECDSASignSession(t *testing.T) {
+	gConn, eConn := p2p.Pipe()
+	var sessions [2]*Session
+	for idx, conn := range []*p2p.Conn{gConn, eConn} {
+		role := Sender
+		if idx == 1 {
+			role = Receiver
+		}
+		session, err := NewSession(conn, role, OTInsecure.New(rand.Reader))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions[idx] = session
+	}
+	d0 := big.NewInt(3)
+	d1 := big.NewInt(4)
+	pub := &ecdsa.PublicKey{
+		Curve: P256.Curve,
+	}
+	pub.X, pub.Y = P256.Curve.ScalarBaseMult(big.NewInt(7).Bytes())
+
+	for i := 0; i < 2; i++ {
+		hash := sha256.Sum256([]byte{byte(i)})
+
+		var wg sync.WaitGroup
+		var eErr error
+		wg.Go(func() {
+			_, _, eErr = P256.ECDSASignSession(sessions[1], d1, hash[:])
+		})
+		r, s, err := P256.ECDSASignSession(sessions[0], d0, hash[:])
+		wg.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if eErr != nil {
+			t.Fatal(eErr)
+		}
+		if !ecdsa.Verify(pub, hash[:], r, s) {
+			t.Errorf("signature %v verification failed", i)
+		}
+	}
+	for idx, session := range sessions {
+		if session.Stats.Setups != 1 {
+			t.Errorf("session %v: %v OT setups, expected 1", idx,
+				session.Stats.Setups)
+		}
+	}
+}
+
+func TestExchangeMutualCommitted(t *testing.T) {
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	// The cheating receiver opens its commitment with a different
+	// value.
+	var eErr error
+	wg.Go(func() {
+		opening := make([]byte, 33)
+		commit := sha256.Sum256(opening)
+		_, eErr = exchangeData(eConn, Receiver, commit[:])
+		if eErr != nil {
+			return
+		}
+		opening[32] = 1
+		_, eErr = exchangeData(eConn, Receiver, opening)
+	})
+	_, err := exchangeMutualCommitted(gConn, Sender, []byte{0})
+	wg.Wait()
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	if err == nil {
+		t.Errorf("invalid commitment accepted")
+	}
+}
+
+func TestHashToInt(t *testing.T) {
+	hash := make([]byte, 48)
+	for i := range hash {
+		hash[i] = 0xff
+	}
+	z := P256.hashToInt(hash)
+	if z.BitLen() != P256.N.BitLen() {
+		t.Errorf("got %v bits, expected %v", z.BitLen(), P256.N.BitLen())
+	}
+}
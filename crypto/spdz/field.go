@@ -0,0 +1,165 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+// fieldElement is an element of a 256-bit prime field as four 64-bit
+// little-endian limbs. The montField arithmetic keeps the elements in
+// the Montgomery form x*R mod p where R = 2^256.
+type fieldElement [4]uint64
+
+// montField implements constant-time Montgomery arithmetic in the
+// prime field p. The operations run in time independent of the
+// values of their operands, unlike the math/big operations whose
+// running time depends on the operands' magnitudes.
+type montField struct {
+	p    fieldElement
+	pInv uint64       // -p^-1 mod 2^64
+	rr   fieldElement // R^2 mod p
+}
+
+// newMontField creates Montgomery arithmetic for the prime field
+// p. The function returns nil if p is not a 256-bit odd prime
+// modulus.
+func newMontField(p *big.Int) *montField {
+	if p.BitLen() != 256 || p.Bit(0) == 0 {
+		return nil
+	}
+	f := &montField{
+		p: loadField(p),
+	}
+
+	r64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	inv := new(big.Int).ModInverse(new(big.Int).Mod(p, r64), r64)
+	f.pInv = -inv.Uint64()
+
+	rr := new(big.Int).Lsh(big.NewInt(1), 512)
+	f.rr = loadField(rr.Mod(rr, p))
+
+	return f
+}
+
+// loadField loads the non-negative value x < 2^256 into limbs.
+func loadField(x *big.Int) fieldElement {
+	var buf [32]byte
+	x.FillBytes(buf[:])
+
+	var z fieldElement
+	for i := range z {
+		for j := 0; j < 8; j++ {
+			z[i] |= uint64(buf[31-8*i-j]) << (8 * j)
+		}
+	}
+	return z
+}
+
+// storeField returns the limbs as a big.Int.
+func storeField(x fieldElement) *big.Int {
+	var buf [32]byte
+	for i := range x {
+		for j := 0; j < 8; j++ {
+			buf[31-8*i-j] = byte(x[i] >> (8 * j))
+		}
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
+
+// reduce returns x+carry*2^256 mod p for values less than 2p.
+func (f *montField) reduce(x fieldElement, carry uint64) fieldElement {
+	var r fieldElement
+	var borrow uint64
+	for i := range r {
+		r[i], borrow = bits.Sub64(x[i], f.p[i], borrow)
+	}
+	// Use r if the subtraction did not underflow or if x overflowed
+	// 256 bits.
+	mask := -(carry | (borrow ^ 1))
+	for i := range r {
+		r[i] = r[i]&mask | x[i]&^mask
+	}
+	return r
+}
+
+// add returns a+b mod p.
+func (f *montField) add(a, b fieldElement) fieldElement {
+	var z fieldElement
+	var carry uint64
+	for i := range z {
+		z[i], carry = bits.Add64(a[i], b[i], carry)
+	}
+	return f.reduce(z, carry)
+}
+
+// sub returns a-b mod p.
+func (f *montField) sub(a, b fieldElement) fieldElement {
+	var z fieldElement
+	var borrow uint64
+	for i := range z {
+		z[i], borrow = bits.Sub64(a[i], b[i], borrow)
+	}
+	// Add p back if the subtraction underflowed.
+	mask := -borrow
+	var carry uint64
+	for i := range z {
+		z[i], carry = bits.Add64(z[i], f.p[i]&mask, carry)
+	}
+	return z
+}
+
+// mul returns the Montgomery product a*b*R^-1 mod p.
+func (f *montField) mul(a, b fieldElement) fieldElement {
+	var t [6]uint64
+	for i := range a {
+		// t += a[i]*b
+		var c, c0, hi, lo uint64
+		for j := range b {
+			hi, lo = bits.Mul64(a[i], b[j])
+			lo, c0 = bits.Add64(lo, t[j], 0)
+			hi += c0
+			lo, c0 = bits.Add64(lo, c, 0)
+			hi += c0
+			t[j] = lo
+			c = hi
+		}
+		t[4], c0 = bits.Add64(t[4], c, 0)
+		t[5] = c0
+
+		// t = (t + m*p) / 2^64
+		m := t[0] * f.pInv
+		hi, lo = bits.Mul64(m, f.p[0])
+		_, c0 = bits.Add64(lo, t[0], 0)
+		c = hi + c0
+		for j := 1; j < len(f.p); j++ {
+			hi, lo = bits.Mul64(m, f.p[j])
+			lo, c0 = bits.Add64(lo, t[j], 0)
+			hi += c0
+			lo, c0 = bits.Add64(lo, c, 0)
+			hi += c0
+			t[j-1] = lo
+			c = hi
+		}
+		t[3], c0 = bits.Add64(t[4], c, 0)
+		t[4] = t[5] + c0
+	}
+	return f.reduce(fieldElement{t[0], t[1], t[2], t[3]}, t[4])
+}
+
+// toMont converts the value x in [0, 2^256) into the Montgomery form
+// of x mod p.
+func (f *montField) toMont(x *big.Int) fieldElement {
+	return f.mul(loadField(x), f.rr)
+}
+
+// fromMont converts the Montgomery form element x into a field
+// element.
+func (f *montField) fromMont(x fieldElement) *big.Int {
+	return storeField(f.mul(x, fieldElement{1}))
+}
@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func fieldTestValues(t *testing.T, p *big.Int, n int) []*big.Int {
+	values := []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(2),
+		new(big.Int).Sub(p, big.NewInt(2)),
+		new(big.Int).Sub(p, big.NewInt(1)),
+	}
+	for i := 0; i < n; i++ {
+		v, err := rand.Int(rand.Reader, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestMontField(t *testing.T) {
+	for _, p := range []*big.Int{P256.P, P256.N, Secp256k1.P, Secp256k1.N} {
+		f := newMontField(p)
+		if f == nil {
+			t.Fatalf("no Montgomery field for %x", p)
+		}
+		values := fieldTestValues(t, p, 100)
+		for _, a := range values {
+			am := f.toMont(a)
+			if f.fromMont(am).Cmp(a) != 0 {
+				t.Errorf("fromMont(toMont(%x)) mismatch", a)
+			}
+			for _, b := range values {
+				bm := f.toMont(b)
+
+				expected := new(big.Int).Add(a, b)
+				expected.Mod(expected, p)
+				if f.fromMont(f.add(am, bm)).Cmp(expected) != 0 {
+					t.Fatalf("%x+%x mod %x mismatch", a, b, p)
+				}
+				expected.Sub(a, b)
+				expected.Mod(expected, p)
+				if f.fromMont(f.sub(am, bm)).Cmp(expected) != 0 {
+					t.Fatalf("%x-%x mod %x mismatch", a, b, p)
+				}
+				expected.Mul(a, b)
+				expected.Mod(expected, p)
+				if f.fromMont(f.mul(am, bm)).Cmp(expected) != 0 {
+					t.Fatalf("%x*%x mod %x mismatch", a, b, p)
+				}
+			}
+		}
+	}
+	if newMontField(P384.P) != nil {
+		t.Errorf("Montgomery field for P-384")
+	}
+}
+
+func TestBeaverProductCT(t *testing.T) {
+	keys := randomValues(t, P256, 2)
+	for _, params := range []*Params{P256, P256.WithMACKey(keys[0])} {
+		generic := *params
+		generic.field = nil
+
+		values := randomValues(t, params, 5)
+		gShares, _ := authShares(t, params, keys[0], keys[1], values[:3])
+		triple := &Triple{
+			A: gShares[0],
+			B: gShares[1],
+			C: gShares[2],
+		}
+		for _, role := range []Role{Sender, Receiver} {
+			z := params.beaverProduct(role, triple, values[3], values[4])
+			expected := generic.beaverProduct(role, triple, values[3],
+				values[4])
+			macMatch := z.MAC == nil && expected.MAC == nil
+			if z.MAC != nil && expected.MAC != nil {
+				macMatch = z.MAC.Cmp(expected.MAC) == 0
+			}
+			if z.V.Cmp(expected.V) != 0 || !macMatch {
+				t.Errorf("beaverProduct mismatch: got %v/%v, expected %v/%v",
+					z.V, z.MAC, expected.V, expected.MAC)
+			}
+		}
+	}
+}
+
+// BenchmarkFieldMul compares the multiplication timings for small and
+// large operands. The Montgomery multiplication runs in the same time
+// for all operands while the math/big timings depend on the operand
+// magnitudes.
+func BenchmarkFieldMul(b *testing.B) {
+	p := P256.P
+	f := P256.field
+	operands := []struct {
+		name string
+		v    *big.Int
+	}{
+		{"small", big.NewInt(3)},
+		{"large", new(big.Int).Sub(p, big.NewInt(3))},
+	}
+	for _, op := range operands {
+		b.Run("mont/"+op.name, func(b *testing.B) {
+			x := f.toMont(op.v)
+			var z fieldElement
+			for i := 0; i < b.N; i++ {
+				z = f.mul(x, x)
+				z = f.add(z, x)
+			}
+			_ = z
+		})
+		b.Run("big/"+op.name, func(b *testing.B) {
+			z := new(big.Int)
+			for i := 0; i < b.N; i++ {
+				z.Mul(op.v, op.v)
+				z.Mod(z, p)
+				z.Add(z, op.v)
+				z.Mod(z, p)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/markkurossi/mpc/ot"
+)
+
+// OTType defines the base oblivious transfer protocols.
+type OTType int
+
+// Base OT protocols.
+const (
+	// OTCO is the Chou-Orlandi OT.
+	OTCO OTType = iota
+
+	// OTInsecure is an insecure OT where the sender sends both
+	// labels to the receiver. It is meant only for testing and
+	// benchmarking and it MUST NOT be used in production.
+	OTInsecure
+)
+
+var otTypes = map[OTType]string{
+	OTCO:       "co",
+	OTInsecure: "insecure",
+}
+
+func (t OTType) String() string {
+	name, ok := otTypes[t]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{OTType %d}", t)
+}
+
+// ParseOTType parses the OT protocol name. The empty name selects
+// OTCO.
+func ParseOTType(name string) (OTType, error) {
+	if len(name) == 0 {
+		return OTCO, nil
+	}
+	for t, n := range otTypes {
+		if n == name {
+			return t, nil
+		}
+	}
+	return OTCO, fmt.Errorf("unknown OT: %s", name)
+}
+
+// New creates a new OT instance of the protocol.
+func (t OTType) New(rand io.Reader) ot.OT {
+	switch t {
+	case OTInsecure:
+		return &insecureOT{}
+	default:
+		return ot.NewCO(rand)
+	}
+}
+
+type insecureOT struct {
+	io ot.IO
+}
+
+// InitSender implements ot.OT.InitSender.
+func (o *insecureOT) InitSender(io ot.IO) error {
+	o.io = io
+	return nil
+}
+
+// InitReceiver implements ot.OT.InitReceiver.
+func (o *insecureOT) InitReceiver(io ot.IO) error {
+	o.io = io
+	return nil
+}
+
+// Send implements ot.OT.Send.
+func (o *insecureOT) Send(wires []ot.Wire) error {
+	var d ot.LabelData
+	for _, w := range wires {
+		w.L0.GetData(&d)
+		if err := o.io.SendData(d[:]); err != nil {
+			return err
+		}
+		w.L1.GetData(&d)
+		if err := o.io.SendData(d[:]); err != nil {
+			return err
+		}
+	}
+	return o.io.Flush()
+}
+
+// Receive implements ot.OT.Receive.
+func (o *insecureOT) Receive(flags []bool, result []ot.Label) error {
+	if len(flags) != len(result) {
+		return fmt.Errorf("got %d flags for %d labels", len(flags),
+			len(result))
+	}
+	var d ot.LabelData
+	for i, flag := range flags {
+		l0, err := o.io.ReceiveData()
+		if err != nil {
+			return err
+		}
+		l1, err := o.io.ReceiveData()
+		if err != nil {
+			return err
+		}
+		data := l0
+		if flag {
+			data = l1
+		}
+		if len(data) != len(d) {
+			return fmt.Errorf("invalid label length: %d", len(data))
+		}
+		copy(d[:], data)
+		result[i].SetData(&d)
+	}
+	return nil
+}
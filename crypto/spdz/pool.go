@@ -0,0 +1,115 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// The triple file has a header followed by the triples:
+//
+//	magic [4]byte "SPDZ"
+//	flags uint32  tripleFlagMAC if the triples are authenticated
+//	count uint32  number of triples
+//
+// Each triple has the A, B, and C share values followed by the A, B,
+// and C MAC shares for authenticated triples. All values are 32-byte
+// big-endian fields.
+const (
+	tripleMagic   = "SPDZ"
+	tripleHdrSize = 12
+	tripleFlagMAC = 1
+)
+
+// SaveTriples writes the party's shares of the triples to w. The
+// triples must be all authenticated or all unauthenticated. The
+// fixed 32-byte fields hold the shares of 256-bit curves only.
+func SaveTriples(w io.Writer, triples []*Triple) error {
+	var flags uint32
+	if len(triples) > 0 && triples[0].A.MAC != nil {
+		flags |= tripleFlagMAC
+	}
+	var hdr [tripleHdrSize]byte
+	copy(hdr[:], tripleMagic)
+	binary.BigEndian.PutUint32(hdr[4:], flags)
+	binary.BigEndian.PutUint32(hdr[8:], uint32(len(triples)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+
+	for idx, t := range triples {
+		values := []*big.Int{t.A.V, t.B.V, t.C.V}
+		if flags&tripleFlagMAC != 0 {
+			values = append(values, t.A.MAC, t.B.MAC, t.C.MAC)
+		}
+		buf := make([]byte, len(values)*32)
+		for i, v := range values {
+			if v == nil {
+				return fmt.Errorf("triple %d: mixed authentication", idx)
+			}
+			if v.Sign() < 0 || v.BitLen() > 256 {
+				return fmt.Errorf("triple %d: invalid share value", idx)
+			}
+			v.FillBytes(buf[i*32 : (i+1)*32])
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadTriples reads the party's shares of the triples from r.
+func LoadTriples(r io.Reader) ([]*Triple, error) {
+	var hdr [tripleHdrSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if string(hdr[:4]) != tripleMagic {
+		return nil, errors.New("invalid triple file magic")
+	}
+	flags := binary.BigEndian.Uint32(hdr[4:])
+	if flags&^tripleFlagMAC != 0 {
+		return nil, fmt.Errorf("unsupported triple file flags: %x", flags)
+	}
+	count := binary.BigEndian.Uint32(hdr[8:])
+
+	fields := 3
+	if flags&tripleFlagMAC != 0 {
+		fields = 6
+	}
+	buf := make([]byte, fields*32)
+
+	var triples []*Triple
+	for i := uint32(0); i < count; i++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		var shares [3]*Share
+		for j := range shares {
+			shares[j] = &Share{
+				V: new(big.Int).SetBytes(buf[j*32 : (j+1)*32]),
+			}
+			if fields == 6 {
+				shares[j].MAC = new(big.Int).SetBytes(buf[(j+3)*32 : (j+4)*32])
+			}
+		}
+		triples = append(triples, &Triple{
+			A: shares[0],
+			B: shares[1],
+			C: shares[2],
+		})
+	}
+	return triples, nil
+}
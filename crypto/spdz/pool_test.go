@@ -0,0 +1,201 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+func TestSaveLoadTriples(t *testing.T) {
+	values := randomValues(t, P256, 12)
+	triples := []*Triple{
+		{
+			A: P256.NewShare(values[0]),
+			B: P256.NewShare(values[1]),
+			C: P256.NewShare(values[2]),
+		},
+		{
+			A: P256.NewShare(values[3]),
+			B: P256.NewShare(values[4]),
+			C: P256.NewShare(values[5]),
+		},
+	}
+	authenticated := []*Triple{
+		{
+			A: &Share{V: values[0], MAC: values[6]},
+			B: &Share{V: values[1], MAC: values[7]},
+			C: &Share{V: values[2], MAC: values[8]},
+		},
+		{
+			A: &Share{V: values[3], MAC: values[9]},
+			B: &Share{V: values[4], MAC: values[10]},
+			C: &Share{V: values[5], MAC: values[11]},
+		},
+	}
+	equal := func(a, b *big.Int) bool {
+		if a == nil || b == nil {
+			return a == nil && b == nil
+		}
+		return a.Cmp(b) == 0
+	}
+
+	for _, test := range [][]*Triple{nil, triples, authenticated} {
+		var buf bytes.Buffer
+		if err := SaveTriples(&buf, test); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadTriples(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(loaded) != len(test) {
+			t.Fatalf("got %v triples, expected %v", len(loaded), len(test))
+		}
+		for i := range test {
+			got := []*Share{loaded[i].A, loaded[i].B, loaded[i].C}
+			expected := []*Share{test[i].A, test[i].B, test[i].C}
+			for j := range got {
+				if !equal(got[j].V, expected[j].V) ||
+					!equal(got[j].MAC, expected[j].MAC) {
+					t.Errorf("triple %v share %v: got %v, expected %v",
+						i, j, got[j], expected[j])
+				}
+			}
+		}
+	}
+
+	// Truncated file.
+	var buf bytes.Buffer
+	if err := SaveTriples(&buf, triples); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadTriples(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	if err == nil {
+		t.Errorf("truncated triple file loaded")
+	}
+
+	// Mixed authentication.
+	mixed := []*Triple{authenticated[0], triples[1]}
+	if err := SaveTriples(&buf, mixed); err == nil {
+		t.Errorf("mixed triples saved")
+	}
+}
+
+func TestLoadedTriples(t *testing.T) {
+	const n = 10
+
+	run := func(conn *p2p.Conn, role Role) ([]*big.Int, error) {
+		session, err := NewSession(conn, role, OTInsecure.New(rand.Reader))
+		if err != nil {
+			return nil, err
+		}
+		params := P256.WithMACKey(session.MACKey())
+		triples, err := params.GenerateBeaverTriplesSession(session, n)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := SaveTriples(&buf, triples); err != nil {
+			return nil, err
+		}
+		triples, err = LoadTriples(&buf)
+		if err != nil {
+			return nil, err
+		}
+		var shares []*Share
+		for _, t := range triples {
+			shares = append(shares, t.A, t.B, t.C)
+		}
+		return params.Open(conn, role, shares)
+	}
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var eErr error
+	wg.Go(func() {
+		_, eErr = run(eConn, Receiver)
+	})
+	values, err := run(gConn, Sender)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	for i := 0; i < n; i++ {
+		ab := new(big.Int).Mul(values[3*i], values[3*i+1])
+		if P256.modReduce(ab).Cmp(values[3*i+2]) != 0 {
+			t.Errorf("triple %v: c != a*b", i)
+		}
+	}
+}
+
+func TestAddTriplePool(t *testing.T) {
+	gx, gy, err := randomPoint(curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex, ey, err := randomPoint(curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rx, ry := curve.Add(gx, gy, ex, ey)
+
+	run := func(conn *p2p.Conn, role Role, x, y *big.Int) (
+		*big.Int, *big.Int, *Session, error) {
+
+		session, err := NewSession(conn, role, OTInsecure.New(rand.Reader))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		params := P256.WithMACKey(session.MACKey())
+		triples, err := params.GenerateBeaverTriplesSession(session,
+			AddTriples)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pooled, err := NewSession(conn, role, OTInsecure.New(rand.Reader))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pooled.SetTriplePool(triples, session.MACKey())
+		x, y, err = P256.AddSession(pooled, x, y)
+		return x, y, pooled, err
+	}
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var eErr error
+	var erx, ery *big.Int
+	wg.Go(func() {
+		erx, ery, _, eErr = run(eConn, Receiver, ex, ey)
+	})
+	grx, gry, session, err := run(gConn, Sender, gx, gy)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	if add(P256, grx, erx).Cmp(rx) != 0 || add(P256, gry, ery).Cmp(ry) != 0 {
+		t.Errorf("pooled point addition mismatch")
+	}
+	if session.Stats.Setups != 0 || len(session.pool) != 0 {
+		t.Errorf("got %v setups, %v pooled triples, expected 0/0",
+			session.Stats.Setups, len(session.pool))
+	}
+}
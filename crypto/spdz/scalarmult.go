@@ -0,0 +1,145 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// ScalarMultTriples is the maximum number of Beaver triples that
+// ScalarMult consumes per scalar bit. The function consumes at most
+// ScalarMultTriples*n+PointAddTriples triples for an n-bit scalar.
+const ScalarMultTriples = PointAddTriples + PointDoubleTriples + 2
+
+// PointAddTriples is the maximum number of Beaver triples that
+// PointAdd consumes when the points are not equal or each other's
+// inverses.
+const PointAddTriples = 5
+
+// PointDoubleTriples is the maximum number of Beaver triples that
+// PointDouble consumes.
+const PointDoubleTriples = 6
+
+// PointDouble computes the secret-shared point 2*(x, y). The function
+// opens the masked y-coordinate for the inversion of 2y which reveals
+// only whether y is zero. Since the supported curves have no points
+// with y = 0, the inversion fails only for invalid points.
+func (params *Params) PointDouble(conn *p2p.Conn, role Role, x, y *Share,
+	triples []*Triple, tripleIndex *int) (x3, y3 *Share, err error) {
+
+	// lam = (3x^2 + a) / 2y
+	xx, err := params.safeMul(conn, role, x, x, triples, tripleIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	num := params.addConst(params.mulConst(xx, big.NewInt(3)),
+		role == Sender, params.A)
+
+	inv, err := params.InvShareMasked(conn, role,
+		params.mulConst(y, big.NewInt(2)), triples, tripleIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	lam, err := params.safeMul(conn, role, num, inv, triples, tripleIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// x3 = lam^2 - 2x
+	lam2, err := params.safeMul(conn, role, lam, lam, triples, tripleIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	x3 = params.SubShare(lam2, params.mulConst(x, big.NewInt(2)))
+
+	// y3 = lam*(x - x3) - y
+	prod, err := params.safeMul(conn, role, lam, params.SubShare(x, x3),
+		triples, tripleIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	y3 = params.SubShare(prod, y)
+
+	return x3, y3, nil
+}
+
+// ScalarMult computes the secret-shared point k*(px, py) for the
+// secret-shared scalar k. The scalar is given as the shares of its
+// bits kBits in the field P, the least significant bit first. The
+// bits must be 0 or 1.
+//
+// The function computes the product with double-and-add over the
+// scalar bits. For each bit b, it computes Q = 2^i*(px, py) with
+// PointDouble, R+Q with PointAdd, and selects R + b*(R+Q - R) with
+// two multiplications. The affine addition formulas have no
+// representation for the point at infinity so the accumulator R
+// starts from a fixed public offset point T that is subtracted from
+// the result. The offset T is derived from a hash so R+Q hits an
+// exceptional case only with negligible probability. The function
+// returns the infinity flag if the result is the point at infinity,
+// i.e. k is a multiple of the order of the point.
+//
+// The function consumes at most ScalarMultTriples Beaver triples per
+// scalar bit and PointAddTriples triples for removing the offset.
+func (params *Params) ScalarMult(conn *p2p.Conn, role Role, kBits []*Share,
+	px, py *Share, triples []*Triple, tripleIndex *int) (
+	x3, y3 *Share, infinity bool, err error) {
+
+	tx, ty := params.scalarMultOffset()
+
+	rx := params.constShare(role, tx)
+	ry := params.constShare(role, ty)
+	qx := px
+	qy := py
+
+	for i, bit := range kBits {
+		if i > 0 {
+			qx, qy, err = params.PointDouble(conn, role, qx, qy, triples,
+				tripleIndex)
+			if err != nil {
+				return nil, nil, false, err
+			}
+		}
+		sx, sy, inf, err := params.PointAdd(conn, role, rx, ry, qx, qy,
+			triples, tripleIndex)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if inf {
+			return nil, nil, false,
+				errors.New("scalar mult: unexpected point at infinity")
+		}
+		// R = R + b*(S - R)
+		prods, err := params.mulMany(conn, role,
+			[]*Share{bit, bit},
+			[]*Share{params.SubShare(sx, rx), params.SubShare(sy, ry)},
+			triples, tripleIndex)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		rx = params.AddShare(rx, prods[0])
+		ry = params.AddShare(ry, prods[1])
+	}
+
+	// Remove the offset: R + -T.
+	return params.PointAdd(conn, role, rx, ry,
+		params.constShare(role, tx),
+		params.constShare(role, new(big.Int).Sub(params.P, ty)),
+		triples, tripleIndex)
+}
+
+// scalarMultOffset returns the public offset point for ScalarMult.
+func (params *Params) scalarMultOffset() (x, y *big.Int) {
+	digest := sha256.Sum256([]byte("spdz scalar mult offset " + params.Name))
+	t := new(big.Int).SetBytes(digest[:])
+	t.Mod(t, params.N)
+	return params.Curve.ScalarBaseMult(t.Bytes())
+}
@@ -0,0 +1,103 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+func TestScalarMult(t *testing.T) {
+	params := P256
+	k, err := rand.Int(rand.Reader, params.N)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		k    *big.Int
+		bits int
+	}{
+		{k, 256},
+		{big.NewInt(1), 4},
+		{big.NewInt(0), 4},
+	}
+	for _, test := range tests {
+		// Split the scalar bits and the generator into shares.
+		var gBits, eBits []*Share
+		for i := 0; i < test.bits; i++ {
+			g, err := params.randomFieldElement(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bit := big.NewInt(int64(test.k.Bit(i)))
+			gBits = append(gBits, params.NewShare(g))
+			eBits = append(eBits, params.NewShare(bit.Sub(bit, g)))
+		}
+		gx, gy := params.constShare(Sender, params.Gx),
+			params.constShare(Sender, params.Gy)
+		ex, ey := params.constShare(Receiver, params.Gx),
+			params.constShare(Receiver, params.Gy)
+
+		numTriples := ScalarMultTriples*test.bits + PointAddTriples
+
+		run := func(conn *p2p.Conn, role Role, kBits []*Share,
+			px, py *Share) ([]*big.Int, bool, error) {
+
+			triples, err := params.GenerateBeaverTriplesOTBatch(conn,
+				OTInsecure.New(rand.Reader), role, numTriples)
+			if err != nil {
+				return nil, false, err
+			}
+			var tripleIndex int
+			x, y, inf, err := params.ScalarMult(conn, role, kBits, px, py,
+				triples, &tripleIndex)
+			if err != nil || inf {
+				return nil, inf, err
+			}
+			values, err := params.OpenMany(conn, role, []*Share{x, y})
+			return values, false, err
+		}
+
+		gConn, eConn := p2p.Pipe()
+		var wg sync.WaitGroup
+
+		var eErr error
+		var eInf bool
+		wg.Go(func() {
+			_, eInf, eErr = run(eConn, Receiver, eBits, ex, ey)
+		})
+		values, gInf, err := run(gConn, Sender, gBits, gx, gy)
+		wg.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if eErr != nil {
+			t.Fatal(eErr)
+		}
+
+		if test.k.Sign() == 0 {
+			if !gInf || !eInf {
+				t.Errorf("0*G: got infinity %v/%v, expected true", gInf, eInf)
+			}
+			continue
+		}
+		if gInf || eInf {
+			t.Errorf("%x*G: unexpected point at infinity", test.k)
+			continue
+		}
+		x, y := curve.ScalarBaseMult(test.k.Bytes())
+		if values[0].Cmp(x) != 0 || values[1].Cmp(y) != 0 {
+			t.Errorf("%x*G: got (%x,%x), expected (%x,%x)", test.k,
+				values[0], values[1], x, y)
+		}
+	}
+}
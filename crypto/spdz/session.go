@@ -0,0 +1,249 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package spdz
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// ErrCanceled is returned when the session's stop channel is closed
+// during a computation.
+var ErrCanceled = errors.New("spdz: operation canceled")
+
+// ErrConnClosed is returned when the connection to the peer is
+// closed during a computation.
+var ErrConnClosed = errors.New("spdz: peer connection closed")
+
+// Session holds the OT extension state between two peers. The session
+// runs the base OTs and the IKNP setup once, on the first triple
+// generation, and amortizes them over all subsequent IKNP
+// extensions. Each extension advances the IKNP PRG streams so the
+// extended OTs are fresh even though the base OTs are reused; the
+// streams are never rewound. Both peers must run the same sequence of
+// computations with their sessions. If a computation fails, the peers
+// must discard their sessions since the IKNP streams may be out of
+// sync.
+type Session struct {
+	conn   *p2p.Conn
+	oti    ot.OT
+	role   Role
+	iknpS  *ot.IKNPSender
+	iknpR  *ot.IKNPReceiver
+	ready  bool
+	stop   <-chan struct{}
+	closer io.Closer
+	macKey *big.Int
+	pool   []*Triple
+	poolMK *big.Int
+	audit  float64
+
+	// The VOLE self-test count and the VOLE sender constructor. The
+	// newSender is nil for the vole package's senders.
+	selfTest  int
+	newSender newVOLESenderFunc
+	Stats     SessionStats
+}
+
+// SessionStats provide session statistics.
+type SessionStats struct {
+	// Setups is the number of base OT setups.
+	Setups int
+	// SetupTime is the time spent in the base OT setups.
+	SetupTime time.Duration
+	// Extensions is the number of IKNP extensions.
+	Extensions int
+}
+
+// NewSession creates a new session for the connection conn. The oti
+// specifies the base OT protocol. Both peers must use the same base
+// OT protocol.
+func NewSession(conn *p2p.Conn, role Role, oti ot.OT) (*Session, error) {
+	switch role {
+	case Sender, Receiver:
+	default:
+		return nil, fmt.Errorf("invalid role: %d", role)
+	}
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	return &Session{
+		conn:   conn,
+		oti:    oti,
+		role:   role,
+		macKey: new(big.Int).SetBytes(key[:]),
+	}, nil
+}
+
+// Role returns the session role.
+func (s *Session) Role() Role {
+	return s.role
+}
+
+// MACKey returns the party's random MAC key share for the session.
+// See Params.WithMACKey for computing with authenticated shares.
+func (s *Session) MACKey() *big.Int {
+	return s.macKey
+}
+
+// SetStop sets the stop channel for the session's computations. The
+// SPDZ operations run thousands of round-trips with blocking sends
+// and receives which do not see the stop channel. Therefore, if the
+// stop channel is closed during a computation, the session closes
+// the closer, typically the network connection under the session's
+// p2p.Conn, to unblock the pending I/O and the computation returns
+// ErrCanceled. The session is unusable after it has been canceled.
+func (s *Session) SetStop(stop <-chan struct{}, closer io.Closer) {
+	s.stop = stop
+	s.closer = closer
+}
+
+// run runs the computation f. It aborts the computation if the stop
+// channel is closed and reports the connection loss as
+// ErrConnClosed.
+func (s *Session) run(f func() error) error {
+	if s.stop != nil {
+		select {
+		case <-s.stop:
+			return ErrCanceled
+		default:
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-s.stop:
+				if s.closer != nil {
+					s.closer.Close()
+				}
+			case <-done:
+			}
+		}()
+	}
+	err := f()
+	if err == nil {
+		return nil
+	}
+	// The computation fails when the stop closes the connection.
+	// The caller may close the connection after the stop channel so
+	// check the channel and not whether the closer was called.
+	select {
+	case <-s.stop:
+		return ErrCanceled
+	default:
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) {
+		return fmt.Errorf("%w: %w", ErrConnClosed, err)
+	}
+	return err
+}
+
+// SetAuditRate sets the fraction of extra triples the session's
+// triple generation produces in each batch for auditing the
+// CrossMultiplyBatch results. After the cross multiplication, the
+// parties select the audited triples and random coefficients γi with
+// a commit-and-reveal coin toss, open the audited triples, and check
+// that Σγi*ci = Σγi*ai*bi. The audited triples are discarded. The
+// audit detects a VOLE peer that added offsets to the masks of any of
+// the audited triples. The rate 0 disables the audit. Both peers must
+// use the same rate.
+func (s *Session) SetAuditRate(rate float64) error {
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("invalid triple audit rate: %v", rate)
+	}
+	s.audit = rate
+	return nil
+}
+
+// SetVOLESelfTest sets how many extra multiplications the session's
+// triple generation runs with random inputs in each VOLE direction to
+// verify that the VOLE results satisfy u = r + x*y. The test inputs
+// are placed at random positions of the batch, opened to the peer,
+// and discarded after the check. The value 0 disables the self-test.
+// The self-test is a debugging aid for the triple generation and it
+// is not a protection against a malicious peer. Both peers must use
+// the same value.
+func (s *Session) SetVOLESelfTest(k int) error {
+	if k < 0 {
+		return fmt.Errorf("invalid VOLE self-test count: %d", k)
+	}
+	s.selfTest = k
+	return nil
+}
+
+// SetTriplePool sets the preprocessed Beaver triples for the
+// session. The macKey is the party's MAC key share that authenticates
+// the triples, or nil if the triples are unauthenticated. AddSession
+// takes its triples from the pool and falls back to live triple
+// generation when the pool does not have enough triples. Both peers
+// must set matching pools that were generated together, and each pool
+// must be used in one session only.
+func (s *Session) SetTriplePool(triples []*Triple, macKey *big.Int) {
+	s.pool = triples
+	s.poolMK = macKey
+}
+
+// takeTriples takes n triples from the session's triple pool. The
+// function returns nil if the pool does not have enough triples.
+func (s *Session) takeTriples(n int) ([]*Triple, *big.Int) {
+	if len(s.pool) < n {
+		return nil, nil
+	}
+	triples := s.pool[:n]
+	s.pool = s.pool[n:]
+	return triples, s.poolMK
+}
+
+// setup runs the base OTs and the IKNP setup if they are not done
+// yet.
+func (s *Session) setup() error {
+	if s.ready {
+		return nil
+	}
+	start := time.Now()
+	var err error
+
+	if s.role == Sender {
+		if err = s.oti.InitSender(s.conn); err != nil {
+			return err
+		}
+		s.iknpS, err = ot.NewIKNPSender(s.oti, s.conn, rand.Reader, nil)
+	} else {
+		if err = s.oti.InitReceiver(s.conn); err != nil {
+			return err
+		}
+		s.iknpR, err = ot.NewIKNPReceiver(s.oti, s.conn, rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+	s.ready = true
+	s.Stats.Setups++
+	s.Stats.SetupTime += time.Since(start)
+	return nil
+}
+
+// send extends m IKNP sender labels.
+func (s *Session) send(m int) ([]ot.Label, error) {
+	s.Stats.Extensions++
+	return s.iknpS.Send(m, false)
+}
+
+// receive extends len(flags) IKNP receiver labels.
+func (s *Session) receive(flags []bool, labels []ot.Label) error {
+	s.Stats.Extensions++
+	return s.iknpR.Receive(flags, labels, false)
+}
@@ -1,30 +1,148 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
 
-// Package spdz implements the SPDZ protocol for P-256 point addition.
+// Package spdz implements the SPDZ protocol for elliptic curve point
+// addition.
 package spdz
 
 import (
+	"bytes"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"math/big"
 
+	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/markkurossi/mpc/ot"
 	"github.com/markkurossi/mpc/p2p"
 )
 
+// Params define the elliptic curve for the SPDZ operations. The
+// secret shares are elements of the curve's base field P.
+type Params struct {
+	Name  string
+	P     *big.Int       // Order of the base field.
+	N     *big.Int       // Order of the base point.
+	A     *big.Int       // Coefficient a of the curve equation.
+	B     *big.Int       // Constant of the curve equation.
+	Gx    *big.Int       // X-coordinate of the base point.
+	Gy    *big.Int       // Y-coordinate of the base point.
+	Curve elliptic.Curve // Curve for operations on public points.
+	alpha *big.Int       // MAC key share, nil for unauthenticated shares.
+	field *montField     // Constant-time arithmetic, nil if not supported.
+}
+
 var (
-	curve       = elliptic.P256()
-	curveParams = curve.Params()
-	p256P       = curveParams.P
+	// P256 defines the NIST P-256 curve parameters.
+	P256 = newParams(elliptic.P256())
+
+	// P384 defines the NIST P-384 curve parameters.
+	P384 = newParams(elliptic.P384())
+
+	secp256k1P = hexInt(
+		"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+
+	// Secp256k1 defines the SEC 2 secp256k1 curve parameters.
+	Secp256k1 = &Params{
+		Name: "secp256k1",
+		P:    secp256k1P,
+		N: hexInt(
+			"fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+		A: big.NewInt(0),
+		B: big.NewInt(7),
+		Gx: hexInt(
+			"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+		Gy: hexInt(
+			"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+		Curve: btcec.S256(),
+		field: newMontField(secp256k1P),
+	}
+
+	curves = map[string]*Params{
+		P256.Name:      P256,
+		P384.Name:      P384,
+		Secp256k1.Name: Secp256k1,
+	}
 )
 
+// newParams creates parameters for the curve. The elliptic.Curve
+// implementations assume the curve equation y² = x³ - 3x + b.
+func newParams(curve elliptic.Curve) *Params {
+	params := curve.Params()
+	return &Params{
+		Name:  params.Name,
+		P:     params.P,
+		N:     params.N,
+		A:     new(big.Int).Sub(params.P, big.NewInt(3)),
+		B:     params.B,
+		Gx:    params.Gx,
+		Gy:    params.Gy,
+		Curve: curve,
+		field: newMontField(params.P),
+	}
+}
+
+// scalarField returns parameters for computing with shares over the
+// scalar field N instead of the base field P.
+func (params *Params) scalarField() *Params {
+	return &Params{
+		Name:  params.Name,
+		P:     params.N,
+		N:     params.N,
+		A:     params.A,
+		B:     params.B,
+		Gx:    params.Gx,
+		Gy:    params.Gy,
+		Curve: params.Curve,
+		field: newMontField(params.N),
+	}
+}
+
+// WithMACKey returns parameters for computing with MAC-authenticated
+// shares. The alpha is the party's share of the global MAC key
+// α = α0+α1. Each authenticated share of a value v carries the
+// party's share of the MAC α*v. Neither party knows α so a party
+// can't modify its shares without the MAC check failing when the
+// value is opened with Open.
+func (params *Params) WithMACKey(alpha *big.Int) *Params {
+	p := *params
+	p.alpha = params.modReduce(alpha)
+	return &p
+}
+
+func hexInt(v string) *big.Int {
+	i, ok := new(big.Int).SetString(v, 16)
+	if !ok {
+		panic(fmt.Sprintf("invalid hex integer: %v", v))
+	}
+	return i
+}
+
+// DefaultP256 returns the P-256 curve parameters.
+func DefaultP256() *Params {
+	return P256
+}
+
+// CurveByName returns the registered curve parameters by curve name.
+func CurveByName(name string) (*Params, bool) {
+	params, ok := curves[name]
+	return params, ok
+}
+
+// ErrInfinity is returned by the point addition functions when the
+// sum of the points is the point at infinity i.e. the points are each
+// other's inverses. The point at infinity has no affine coordinates
+// so the functions return no result shares.
+var ErrInfinity = errors.New("spdz: point at infinity")
+
+var errNotInvertible = errors.New("batch inverse: element not invertible")
+
 // Role defines the SPDZ protocol role.
 type Role int
 
@@ -34,38 +152,44 @@ const (
 	Receiver
 )
 
-func modReduce(x *big.Int) *big.Int {
-	z := new(big.Int).Mod(x, p256P)
+func (params *Params) modReduce(x *big.Int) *big.Int {
+	z := new(big.Int).Mod(x, params.P)
 	if z.Sign() < 0 {
-		z.Add(z, p256P)
+		z.Add(z, params.P)
 	}
 	return z
 }
 
-func randomFieldElement(r io.Reader) (*big.Int, error) {
-	b := make([]byte, 32)
+// size returns the byte size of the field elements.
+func (params *Params) size() int {
+	return (params.P.BitLen() + 7) / 8
+}
+
+// randomFieldElement returns a random field element. The function
+// reduces 128 extra random bits so the result is uniform up to a
+// negligible bias.
+func (params *Params) randomFieldElement(r io.Reader) (*big.Int, error) {
+	b := make([]byte, params.size()+16)
 	if _, err := io.ReadFull(r, b); err != nil {
 		return nil, err
 	}
-	return modReduce(new(big.Int).SetBytes(b)), nil
+	return params.modReduce(new(big.Int).SetBytes(b)), nil
 }
 
-func bytes32(v *big.Int) []byte {
-	b := make([]byte, 32)
+func (params *Params) fieldBytes(v *big.Int) []byte {
+	b := make([]byte, params.size())
 	if v == nil {
 		return b
 	}
-	z := modReduce(v)
-	copy(b[32-len(z.Bytes()):], z.Bytes())
-	return b
+	return params.modReduce(v).FillBytes(b)
 }
 
-func read32ToBig(b []byte) *big.Int {
+func readField(b []byte) *big.Int {
 	return new(big.Int).SetBytes(b)
 }
 
-func sendField(conn *p2p.Conn, v *big.Int) error {
-	return conn.SendData(bytes32(v))
+func (params *Params) sendField(conn *p2p.Conn, v *big.Int) error {
+	return conn.SendData(params.fieldBytes(v))
 }
 
 func recvField(conn *p2p.Conn) (*big.Int, error) {
@@ -73,26 +197,90 @@ func recvField(conn *p2p.Conn) (*big.Int, error) {
 	if err != nil {
 		return nil, err
 	}
-	return read32ToBig(b), nil
+	return readField(b), nil
 }
 
-// Share implements a share value in Beaver triple.
+// Share implements a share value in Beaver triple. The MAC is the
+// party's share of the value's MAC α*V. It is nil for unauthenticated
+// shares.
 type Share struct {
-	V *big.Int
+	V   *big.Int
+	MAC *big.Int
 }
 
-func NewShare(v *big.Int) *Share {
-	return &Share{V: modReduce(v)}
+// NewShare creates a new unauthenticated share for the value v.
+func (params *Params) NewShare(v *big.Int) *Share {
+	return &Share{V: params.modReduce(v)}
 }
 
-func AddShare(a, b *Share) *Share {
-	z := new(big.Int).Add(a.V, b.V)
-	return NewShare(z)
+// AddShare adds the shares a and b. The result is authenticated if
+// both a and b are authenticated.
+func (params *Params) AddShare(a, b *Share) *Share {
+	z := params.NewShare(new(big.Int).Add(a.V, b.V))
+	if a.MAC != nil && b.MAC != nil {
+		z.MAC = params.modReduce(new(big.Int).Add(a.MAC, b.MAC))
+	}
+	return z
 }
 
-func SubShare(a, b *Share) *Share {
-	z := new(big.Int).Sub(a.V, b.V)
-	return NewShare(z)
+// SubShare subtracts the share b from the share a. The result is
+// authenticated if both a and b are authenticated.
+func (params *Params) SubShare(a, b *Share) *Share {
+	z := params.NewShare(new(big.Int).Sub(a.V, b.V))
+	if a.MAC != nil && b.MAC != nil {
+		z.MAC = params.modReduce(new(big.Int).Sub(a.MAC, b.MAC))
+	}
+	return z
+}
+
+// addConst adds the public constant c to the share s. Only one party
+// adds c to its value share, specified by add, but both parties add
+// their shares of the MAC α*c.
+func (params *Params) addConst(s *Share, add bool, c *big.Int) *Share {
+	z := params.NewShare(s.V)
+	if add {
+		z.V = params.modReduce(new(big.Int).Add(s.V, c))
+	}
+	if s.MAC != nil && params.alpha != nil {
+		m := new(big.Int).Mul(params.alpha, c)
+		z.MAC = params.modReduce(m.Add(m, s.MAC))
+	}
+	return z
+}
+
+// mulConst multiplies the share s with the public constant c.
+func (params *Params) mulConst(s *Share, c *big.Int) *Share {
+	z := params.NewShare(new(big.Int).Mul(s.V, c))
+	if s.MAC != nil {
+		z.MAC = params.modReduce(new(big.Int).Mul(s.MAC, c))
+	}
+	return z
+}
+
+// constShare returns the party's share of the public constant c. The
+// share is authenticated if the parameters have a MAC key.
+func (params *Params) constShare(role Role, c *big.Int) *Share {
+	zero := &Share{
+		V: new(big.Int),
+	}
+	if params.alpha != nil {
+		zero.MAC = new(big.Int)
+	}
+	return params.addConst(zero, role == Sender, c)
+}
+
+// authenticated tests if all shares are authenticated with the
+// parameters' MAC key.
+func (params *Params) authenticated(shares []*Share) bool {
+	if params.alpha == nil {
+		return false
+	}
+	for _, share := range shares {
+		if share.MAC == nil {
+			return false
+		}
+	}
+	return true
 }
 
 // Triple implements a Beaver triple.
@@ -102,90 +290,318 @@ type Triple struct {
 	C *Share
 }
 
+// MACError reports a failed MAC check on the opened values. The
+// failure means that the peer has modified its shares or the shares
+// are corrupted. The protocol must be aborted and the opened values
+// must not be used. Therefore, the error identifies the failed value
+// only by its index in the batch of opened values.
+type MACError struct {
+	Index int
+}
+
+func (err *MACError) Error() string {
+	return fmt.Sprintf("MAC check failed for value %d", err.Index)
+}
+
 // openTwoShares opens two shares in one round-trip
-func openTwoShares(conn *p2p.Conn, role Role, s1, s2 *Share) (
+func (params *Params) openTwoShares(conn *p2p.Conn, role Role, s1, s2 *Share) (
 	*big.Int, *big.Int, error) {
 
+	values, err := params.open(conn, role, []*Share{s1, s2})
+	if err != nil {
+		return nil, nil, err
+	}
+	return values[0], values[1], nil
+}
+
+// OpenMany opens all shares in one round-trip. The shares are sent
+// as a single message and the sender and receiver use asymmetric
+// ordering to avoid deadlock.
+func (params *Params) OpenMany(conn *p2p.Conn, role Role, shares []*Share) (
+	[]*big.Int, error) {
+
+	size := params.size()
+	data := make([]byte, 0, len(shares)*size)
+	for _, share := range shares {
+		data = append(data, params.fieldBytes(share.V)...)
+	}
+
+	var peer []byte
+	var err error
+
 	if role == Sender {
-		if err := sendField(conn, s1.V); err != nil {
-			return nil, nil, err
+		err = conn.SendData(data)
+		if err == nil {
+			err = conn.Flush()
 		}
-		if err := sendField(conn, s2.V); err != nil {
-			return nil, nil, err
+		if err == nil {
+			peer, err = conn.ReceiveData()
 		}
-		if err := conn.Flush(); err != nil {
-			return nil, nil, err
+	} else {
+		peer, err = conn.ReceiveData()
+		if err == nil {
+			err = conn.SendData(data)
 		}
-		p1, err := recvField(conn)
-		if err != nil {
-			return nil, nil, err
+		if err == nil {
+			err = conn.Flush()
 		}
-		p2, err := recvField(conn)
-		if err != nil {
-			return nil, nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(peer) != len(data) {
+		return nil, fmt.Errorf("invalid open: got %v bytes, expected %v",
+			len(peer), len(data))
+	}
+
+	result := make([]*big.Int, len(shares))
+	for i, share := range shares {
+		v := readField(peer[i*size : (i+1)*size])
+		result[i] = params.modReduce(v.Add(v, share.V))
+	}
+	return result, nil
+}
+
+// open opens the shares with Open if they are authenticated and with
+// OpenMany otherwise.
+func (params *Params) open(conn *p2p.Conn, role Role, shares []*Share) (
+	[]*big.Int, error) {
+
+	if params.authenticated(shares) {
+		return params.Open(conn, role, shares)
+	}
+	return params.OpenMany(conn, role, shares)
+}
+
+// Open opens the authenticated shares and verifies their MACs. After
+// reconstructing the values v, each party computes σi = mi - αi*v
+// for its MAC shares mi. The MACs are valid if σ0+σ1 = 0. The parties
+// exchange their σ values with exchangeCommitted so neither party can
+// choose its σ values based on the peer's values. The function
+// returns a MACError if any of the MAC checks fail.
+func (params *Params) Open(conn *p2p.Conn, role Role, shares []*Share) (
+	[]*big.Int, error) {
+
+	if !params.authenticated(shares) {
+		return nil, errors.New("open: unauthenticated shares")
+	}
+	values, err := params.OpenMany(conn, role, shares)
+	if err != nil {
+		return nil, err
+	}
+
+	size := params.size()
+	sigma := make([]byte, 0, len(shares)*size)
+	for i, share := range shares {
+		s := new(big.Int).Mul(params.alpha, values[i])
+		sigma = append(sigma, params.fieldBytes(s.Sub(share.MAC, s))...)
+	}
+
+	peer, err := exchangeCommitted(conn, role, sigma)
+	if err != nil {
+		return nil, err
+	}
+	if len(peer) != len(sigma) {
+		return nil, fmt.Errorf("invalid MAC check: got %v bytes, expected %v",
+			len(peer), len(sigma))
+	}
+	for i := range shares {
+		s := readField(sigma[i*size : (i+1)*size])
+		s.Add(s, readField(peer[i*size:(i+1)*size]))
+		if params.modReduce(s).Sign() != 0 {
+			return nil, &MACError{
+				Index: i,
+			}
 		}
-		sum1 := modReduce(new(big.Int).Add(s1.V, p1))
-		sum2 := modReduce(new(big.Int).Add(s2.V, p2))
-		return sum1, sum2, nil
-	} else {
-		p1, err := recvField(conn)
-		if err != nil {
-			return nil, nil, err
+	}
+	return values, nil
+}
+
+// exchangeCommitted exchanges data with the peer. The sender commits
+// to its data with a hash commitment before the receiver reveals its
+// own data, and the sender opens the commitment after receiving the
+// receiver's data. This way neither party can choose its data based
+// on the peer's data. The function returns the peer's data.
+func exchangeCommitted(conn *p2p.Conn, role Role, data []byte) (
+	[]byte, error) {
+
+	var peer []byte
+	var err error
+
+	if role == Sender {
+		opening := make([]byte, 32, 32+len(data))
+		if _, err := rand.Read(opening); err != nil {
+			return nil, err
 		}
-		p2, err := recvField(conn)
-		if err != nil {
-			return nil, nil, err
+		opening = append(opening, data...)
+		commit := sha256.Sum256(opening)
+
+		err = conn.SendData(commit[:])
+		if err == nil {
+			err = conn.Flush()
 		}
-		if err := sendField(conn, s1.V); err != nil {
-			return nil, nil, err
+		if err == nil {
+			peer, err = conn.ReceiveData()
 		}
-		if err := sendField(conn, s2.V); err != nil {
-			return nil, nil, err
+		if err == nil {
+			err = conn.SendData(opening)
 		}
-		if err := conn.Flush(); err != nil {
-			return nil, nil, err
+		if err == nil {
+			err = conn.Flush()
+		}
+	} else {
+		var commit, opening []byte
+		commit, err = conn.ReceiveData()
+		if err == nil {
+			err = conn.SendData(data)
 		}
-		sum1 := modReduce(new(big.Int).Add(s1.V, p1))
-		sum2 := modReduce(new(big.Int).Add(s2.V, p2))
-		return sum1, sum2, nil
+		if err == nil {
+			err = conn.Flush()
+		}
+		if err == nil {
+			opening, err = conn.ReceiveData()
+		}
+		if err == nil {
+			digest := sha256.Sum256(opening)
+			if len(opening) < 32 || !bytes.Equal(digest[:], commit) {
+				return nil, errors.New("invalid commitment")
+			}
+			peer = opening[32:]
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
+	return peer, nil
 }
 
-// MulShare computes a*b given shares and a Beaver triple.
-// Note: to avoid doubling d*e term, only one party (id==0) adds dv*ev.
-func MulShare(conn *p2p.Conn, role Role, a, b *Share, triple *Triple) (
-	*Share, error) {
+// exchangeMutualCommitted exchanges data with the peer with hash
+// commitments from both parties. The parties first exchange the
+// commitments to their data and open the commitments only after
+// receiving the peer's commitment. This way neither party can choose
+// its data based on the peer's data. The function returns the peer's
+// data.
+func exchangeMutualCommitted(conn *p2p.Conn, role Role, data []byte) (
+	[]byte, error) {
 
-	d := SubShare(a, triple.A)
-	e := SubShare(b, triple.B)
+	opening := make([]byte, 32, 32+len(data))
+	if _, err := rand.Read(opening); err != nil {
+		return nil, err
+	}
+	opening = append(opening, data...)
+	commit := sha256.Sum256(opening)
 
-	dv, ev, err := openTwoShares(conn, role, d, e)
+	peerCommit, err := exchangeData(conn, role, commit[:])
+	if err != nil {
+		return nil, err
+	}
+	peerOpening, err := exchangeData(conn, role, opening)
 	if err != nil {
 		return nil, err
 	}
+	digest := sha256.Sum256(peerOpening)
+	if len(peerOpening) < 32 || !bytes.Equal(digest[:], peerCommit) {
+		return nil, errors.New("invalid commitment")
+	}
+	return peerOpening[32:], nil
+}
 
-	term := new(big.Int).Set(triple.C.V)
-	tmp := new(big.Int).Mul(dv, triple.B.V)
-	term.Add(term, tmp)
-	tmp2 := new(big.Int).Mul(ev, triple.A.V)
-	term.Add(term, tmp2)
+// exchangeData sends data to the peer and returns the peer's data.
+// The sender sends its data first.
+func exchangeData(conn *p2p.Conn, role Role, data []byte) ([]byte, error) {
+	send := func() error {
+		if err := conn.SendData(data); err != nil {
+			return err
+		}
+		return conn.Flush()
+	}
 	if role == Sender {
-		tmp3 := new(big.Int).Mul(dv, ev)
-		term.Add(term, tmp3)
+		if err := send(); err != nil {
+			return nil, err
+		}
+		return conn.ReceiveData()
+	}
+	peer, err := conn.ReceiveData()
+	if err != nil {
+		return nil, err
+	}
+	if err := send(); err != nil {
+		return nil, err
 	}
-	term.Mod(term, p256P)
+	return peer, nil
+}
+
+// MulShare computes a*b given shares and a Beaver triple. The result
+// is authenticated if the shares and the triple are authenticated.
+func (params *Params) MulShare(conn *p2p.Conn, role Role, a, b *Share,
+	triple *Triple) (*Share, error) {
 
-	return NewShare(term), nil
+	d := params.SubShare(a, triple.A)
+	e := params.SubShare(b, triple.B)
+
+	dv, ev, err := params.openTwoShares(conn, role, d, e)
+	if err != nil {
+		return nil, err
+	}
+	return params.beaverProduct(role, triple, dv, ev), nil
 }
 
-func safeMul(conn *p2p.Conn, role Role, a, b *Share, triples []*Triple,
-	tripleIndex *int) (*Share, error) {
+// beaverProduct computes the product share c + d*b + e*a + d*e from
+// the triple and the opened values d and e. Only the sender adds the
+// public d*e term to its value share to avoid doubling it. For
+// 256-bit fields, the function computes with the secret triple shares
+// in constant time.
+func (params *Params) beaverProduct(role Role, triple *Triple,
+	dv, ev *big.Int) *Share {
+
+	if params.field != nil {
+		return params.beaverProductCT(role, triple, dv, ev)
+	}
+	z := params.AddShare(triple.C, params.mulConst(triple.B, dv))
+	z = params.AddShare(z, params.mulConst(triple.A, ev))
+	return params.addConst(z, role == Sender, new(big.Int).Mul(dv, ev))
+}
+
+// beaverProductCT implements beaverProduct with the constant-time
+// Montgomery arithmetic.
+func (params *Params) beaverProductCT(role Role, triple *Triple,
+	dv, ev *big.Int) *Share {
+
+	f := params.field
+	d := f.toMont(dv)
+	e := f.toMont(ev)
+	de := f.mul(d, e)
+
+	combine := func(a, b, c *big.Int) fieldElement {
+		z := f.add(f.toMont(c), f.mul(d, f.toMont(b)))
+		return f.add(z, f.mul(e, f.toMont(a)))
+	}
+
+	v := combine(triple.A.V, triple.B.V, triple.C.V)
+	if role == Sender {
+		v = f.add(v, de)
+	}
+	z := &Share{
+		V: f.fromMont(v),
+	}
+	// Like addConst, the product carries a MAC only with a MAC key.
+	if params.alpha != nil && triple.A.MAC != nil && triple.B.MAC != nil &&
+		triple.C.MAC != nil {
+		m := combine(triple.A.MAC, triple.B.MAC, triple.C.MAC)
+		m = f.add(m, f.mul(f.toMont(params.alpha), de))
+		z.MAC = f.fromMont(m)
+	}
+	return z
+}
+
+func (params *Params) safeMul(conn *p2p.Conn, role Role, a, b *Share,
+	triples []*Triple, tripleIndex *int) (*Share, error) {
 
 	if *tripleIndex >= len(triples) {
 		return nil, errors.New("not enough triples for multiplication")
 	}
 	t := triples[*tripleIndex]
-	res, err := MulShare(conn, role, a, b, t)
+	res, err := params.MulShare(conn, role, a, b, t)
 	if err != nil {
 		return nil, err
 	}
@@ -196,19 +612,15 @@ func safeMul(conn *p2p.Conn, role Role, a, b *Share, triples []*Triple,
 // ExpShare computes [x]^exponent (exponent is public) using
 // square-and-multiply.  It uses Beaver triples provided in 'triples'
 // and advances tripleIndex accordingly.
-func ExpShare(conn *p2p.Conn, role Role, x *Share, exponent *big.Int,
-	triples []*Triple, tripleIndex *int) (*Share, error) {
+func (params *Params) ExpShare(conn *p2p.Conn, role Role, x *Share,
+	exponent *big.Int, triples []*Triple, tripleIndex *int) (*Share, error) {
 
 	// Initialize [res] = 1 additive share (peer0 holds 1, peer1 holds 0).
-	var res *Share
-	if role == Sender {
-		res = NewShare(big.NewInt(1))
-	} else {
-		res = NewShare(big.NewInt(0))
-	}
+	res := params.constShare(role, big.NewInt(1))
 
 	// base copy
-	base := NewShare(new(big.Int).Set(x.V))
+	base := params.NewShare(new(big.Int).Set(x.V))
+	base.MAC = x.MAC
 
 	if exponent == nil {
 		return nil, errors.New("nil exponent")
@@ -222,13 +634,84 @@ func ExpShare(conn *p2p.Conn, role Role, x *Share, exponent *big.Int,
 	for i := bitLen - 1; i >= 0; i-- {
 		// square
 		var err error
-		res, err = safeMul(conn, role, res, res, triples, tripleIndex)
+		res, err = params.safeMul(conn, role, res, res, triples, tripleIndex)
 		if err != nil {
 			return nil, err
 		}
 		// if bit set, multiply by base
 		if exponent.Bit(i) == 1 {
-			res, err = safeMul(conn, role, res, base, triples, tripleIndex)
+			res, err = params.safeMul(conn, role, res, base, triples,
+				tripleIndex)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// ExpShareWindow computes [x]^exponent (exponent is public) with
+// fixed-window exponentiation. The function precomputes the shared
+// powers [x]^2..[x]^d for the largest window value d of the exponent
+// and processes the exponent window bits at a time, with window
+// squarings and at most one multiplication per window. The window
+// size must be between 1 and 8 bits. With a 4-bit window, the
+// exponentiation by a 256-bit exponent consumes at most 14+252+63
+// triples, compared to up to 512 triples with ExpShare.
+func (params *Params) ExpShareWindow(conn *p2p.Conn, role Role, x *Share,
+	exponent *big.Int, window int, triples []*Triple, tripleIndex *int) (
+	*Share, error) {
+
+	if exponent == nil {
+		return nil, errors.New("nil exponent")
+	}
+	if window < 1 || window > 8 {
+		return nil, fmt.Errorf("invalid window size: %d", window)
+	}
+	if exponent.Sign() == 0 {
+		return params.constShare(role, big.NewInt(1)), nil
+	}
+
+	// Split the exponent into window values, most significant first.
+	numDigits := (exponent.BitLen() + window - 1) / window
+	digits := make([]int, numDigits)
+	var maxDigit int
+	for i := range digits {
+		var d int
+		for j := window - 1; j >= 0; j-- {
+			d = d<<1 | int(exponent.Bit((numDigits-1-i)*window+j))
+		}
+		digits[i] = d
+		maxDigit = max(maxDigit, d)
+	}
+
+	// Precompute the powers of the base.
+	powers := make([]*Share, maxDigit+1)
+	powers[1] = params.NewShare(new(big.Int).Set(x.V))
+	powers[1].MAC = x.MAC
+	for i := 2; i <= maxDigit; i++ {
+		p, err := params.safeMul(conn, role, powers[i-1], powers[1], triples,
+			tripleIndex)
+		if err != nil {
+			return nil, err
+		}
+		powers[i] = p
+	}
+
+	// The most significant window is non-zero.
+	res := powers[digits[0]]
+	for _, d := range digits[1:] {
+		var err error
+		for j := 0; j < window; j++ {
+			res, err = params.safeMul(conn, role, res, res, triples,
+				tripleIndex)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if d != 0 {
+			res, err = params.safeMul(conn, role, res, powers[d], triples,
+				tripleIndex)
 			if err != nil {
 				return nil, err
 			}
@@ -238,167 +721,542 @@ func ExpShare(conn *p2p.Conn, role Role, x *Share, exponent *big.Int,
 }
 
 // InvShare computes multiplicative inverse via Fermat: x^(p-2)
-func InvShare(conn *p2p.Conn, role Role, x *Share, triples []*Triple,
-	tripleIndex *int) (*Share, error) {
+func (params *Params) InvShare(conn *p2p.Conn, role Role, x *Share,
+	triples []*Triple, tripleIndex *int) (*Share, error) {
 
-	exp := new(big.Int).Sub(p256P, big.NewInt(2))
-	return ExpShare(conn, role, x, exp, triples, tripleIndex)
+	exp := new(big.Int).Sub(params.P, big.NewInt(2))
+	return params.ExpShare(conn, role, x, exp, triples, tripleIndex)
 }
 
-// SPDZPointAdd implements point addition in SPDZ.
-func SPDZPointAdd(conn *p2p.Conn, role Role, x1, y1, x2, y2 *Share,
-	triples []*Triple, tripleIndex *int) (*Share, *Share, error) {
+// InvShareMasked computes the multiplicative inverse of x with a
+// random mask r: it opens u = x*r, inverts u in the clear, and
+// computes x^-1 = u^-1 * r. The inversion takes one multiplication
+// and one opening, compared to about 1.5*log2(P) sequential
+// multiplications with InvShare. The opened u reveals only whether x
+// is zero, in which case the function returns an error. The function
+// consumes one Beaver triple and one more for the mask with
+// authenticated shares.
+func (params *Params) InvShareMasked(conn *p2p.Conn, role Role, x *Share,
+	triples []*Triple, tripleIndex *int) (*Share, error) {
+
+	invs, err := params.BatchInverse(conn, role, []*Share{x}, triples,
+		tripleIndex)
+	if err != nil {
+		return nil, err
+	}
+	return invs[0], nil
+}
+
+// BatchInverse computes the multiplicative inverses of all shares
+// xs with Montgomery's batch inversion trick. The function computes
+// the prefix products of xs, inverts the full product with a single
+// mask-and-open inversion, and distributes the inverse back to the
+// individual elements. The batch inversion of n elements consumes
+// 3n-2 Beaver triples, compared to about 1.5*log2(P) triples per
+// element with InvShare.
+//
+// The function returns an error if any of the elements is zero. This
+// reveals that the product of the elements is zero but nothing else
+// about the individual elements.
+func (params *Params) BatchInverse(conn *p2p.Conn, role Role, xs []*Share,
+	triples []*Triple, tripleIndex *int) ([]*Share, error) {
+
+	n := len(xs)
+	if n == 0 {
+		return nil, nil
+	}
+
+	// Prefix products p[i] = x[0]*...*x[i].
+	prefix := make([]*Share, n)
+	prefix[0] = xs[0]
+	for i := 1; i < n; i++ {
+		var err error
+		prefix[i], err = params.safeMul(conn, role, prefix[i-1], xs[i],
+			triples, tripleIndex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Invert the product: open u = p*r for a random r and compute
+	// p^-1 = u^-1 * r.
+	r, err := params.randomMask(triples, tripleIndex)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := params.safeMul(conn, role, prefix[n-1], r, triples,
+		tripleIndex)
+	if err != nil {
+		return nil, err
+	}
+	u, err := params.open(conn, role, []*Share{pr})
+	if err != nil {
+		return nil, err
+	}
+	if u[0].Sign() == 0 {
+		return nil, errNotInvertible
+	}
+	uInv := new(big.Int).ModInverse(u[0], params.P)
+	inv := params.mulConst(r, uInv)
+
+	// Distribute the inverse: x[i]^-1 = (x[0]*...*x[i])^-1 *
+	// p[i-1] and (x[0]*...*x[i-1])^-1 = (x[0]*...*x[i])^-1 * x[i].
+	result := make([]*Share, n)
+	for i := n - 1; i > 0; i-- {
+		prods, err := params.mulMany(conn, role,
+			[]*Share{inv, inv}, []*Share{prefix[i-1], xs[i]},
+			triples, tripleIndex)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = prods[0]
+		inv = prods[1]
+	}
+	result[0] = inv
+
+	return result, nil
+}
+
+// randomMask returns a share of a random mask value. With
+// authenticated shares, the mask is the A share of the next triple.
+func (params *Params) randomMask(triples []*Triple, tripleIndex *int) (
+	*Share, error) {
+
+	if params.alpha != nil {
+		if *tripleIndex >= len(triples) {
+			return nil, errors.New("not enough triples for mask")
+		}
+		r := triples[*tripleIndex].A
+		*tripleIndex++
+		return r, nil
+	}
+	rv, err := params.randomFieldElement(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return params.NewShare(rv), nil
+}
+
+// isZero tests if the shared value x is zero. The function opens x*r
+// for a random r which reveals only whether x is zero.
+func (params *Params) isZero(conn *p2p.Conn, role Role, x *Share,
+	triples []*Triple, tripleIndex *int) (bool, error) {
+
+	r, err := params.randomMask(triples, tripleIndex)
+	if err != nil {
+		return false, err
+	}
+	xr, err := params.safeMul(conn, role, x, r, triples, tripleIndex)
+	if err != nil {
+		return false, err
+	}
+	v, err := params.open(conn, role, []*Share{xr})
+	if err != nil {
+		return false, err
+	}
+	return v[0].Sign() == 0, nil
+}
+
+// mulMany computes the products a[i]*b[i] with one opening round.
+func (params *Params) mulMany(conn *p2p.Conn, role Role, a, b []*Share,
+	triples []*Triple, tripleIndex *int) ([]*Share, error) {
+
+	n := len(a)
+	if *tripleIndex+n > len(triples) {
+		return nil, errors.New("not enough triples for multiplication")
+	}
+	ts := triples[*tripleIndex : *tripleIndex+n]
+
+	masked := make([]*Share, 0, 2*n)
+	for i := 0; i < n; i++ {
+		masked = append(masked, params.SubShare(a[i], ts[i].A))
+		masked = append(masked, params.SubShare(b[i], ts[i].B))
+	}
+	opened, err := params.open(conn, role, masked)
+	if err != nil {
+		return nil, err
+	}
+	*tripleIndex += n
+
+	result := make([]*Share, n)
+	for i := 0; i < n; i++ {
+		result[i] = params.beaverProduct(role, ts[i], opened[2*i],
+			opened[2*i+1])
+	}
+	return result, nil
+}
+
+// PointAdd implements point addition in SPDZ. If the points are each
+// other's inverses, their sum is the point at infinity and the
+// function sets the infinity flag and returns zero shares for the
+// coordinates. The inversion of x2-x1 with InvShareMasked opens the
+// masked difference which reveals only whether x1 == x2. In that
+// case, the function opens the masked sum y1+y2 which reveals only
+// whether the result is the point at infinity. Adding a point to
+// itself is not supported.
+func (params *Params) PointAdd(conn *p2p.Conn, role Role,
+	x1, y1, x2, y2 *Share, triples []*Triple, tripleIndex *int) (
+	x3, y3 *Share, infinity bool, err error) {
 
 	// dx = x2 - x1 ; dy = y2 - y1
-	dx := SubShare(x2, x1)
-	dy := SubShare(y2, y1)
+	dx := params.SubShare(x2, x1)
+	dy := params.SubShare(y2, y1)
 
 	// invDx = inv(dx) inside MPC
-	invDx, err := InvShare(conn, role, dx, triples, tripleIndex)
+	invDx, err := params.InvShareMasked(conn, role, dx, triples, tripleIndex)
+	if errors.Is(err, errNotInvertible) {
+		// x1 == x2 so the points are equal or each other's inverses.
+		zero, err := params.isZero(conn, role, params.AddShare(y1, y2),
+			triples, tripleIndex)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if !zero {
+			return nil, nil, false, errors.New("point doubling not supported")
+		}
+		return params.constShare(role, new(big.Int)),
+			params.constShare(role, new(big.Int)), true, nil
+	}
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, false, err
 	}
 
 	// lam = dy * invDx
 	if *tripleIndex >= len(triples) {
-		return nil, nil, errors.New("not enough triples for lam")
+		return nil, nil, false, errors.New("not enough triples for lam")
 	}
-	lam, err := MulShare(conn, role, dy, invDx, triples[*tripleIndex])
+	lam, err := params.MulShare(conn, role, dy, invDx, triples[*tripleIndex])
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, false, err
 	}
 	*tripleIndex++
 
 	// lam2 = lam * lam
 	if *tripleIndex >= len(triples) {
-		return nil, nil, errors.New("not enough triples for lam2")
+		return nil, nil, false, errors.New("not enough triples for lam2")
 	}
-	lam2, err := MulShare(conn, role, lam, lam, triples[*tripleIndex])
+	lam2, err := params.MulShare(conn, role, lam, lam, triples[*tripleIndex])
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, false, err
 	}
 	*tripleIndex++
 
 	// x3 = lam2 - x1 - x2
-	tmp := SubShare(lam2, x1)
-	x3 := SubShare(tmp, x2)
+	tmp := params.SubShare(lam2, x1)
+	x3 = params.SubShare(tmp, x2)
 
 	// y3 = lam*(x1 - x3) - y1
-	diff := SubShare(x1, x3)
+	diff := params.SubShare(x1, x3)
 	if *tripleIndex >= len(triples) {
-		return nil, nil, errors.New("not enough triples for lam*diff")
+		return nil, nil, false, errors.New("not enough triples for lam*diff")
 	}
-	prod, err := MulShare(conn, role, lam, diff, triples[*tripleIndex])
+	prod, err := params.MulShare(conn, role, lam, diff, triples[*tripleIndex])
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, false, err
 	}
 	*tripleIndex++
-	y3 := SubShare(prod, y1)
+	y3 = params.SubShare(prod, y1)
 
-	return x3, y3, nil
+	return x3, y3, false, nil
 }
 
 // ShareInput shares the input point to the peer:
 //   - if owner==true => mask with random s and send o = val - s to peer;
 //     return local s.
 //   - if owner==false => receive o and use as local share.
-func ShareInput(conn *p2p.Conn, owner bool, val *big.Int) (*Share, error) {
+//
+// If mask is not nil, the input is authenticated with the
+// authenticated random mask [r], e.g. the A share of an unused triple:
+// the peer sends its share of r to the owner, the owner sends
+// ε = val - r to the peer, and both parties compute [val] = [r] + ε.
+// The mask must not be used for anything else.
+func (params *Params) ShareInput(conn *p2p.Conn, owner bool, val *big.Int,
+	mask *Share) (*Share, error) {
 
+	if mask != nil {
+		return params.shareAuthInput(conn, owner, val, mask)
+	}
 	if owner {
-		s, err := randomFieldElement(rand.Reader)
+		s, err := params.randomFieldElement(rand.Reader)
 		if err != nil {
 			return nil, err
 		}
-		o := new(big.Int).Sub(modReduce(val), s)
-		o.Mod(o, p256P)
-		if err := sendField(conn, o); err != nil {
+		o := new(big.Int).Sub(params.modReduce(val), s)
+		o.Mod(o, params.P)
+		if err := params.sendField(conn, o); err != nil {
 			return nil, err
 		}
 		if err := conn.Flush(); err != nil {
 			return nil, err
 		}
-		return NewShare(s), nil
+		return params.NewShare(s), nil
 	} else {
 		o, err := recvField(conn)
 		if err != nil {
 			return nil, err
 		}
-		return NewShare(o), nil
+		return params.NewShare(o), nil
 	}
 }
 
+func (params *Params) shareAuthInput(conn *p2p.Conn, owner bool,
+	val *big.Int, mask *Share) (*Share, error) {
+
+	if owner {
+		peer, err := recvField(conn)
+		if err != nil {
+			return nil, err
+		}
+		eps := new(big.Int).Sub(val, mask.V)
+		eps = params.modReduce(eps.Sub(eps, peer))
+		if err := params.sendField(conn, eps); err != nil {
+			return nil, err
+		}
+		if err := conn.Flush(); err != nil {
+			return nil, err
+		}
+		return params.addConst(mask, true, eps), nil
+	}
+	if err := params.sendField(conn, mask.V); err != nil {
+		return nil, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	eps, err := recvField(conn)
+	if err != nil {
+		return nil, err
+	}
+	return params.addConst(mask, false, eps), nil
+}
+
 // P256Add implements P-256 point addition. Each peer supplies only
 // its own point that is secret shared with the peeer.
 func P256Add(role Role, conn *p2p.Conn, xInput, yInput *big.Int) (
 	xOut, yOut *big.Int, err error) {
+	return P256.Add(role, conn, xInput, yInput)
+}
 
-	// Init OT roles.
+// P256AddPool implements P-256 point addition with the preloaded
+// triple pool. The macKey is the party's MAC key share of the pool;
+// see Session.SetTriplePool. The function generates the triples if
+// the pool does not have enough triples.
+func P256AddPool(role Role, conn *p2p.Conn, triples []*Triple,
+	macKey, xInput, yInput *big.Int) (xOut, yOut *big.Int, err error) {
 
-	oti := ot.NewCO(rand.Reader)
-	var isOwnerP, isOwnerQ bool
+	session, err := NewSession(conn, role, ot.NewCO(rand.Reader))
+	if err != nil {
+		return nil, nil, err
+	}
+	session.SetTriplePool(triples, macKey)
+	return P256.AddSession(session, xInput, yInput)
+}
 
-	switch role {
-	case Sender:
-		if err := oti.InitSender(conn); err != nil {
-			return nil, nil, err
-		}
-		isOwnerP = true
+// The following functions implement the P-256 share arithmetic with
+// the P256 parameters. See the corresponding Params methods for
+// details.
 
-	case Receiver:
-		if err := oti.InitReceiver(conn); err != nil {
-			return nil, nil, err
-		}
-		isOwnerQ = true
+// NewShare creates a P-256 share of the value v.
+func NewShare(v *big.Int) *Share {
+	return P256.NewShare(v)
+}
+
+// AddShare adds the P-256 shares a and b.
+func AddShare(a, b *Share) *Share {
+	return P256.AddShare(a, b)
+}
+
+// SubShare subtracts the P-256 share b from a.
+func SubShare(a, b *Share) *Share {
+	return P256.SubShare(a, b)
+}
+
+// MulShare computes a*b given P-256 shares and a Beaver triple.
+func MulShare(conn *p2p.Conn, role Role, a, b *Share, triple *Triple) (
+	*Share, error) {
+	return P256.MulShare(conn, role, a, b, triple)
+}
 
-	default:
-		return nil, nil, fmt.Errorf("invalid role: %d", role)
+// ExpShare computes [x]^exponent for the P-256 share x.
+func ExpShare(conn *p2p.Conn, role Role, x *Share, exponent *big.Int,
+	triples []*Triple, tripleIndex *int) (*Share, error) {
+	return P256.ExpShare(conn, role, x, exponent, triples, tripleIndex)
+}
+
+// InvShare computes the multiplicative inverse of the P-256 share x.
+func InvShare(conn *p2p.Conn, role Role, x *Share, triples []*Triple,
+	tripleIndex *int) (*Share, error) {
+	return P256.InvShare(conn, role, x, triples, tripleIndex)
+}
+
+// SPDZPointAdd implements P-256 point addition in SPDZ. The function
+// returns ErrInfinity if the sum is the point at infinity.
+func SPDZPointAdd(conn *p2p.Conn, role Role, x1, y1, x2, y2 *Share,
+	triples []*Triple, tripleIndex *int) (*Share, *Share, error) {
+
+	x3, y3, infinity, err := P256.PointAdd(conn, role, x1, y1, x2, y2,
+		triples, tripleIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if infinity {
+		return nil, nil, ErrInfinity
 	}
+	return x3, y3, nil
+}
 
-	// Share inputs
-	x1Share, err := ShareInput(conn, isOwnerP, xInput)
+// ShareInput shares the P-256 input value val with the peer.
+func ShareInput(conn *p2p.Conn, owner bool, val *big.Int) (*Share, error) {
+	return P256.ShareInput(conn, owner, val, nil)
+}
+
+// ExpandLabelToField converts the label to a P-256 field element.
+func ExpandLabelToField(l ot.Label) *big.Int {
+	return P256.ExpandLabelToField(l)
+}
+
+// GenerateBeaverTriplesOTBatch generates n P-256 triples using
+// batched IKNP and batched bitwise OT.
+func GenerateBeaverTriplesOTBatch(conn *p2p.Conn, oti ot.OT, role Role,
+	n int) ([]*Triple, error) {
+	return P256.GenerateBeaverTriplesOTBatch(conn, oti, role, n)
+}
+
+// CrossMultiplyBatch is a batched version of CrossMultiply with OT
+// for the P-256 triples.
+func CrossMultiplyBatch(conn *p2p.Conn, oti ot.OT, role Role,
+	triples []*Triple) ([]*Share, error) {
+	return P256.CrossMultiplyBatch(conn, oti, role, triples)
+}
+
+// Secp256k1Add implements secp256k1 point addition. Each peer
+// supplies only its own point that is secret shared with the peer.
+func Secp256k1Add(role Role, conn *p2p.Conn, xInput, yInput *big.Int) (
+	xOut, yOut *big.Int, err error) {
+	return Secp256k1.Add(role, conn, xInput, yInput)
+}
+
+// Add implements point addition for the curve. Each peer supplies
+// only its own point that is secret shared with the peer. The
+// function returns the peer's additive shares of the result point,
+// or ErrInfinity if the sum is the point at infinity. The function
+// uses the Chou-Orlandi base OT; see AddOT for selecting the base OT.
+func (params *Params) Add(role Role, conn *p2p.Conn, xInput, yInput *big.Int) (
+	xOut, yOut *big.Int, err error) {
+	return params.AddOT(role, conn, ot.NewCO(rand.Reader), xInput, yInput)
+}
+
+// AddOT implements point addition for the curve with the base OT
+// oti. Both peers must use the same base OT protocol.
+func (params *Params) AddOT(role Role, conn *p2p.Conn, oti ot.OT,
+	xInput, yInput *big.Int) (xOut, yOut *big.Int, err error) {
+
+	session, err := NewSession(conn, role, oti)
 	if err != nil {
 		return nil, nil, err
 	}
-	y1Share, err := ShareInput(conn, isOwnerP, yInput)
+	return params.AddSession(session, xInput, yInput)
+}
+
+// AddTriples is the number of Beaver triples that AddSession consumes
+// per point addition: PointAdd takes at most PointAddTriples triples
+// and isZeroTriples more for testing the point at infinity, and the
+// last addInputMasks triples provide the authenticated input masks.
+const AddTriples = PointAddTriples + isZeroTriples + addInputMasks
+
+// isZeroTriples is the number of Beaver triples that isZero consumes
+// with authenticated shares: one for the mask and one for the
+// multiplication.
+const isZeroTriples = 2
+
+// addInputMasks is the number of authenticated input masks that
+// AddSession takes from its triples.
+const addInputMasks = 4
+
+// AddSession implements point addition for the curve with the
+// session's OT extension. The base OTs are run on the first call of
+// the session and reused on the subsequent calls. If the session has
+// a triple pool with enough triples, AddSession uses the pool instead
+// of generating the triples.
+func (params *Params) AddSession(session *Session, xInput, yInput *big.Int) (
+	xOut, yOut *big.Int, err error) {
+
+	err = session.run(func() error {
+		xOut, yOut, err = params.addSession(session, xInput, yInput)
+		return err
+	})
+	return xOut, yOut, err
+}
+
+func (params *Params) addSession(session *Session, xInput, yInput *big.Int) (
+	xOut, yOut *big.Int, err error) {
+
+	conn := session.conn
+	role := session.role
+	isOwnerP := role == Sender
+	isOwnerQ := role == Receiver
+
+	// Take Beaver triples from the session's pool or generate
+	// them. The live triples are generated in pairs and verified
+	// with Sacrifice.
+	triples, macKey := session.takeTriples(AddTriples)
+	if triples != nil {
+		if macKey != nil {
+			params = params.WithMACKey(macKey)
+		}
+	} else {
+		params = params.WithMACKey(session.MACKey())
+		triples, err = params.generateBeaverTriples(session, 2*AddTriples)
+		if err != nil {
+			return nil, nil, err
+		}
+		triples, err = params.Sacrifice(conn, role, triples)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	masks := triples[AddTriples-addInputMasks:]
+	triples = triples[:AddTriples-addInputMasks]
+
+	// Share inputs
+	x1Share, err := params.ShareInput(conn, isOwnerP, xInput, masks[0].A)
 	if err != nil {
 		return nil, nil, err
 	}
-	x2Share, err := ShareInput(conn, isOwnerQ, xInput)
+	y1Share, err := params.ShareInput(conn, isOwnerP, yInput, masks[1].A)
 	if err != nil {
 		return nil, nil, err
 	}
-	y2Share, err := ShareInput(conn, isOwnerQ, yInput)
+	x2Share, err := params.ShareInput(conn, isOwnerQ, xInput, masks[2].A)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	// Generate Beaver triples. This is a safe upper bound for
-	// inversion + intermediate multiplications
-	triplesNeeded := 1400
-	triples, err := GenerateBeaverTriplesOTBatch(conn, oti, role, triplesNeeded)
+	y2Share, err := params.ShareInput(conn, isOwnerQ, yInput, masks[3].A)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// Run SPDZ point-add
 	tripleIndex := 0
-	x3Share, y3Share, err := SPDZPointAdd(conn, role, x1Share, y1Share,
-		x2Share, y2Share, triples, &tripleIndex)
+	x3Share, y3Share, infinity, err := params.PointAdd(conn, role,
+		x1Share, y1Share, x2Share, y2Share, triples, &tripleIndex)
 	if err != nil {
 		return nil, nil, err
 	}
+	if infinity {
+		return nil, nil, ErrInfinity
+	}
 
-	return modReduce(x3Share.V), modReduce(y3Share.V), nil
+	return params.modReduce(x3Share.V), params.modReduce(y3Share.V), nil
 }
 
 // ExpandLabelToField interprets the 16-byte Label as a 128-bit
-// big.Int and reduces it modulo p256P to produce a valid field
-// element.
-func ExpandLabelToField(l ot.Label) *big.Int {
+// big.Int and reduces it modulo P to produce a valid field element.
+func (params *Params) ExpandLabelToField(l ot.Label) *big.Int {
 	var d ot.LabelData
 	l.GetData(&d)
 	x := new(big.Int).SetBytes(d[:])
-	x.Mod(x, p256P)
+	x.Mod(x, params.P)
 	return x
 }
 
@@ -7,15 +7,21 @@
 package spdz
 
 import (
+	"crypto/elliptic"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/markkurossi/mpc/ot"
 	"github.com/markkurossi/mpc/p2p"
 )
 
+var curve = elliptic.P256()
+
 var wellKnown = []struct {
 	gx string
 	gy string
@@ -61,14 +67,14 @@ func TestP256WellKnown(t *testing.T) {
 			t.Fatalf("invalid ry")
 		}
 
-		err := testAdd(gx, gy, ex, ey, rx, ry)
+		err := testAdd(P256, gx, gy, ex, ey, rx, ry)
 		if err != nil {
 			t.Fatal(err)
 		}
 	}
 }
 
-func testAdd(gx, gy, ex, ey, rx, ry *big.Int) error {
+func testAdd(params *Params, gx, gy, ex, ey, rx, ry *big.Int) error {
 
 	gConn, eConn := p2p.Pipe()
 	var wg sync.WaitGroup
@@ -77,10 +83,10 @@ func testAdd(gx, gy, ex, ey, rx, ry *big.Int) error {
 	var rex, rey *big.Int
 
 	wg.Go(func() {
-		rex, rey, eErr = P256Add(1, eConn, ex, ey)
+		rex, rey, eErr = params.Add(Receiver, eConn, ex, ey)
 	})
 
-	rgx, rgy, err := P256Add(0, gConn, gx, gy)
+	rgx, rgy, err := params.Add(Sender, gConn, gx, gy)
 	if err != nil {
 		return err
 	}
@@ -91,8 +97,8 @@ func testAdd(gx, gy, ex, ey, rx, ry *big.Int) error {
 		return eErr
 	}
 
-	crx := add(rgx, rex)
-	cry := add(rgy, rey)
+	crx := add(params, rgx, rex)
+	cry := add(params, rgy, rey)
 
 	if crx.Cmp(rx) != 0 {
 		return fmt.Errorf("computed x mismatch: %s != %s",
@@ -107,53 +113,920 @@ func testAdd(gx, gy, ex, ey, rx, ry *big.Int) error {
 
 func TestRandomPoints(t *testing.T) {
 	for i := 0; i < 5; i++ {
-		gx, gy, err := randomPoint()
+		gx, gy, err := randomPoint(curve)
 		if err != nil {
 			t.Fatal(err)
 		}
-		ex, ey, err := randomPoint()
+		ex, ey, err := randomPoint(curve)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rx, ry := curve.Add(gx, gy, ex, ey)
 
-		err = testAdd(gx, gy, ex, ey, rx, ry)
+		err = testAdd(P256, gx, gy, ex, ey, rx, ry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSecp256k1RandomPoints(t *testing.T) {
+	k1 := btcec.S256()
+	for i := 0; i < 5; i++ {
+		gx, gy, err := randomPoint(k1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ex, ey, err := randomPoint(k1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rx, ry := k1.Add(gx, gy, ex, ey)
+
+		err = testAdd(Secp256k1, gx, gy, ex, ey, rx, ry)
 		if err != nil {
 			t.Fatal(err)
 		}
 	}
 }
 
+func TestP384RandomPoints(t *testing.T) {
+	p384 := elliptic.P384()
+	for i := 0; i < 2; i++ {
+		gx, gy, err := randomPoint(p384)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ex, ey, err := randomPoint(p384)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rx, ry := p384.Add(gx, gy, ex, ey)
+
+		err = testAdd(P384, gx, gy, ex, ey, rx, ry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, ok := CurveByName("P-384")
+	if !ok || p != P384 {
+		t.Errorf("P-384 not registered")
+	}
+}
+
+func TestSecp256k1Params(t *testing.T) {
+	params := btcec.S256().Params()
+	if Secp256k1.P.Cmp(params.P) != 0 || Secp256k1.N.Cmp(params.N) != 0 ||
+		Secp256k1.B.Cmp(params.B) != 0 || Secp256k1.Gx.Cmp(params.Gx) != 0 ||
+		Secp256k1.Gy.Cmp(params.Gy) != 0 {
+		t.Errorf("secp256k1 parameters mismatch")
+	}
+	p, ok := CurveByName("secp256k1")
+	if !ok || p != Secp256k1 {
+		t.Errorf("secp256k1 not registered")
+	}
+}
+
 func BenchmarkP256Add(b *testing.B) {
-	gx, gy, err := randomPoint()
+	gx, gy, err := randomPoint(curve)
 	if err != nil {
 		b.Fatal(err)
 	}
-	ex, ey, err := randomPoint()
+	ex, ey, err := randomPoint(curve)
 	if err != nil {
 		b.Fatal(err)
 	}
 	rx, ry := curve.Add(gx, gy, ex, ey)
 
 	for b.Loop() {
-		err = testAdd(gx, gy, ex, ey, rx, ry)
+		err = testAdd(P256, gx, gy, ex, ey, rx, ry)
 		if err != nil {
 			b.Fatal(err)
 		}
 	}
 }
 
-func randomPoint() (*big.Int, *big.Int, error) {
-	r, err := rand.Int(rand.Reader, curveParams.N)
+func randomPoint(c elliptic.Curve) (*big.Int, *big.Int, error) {
+	r, err := rand.Int(rand.Reader, c.Params().N)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	x, y := curve.ScalarBaseMult(r.Bytes())
+	x, y := c.ScalarBaseMult(r.Bytes())
 	return x, y, nil
 }
 
-func add(x, y *big.Int) *big.Int {
+func add(params *Params, x, y *big.Int) *big.Int {
 	r := new(big.Int).Add(x, y)
-	return new(big.Int).Mod(r, p256P)
+	return new(big.Int).Mod(r, params.P)
+}
+
+func TestOpenMany(t *testing.T) {
+	params := P256
+	n := 100
+
+	values := make([]*big.Int, n)
+	gShares := make([]*Share, n)
+	eShares := make([]*Share, n)
+	for i := 0; i < n; i++ {
+		v, err := params.randomFieldElement(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := params.randomFieldElement(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[i] = v
+		gShares[i] = params.NewShare(g)
+		eShares[i] = params.NewShare(new(big.Int).Sub(v, g))
+	}
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var eErr error
+	var eValues, eSingle []*big.Int
+
+	wg.Go(func() {
+		eValues, eErr = params.OpenMany(eConn, Receiver, eShares)
+		if eErr != nil {
+			return
+		}
+		for i := 0; i < n; i += 2 {
+			v1, v2, err := params.openTwoShares(eConn, Receiver,
+				eShares[i], eShares[i+1])
+			if err != nil {
+				eErr = err
+				return
+			}
+			eSingle = append(eSingle, v1, v2)
+		}
+	})
+
+	gValues, err := params.OpenMany(gConn, Sender, gShares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gSingle []*big.Int
+	for i := 0; i < n; i += 2 {
+		v1, v2, err := params.openTwoShares(gConn, Sender,
+			gShares[i], gShares[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		gSingle = append(gSingle, v1, v2)
+	}
+	wg.Wait()
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+
+	for i := 0; i < n; i++ {
+		if gValues[i].Cmp(values[i]) != 0 {
+			t.Errorf("value %v: got %x, expected %x", i, gValues[i], values[i])
+		}
+		if eValues[i].Cmp(values[i]) != 0 {
+			t.Errorf("value %v: got %x, expected %x", i, eValues[i], values[i])
+		}
+		if gSingle[i].Cmp(gValues[i]) != 0 || eSingle[i].Cmp(gValues[i]) != 0 {
+			t.Errorf("value %v: batched and single open mismatch", i)
+		}
+	}
+}
+
+func TestBatchInverse(t *testing.T) {
+	params := P256
+	n := 8
+
+	gShares := make([]*Share, n)
+	eShares := make([]*Share, n)
+	for i := 0; i < n; i++ {
+		v, err := params.randomFieldElement(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := params.randomFieldElement(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gShares[i] = params.NewShare(g)
+		eShares[i] = params.NewShare(new(big.Int).Sub(v, g))
+	}
+
+	// 3n-2 triples for the inversion and n triples for the check.
+	numTriples := 4*n - 2
+
+	run := func(conn *p2p.Conn, role Role, xs []*Share) ([]*big.Int, error) {
+		triples, err := params.GenerateBeaverTriplesOTBatch(conn,
+			ot.NewCO(rand.Reader), role, numTriples)
+		if err != nil {
+			return nil, err
+		}
+		var tripleIndex int
+		invs, err := params.BatchInverse(conn, role, xs, triples,
+			&tripleIndex)
+		if err != nil {
+			return nil, err
+		}
+		if tripleIndex != 3*n-2 {
+			return nil, fmt.Errorf("used %v triples, expected %v",
+				tripleIndex, 3*n-2)
+		}
+		prods, err := params.mulMany(conn, role, xs, invs, triples,
+			&tripleIndex)
+		if err != nil {
+			return nil, err
+		}
+		return params.OpenMany(conn, role, prods)
+	}
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var eErr error
+	wg.Go(func() {
+		_, eErr = run(eConn, Receiver, eShares)
+	})
+	values, err := run(gConn, Sender, gShares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	for i, v := range values {
+		if v.Cmp(big.NewInt(1)) != 0 {
+			t.Errorf("x[%v]*inv(x[%v])=%v, expected 1", i, i, v)
+		}
+	}
+}
+
+// authShares splits the values into authenticated shares for the
+// MAC key shares alpha0 and alpha1.
+func authShares(t *testing.T, params *Params, alpha0, alpha1 *big.Int,
+	values []*big.Int) ([]*Share, []*Share) {
+
+	alpha := new(big.Int).Add(alpha0, alpha1)
+
+	gShares := make([]*Share, len(values))
+	eShares := make([]*Share, len(values))
+	for i, v := range values {
+		g, err := params.randomFieldElement(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := params.randomFieldElement(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac := new(big.Int).Mul(alpha, v)
+		gShares[i] = &Share{
+			V:   g,
+			MAC: m,
+		}
+		eShares[i] = &Share{
+			V:   params.modReduce(new(big.Int).Sub(v, g)),
+			MAC: params.modReduce(mac.Sub(mac, m)),
+		}
+	}
+	return gShares, eShares
+}
+
+func randomValues(t *testing.T, params *Params, n int) []*big.Int {
+	values := make([]*big.Int, n)
+	for i := 0; i < n; i++ {
+		v, err := params.randomFieldElement(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[i] = v
+	}
+	return values
+}
+
+func TestOpenMAC(t *testing.T) {
+	values := randomValues(t, P256, 10)
+	keys := randomValues(t, P256, 2)
+	gParams := P256.WithMACKey(keys[0])
+	eParams := P256.WithMACKey(keys[1])
+
+	gShares, eShares := authShares(t, P256, keys[0], keys[1], values)
+
+	open := func() ([]*big.Int, []*big.Int, error, error) {
+		gConn, eConn := p2p.Pipe()
+		var wg sync.WaitGroup
+
+		var eErr error
+		var eValues []*big.Int
+		wg.Go(func() {
+			eValues, eErr = eParams.Open(eConn, Receiver, eShares)
+		})
+		gValues, gErr := gParams.Open(gConn, Sender, gShares)
+		wg.Wait()
+		return gValues, eValues, gErr, eErr
+	}
+
+	gValues, eValues, gErr, eErr := open()
+	if gErr != nil {
+		t.Fatal(gErr)
+	}
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	for i := range values {
+		if gValues[i].Cmp(values[i]) != 0 || eValues[i].Cmp(values[i]) != 0 {
+			t.Errorf("value %v: got %x/%x, expected %x", i,
+				gValues[i], eValues[i], values[i])
+		}
+	}
+
+	tests := []struct {
+		name   string
+		tamper func()
+	}{
+		{
+			name: "value",
+			tamper: func() {
+				eShares[3].V = P256.modReduce(
+					new(big.Int).Add(eShares[3].V, big.NewInt(1)))
+			},
+		},
+		{
+			name: "mac",
+			tamper: func() {
+				gShares[3].MAC = P256.modReduce(
+					new(big.Int).Add(gShares[3].MAC, big.NewInt(1)))
+			},
+		},
+	}
+	for _, test := range tests {
+		gShares, eShares = authShares(t, P256, keys[0], keys[1], values)
+		test.tamper()
+
+		_, _, gErr, eErr = open()
+		for _, err := range []error{gErr, eErr} {
+			var macErr *MACError
+			if !errors.As(err, &macErr) {
+				t.Errorf("%v: got %v, expected MAC error", test.name, err)
+				continue
+			}
+			if macErr.Index != 3 {
+				t.Errorf("%v: got index %v, expected 3", test.name,
+					macErr.Index)
+			}
+		}
+	}
+
+	_, err := P256.Open(nil, Sender, gShares)
+	if err == nil {
+		t.Errorf("Open succeeded without MAC key")
+	}
+}
+
+func TestMulShareMAC(t *testing.T) {
+	// Values x, y, a, b, a*b.
+	values := randomValues(t, P256, 4)
+	values = append(values, P256.modReduce(
+		new(big.Int).Mul(values[2], values[3])))
+	keys := randomValues(t, P256, 2)
+	gParams := P256.WithMACKey(keys[0])
+	eParams := P256.WithMACKey(keys[1])
+
+	gShares, eShares := authShares(t, P256, keys[0], keys[1], values)
+
+	mul := func(params *Params, conn *p2p.Conn, role Role, s []*Share) (
+		[]*big.Int, error) {
+
+		z, err := params.MulShare(conn, role, s[0], s[1], &Triple{
+			A: s[2],
+			B: s[3],
+			C: s[4],
+		})
+		if err != nil {
+			return nil, err
+		}
+		z = params.addConst(z, role == Sender, big.NewInt(7))
+		return params.Open(conn, role, []*Share{z})
+	}
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var eErr error
+	wg.Go(func() {
+		_, eErr = mul(eParams, eConn, Receiver, eShares)
+	})
+	result, err := mul(gParams, gConn, Sender, gShares)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	expected := new(big.Int).Mul(values[0], values[1])
+	expected = P256.modReduce(expected.Add(expected, big.NewInt(7)))
+	if result[0].Cmp(expected) != 0 {
+		t.Errorf("got %x, expected %x", result[0], expected)
+	}
+}
+
+func TestAuthenticatedTriples(t *testing.T) {
+	keys := randomValues(t, P256, 2)
+	gParams := P256.WithMACKey(keys[0])
+	eParams := P256.WithMACKey(keys[1])
+	n := 10
+
+	run := func(params *Params, conn *p2p.Conn, role Role) (
+		[]*big.Int, error) {
+
+		triples, err := params.GenerateBeaverTriplesOTBatch(conn,
+			OTInsecure.New(rand.Reader), role, n)
+		if err != nil {
+			return nil, err
+		}
+		var shares []*Share
+		for _, t := range triples {
+			shares = append(shares, t.A, t.B, t.C)
+		}
+		return params.Open(conn, role, shares)
+	}
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var eErr error
+	wg.Go(func() {
+		_, eErr = run(eParams, eConn, Receiver)
+	})
+	values, err := run(gParams, gConn, Sender)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	for i := 0; i < n; i++ {
+		ab := new(big.Int).Mul(values[3*i], values[3*i+1])
+		if P256.modReduce(ab).Cmp(values[3*i+2]) != 0 {
+			t.Errorf("triple %v: c != a*b", i)
+		}
+	}
+}
+
+func TestPointAddInfinity(t *testing.T) {
+	x, y, err := randomPoint(curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	negY := new(big.Int).Sub(P256.P, y)
+
+	add := func(ex, ey *big.Int) (error, error) {
+		gConn, eConn := p2p.Pipe()
+		var wg sync.WaitGroup
+
+		var eErr error
+		wg.Go(func() {
+			_, _, eErr = P256.AddOT(Receiver, eConn,
+				OTInsecure.New(rand.Reader), ex, ey)
+		})
+		_, _, gErr := P256.AddOT(Sender, gConn,
+			OTInsecure.New(rand.Reader), x, y)
+		wg.Wait()
+		return gErr, eErr
+	}
+
+	// P + -P
+	gErr, eErr := add(x, negY)
+	if !errors.Is(gErr, ErrInfinity) || !errors.Is(eErr, ErrInfinity) {
+		t.Errorf("got %v/%v, expected %v", gErr, eErr, ErrInfinity)
+	}
+
+	// P + P
+	gErr, eErr = add(x, y)
+	if gErr == nil || eErr == nil ||
+		errors.Is(gErr, ErrInfinity) || errors.Is(eErr, ErrInfinity) {
+		t.Errorf("got %v/%v, expected doubling error", gErr, eErr)
+	}
+}
+
+func TestNotEnoughTriples(t *testing.T) {
+	params := P256
+	x1, y1, err := randomPoint(curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x2, y2, err := randomPoint(curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The all-zero triples are valid, although insecure, triples.
+	zeroTriples := func(n int) []*Triple {
+		var triples []*Triple
+		for i := 0; i < n; i++ {
+			triples = append(triples, &Triple{
+				A: params.NewShare(new(big.Int)),
+				B: params.NewShare(new(big.Int)),
+				C: params.NewShare(new(big.Int)),
+			})
+		}
+		return triples
+	}
+
+	run := func(conn *p2p.Conn, role Role, values []*big.Int) error {
+		var shares []*Share
+		for _, v := range values {
+			if role == Receiver {
+				v = new(big.Int)
+			}
+			shares = append(shares, params.NewShare(v))
+		}
+		var tripleIndex int
+		_, _, _, err := params.PointAdd(conn, role,
+			shares[0], shares[1], shares[2], shares[3],
+			zeroTriples(2), &tripleIndex)
+		return err
+	}
+	values := []*big.Int{x1, y1, x2, y2}
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var eErr error
+	wg.Go(func() {
+		eErr = run(eConn, Receiver, values)
+	})
+	gErr := run(gConn, Sender, values)
+	wg.Wait()
+
+	if gErr == nil || eErr == nil {
+		t.Errorf("got %v/%v, expected error", gErr, eErr)
+	}
+}
+
+func TestInvShareMasked(t *testing.T) {
+	params := P256
+	values := randomValues(t, params, 4)
+	values = append(values, big.NewInt(1))
+
+	gShares := make([]*Share, len(values))
+	eShares := make([]*Share, len(values))
+	for i, v := range values {
+		g, err := params.randomFieldElement(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gShares[i] = params.NewShare(g)
+		eShares[i] = params.NewShare(new(big.Int).Sub(v, g))
+	}
+	numTriples := 2 * params.P.BitLen()
+
+	run := func(conn *p2p.Conn, role Role, xs []*Share) ([]*big.Int, error) {
+		triples, err := params.GenerateBeaverTriplesOTBatch(conn,
+			OTInsecure.New(rand.Reader), role, numTriples)
+		if err != nil {
+			return nil, err
+		}
+		var invs []*Share
+		for i, x := range xs {
+			var tripleIndex int
+			inv, err := params.InvShareMasked(conn, role, x, triples,
+				&tripleIndex)
+			if err != nil {
+				return nil, err
+			}
+			invs = append(invs, inv)
+
+			// Compare the last value against the InvShare.
+			if i == len(xs)-1 {
+				inv, err = params.InvShare(conn, role, x, triples,
+					&tripleIndex)
+				if err != nil {
+					return nil, err
+				}
+				invs = append(invs, inv)
+			}
+		}
+		return params.OpenMany(conn, role, invs)
+	}
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var eErr error
+	wg.Go(func() {
+		_, eErr = run(eConn, Receiver, eShares)
+	})
+	invs, err := run(gConn, Sender, gShares)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	for i, v := range values {
+		expected := new(big.Int).ModInverse(v, params.P)
+		if invs[i].Cmp(expected) != 0 {
+			t.Errorf("inv(%x): got %x, expected %x", v, invs[i], expected)
+		}
+	}
+	last := values[len(values)-1]
+	if invs[len(values)].Cmp(new(big.Int).ModInverse(last, params.P)) != 0 {
+		t.Errorf("InvShare(%x) mismatch", last)
+	}
+}
+
+func TestExpShareWindow(t *testing.T) {
+	params := P256
+	values := randomValues(t, params, 2)
+	x := values[0]
+	g := values[1]
+
+	exponents := []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(2),
+		big.NewInt(0x10),
+		big.NewInt(0xbeef),
+		new(big.Int).Sub(params.P, big.NewInt(2)),
+	}
+	windows := []int{1, 4, 5}
+	numTriples := 2 * params.P.BitLen()
+
+	// run computes x^e with ExpShare and ExpShareWindow and returns
+	// the opened results and the numbers of consumed triples.
+	run := func(conn *p2p.Conn, role Role, x *Share, e *big.Int) (
+		[]*big.Int, []int, error) {
+
+		triples, err := params.GenerateBeaverTriplesOTBatch(conn,
+			OTInsecure.New(rand.Reader), role, numTriples)
+		if err != nil {
+			return nil, nil, err
+		}
+		var results []*Share
+		var used []int
+
+		var tripleIndex int
+		r, err := params.ExpShare(conn, role, x, e, triples, &tripleIndex)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, r)
+		used = append(used, tripleIndex)
+
+		for _, window := range windows {
+			tripleIndex = 0
+			r, err = params.ExpShareWindow(conn, role, x, e, window, triples,
+				&tripleIndex)
+			if err != nil {
+				return nil, nil, err
+			}
+			results = append(results, r)
+			used = append(used, tripleIndex)
+		}
+		values, err := params.OpenMany(conn, role, results)
+		return values, used, err
+	}
+
+	for _, e := range exponents {
+		gConn, eConn := p2p.Pipe()
+		var wg sync.WaitGroup
+
+		var eErr error
+		wg.Go(func() {
+			_, _, eErr = run(eConn, Receiver,
+				params.NewShare(params.modReduce(new(big.Int).Sub(x, g))), e)
+		})
+		results, used, err := run(gConn, Sender, params.NewShare(g), e)
+		wg.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if eErr != nil {
+			t.Fatal(eErr)
+		}
+		expected := new(big.Int).Exp(x, e, params.P)
+		for i, r := range results {
+			if r.Cmp(expected) != 0 {
+				t.Errorf("x^%x: result %d: got %x, expected %x", e, i, r,
+					expected)
+			}
+		}
+		for i, window := range windows {
+			// The precomputation pays off for long exponents.
+			if e.BitLen() > 64 && used[i+1] >= used[0] {
+				t.Errorf("x^%x: window %d used %d triples, ExpShare %d",
+					e, window, used[i+1], used[0])
+			}
+			t.Logf("x^%x: window %d: %d triples, ExpShare: %d triples",
+				e, window, used[i+1], used[0])
+		}
+	}
+
+	var tripleIndex int
+	_, err := params.ExpShareWindow(nil, Sender, params.NewShare(x),
+		big.NewInt(3), 9, nil, &tripleIndex)
+	if err == nil {
+		t.Errorf("invalid window accepted")
+	}
+}
+
+func BenchmarkInvShare(b *testing.B) {
+	benchmarkInv(b, P256.InvShare)
+}
+
+func BenchmarkInvShareMasked(b *testing.B) {
+	benchmarkInv(b, P256.InvShareMasked)
+}
+
+type invFunc func(conn *p2p.Conn, role Role, x *Share, triples []*Triple,
+	tripleIndex *int) (*Share, error)
+
+// benchmarkInv benchmarks the inversion function and reports the
+// number of the sender's round trips per inversion.
+func benchmarkInv(b *testing.B, inv invFunc) {
+	params := P256
+	numTriples := 2 * params.P.BitLen()
+
+	gConn, eConn := p2p.Pipe()
+	var gTriples, eTriples []*Triple
+	var eErr error
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		eTriples, eErr = params.GenerateBeaverTriplesOTBatch(eConn,
+			OTInsecure.New(rand.Reader), Receiver, numTriples)
+	})
+	gTriples, err := params.GenerateBeaverTriplesOTBatch(gConn,
+		OTInsecure.New(rand.Reader), Sender, numTriples)
+	wg.Wait()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if eErr != nil {
+		b.Fatal(eErr)
+	}
+	x := params.NewShare(big.NewInt(42))
+	zero := params.NewShare(big.NewInt(0))
+
+	start := gConn.Stats.Flushed.Load()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Go(func() {
+			var tripleIndex int
+			_, eErr = inv(eConn, Receiver, zero, eTriples, &tripleIndex)
+		})
+		var tripleIndex int
+		_, err := inv(gConn, Sender, x, gTriples, &tripleIndex)
+		wg.Wait()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if eErr != nil {
+			b.Fatal(eErr)
+		}
+	}
+	rounds := gConn.Stats.Flushed.Load() - start
+	b.ReportMetric(float64(rounds)/float64(b.N), "rounds/op")
+}
+
+func TestAddTripleBudget(t *testing.T) {
+	x1, y1, err := randomPoint(curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x2, y2, err := randomPoint(curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	negY1 := new(big.Int).Sub(P256.P, y1)
+
+	tests := []struct {
+		x2, y2   *big.Int
+		infinity bool
+		used     int
+	}{
+		{x2, y2, false, PointAddTriples},
+		// The masked inversion fails and isZero tests the sum.
+		{x1, negY1, true, 2 + isZeroTriples},
+	}
+
+	for idx, test := range tests {
+		run := func(conn *p2p.Conn, role Role) (int, bool, error) {
+			session, err := NewSession(conn, role,
+				OTInsecure.New(rand.Reader))
+			if err != nil {
+				return 0, false, err
+			}
+			params := P256.WithMACKey(session.MACKey())
+			triples, err := params.GenerateBeaverTriplesSession(session,
+				AddTriples)
+			if err != nil {
+				return 0, false, err
+			}
+			masks := triples[AddTriples-addInputMasks:]
+			triples = triples[:AddTriples-addInputMasks]
+
+			var shares []*Share
+			for i, v := range []*big.Int{x1, y1, test.x2, test.y2} {
+				owner := (i < 2) == (role == Sender)
+				s, err := params.ShareInput(conn, owner, v, masks[i].A)
+				if err != nil {
+					return 0, false, err
+				}
+				shares = append(shares, s)
+			}
+			var tripleIndex int
+			_, _, infinity, err := params.PointAdd(conn, role,
+				shares[0], shares[1], shares[2], shares[3], triples,
+				&tripleIndex)
+			return tripleIndex, infinity, err
+		}
+
+		gConn, eConn := p2p.Pipe()
+		var wg sync.WaitGroup
+
+		var eErr error
+		wg.Go(func() {
+			_, _, eErr = run(eConn, Receiver)
+		})
+		used, infinity, err := run(gConn, Sender)
+		wg.Wait()
+		if err != nil {
+			t.Fatalf("test%d: %v", idx, err)
+		}
+		if eErr != nil {
+			t.Fatalf("test%d: %v", idx, eErr)
+		}
+		if infinity != test.infinity {
+			t.Errorf("test%d: infinity %v, expected %v", idx, infinity,
+				test.infinity)
+		}
+		if used != test.used {
+			t.Errorf("test%d: used %v triples, expected %v", idx, used,
+				test.used)
+		}
+		if used > AddTriples-addInputMasks {
+			t.Errorf("test%d: used %v triples, budget %v", idx, used,
+				AddTriples-addInputMasks)
+		}
+	}
+}
+
+func TestP256ShareFunctions(t *testing.T) {
+	values := randomValues(t, P256, 2)
+
+	mul := func(conn *p2p.Conn, role Role) (*big.Int, error) {
+		triples, err := GenerateBeaverTriplesOTBatch(conn,
+			OTInsecure.New(rand.Reader), role, 1)
+		if err != nil {
+			return nil, err
+		}
+		var x, y *Share
+		if role == Sender {
+			x, err = ShareInput(conn, true, values[0])
+			if err == nil {
+				y, err = ShareInput(conn, false, nil)
+			}
+		} else {
+			x, err = ShareInput(conn, false, nil)
+			if err == nil {
+				y, err = ShareInput(conn, true, values[1])
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		z, err := MulShare(conn, role, x, y, triples[0])
+		if err != nil {
+			return nil, err
+		}
+		return z.V, nil
+	}
+
+	gConn, eConn := p2p.Pipe()
+	var wg sync.WaitGroup
+
+	var ez *big.Int
+	var eErr error
+	wg.Go(func() {
+		ez, eErr = mul(eConn, Receiver)
+	})
+	gz, err := mul(gConn, Sender)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	result := AddShare(NewShare(gz), NewShare(ez))
+	expected := P256.modReduce(new(big.Int).Mul(values[0], values[1]))
+	if result.V.Cmp(expected) != 0 {
+		t.Errorf("got %x, expected %x", result.V, expected)
+	}
 }
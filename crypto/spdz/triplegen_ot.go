@@ -7,9 +7,13 @@
 package spdz
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 
 	"github.com/markkurossi/mpc/ot"
@@ -17,42 +21,62 @@ import (
 	"github.com/markkurossi/mpc/vole"
 )
 
+// voleSender is the sender of the VOLE multiplications.
+type voleSender interface {
+	// Mul returns the masks r_i for the inputs xs. The receiver gets
+	// u_i = r_i + x_i*y_i for its inputs y_i.
+	Mul(xs []*big.Int, p *big.Int) ([]*big.Int, error)
+}
+
+// newVOLESenderFunc creates the VOLE sender for the connection.
+type newVOLESenderFunc func(oti ot.OT, conn *p2p.Conn) (voleSender, error)
+
+// newVOLESender creates the vole package's VOLE sender.
+func newVOLESender(oti ot.OT, conn *p2p.Conn) (voleSender, error) {
+	sender, err := vole.NewSender(oti, conn, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return sender, nil
+}
+
 // GenerateBeaverTriplesOTBatch generates n triples using batched IKNP
-// and batched bitwise OT.
-func GenerateBeaverTriplesOTBatch(conn *p2p.Conn, oti ot.OT, role Role, n int) (
-	[]*Triple, error) {
+// and batched bitwise OT. The function runs the base OTs for this
+// call only; use GenerateBeaverTriplesSession to reuse the OT
+// extension setup across calls.
+func (params *Params) GenerateBeaverTriplesOTBatch(conn *p2p.Conn, oti ot.OT,
+	role Role, n int) ([]*Triple, error) {
 
-	if n <= 0 {
-		return nil, errors.New("n must be positive")
+	session, err := NewSession(conn, role, oti)
+	if err != nil {
+		return nil, err
 	}
+	return params.GenerateBeaverTriplesSession(session, n)
+}
 
-	var iknpS *ot.IKNPSender
-	var iknpR *ot.IKNPReceiver
-	var err error
+// GenerateBeaverTriplesSession generates n triples using the session's
+// IKNP extension and batched bitwise OT.
+func (params *Params) GenerateBeaverTriplesSession(session *Session,
+	n int) (triples []*Triple, err error) {
 
-	// Init base-OT roles
-	switch role {
-	case Sender:
-		if err := oti.InitSender(conn); err != nil {
-			return nil, err
-		}
-		iknpS, err = ot.NewIKNPSender(oti, conn, rand.Reader, nil)
-		if err != nil {
-			return nil, err
-		}
+	err = session.run(func() error {
+		triples, err = params.generateBeaverTriples(session, n)
+		return err
+	})
+	return triples, err
+}
 
-	case Receiver:
-		if err := oti.InitReceiver(conn); err != nil {
-			return nil, err
-		}
-		iknpR, err = ot.NewIKNPReceiver(oti, conn, rand.Reader)
-		if err != nil {
-			return nil, err
-		}
+func (params *Params) generateBeaverTriples(session *Session, n int) (
+	[]*Triple, error) {
 
-	default:
-		return nil, fmt.Errorf("invalid role: %d", role)
+	if n <= 0 {
+		return nil, errors.New("n must be positive")
 	}
+	if err := session.setup(); err != nil {
+		return nil, err
+	}
+	conn := session.conn
+	role := session.role
 
 	triples := make([]*Triple, n)
 
@@ -64,36 +88,38 @@ func GenerateBeaverTriplesOTBatch(conn *p2p.Conn, oti ot.OT, role Role, n int) (
 		if end > n {
 			end = n
 		}
-		m := end - base
+		audit := int(math.Ceil(float64(end-base) * session.audit))
+		m := end - base + audit
+		batch := make([]*Triple, m)
 
 		// 1) Sample A shares via IKNP (batched)
 		if role == Sender {
 			// sender expands m wires
-			labels, err := iknpS.Send(m, false)
+			labels, err := session.send(m)
 			if err != nil {
 				return nil, fmt.Errorf("ExpandSend A: %w", err)
 			}
 			for i := 0; i < m; i++ {
-				a0 := ExpandLabelToField(labels[i])
-				triples[base+i] = &Triple{A: NewShare(a0)}
+				a0 := params.ExpandLabelToField(labels[i])
+				batch[i] = &Triple{A: params.NewShare(a0)}
 			}
 		} else {
 			flags := randomBools(m)
 			labels := make([]ot.Label, m)
-			err := iknpR.Receive(flags, labels, false)
+			err := session.receive(flags, labels)
 			if err != nil {
 				return nil, fmt.Errorf("ExpandReceive A: %w", err)
 			}
 			for i := 0; i < m; i++ {
-				a1 := ExpandLabelToField(labels[i])
-				triples[base+i] = &Triple{A: NewShare(a1)}
+				a1 := params.ExpandLabelToField(labels[i])
+				batch[i] = &Triple{A: params.NewShare(a1)}
 			}
 		}
 
 		// exchange complementary A shares
 		if role == Sender {
 			for i := 0; i < m; i++ {
-				if err := sendField(conn, triples[base+i].A.V); err != nil {
+				if err := params.sendField(conn, batch[i].A.V); err != nil {
 					return nil, fmt.Errorf("send a0: %w", err)
 				}
 			}
@@ -106,40 +132,40 @@ func GenerateBeaverTriplesOTBatch(conn *p2p.Conn, oti ot.OT, role Role, n int) (
 				if err != nil {
 					return nil, fmt.Errorf("recv a0: %w", err)
 				}
-				aLabel := triples[base+i].A.V
+				aLabel := batch[i].A.V
 				a1 := new(big.Int).Sub(aLabel, a0)
-				a1.Mod(a1, p256P)
-				triples[base+i].A = NewShare(a1)
+				a1.Mod(a1, params.P)
+				batch[i].A = params.NewShare(a1)
 			}
 		}
 
 		// 2) Sample B shares via IKNP (batched)
 		if role == Sender {
-			labels, err := iknpS.Send(m, false)
+			labels, err := session.send(m)
 			if err != nil {
 				return nil, err
 			}
 			for i := 0; i < m; i++ {
-				b0 := ExpandLabelToField(labels[i])
-				triples[base+i].B = NewShare(b0)
+				b0 := params.ExpandLabelToField(labels[i])
+				batch[i].B = params.NewShare(b0)
 			}
 		} else {
 			flags := randomBools(m)
 			labels := make([]ot.Label, m)
-			err := iknpR.Receive(flags, labels, false)
+			err := session.receive(flags, labels)
 			if err != nil {
 				return nil, err
 			}
 			for i := 0; i < m; i++ {
-				b1 := ExpandLabelToField(labels[i])
-				triples[base+i].B = NewShare(b1)
+				b1 := params.ExpandLabelToField(labels[i])
+				batch[i].B = params.NewShare(b1)
 			}
 		}
 
 		// exchange complementary B shares
 		if role == Sender {
 			for i := 0; i < m; i++ {
-				if err := sendField(conn, triples[base+i].B.V); err != nil {
+				if err := params.sendField(conn, batch[i].B.V); err != nil {
 					return nil, fmt.Errorf("send b0: %w", err)
 				}
 			}
@@ -152,15 +178,16 @@ func GenerateBeaverTriplesOTBatch(conn *p2p.Conn, oti ot.OT, role Role, n int) (
 				if err != nil {
 					return nil, fmt.Errorf("recv b0: %w", err)
 				}
-				bLabel := triples[base+i].B.V
+				bLabel := batch[i].B.V
 				b1 := new(big.Int).Sub(bLabel, b0)
-				b1.Mod(b1, p256P)
-				triples[base+i].B = NewShare(b1)
+				b1.Mod(b1, params.P)
+				batch[i].B = params.NewShare(b1)
 			}
 		}
 
-		// 3) Batch cross-multiply: compute all cShares for triples[base:base+m]
-		cShares, err := CrossMultiplyBatch(conn, oti, role, triples[base:base+m])
+		// 3) Batch cross-multiply: compute all cShares for the batch
+		cShares, err := params.crossMultiplyBatch(conn, session.oti, role,
+			batch, session.selfTest, session.newSender)
 		if err != nil {
 			return nil, fmt.Errorf("CrossMultiplyBatch failed: %w", err)
 		}
@@ -170,57 +197,310 @@ func GenerateBeaverTriplesOTBatch(conn *p2p.Conn, oti ot.OT, role Role, n int) (
 					len(cShares), m)
 		}
 		for i := 0; i < m; i++ {
-			triples[base+i].C = cShares[i]
+			batch[i].C = cShares[i]
+		}
+
+		// 4) Audit the cross multiplication.
+		batch, err = params.auditTriples(conn, role, batch, audit)
+		if err != nil {
+			return nil, err
+		}
+
+		// 5) Authenticate the triples.
+		if params.alpha != nil {
+			err = params.authenticateTriples(session, batch)
+			if err != nil {
+				return nil, fmt.Errorf("authenticate triples: %w", err)
+			}
 		}
+		copy(triples[base:end], batch)
 	}
 
 	return triples, nil
 }
 
+// Sacrifice verifies the triples and returns the verified half of
+// them. The function consumes the triples in pairs: each triple
+// (a,b,c) at an even index is verified by sacrificing the next triple
+// (f,g,h). The parties draw a random t with a commit-and-reveal coin
+// toss, open ρ = t*a-f and σ = b-g, and check that
+//
+//	t*c - h - σ*f - ρ*g - σ*ρ = t*(c-a*b) - (h-f*g) = 0
+//
+// The check fails with probability 1-1/P if either triple is
+// malformed. The function returns an error if any of the checks
+// fail. The sacrificed triples must not be used for anything else.
+func (params *Params) Sacrifice(conn *p2p.Conn, role Role,
+	triples []*Triple) ([]*Triple, error) {
+
+	if len(triples)%2 != 0 {
+		return nil, fmt.Errorf("sacrifice: odd number of triples: %d",
+			len(triples))
+	}
+	n := len(triples) / 2
+
+	seed, err := params.randomFieldElement(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := exchangeCommitted(conn, role, params.fieldBytes(seed))
+	if err != nil {
+		return nil, fmt.Errorf("sacrifice: %w", err)
+	}
+	if len(peer) != params.size() {
+		return nil, fmt.Errorf("sacrifice: invalid seed: %d bytes", len(peer))
+	}
+	t := params.modReduce(seed.Add(seed, readField(peer)))
+
+	masked := make([]*Share, 0, 2*n)
+	for i := 0; i < n; i++ {
+		x := triples[2*i]
+		y := triples[2*i+1]
+		masked = append(masked, params.SubShare(params.mulConst(x.A, t), y.A))
+		masked = append(masked, params.SubShare(x.B, y.B))
+	}
+	opened, err := params.open(conn, role, masked)
+	if err != nil {
+		return nil, fmt.Errorf("sacrifice: %w", err)
+	}
+
+	checks := make([]*Share, n)
+	for i := 0; i < n; i++ {
+		x := triples[2*i]
+		y := triples[2*i+1]
+		rho := opened[2*i]
+		sigma := opened[2*i+1]
+
+		z := params.SubShare(params.mulConst(x.C, t), y.C)
+		z = params.SubShare(z, params.mulConst(y.A, sigma))
+		z = params.SubShare(z, params.mulConst(y.B, rho))
+		checks[i] = params.addConst(z, role == Sender,
+			new(big.Int).Neg(new(big.Int).Mul(sigma, rho)))
+	}
+	values, err := params.open(conn, role, checks)
+	if err != nil {
+		return nil, fmt.Errorf("sacrifice: %w", err)
+	}
+
+	result := make([]*Triple, n)
+	for i, v := range values {
+		if v.Sign() != 0 {
+			return nil, fmt.Errorf("sacrifice: invalid triple %d", 2*i)
+		}
+		result[i] = triples[2*i]
+	}
+	return result, nil
+}
+
+// auditTriples audits k of the triples and returns the remaining
+// triples. The parties derive the audited triples and the
+// coefficients γi from a joint seed, open the audited triples, and
+// check that Σγi*(ci-ai*bi) = 0. The check fails with probability
+// 1-1/P if any of the audited triples is malformed.
+func (params *Params) auditTriples(conn *p2p.Conn, role Role,
+	triples []*Triple, k int) ([]*Triple, error) {
+
+	if k == 0 {
+		return triples, nil
+	}
+	n := len(triples)
+	if k >= n {
+		return nil, fmt.Errorf("audit: %d of %d triples", k, n)
+	}
+
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	peer, err := exchangeCommitted(conn, role, seed)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	if len(peer) != len(seed) {
+		return nil, fmt.Errorf("audit: invalid seed: %d bytes", len(peer))
+	}
+	for i := range seed {
+		seed[i] ^= peer[i]
+	}
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, err
+	}
+	size := params.size() + 16
+	prg := make([]byte, k*(8+size))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(prg, prg)
+
+	// Select the audited triples with a partial Fisher-Yates shuffle.
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := 0; i < k; i++ {
+		j := i + int(binary.BigEndian.Uint64(prg[i*8:])%uint64(n-i))
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+	prg = prg[k*8:]
+
+	audited := make([]bool, n)
+	shares := make([]*Share, 0, 3*k)
+	for _, idx := range perm[:k] {
+		audited[idx] = true
+		t := triples[idx]
+		shares = append(shares, t.A, t.B, t.C)
+	}
+	values, err := params.open(conn, role, shares)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+
+	sum := new(big.Int)
+	for i := 0; i < k; i++ {
+		gamma := params.modReduce(new(big.Int).SetBytes(
+			prg[i*size : (i+1)*size]))
+		a := values[3*i]
+		b := values[3*i+1]
+		c := values[3*i+2]
+		d := new(big.Int).Sub(c, new(big.Int).Mul(a, b))
+		sum.Add(sum, d.Mul(d, gamma))
+	}
+	if params.modReduce(sum).Sign() != 0 {
+		return nil, errors.New("audit: invalid triples")
+	}
+
+	result := make([]*Triple, 0, n-k)
+	for i, t := range triples {
+		if !audited[i] {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+// authenticateTriples computes the MAC shares for the triples' A, B,
+// and C shares. The MAC α*v = (α0+α1)*(v0+v1) is a product of two
+// shared values so the function computes the MACs like the C shares,
+// with CrossMultiplyBatch over the pairs (αi, vi).
+func (params *Params) authenticateTriples(session *Session,
+	triples []*Triple) error {
+
+	var shares []*Share
+	for _, t := range triples {
+		shares = append(shares, t.A, t.B, t.C)
+	}
+	pairs := make([]*Triple, len(shares))
+	for i, share := range shares {
+		pairs[i] = &Triple{
+			A: &Share{V: params.alpha},
+			B: share,
+		}
+	}
+	macs, err := params.crossMultiplyBatch(session.conn, session.oti,
+		session.role, pairs, session.selfTest, session.newSender)
+	if err != nil {
+		return err
+	}
+	if len(macs) != len(shares) {
+		return fmt.Errorf("CrossMultiplyBatch returned %d shares want %d",
+			len(macs), len(shares))
+	}
+	for i, share := range shares {
+		share.MAC = macs[i].V
+	}
+	return nil
+}
+
 // CrossMultiplyBatch is a batched version of CrossMultiply with OT
 // for m triples. The triples is a list of triples with A and B shares
 // filled (local shares). The function returns a slice of C shares
 // (local contributions).
-func CrossMultiplyBatch(conn *p2p.Conn, oti ot.OT, role Role,
+func (params *Params) CrossMultiplyBatch(conn *p2p.Conn, oti ot.OT, role Role,
 	triples []*Triple) ([]*Share, error) {
 
+	return params.crossMultiplyBatch(conn, oti, role, triples, 0, nil)
+}
+
+// crossMultiplyBatch implements CrossMultiplyBatch with k self-test
+// multiplications in each VOLE direction; see
+// Session.SetVOLESelfTest. The newSender creates the VOLE senders. If
+// it is nil, the function uses the vole package's senders.
+func (params *Params) crossMultiplyBatch(conn *p2p.Conn, oti ot.OT,
+	role Role, triples []*Triple, k int, newSender newVOLESenderFunc) (
+	[]*Share, error) {
+
 	m := len(triples)
 	if m == 0 {
 		return nil, nil
 	}
+	if newSender == nil {
+		newSender = newVOLESender
+	}
+	n := m + k
 
 	// Helper that runs one VOLE direction and returns per-triple
 	// contributions (big.Int)
 	runDirection := func(localIsSender bool) ([]*big.Int, error) {
+		checks, err := params.voleCheckPositions(conn, localIsSender, n, k)
+		if err != nil {
+			return nil, err
+		}
+		// inputs returns the VOLE input vector with the triple values
+		// and random values at the check positions.
+		inputs := func(value func(t int) *big.Int) ([]*big.Int, error) {
+			result := make([]*big.Int, n)
+			var t int
+			for i := 0; i < n; i++ {
+				if checks != nil && checks[i] {
+					v, err := params.randomFieldElement(rand.Reader)
+					if err != nil {
+						return nil, err
+					}
+					result[i] = v
+				} else {
+					result[i] = value(t)
+					t++
+				}
+			}
+			return result, nil
+		}
+
 		// Build local input vector for this direction:
 		// - if sender, senderInputs = local A shares (triples[t].A.V)
 		// - if receiver, receiverInputs = local B shares (triples[t].B.V)
 		if localIsSender {
-			ve, err := vole.NewSender(oti, conn, rand.Reader)
+			ve, err := newSender(oti, conn)
 			if err != nil {
 				return nil, err
 			}
 
-			xs := make([]*big.Int, m)
-			for t := 0; t < m; t++ {
-				xs[t] = triples[t].A.V
+			xs, err := inputs(func(t int) *big.Int {
+				return triples[t].A.V
+			})
+			if err != nil {
+				return nil, err
 			}
 			// MulSender returns r_i (sender masks)
-			rs, err := ve.Mul(xs, p256P)
+			rs, err := ve.Mul(xs, params.P)
 			if err != nil {
 				return nil, fmt.Errorf("VOLE MulSender: %w", err)
 			}
-			if len(rs) != m {
+			if len(rs) != n {
 				return nil,
 					fmt.Errorf("VOLE MulSender returned %d masks, want %d",
-						len(rs), m)
+						len(rs), n)
+			}
+			err = params.voleSelfTest(conn, true, checks, xs, rs)
+			if err != nil {
+				return nil, err
 			}
 			// Sender's contribution for this direction is -r_i mod p
-			out := make([]*big.Int, m)
-			for t := 0; t < m; t++ {
-				neg := new(big.Int).Neg(rs[t])
-				neg.Mod(neg, p256P)
-				out[t] = neg
+			out := make([]*big.Int, 0, m)
+			for i := 0; i < n; i++ {
+				if checks != nil && checks[i] {
+					continue
+				}
+				neg := new(big.Int).Neg(rs[i])
+				neg.Mod(neg, params.P)
+				out = append(out, neg)
 			}
 			return out, nil
 		} else {
@@ -229,22 +509,35 @@ func CrossMultiplyBatch(conn *p2p.Conn, oti ot.OT, role Role,
 				return nil, err
 			}
 
-			ys := make([]*big.Int, m)
-			for t := 0; t < m; t++ {
-				ys[t] = triples[t].B.V
+			ys, err := inputs(func(t int) *big.Int {
+				return triples[t].B.V
+			})
+			if err != nil {
+				return nil, err
 			}
 			// MulReceiver returns u_i = r_i + x_i*y_i
-			us, err := ve.Mul(ys, p256P)
+			us, err := ve.Mul(ys, params.P)
 			if err != nil {
 				return nil, fmt.Errorf("VOLE MulReceiver: %w", err)
 			}
-			if len(us) != m {
+			if len(us) != n {
 				return nil,
 					fmt.Errorf("VOLE MulReceiver returned %d values, want %d",
-						len(us), m)
+						len(us), n)
+			}
+			err = params.voleSelfTest(conn, false, checks, ys, us)
+			if err != nil {
+				return nil, err
 			}
 			// Receiver's contribution for this direction is u_i
-			return us, nil
+			out := make([]*big.Int, 0, m)
+			for i := 0; i < n; i++ {
+				if checks != nil && checks[i] {
+					continue
+				}
+				out = append(out, us[i])
+			}
+			return out, nil
 		}
 	}
 
@@ -271,14 +564,134 @@ func CrossMultiplyBatch(conn *p2p.Conn, oti ot.OT, role Role,
 		sum := new(big.Int).SetInt64(0)
 		// local product a_t * b_t
 		localProd := new(big.Int).Mul(triples[t].A.V, triples[t].B.V)
-		localProd.Mod(localProd, p256P)
+		localProd.Mod(localProd, params.P)
 		sum.Add(sum, localProd)
 
 		sum.Add(sum, term1[t])
 		sum.Add(sum, term2[t])
-		sum.Mod(sum, p256P)
-		cShares[t] = NewShare(sum)
+		sum.Mod(sum, params.P)
+		cShares[t] = params.NewShare(sum)
 	}
 
 	return cShares, nil
 }
+
+// voleCheckPositions selects k random check positions from the VOLE
+// batch of n values. The VOLE sender selects the positions and sends
+// them to the receiver. The function returns nil if k is 0.
+func (params *Params) voleCheckPositions(conn *p2p.Conn, sender bool,
+	n, k int) ([]bool, error) {
+
+	if k == 0 {
+		return nil, nil
+	}
+	checks := make([]bool, n)
+
+	if sender {
+		max := big.NewInt(int64(n))
+		for selected := 0; selected < k; {
+			v, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, err
+			}
+			i := int(v.Int64())
+			if checks[i] {
+				continue
+			}
+			checks[i] = true
+			selected++
+			if err := conn.SendUint32(i); err != nil {
+				return nil, err
+			}
+		}
+		if err := conn.Flush(); err != nil {
+			return nil, err
+		}
+		return checks, nil
+	}
+
+	for selected := 0; selected < k; selected++ {
+		i, err := conn.ReceiveUint32()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= n || checks[i] {
+			return nil, fmt.Errorf("invalid VOLE check position %d", i)
+		}
+		checks[i] = true
+	}
+	return checks, nil
+}
+
+// voleSelfTest verifies the VOLE results at the check positions. The
+// VOLE sender opens its inputs x_i and masks r_i, and the receiver
+// verifies that its results satisfy u_i = r_i + x_i*y_i. The receiver
+// sends the verification result back to the sender so that both
+// peers fail together.
+func (params *Params) voleSelfTest(conn *p2p.Conn, sender bool,
+	checks []bool, inputs, results []*big.Int) error {
+
+	if checks == nil {
+		return nil
+	}
+	if sender {
+		for i, check := range checks {
+			if !check {
+				continue
+			}
+			if err := params.sendField(conn, inputs[i]); err != nil {
+				return err
+			}
+			if err := params.sendField(conn, results[i]); err != nil {
+				return err
+			}
+		}
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+		ok, err := conn.ReceiveByte()
+		if err != nil {
+			return err
+		}
+		if ok != 1 {
+			return errors.New("VOLE self-test failed")
+		}
+		return nil
+	}
+
+	failed := -1
+	for i, check := range checks {
+		if !check {
+			continue
+		}
+		x, err := recvField(conn)
+		if err != nil {
+			return err
+		}
+		r, err := recvField(conn)
+		if err != nil {
+			return err
+		}
+		// u - r == x*y
+		want := new(big.Int).Mul(x, inputs[i])
+		want.Add(want, r)
+		want.Mod(want, params.P)
+		if failed < 0 && want.Cmp(results[i]) != 0 {
+			failed = i
+		}
+	}
+	var ok byte
+	if failed < 0 {
+		ok = 1
+	}
+	if err := conn.SendByte(ok); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	if failed >= 0 {
+		return fmt.Errorf("VOLE self-test failed for value %d", failed)
+	}
+	return nil
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -8,6 +8,7 @@ package spdz
 
 import (
 	"crypto/rand"
+	"errors"
 	"math/big"
 	"sync"
 	"testing"
@@ -20,7 +21,7 @@ import (
 // reconstruct sum of two shares
 func rec2(x0, x1 *Share) *big.Int {
 	s := new(big.Int).Add(x0.V, x1.V)
-	s.Mod(s, p256P)
+	s.Mod(s, P256.P)
 	return s
 }
 
@@ -43,13 +44,13 @@ func TestGenerateBeaverTriplesOTBatch(t *testing.T) {
 	// Peer 0
 	go func() {
 		defer wg.Done()
-		triples0, err0 = GenerateBeaverTriplesOTBatch(c0, ot0, 0, tripleCount)
+		triples0, err0 = P256.GenerateBeaverTriplesOTBatch(c0, ot0, 0, tripleCount)
 	}()
 
 	// Peer 1
 	go func() {
 		defer wg.Done()
-		triples1, err1 = GenerateBeaverTriplesOTBatch(c1, ot1, 1, tripleCount)
+		triples1, err1 = P256.GenerateBeaverTriplesOTBatch(c1, ot1, 1, tripleCount)
 	}()
 
 	// Timeout watchdog
@@ -84,7 +85,7 @@ func TestGenerateBeaverTriplesOTBatch(t *testing.T) {
 		C := rec2(triples0[i].C, triples1[i].C)
 
 		want := new(big.Int).Mul(A, B)
-		want.Mod(want, p256P)
+		want.Mod(want, P256.P)
 
 		if C.Cmp(want) != 0 {
 			t.Fatalf("triple %d incorrect:\nA=%x\nB=%x\nC=%x\nwant=%x\n",
@@ -92,3 +93,538 @@ func TestGenerateBeaverTriplesOTBatch(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateBeaverTriplesSession(t *testing.T) {
+	const tripleCount = 10
+	const rounds = 3
+
+	c0, c1 := p2p.Pipe()
+
+	s0, err := NewSession(c0, Sender, ot.NewCO(rand.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err := NewSession(c1, Receiver, ot.NewCO(rand.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for round := 0; round < rounds; round++ {
+		var triples0, triples1 []*Triple
+		var err0, err1 error
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			triples0, err0 = P256.GenerateBeaverTriplesSession(s0, tripleCount)
+		})
+		wg.Go(func() {
+			triples1, err1 = P256.GenerateBeaverTriplesSession(s1, tripleCount)
+		})
+		wg.Wait()
+		if err0 != nil || err1 != nil {
+			t.Fatalf("round %v: peer0=%v, peer1=%v", round, err0, err1)
+		}
+		for i := 0; i < tripleCount; i++ {
+			A := rec2(triples0[i].A, triples1[i].A)
+			B := rec2(triples0[i].B, triples1[i].B)
+			C := rec2(triples0[i].C, triples1[i].C)
+
+			want := new(big.Int).Mul(A, B)
+			want.Mod(want, P256.P)
+
+			if C.Cmp(want) != 0 {
+				t.Fatalf("round %v: triple %d incorrect", round, i)
+			}
+		}
+	}
+
+	// The base OTs are run once and the extensions are reused.
+	for _, s := range []*Session{s0, s1} {
+		if s.Stats.Setups != 1 {
+			t.Errorf("%v: got %v setups, expected 1", s.Role(), s.Stats.Setups)
+		}
+		if s.Stats.Extensions != 2*rounds {
+			t.Errorf("%v: got %v extensions, expected %v",
+				s.Role(), s.Stats.Extensions, 2*rounds)
+		}
+	}
+}
+
+func BenchmarkTriplesOTBatch(b *testing.B) {
+	benchmarkTriples(b, false)
+}
+
+func BenchmarkTriplesSession(b *testing.B) {
+	benchmarkTriples(b, true)
+}
+
+func benchmarkTriples(b *testing.B, reuse bool) {
+	const tripleCount = 64
+
+	c0, c1 := p2p.Pipe()
+	var s0, s1 *Session
+
+	for b.Loop() {
+		if s0 == nil || !reuse {
+			s0, _ = NewSession(c0, Sender, ot.NewCO(rand.Reader))
+			s1, _ = NewSession(c1, Receiver, ot.NewCO(rand.Reader))
+		}
+		var err0, err1 error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			_, err0 = P256.GenerateBeaverTriplesSession(s0, tripleCount)
+		})
+		wg.Go(func() {
+			_, err1 = P256.GenerateBeaverTriplesSession(s1, tripleCount)
+		})
+		wg.Wait()
+		if err0 != nil || err1 != nil {
+			b.Fatalf("peer0=%v, peer1=%v", err0, err1)
+		}
+	}
+}
+
+func TestVOLESelfTest(t *testing.T) {
+	const n = 16
+	const k = 4
+
+	params := P256
+	xs := make([]*big.Int, n)
+	ys := make([]*big.Int, n)
+	rs := make([]*big.Int, n)
+	us := make([]*big.Int, n)
+	for i := 0; i < n; i++ {
+		xs[i], _ = params.randomFieldElement(rand.Reader)
+		ys[i], _ = params.randomFieldElement(rand.Reader)
+		rs[i], _ = params.randomFieldElement(rand.Reader)
+		us[i] = new(big.Int).Mul(xs[i], ys[i])
+		us[i].Add(us[i], rs[i])
+		us[i].Mod(us[i], params.P)
+	}
+
+	run := func(us []*big.Int) (err0, err1 error) {
+		c0, c1 := p2p.Pipe()
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			checks, err := params.voleCheckPositions(c0, true, n, k)
+			if err == nil {
+				err = params.voleSelfTest(c0, true, checks, xs, rs)
+			}
+			err0 = err
+		})
+		wg.Go(func() {
+			checks, err := params.voleCheckPositions(c1, false, n, k)
+			if err == nil {
+				err = params.voleSelfTest(c1, false, checks, ys, us)
+			}
+			err1 = err
+		})
+		wg.Wait()
+		return
+	}
+
+	err0, err1 := run(us)
+	if err0 != nil || err1 != nil {
+		t.Fatalf("valid VOLE: sender=%v, receiver=%v", err0, err1)
+	}
+
+	// Corrupt all results so that the check fails regardless of the
+	// selected positions.
+	bad := make([]*big.Int, n)
+	for i := 0; i < n; i++ {
+		bad[i] = new(big.Int).Add(us[i], big.NewInt(1))
+	}
+	err0, err1 = run(bad)
+	if err0 == nil || err1 == nil {
+		t.Errorf("invalid VOLE: sender=%v, receiver=%v", err0, err1)
+	}
+}
+
+func TestInsecureOT(t *testing.T) {
+	const n = 8
+
+	wires := make([]ot.Wire, n)
+	for i := 0; i < n; i++ {
+		l0, err := ot.NewLabel(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l1, err := ot.NewLabel(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wires[i] = ot.Wire{
+			L0: l0,
+			L1: l1,
+		}
+	}
+	flags := randomBools(n)
+	result := make([]ot.Label, n)
+
+	c0, c1 := p2p.Pipe()
+	sender := OTInsecure.New(rand.Reader)
+	receiver := OTInsecure.New(rand.Reader)
+
+	var err0, err1 error
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		err0 = sender.InitSender(c0)
+		if err0 == nil {
+			err0 = sender.Send(wires)
+		}
+	})
+	wg.Go(func() {
+		err1 = receiver.InitReceiver(c1)
+		if err1 == nil {
+			err1 = receiver.Receive(flags, result)
+		}
+	})
+	wg.Wait()
+	if err0 != nil || err1 != nil {
+		t.Fatalf("sender=%v, receiver=%v", err0, err1)
+	}
+	for i := 0; i < n; i++ {
+		expected := wires[i].L0
+		if flags[i] {
+			expected = wires[i].L1
+		}
+		if !result[i].Equal(expected) {
+			t.Errorf("label %d: got %v, expected %v", i, result[i], expected)
+		}
+	}
+}
+
+func TestParseOTType(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		t    OTType
+	}{
+		{"", OTCO},
+		{"co", OTCO},
+		{"insecure", OTInsecure},
+	} {
+		v, err := ParseOTType(test.name)
+		if err != nil {
+			t.Errorf("ParseOTType(%q): %v", test.name, err)
+			continue
+		}
+		if v != test.t {
+			t.Errorf("ParseOTType(%q): got %v, expected %v", test.name, v,
+				test.t)
+		}
+	}
+	_, err := ParseOTType("rsa")
+	if err == nil {
+		t.Errorf("ParseOTType(rsa) succeeded")
+	}
+}
+
+func TestSessionConnClosed(t *testing.T) {
+	c0, c1 := p2p.Pipe()
+	s1, err := NewSession(c1, Receiver, OTInsecure.New(rand.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error)
+	go func() {
+		_, _, err := P256.AddSession(s1, big.NewInt(1), big.NewInt(2))
+		result <- err
+	}()
+
+	// The peer disappears before sending its input shares.
+	time.Sleep(10 * time.Millisecond)
+	c0.Close()
+
+	select {
+	case err = <-result:
+		if !errors.Is(err, ErrConnClosed) {
+			t.Errorf("got %v, expected %v", err, ErrConnClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddSession did not return after connection close")
+	}
+}
+
+func TestSessionStop(t *testing.T) {
+	c0, c1 := p2p.Pipe()
+	defer c0.Close()
+
+	s1, err := NewSession(c1, Receiver, OTInsecure.New(rand.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	s1.SetStop(stop, c1)
+
+	// The peer is alive but silent: it reads the session's messages
+	// but does not respond.
+	go func() {
+		for {
+			if _, err := c0.ReceiveByte(); err != nil {
+				return
+			}
+		}
+	}()
+
+	result := make(chan error)
+	go func() {
+		_, _, err := P256.AddSession(s1, big.NewInt(1), big.NewInt(2))
+		result <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+
+	select {
+	case err = <-result:
+		if !errors.Is(err, ErrCanceled) {
+			t.Errorf("got %v, expected %v", err, ErrCanceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddSession did not return after stop")
+	}
+
+	// The stopped session does not start new computations.
+	_, err = P256.GenerateBeaverTriplesSession(s1, 1)
+	if !errors.Is(err, ErrCanceled) {
+		t.Errorf("got %v, expected %v", err, ErrCanceled)
+	}
+}
+
+func TestSacrifice(t *testing.T) {
+	const tripleCount = 20
+
+	tests := []struct {
+		name    string
+		corrupt int
+	}{
+		{"valid", -1},
+		{"checked", 4},
+		{"sacrificed", 7},
+	}
+	for _, test := range tests {
+		c0, c1 := p2p.Pipe()
+
+		var triples0, triples1 []*Triple
+		var err0, err1 error
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			triples0, err0 = P256.GenerateBeaverTriplesOTBatch(c0,
+				OTInsecure.New(rand.Reader), Sender, tripleCount)
+			if err0 != nil {
+				return
+			}
+			if test.corrupt >= 0 {
+				c := triples0[test.corrupt].C
+				c.V = P256.modReduce(new(big.Int).Add(c.V, big.NewInt(1)))
+			}
+			triples0, err0 = P256.Sacrifice(c0, Sender, triples0)
+		})
+		wg.Go(func() {
+			triples1, err1 = P256.GenerateBeaverTriplesOTBatch(c1,
+				OTInsecure.New(rand.Reader), Receiver, tripleCount)
+			if err1 != nil {
+				return
+			}
+			triples1, err1 = P256.Sacrifice(c1, Receiver, triples1)
+		})
+		wg.Wait()
+
+		if test.corrupt >= 0 {
+			if err0 == nil || err1 == nil {
+				t.Errorf("%v: got %v/%v, expected error", test.name, err0, err1)
+			}
+			continue
+		}
+		if err0 != nil {
+			t.Fatalf("%v: peer0 error: %v", test.name, err0)
+		}
+		if err1 != nil {
+			t.Fatalf("%v: peer1 error: %v", test.name, err1)
+		}
+		if len(triples0) != tripleCount/2 || len(triples1) != tripleCount/2 {
+			t.Fatalf("%v: got %v/%v triples, expected %v", test.name,
+				len(triples0), len(triples1), tripleCount/2)
+		}
+		for i := range triples0 {
+			A := rec2(triples0[i].A, triples1[i].A)
+			B := rec2(triples0[i].B, triples1[i].B)
+			C := rec2(triples0[i].C, triples1[i].C)
+			if P256.modReduce(A.Mul(A, B)).Cmp(C) != 0 {
+				t.Errorf("%v: triple %d incorrect", test.name, i)
+			}
+		}
+	}
+}
+
+// tamperVOLESender simulates a cheating VOLE sender. It calls tamper
+// with the VOLE sender's masks.
+type tamperVOLESender struct {
+	voleSender
+	tamper func(rs []*big.Int)
+}
+
+func (s *tamperVOLESender) Mul(xs []*big.Int, p *big.Int) (
+	[]*big.Int, error) {
+
+	rs, err := s.voleSender.Mul(xs, p)
+	if err == nil {
+		s.tamper(rs)
+	}
+	return rs, err
+}
+
+// tamperSession makes the session's VOLE senders cheat with tamper.
+func tamperSession(session *Session, tamper func(rs []*big.Int)) {
+	session.newSender = func(oti ot.OT, conn *p2p.Conn) (voleSender, error) {
+		sender, err := newVOLESender(oti, conn)
+		if err != nil {
+			return nil, err
+		}
+		return &tamperVOLESender{
+			voleSender: sender,
+			tamper:     tamper,
+		}, nil
+	}
+}
+
+func TestTripleAudit(t *testing.T) {
+	const tripleCount = 20
+
+	// tamper simulates a cheating VOLE sender that adds an offset to
+	// every other mask.
+	tamper := func(rs []*big.Int) {
+		for i := 1; i < len(rs); i += 2 {
+			rs[i] = P256.modReduce(new(big.Int).Add(rs[i], big.NewInt(1)))
+		}
+	}
+
+	for _, cheat := range []bool{false, true} {
+		c0, c1 := p2p.Pipe()
+
+		var triples0, triples1 []*Triple
+		var err0, err1 error
+
+		generate := func(conn *p2p.Conn, role Role) ([]*Triple, error) {
+			session, err := NewSession(conn, role,
+				OTInsecure.New(rand.Reader))
+			if err != nil {
+				return nil, err
+			}
+			if err := session.SetAuditRate(1); err != nil {
+				return nil, err
+			}
+			if cheat && role == Sender {
+				tamperSession(session, tamper)
+			}
+			return P256.GenerateBeaverTriplesSession(session, tripleCount)
+		}
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			triples0, err0 = generate(c0, Sender)
+		})
+		wg.Go(func() {
+			triples1, err1 = generate(c1, Receiver)
+		})
+		wg.Wait()
+
+		if cheat {
+			if err0 == nil || err1 == nil {
+				t.Errorf("cheating VOLE: got %v/%v, expected error", err0, err1)
+			}
+			continue
+		}
+		if err0 != nil || err1 != nil {
+			t.Fatalf("peer0=%v, peer1=%v", err0, err1)
+		}
+		if len(triples0) != tripleCount || len(triples1) != tripleCount {
+			t.Fatalf("got %v/%v triples, expected %v", len(triples0),
+				len(triples1), tripleCount)
+		}
+		for i := range triples0 {
+			A := rec2(triples0[i].A, triples1[i].A)
+			B := rec2(triples0[i].B, triples1[i].B)
+			C := rec2(triples0[i].C, triples1[i].C)
+			if P256.modReduce(A.Mul(A, B)).Cmp(C) != 0 {
+				t.Errorf("triple %d incorrect", i)
+			}
+		}
+	}
+}
+
+func TestSetAuditRate(t *testing.T) {
+	c0, _ := p2p.Pipe()
+	session, err := NewSession(c0, Sender, OTInsecure.New(rand.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rate := range []float64{-0.1, 1.5} {
+		if session.SetAuditRate(rate) == nil {
+			t.Errorf("SetAuditRate(%v) succeeded", rate)
+		}
+	}
+	if err := session.SetAuditRate(0.5); err != nil {
+		t.Errorf("SetAuditRate(0.5): %v", err)
+	}
+}
+
+func TestSessionVOLESelfTest(t *testing.T) {
+	const tripleCount = 20
+
+	// tamper corrupts all masks so that the self-test fails
+	// regardless of the selected positions.
+	tamper := func(rs []*big.Int) {
+		for i := range rs {
+			rs[i] = P256.modReduce(new(big.Int).Add(rs[i], big.NewInt(1)))
+		}
+	}
+
+	for _, cheat := range []bool{false, true} {
+		c0, c1 := p2p.Pipe()
+
+		generate := func(conn *p2p.Conn, role Role) ([]*Triple, error) {
+			session, err := NewSession(conn, role,
+				OTInsecure.New(rand.Reader))
+			if err != nil {
+				return nil, err
+			}
+			if err := session.SetVOLESelfTest(4); err != nil {
+				return nil, err
+			}
+			if cheat && role == Receiver {
+				tamperSession(session, tamper)
+			}
+			return P256.GenerateBeaverTriplesSession(session, tripleCount)
+		}
+
+		var err0, err1 error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			_, err0 = generate(c0, Sender)
+		})
+		wg.Go(func() {
+			_, err1 = generate(c1, Receiver)
+		})
+		wg.Wait()
+
+		if cheat {
+			if err0 == nil || err1 == nil {
+				t.Errorf("cheating VOLE: got %v/%v, expected error", err0, err1)
+			}
+		} else if err0 != nil || err1 != nil {
+			t.Errorf("peer0=%v, peer1=%v", err0, err1)
+		}
+	}
+
+	c0, _ := p2p.Pipe()
+	session, err := NewSession(c0, Sender, OTInsecure.New(rand.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.SetVOLESelfTest(-1) == nil {
+		t.Errorf("SetVOLESelfTest(-1) succeeded")
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -10,6 +10,12 @@ import (
 	"fmt"
 )
 
+// Alert sends the alert to the peer. The fatal alerts close the
+// connection and the function returns the alert as an error.
+func (conn *Conn) Alert(desc AlertDescription) error {
+	return conn.alert(desc)
+}
+
 func (conn *Conn) alert(desc AlertDescription) error {
 	var buf [2]byte
 
@@ -22,6 +28,11 @@ func (conn *Conn) alert(desc AlertDescription) error {
 	if err != nil {
 		return fmt.Errorf("write %w failed: %w", desc, err)
 	}
+	conn.onAlert(true, desc)
+	if desc == AlertCloseNotify || desc.Level() == AlertLevelFatal {
+		conn.closeSent = true
+	}
+
 	if desc.Level() == AlertLevelWarning {
 		return nil
 	}
@@ -34,6 +45,12 @@ func (conn *Conn) alert(desc AlertDescription) error {
 	return desc
 }
 
+func (conn *Conn) onAlert(sent bool, desc AlertDescription) {
+	if conn.config.OnAlert != nil {
+		conn.config.OnAlert(sent, desc)
+	}
+}
+
 func (conn *Conn) alertf(desc AlertDescription, format string,
 	a ...interface{}) error {
 
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -7,9 +7,11 @@
 package tls
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"testing"
 )
 
@@ -45,3 +47,173 @@ func TestAlertsAsErrors(t *testing.T) {
 		t.Errorf("%v is not tls.AlertDescription\n", err)
 	}
 }
+
+type alertEvent struct {
+	sent bool
+	desc AlertDescription
+}
+
+func TestOnAlertNoCommonGroup(t *testing.T) {
+	cc, sc := net.Pipe()
+	defer cc.Close()
+
+	var serverAlerts []alertEvent
+	server := NewConnection(sc, &Config{
+		OnAlert: func(sent bool, desc AlertDescription) {
+			serverAlerts = append(serverAlerts, alertEvent{sent, desc})
+		},
+	})
+	errC := make(chan error)
+	go func() {
+		_, err := server.ServerHandshake()
+		errC <- err
+	}()
+
+	var clientAlerts []alertEvent
+	client := NewConnection(cc, &Config{
+		OnAlert: func(sent bool, desc AlertDescription) {
+			clientAlerts = append(clientAlerts, alertEvent{sent, desc})
+		},
+	})
+	client.transcript = sha256.New()
+
+	// ClientHello offering only the unsupported X25519 group.
+	hello := &ClientHello{
+		LegacyVersion: VersionTLS12,
+		CipherSuites: []CipherSuite{
+			CipherTLSChacha20Poly1305Sha256,
+		},
+		LegacyCompressionMethods: []byte{0},
+		Extensions: []Extension{
+			NewExtension(ETSupportedGroups, GroupX25519),
+			NewExtension(ETSignatureAlgorithms,
+				SigSchemeEcdsaSecp256r1Sha256),
+			NewExtension(ETSupportedVersions, VersionTLS13),
+		},
+	}
+	data, err := Marshal(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.writeHandshakeMsg(HTClientHello, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct, data, err := client.ReadRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct != CTAlert {
+		t.Fatalf("got %v, expected %v", ct, CTAlert)
+	}
+	err = client.recvAlert(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = <-errC
+	if !errors.Is(err, AlertHandshakeFailure) {
+		t.Errorf("handshake error %v, expected %v", err, AlertHandshakeFailure)
+	}
+
+	expected := alertEvent{true, AlertHandshakeFailure}
+	if len(serverAlerts) != 1 || serverAlerts[0] != expected {
+		t.Errorf("server alerts %v, expected [%v]", serverAlerts, expected)
+	}
+	expected.sent = false
+	if len(clientAlerts) != 1 || clientAlerts[0] != expected {
+		t.Errorf("client alerts %v, expected [%v]", clientAlerts, expected)
+	}
+}
+
+func TestCloseNotify(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer sc.Close()
+
+	server := NewConnection(sc, newTestServerConfig(t))
+	errC := make(chan error)
+	go func() {
+		errC <- serverHandshake(server)
+	}()
+
+	var clientAlerts []alertEvent
+	client := NewConnection(cc, &Config{
+		OnAlert: func(sent bool, desc AlertDescription) {
+			clientAlerts = append(clientAlerts, alertEvent{sent, desc})
+		},
+	})
+	err := client.ClientHandshake("")
+	if err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	err = <-errC
+	if err != nil {
+		t.Fatalf("server handshake failed: %v", err)
+	}
+
+	// The second Close does not send another close_notify.
+	err = client.Close()
+	if err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	client.Close()
+
+	expected := []alertEvent{{true, AlertCloseNotify}}
+	if len(clientAlerts) != len(expected) ||
+		clientAlerts[0] != expected[0] {
+		t.Errorf("got alerts %v, expected %v", clientAlerts, expected)
+	}
+
+	ct, data, err := server.ReadRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct != CTAlert {
+		t.Fatalf("got %v, expected %v", ct, CTAlert)
+	}
+	if len(data) != 2 || AlertLevel(data[0]) != AlertLevelWarning ||
+		AlertDescription(data[1]) != AlertCloseNotify {
+		t.Fatalf("invalid close_notify: %x", data)
+	}
+	err = server.recvAlert(data)
+	if err != nil {
+		t.Errorf("recvAlert failed: %v", err)
+	}
+	_, err = server.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Errorf("got %v, expected %v", err, io.EOF)
+	}
+}
+
+func TestCloseNotifyGoServer(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer sc.Close()
+
+	server := newGoServer(t, sc)
+	errC := make(chan error)
+	go func() {
+		err := server.Handshake()
+		if err == nil {
+			// The encrypted close_notify is a clean EOF.
+			_, err = server.Read(make([]byte, 1))
+		}
+		errC <- err
+	}()
+
+	client := NewConnection(cc, &Config{
+		ProtectRecords: true,
+	})
+	err := client.ClientHandshake("localhost")
+	if err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	err = client.Close()
+	if err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	err = <-errC
+	if err != io.EOF {
+		t.Errorf("got %v, expected %v", err, io.EOF)
+	}
+}
@@ -24,30 +24,11 @@ func (conn *Conn) keydbgf(format string, a ...interface{}) {
 	}
 }
 
-// HKDF-Expand-Label as per TLS 1.3 spec: 7.1. Key Schedule, page 91
+// HKDF-Expand-Label with the cipher suite hash SHA-256.
 func hkdfExpandLabel(secret []byte, label string, context []byte,
 	length int) []byte {
 
-	// struct {
-	//     uint16 length = Length;
-	//     opaque label<7..255> = "tls13 " + Label;
-	//     opaque context<0..255> = Context;
-	// } HkdfLabel;
-
-	tls13 := []byte("tls13 ")
-	var hkdfLabel []byte
-	hkdfLabel = make([]byte, 0, 2+1+len(tls13)+len(label)+1+len(context))
-	hkdfLabel = append(hkdfLabel, byte(length>>8), byte(length))
-	hkdfLabel = append(hkdfLabel, byte(len(tls13)+len(label)))
-	hkdfLabel = append(hkdfLabel, tls13...)
-	hkdfLabel = append(hkdfLabel, []byte(label)...)
-	hkdfLabel = append(hkdfLabel, byte(len(context)))
-	hkdfLabel = append(hkdfLabel, context...)
-
-	out := make([]byte, length)
-	hkdf.ExpandTLS13(secret, hkdfLabel, out)
-
-	return out
+	return hkdf.ExpandLabel(secret, label, context, length, sha256.New)
 }
 
 // Derive secret using HKDF-Expand-Label
@@ -111,6 +92,7 @@ func (conn *Conn) deriveHandshakeKeys(server bool) error {
 		conn.writeCipher = clientCipher
 		conn.readCipher = serverCipher
 	}
+	conn.writeCipher.padding = conn.config.RecordPadding
 
 	return nil
 }
@@ -158,10 +140,58 @@ func (conn *Conn) deriveKeys(server bool, transcript []byte) error {
 	if server {
 		conn.writeCipher = serverCipher
 		conn.readCipher = clientCipher
+		conn.writeAppTr = serverAppTr
+		conn.readAppTr = clientAppTr
 	} else {
 		conn.writeCipher = clientCipher
 		conn.readCipher = serverCipher
+		conn.writeAppTr = clientAppTr
+		conn.readAppTr = serverAppTr
 	}
+	conn.writeCipher.padding = conn.config.RecordPadding
+
+	return nil
+}
+
+// updateTrafficSecret computes the next generation application
+// traffic secret: RFC-8446: 7.2. Updating Traffic Secrets, page 95.
+func updateTrafficSecret(secret []byte) []byte {
+	return hkdfExpandLabel(secret, "traffic upd", nil, sha256.Size)
+}
+
+// newTrafficCipher creates a cipher for the traffic secret. The
+// cipher's sequence number starts from 0.
+func newTrafficCipher(secret []byte) (*Cipher, error) {
+	key := hkdfExpandLabel(secret, "key", nil, 16)
+	iv := hkdfExpandLabel(secret, "iv", nil, 12)
+	return NewCipher(key, iv)
+}
+
+func (conn *Conn) updateWriteKeys() error {
+	secret := updateTrafficSecret(conn.writeAppTr)
+	cipher, err := newTrafficCipher(secret)
+	if err != nil {
+		return err
+	}
+	cipher.padding = conn.config.RecordPadding
+
+	conn.keydbgf(" - Update write traffic secret\n")
+	conn.writeAppTr = secret
+	conn.writeCipher = cipher
+
+	return nil
+}
+
+func (conn *Conn) updateReadKeys() error {
+	secret := updateTrafficSecret(conn.readAppTr)
+	cipher, err := newTrafficCipher(secret)
+	if err != nil {
+		return err
+	}
+
+	conn.keydbgf(" - Update read traffic secret\n")
+	conn.readAppTr = secret
+	conn.readCipher = cipher
 
 	return nil
 }
@@ -201,17 +231,28 @@ func (conn *Conn) finished(server bool) []byte {
 	finishedKey := hkdfExpandLabel(baseKey, "finished", nil, sha256.Size)
 	hash := hmac.New(sha256.New, finishedKey)
 	digest := conn.transcript.Sum(nil)
-	fmt.Printf("FinishedDigest:\n%s", hex.Dump(digest))
+	conn.keydbgf("FinishedDigest:\n%s", hex.Dump(digest))
 	hash.Write(digest)
 	return hash.Sum(nil)
 }
 
+// maxInnerPlaintext defines the maximum length of the
+// TLSInnerPlaintext: 2^14 bytes of content and the content type.
+const maxInnerPlaintext = 1<<14 + 1
+
+// AESGCMRecordLimit defines the maximum number of records to protect
+// with one AES-GCM key: RFC-8446: 5.5. Limits on Key Usage, page 85.
+const AESGCMRecordLimit = 23726566 // 2^24.5
+
 // Cipher implements an AEAD cipher instance.
 type Cipher struct {
-	cipher cipher.AEAD
-	iv     []byte
-	seq    uint64
-	ivSeq  []byte
+	cipher  cipher.AEAD
+	iv      []byte
+	seq     uint64
+	ivSeq   []byte
+	padding func(plaintextLen int) int
+	records uint64
+	bytes   uint64
 }
 
 // NewCipher creates a new Cipher for the key and iv.
@@ -249,7 +290,13 @@ func (cipher *Cipher) Encrypt(ct ContentType, data []byte) []byte {
 	//     opaque encrypted_record[TLSCiphertext.length];
 	// } TLSCiphertext;
 
-	plaintext := make([]byte, len(data)+1)
+	var pad int
+	if cipher.padding != nil {
+		pad = min(cipher.padding(len(data)), maxInnerPlaintext-len(data)-1)
+		pad = max(pad, 0)
+	}
+
+	plaintext := make([]byte, len(data)+1+pad)
 	copy(plaintext, data)
 	plaintext[len(data)] = byte(ct)
 
@@ -263,10 +310,24 @@ func (cipher *Cipher) Encrypt(ct ContentType, data []byte) []byte {
 
 	// IV.
 	iv := cipher.IV()
+	cipher.count(len(data))
 
 	return cipher.cipher.Seal(nil, iv, plaintext, hdr[:])
 }
 
+// count records a record with n bytes of content protected with the
+// cipher.
+func (cipher *Cipher) count(n int) {
+	cipher.records++
+	cipher.bytes += uint64(n)
+}
+
+// Usage returns the number of records and content bytes protected
+// with the cipher.
+func (cipher *Cipher) Usage() (records, bytes uint64) {
+	return cipher.records, cipher.bytes
+}
+
 // Decrypt decrypts the data and returns its content type and
 // decrypted content.
 func (cipher *Cipher) Decrypt(data []byte) (ContentType, []byte, error) {
@@ -284,13 +345,11 @@ func (cipher *Cipher) Decrypt(data []byte) (ContentType, []byte, error) {
 	}
 
 	// Remove padding and resolve the original content type.
-	var end int
-	for end = len(plain) - 1; end > 0; end-- {
-		if plain[end] != 0 {
-			break
-		}
+	end := len(plain) - 1
+	for end >= 0 && plain[end] == 0 {
+		end--
 	}
-	if end == 0 {
+	if end < 0 {
 		return CTInvalid, nil, AlertUnexpectedMessage
 	}
 
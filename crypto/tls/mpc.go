@@ -14,7 +14,7 @@ import (
 // MakeServerHello makes the server_hello message.
 func (conn *Conn) MakeServerHello(kex []byte) ([]byte, error) {
 	keyShare := &KeyShareEntry{
-		Group:       GroupSecp256r1,
+		Group:       conn.peerKeyShare.Group,
 		KeyExchange: kex,
 	}
 	req := &ServerHello{
@@ -32,9 +32,17 @@ func (conn *Conn) MakeServerHello(kex []byte) ([]byte, error) {
 			},
 		},
 	}
-	_, err := rand.Read(req.Random[:])
-	if err != nil {
-		return nil, conn.internalErrorf("failed to create random: %v", err)
+	// We only speak TLS 1.3 so our random must not be mistaken for a
+	// HelloRetryRequest or carry a downgrade sentinel.
+	for {
+		_, err := rand.Read(req.Random[:])
+		if err != nil {
+			return nil, conn.internalErrorf("failed to create random: %v", err)
+		}
+		if req.Random != HelloRetryRequestRandom &&
+			!IsDowngradeRandom(req.Random) {
+			break
+		}
 	}
 	data, err := Marshal(req)
 	if err != nil {
@@ -47,6 +55,41 @@ func (conn *Conn) MakeServerHello(kex []byte) ([]byte, error) {
 	return data, nil
 }
 
+// ClientHandshakeHello runs the client handshake until the
+// ServerHello message. The kex argument specifies the client's
+// secp256r1 key share. The function returns the server's key share.
+// The transcript contains the ClientHello and ServerHello messages
+// when the function returns. The caller computes the shared secret
+// and continues the handshake from the MPC space.
+func (conn *Conn) ClientHandshakeHello(kex []byte) ([]byte, error) {
+	err := conn.sendClientHello(kex)
+	if err != nil {
+		return nil, err
+	}
+	_, data, err := conn.readHandshakeMsg()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, conn.decodeErrorf("truncated handshake")
+	}
+	ht := HandshakeType(data[0])
+	if ht != HTServerHello {
+		return nil, conn.alertf(AlertUnexpectedMessage,
+			"%s: invalid handshake message: %v", conn.handshakeState, ht)
+	}
+	if int(bo.Uint32(data)&0xffffff)+4 != len(data) {
+		return nil, conn.decodeErrorf("handshake length mismatch")
+	}
+	err = conn.processServerHello(data)
+	if err != nil {
+		return nil, err
+	}
+	conn.WriteTranscript(data)
+
+	return conn.peerKeyShare.KeyExchange, nil
+}
+
 // MakeEncryptedExtensions makes the encrypted_extensions message.
 func (conn *Conn) MakeEncryptedExtensions() ([]byte, error) {
 	// EncryptedExtensions.
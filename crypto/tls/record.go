@@ -1,43 +1,115 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
 
 package tls
 
-// ReadRecord reads a record layer record.
-func (conn *Conn) ReadRecord() (ContentType, []byte, error) {
-	// Read record header.
-	for i := 0; i < 5; {
-		n, err := conn.conn.Read(conn.rbuf[i:5])
+// maxFragment defines the maximum length of the record content:
+// RFC-8446: 5.1. Record Layer, page 78.
+const maxFragment = 1 << 14
+
+// recordHeaderLen defines the length of the record header.
+const recordHeaderLen = 5
+
+// fill reads data from the underlying connection until the read
+// buffer has at least n unconsumed bytes. The bytes are buffered
+// from rofs. A single read can return more than one record and the
+// bytes after the current record remain in the buffer for the next
+// ReadRecord call.
+func (conn *Conn) fill(n int) error {
+	if conn.rend-conn.rofs >= n {
+		return nil
+	}
+	if conn.rofs == conn.rend {
+		conn.rofs = 0
+		conn.rend = 0
+	} else if conn.rofs+n > len(conn.rbuf) {
+		conn.rend = copy(conn.rbuf, conn.rbuf[conn.rofs:conn.rend])
+		conn.rofs = 0
+	}
+	for conn.rend-conn.rofs < n {
+		l, err := conn.conn.Read(conn.rbuf[conn.rend:])
+		conn.rend += l
 		if err != nil {
-			return CTInvalid, nil, err
+			if conn.rend-conn.rofs >= n {
+				return nil
+			}
+			return err
 		}
-		i += n
 	}
-	ct := ContentType(conn.rbuf[0])
-	legacyVersion := ProtocolVersion(bo.Uint16(conn.rbuf[1:3]))
-	length := int(bo.Uint16(conn.rbuf[3:5]))
+	return nil
+}
+
+// ReadRecord reads a record layer record. The returned data is valid
+// until the next ReadRecord call. If the connection protects its
+// records, ReadRecord decrypts the protected records and returns their
+// inner content type.
+func (conn *Conn) ReadRecord() (ContentType, []byte, error) {
+	// Read record header.
+	err := conn.fill(recordHeaderLen)
+	if err != nil {
+		return CTInvalid, nil, err
+	}
+	hdr := conn.rbuf[conn.rofs:]
+	ct := ContentType(hdr[0])
+	legacyVersion := ProtocolVersion(bo.Uint16(hdr[1:3]))
+	length := int(bo.Uint16(hdr[3:5]))
 
 	conn.Debugf("<< %s %s[%d]\n", legacyVersion, ct, length)
 
-	for i := 0; i < length; {
-		n, err := conn.conn.Read(conn.rbuf[i:length])
+	err = conn.fill(recordHeaderLen + length)
+	if err != nil {
+		return CTInvalid, nil, err
+	}
+	start := conn.rofs + recordHeaderLen
+	data := conn.rbuf[start : start+length]
+	conn.rofs = start + length
+
+	if conn.config.ProtectRecords && conn.readCipher != nil &&
+		ct == CTApplicationData {
+		ct, data, err := conn.readCipher.Decrypt(data)
 		if err != nil {
-			return CTInvalid, nil, err
+			return CTInvalid, nil,
+				conn.alertf(AlertBadRecordMAC, "decrypt failed: %v", err)
 		}
-		i += n
+		return ct, data, nil
 	}
 
-	data := conn.rbuf[:length]
-
 	return ct, data, nil
 }
 
-// WriteRecord writes a record layer record.
+// WriteRecord writes a record layer record. If the connection
+// protects its records, WriteRecord encrypts the data with the write
+// cipher. The plaintext data longer than maxFragment is split into
+// multiple records. The records which the MPC programs have already
+// encrypted are written as-is.
 func (conn *Conn) WriteRecord(ct ContentType, data []byte) error {
-	var hdr [5]byte
+	protect := conn.config.ProtectRecords && conn.writeCipher != nil &&
+		ct != CTChangeCipherSpec
+
+	if protect || conn.writeCipher == nil {
+		for len(data) > maxFragment {
+			err := conn.writeRecord(ct, data[:maxFragment], protect)
+			if err != nil {
+				return err
+			}
+			data = data[maxFragment:]
+		}
+	}
+	return conn.writeRecord(ct, data, protect)
+}
+
+func (conn *Conn) writeRecord(ct ContentType, data []byte,
+	protect bool) error {
+
+	var hdr [recordHeaderLen]byte
+
+	if protect {
+		data = conn.writeCipher.Encrypt(ct, data)
+		ct = CTApplicationData
+	}
 
 	hdr[0] = byte(ct)
 	bo.PutUint16(hdr[1:3], uint16(VersionTLS12))
@@ -0,0 +1,162 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package tls
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// chunkConn delivers its data in chunks of the specified size. The
+// chunk size 0 delivers all remaining data in one Read.
+type chunkConn struct {
+	net.Conn
+	data  []byte
+	chunk int
+}
+
+func (c *chunkConn) Read(p []byte) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if c.chunk > 0 {
+		n = min(n, c.chunk)
+	}
+	n = copy(p[:n], c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func makeRecord(ct ContentType, data []byte) []byte {
+	var hdr [recordHeaderLen]byte
+	hdr[0] = byte(ct)
+	bo.PutUint16(hdr[1:3], uint16(VersionTLS12))
+	bo.PutUint16(hdr[3:5], uint16(len(data)))
+	return append(hdr[:], data...)
+}
+
+func TestReadRecordBuffering(t *testing.T) {
+	records := []struct {
+		ct   ContentType
+		data []byte
+	}{
+		{CTHandshake, []byte("first handshake record")},
+		{CTHandshake, []byte("second")},
+		{CTApplicationData, bytes.Repeat([]byte{0x42}, 65535)},
+		{CTAlert, []byte{1, 0}},
+	}
+	var stream []byte
+	for _, r := range records {
+		stream = append(stream, makeRecord(r.ct, r.data)...)
+	}
+
+	for _, chunk := range []int{0, 1, 3, 1000} {
+		conn := NewConnection(&chunkConn{
+			data:  bytes.Clone(stream),
+			chunk: chunk,
+		}, &Config{})
+		for idx, r := range records {
+			ct, data, err := conn.ReadRecord()
+			if err != nil {
+				t.Fatalf("chunk %v: record %v: %v", chunk, idx, err)
+			}
+			if ct != r.ct {
+				t.Errorf("chunk %v: record %v: got %v, expected %v",
+					chunk, idx, ct, r.ct)
+			}
+			if !bytes.Equal(data, r.data) {
+				t.Errorf("chunk %v: record %v: data mismatch",
+					chunk, idx)
+			}
+		}
+		_, _, err := conn.ReadRecord()
+		if err != io.EOF {
+			t.Errorf("chunk %v: got %v, expected %v", chunk, err, io.EOF)
+		}
+	}
+}
+
+func TestReadRecordTruncated(t *testing.T) {
+	record := makeRecord(CTHandshake, []byte("truncated"))
+	conn := NewConnection(&chunkConn{
+		data: record[:len(record)-1],
+	}, &Config{})
+	_, _, err := conn.ReadRecord()
+	if err != io.EOF {
+		t.Errorf("got %v, expected %v", err, io.EOF)
+	}
+}
+
+func TestWriteRecordFragmentation(t *testing.T) {
+	key := make([]byte, 16)
+	iv := make([]byte, 12)
+	data := make([]byte, 40*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	expected := []int{maxFragment, maxFragment, len(data) - 2*maxFragment}
+
+	for _, protect := range []bool{false, true} {
+		cc, sc := newTestConns(t)
+
+		config := &Config{
+			ProtectRecords: protect,
+		}
+		writer := NewConnection(cc, config)
+		reader := NewConnection(sc, config)
+		if protect {
+			var err error
+			writer.writeCipher, err = NewCipher(key, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader.readCipher, err = NewCipher(key, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		errC := make(chan error)
+		go func() {
+			errC <- writer.WriteRecord(CTApplicationData, data)
+		}()
+
+		var result []byte
+		for idx, length := range expected {
+			ct, record, err := reader.ReadRecord()
+			if err != nil {
+				t.Fatalf("protect=%v: record %v: %v", protect, idx, err)
+			}
+			if ct != CTApplicationData {
+				t.Errorf("protect=%v: record %v: got %v, expected %v",
+					protect, idx, ct, CTApplicationData)
+			}
+			if len(record) != length {
+				t.Errorf("protect=%v: record %v: got %v bytes, expected %v",
+					protect, idx, len(record), length)
+			}
+			result = append(result, record...)
+		}
+		if err := <-errC; err != nil {
+			t.Fatalf("protect=%v: write failed: %v", protect, err)
+		}
+		if !bytes.Equal(result, data) {
+			t.Errorf("protect=%v: data mismatch", protect)
+		}
+		if protect {
+			records, size := writer.writeCipher.Usage()
+			if records != 3 || size != uint64(len(data)) {
+				t.Errorf("got usage %v/%v, expected 3/%v",
+					records, size, len(data))
+			}
+		}
+		cc.Close()
+		sc.Close()
+	}
+}
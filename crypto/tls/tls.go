@@ -13,6 +13,7 @@ import (
 	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -23,7 +24,10 @@ import (
 	"hash"
 	"io"
 	"net"
+	"slices"
 	"time"
+
+	"golang.org/x/sys/cpu"
 )
 
 var (
@@ -38,7 +42,7 @@ var (
 	}
 	supportedGroups = map[NamedGroup]bool{
 		GroupSecp256r1: true,
-		GroupX25519:    false,
+		GroupX25519:    true,
 	}
 	supportedSignatureSchemes = map[SignatureScheme]bool{
 		SigSchemeEcdsaSecp256r1Sha256: true,
@@ -54,6 +58,208 @@ type Config struct {
 	PrivateKey  *ecdsa.PrivateKey
 	Certificate *x509.Certificate
 	ServerName  string
+
+	// NextProtos specifies the application protocols the client
+	// offers with the ALPN extension, in the order of preference.
+	NextProtos []string
+
+	// OnAlert is called for each alert the connection sends or
+	// receives. The sent argument tells if the alert was sent to the
+	// peer or received from it.
+	OnAlert func(sent bool, desc AlertDescription)
+
+	// OnServerFinished is called after the server has sent its
+	// Finished message but before it has received the client's
+	// Finished. The callback can send 0.5-RTT application data with
+	// Conn.Write0RTT.
+	OnServerFinished func(conn *Conn) error
+
+	// RecordPadding returns the number of zero padding bytes to add
+	// to an encrypted record with plaintextLen bytes of content. The
+	// padding hides the content length from the network observers.
+	// If nil, the records are not padded. See PadToBlock for a fixed
+	// block size padding policy.
+	RecordPadding func(plaintextLen int) int
+
+	// KeyUpdateRecords specifies how many records the connection
+	// sends with one application traffic key. When the limit is
+	// reached, the connection sends a KeyUpdate and continues with
+	// new keys. The KeyUpdate message is the last record of the
+	// limit. If 0, the limit is AESGCMRecordLimit.
+	KeyUpdateRecords uint64
+
+	// KeyUpdateBytes specifies how many content bytes the connection
+	// sends with one application traffic key before it updates its
+	// keys. If 0, the number of bytes is not limited.
+	KeyUpdateBytes uint64
+
+	// CipherSuites specifies the server's cipher suite preference
+	// order. If nil, the order is selected by CipherPreference.
+	CipherSuites []CipherSuite
+
+	// CipherPreference specifies the server's cipher suite
+	// preference policy when CipherSuites is nil.
+	CipherPreference CipherPreference
+
+	// GetCertificate returns the server certificate and private key
+	// for the server name the client requested with the server_name
+	// extension. The serverName is empty if the client did not send
+	// the extension. If GetCertificate is nil or it returns a nil
+	// certificate, the server uses Certificate and PrivateKey. If
+	// GetCertificate returns an error, the server aborts the
+	// handshake with the unrecognized_name alert.
+	GetCertificate func(serverName string) (*x509.Certificate,
+		*ecdsa.PrivateKey, error)
+
+	// Groups specifies the key exchange groups the server accepts,
+	// in the order of preference. If nil, the server accepts only
+	// secp256r1 which is the group the MPC key exchange implements.
+	// The server returns the client's key share from ServerHandshake
+	// and the caller computes the shared secret with the
+	// Conn.Group's curve.
+	Groups []NamedGroup
+
+	// ProtectRecords specifies if the connection protects its
+	// records with the negotiated traffic keys. By default, the
+	// record protection is implemented in the MPC programs and the
+	// connection reads and writes the records as-is. Clients
+	// connecting to standard TLS servers must set ProtectRecords.
+	// The connection implements only the TLS_AES_128_GCM_SHA256
+	// record protection so clients with ProtectRecords offer only
+	// that cipher suite.
+	ProtectRecords bool
+}
+
+// CipherPreference defines the server's cipher suite preference
+// policies.
+type CipherPreference int
+
+// Cipher suite preference policies.
+const (
+	// PreferAuto prefers AES-GCM if the CPU has hardware AES support
+	// and ChaCha20-Poly1305 otherwise. Without hardware support,
+	// ChaCha20-Poly1305 is faster and it is constant-time.
+	PreferAuto CipherPreference = iota
+	// PreferAESGCM prefers the AES-GCM cipher suites.
+	PreferAESGCM
+	// PreferChaCha20 prefers the ChaCha20-Poly1305 cipher suite.
+	PreferChaCha20
+)
+
+// hasAESGCMHardware tests if the CPU has hardware support for
+// AES-GCM.
+var hasAESGCMHardware = (cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ) ||
+	(cpu.ARM64.HasAES && cpu.ARM64.HasPMULL) ||
+	(cpu.S390X.HasAES && cpu.S390X.HasAESGCM)
+
+// cipherSuitePreference returns the server's cipher suite preference
+// order.
+func (config *Config) cipherSuitePreference() []CipherSuite {
+	if config.CipherSuites != nil {
+		return config.CipherSuites
+	}
+	pref := config.CipherPreference
+	if pref == PreferAuto {
+		if hasAESGCMHardware {
+			pref = PreferAESGCM
+		} else {
+			pref = PreferChaCha20
+		}
+	}
+	if pref == PreferAESGCM {
+		return []CipherSuite{
+			CipherTLSAes128GcmSha256,
+			CipherTLSAes256GcmSha384,
+			CipherTLSChacha20Poly1305Sha256,
+		}
+	}
+	return []CipherSuite{
+		CipherTLSChacha20Poly1305Sha256,
+		CipherTLSAes128GcmSha256,
+		CipherTLSAes256GcmSha384,
+	}
+}
+
+// clientCipherSuites returns the cipher suites the client offers.
+// The connection implements the AES-128-GCM record protection. The
+// MPC record protection implements only ChaCha20-Poly1305, which is
+// also the only suite the servers of this package accept, so the
+// clients without ProtectRecords offer it too.
+func (config *Config) clientCipherSuites() []CipherSuite {
+	if config.ProtectRecords {
+		return []CipherSuite{
+			CipherTLSAes128GcmSha256,
+		}
+	}
+	return []CipherSuite{
+		CipherTLSAes128GcmSha256,
+		CipherTLSChacha20Poly1305Sha256,
+	}
+}
+
+// certificate returns the server certificate and private key for
+// the server name.
+func (config *Config) certificate(serverName string) (
+	*x509.Certificate, *ecdsa.PrivateKey, error) {
+
+	if config.GetCertificate != nil {
+		cert, priv, err := config.GetCertificate(serverName)
+		if err != nil || cert != nil {
+			return cert, priv, err
+		}
+	}
+	return config.Certificate, config.PrivateKey, nil
+}
+
+// groupPreference returns the server's key exchange group
+// preference order.
+func (config *Config) groupPreference() []NamedGroup {
+	if config.Groups != nil {
+		return config.Groups
+	}
+	return []NamedGroup{
+		GroupSecp256r1,
+	}
+}
+
+// acceptGroup tests if the server accepts the key exchange group.
+func (config *Config) acceptGroup(group NamedGroup) bool {
+	return supportedGroups[group] &&
+		slices.Contains(config.groupPreference(), group)
+}
+
+// orderCipherSuites orders the client's cipher suites by the
+// server's preference order pref. The suites missing from pref
+// follow in the client's order.
+func orderCipherSuites(pref, suites []CipherSuite) []CipherSuite {
+	var result []CipherSuite
+	for _, p := range pref {
+		if slices.Contains(suites, p) && !slices.Contains(result, p) {
+			result = append(result, p)
+		}
+	}
+	for _, suite := range suites {
+		if !slices.Contains(result, suite) {
+			result = append(result, suite)
+		}
+	}
+	return result
+}
+
+// ErrHandshakeNotCompleted is returned from the operations which
+// require the application traffic keys when the connection does not
+// have them.
+var ErrHandshakeNotCompleted = errors.New("handshake not completed")
+
+// PadToBlock returns a record padding policy that pads the record
+// content lengths to a multiple of the block size.
+func PadToBlock(size int) func(plaintextLen int) int {
+	return func(plaintextLen int) int {
+		if size <= 0 {
+			return 0
+		}
+		return (size - plaintextLen%size) % size
+	}
 }
 
 // Conn implements a TLS connection.
@@ -61,6 +267,8 @@ type Conn struct {
 	conn   net.Conn
 	config *Config
 	rbuf   []byte
+	rofs   int
+	rend   int
 
 	// Handshake.
 	handshakeState   HandshakeState
@@ -72,15 +280,21 @@ type Conn struct {
 	groups           []NamedGroup
 	signatureSchemes []SignatureScheme
 	peerKeyShare     *KeyShareEntry
+	version          ProtocolVersion
+	cipherSuite      CipherSuite
 	peerCert         *x509.Certificate
 	sharedSecret     []byte
 	handshakeSecret  []byte
 	clientHSTr       []byte
 	serverHSTr       []byte
+	writeAppTr       []byte
+	readAppTr        []byte
 
 	writeCipher *Cipher
 	readCipher  *Cipher
+	halfRTT     bool
 	readEOF     bool
+	closeSent   bool
 	appData     []byte
 }
 
@@ -115,7 +329,7 @@ func NewConnection(conn net.Conn, config *Config) *Conn {
 	return &Conn{
 		conn:   conn,
 		config: config,
-		rbuf:   make([]byte, 65536),
+		rbuf:   make([]byte, recordHeaderLen+65535),
 	}
 }
 
@@ -152,17 +366,132 @@ func (conn *Conn) readHandshakeMsg() (ContentType, []byte, error) {
 	}
 }
 
-// WriteTranscript updates the connection transcript with data.
+// ConnectionState records the negotiated parameters of the
+// connection. The fields are set during the handshake and they have
+// their zero values until the handshake has negotiated them.
+type ConnectionState struct {
+	// Version is the negotiated TLS protocol version.
+	Version ProtocolVersion
+
+	// HandshakeComplete tells if the handshake has completed. In the
+	// MPC handshake, the finished messages are processed in the MPC
+	// programs and the kernel tracks the handshake completion.
+	HandshakeComplete bool
+
+	// DidResume tells if the connection resumed a previous session.
+	// Session resumption is not supported and DidResume is always
+	// false.
+	DidResume bool
+
+	// CipherSuite is the negotiated cipher suite.
+	CipherSuite CipherSuite
+
+	// Group is the negotiated key exchange group.
+	Group NamedGroup
+
+	// NegotiatedProtocol is the application protocol negotiated with
+	// ALPN. The server does not select ALPN protocols so the
+	// negotiated protocol is always empty.
+	NegotiatedProtocol string
+
+	// ServerName is the server name the client sent in its
+	// server_name extension. For clients, it is the server name from
+	// the configuration.
+	ServerName string
+
+	// PeerCertificates are the certificates the peer sent, the leaf
+	// certificate first.
+	PeerCertificates []*x509.Certificate
+}
+
+// ConnectionState returns the connection's negotiated parameters.
+func (conn *Conn) ConnectionState() ConnectionState {
+	state := ConnectionState{
+		Version:           conn.version,
+		HandshakeComplete: conn.handshakeState == HSDone,
+		CipherSuite:       conn.cipherSuite,
+		Group:             conn.Group(),
+	}
+	if len(conn.serverNames) > 0 {
+		state.ServerName = conn.serverNames[0]
+	} else if conn.config != nil {
+		state.ServerName = conn.config.ServerName
+	}
+	if conn.peerCert != nil {
+		state.PeerCertificates = []*x509.Certificate{conn.peerCert}
+	}
+	return state
+}
+
+// CipherSuite returns the negotiated cipher suite.
+func (conn *Conn) CipherSuite() CipherSuite {
+	return conn.cipherSuite
+}
+
+// Group returns the negotiated key exchange group. It returns 0 if
+// the key exchange has not been negotiated.
+func (conn *Conn) Group() NamedGroup {
+	if conn.peerKeyShare == nil {
+		return 0
+	}
+	return conn.peerKeyShare.Group
+}
+
+// ServerNames returns the server names the client sent in its
+// server_name extension.
+func (conn *Conn) ServerNames() []string {
+	return conn.serverNames
+}
+
+// PeerCertificate returns the peer's certificate or nil if the peer
+// did not send a certificate.
+func (conn *Conn) PeerCertificate() *x509.Certificate {
+	return conn.peerCert
+}
+
+// WriteTranscript absorbs the handshake message data into the
+// connection transcript. The data must contain the full handshake
+// message, including the message type and length. The transcript
+// hash is selected by the negotiated cipher suite and it is
+// initialized when the connection receives or sends the ClientHello
+// message.
 func (conn *Conn) WriteTranscript(data []byte) {
 	conn.keydbgf("WriteTranscript:\n%s", hex.Dump(data))
 	conn.transcript.Write(data)
 }
 
-// Transcript returns the current connection transcript.
+// Transcript returns the current transcript hash digest,
+// Transcript-Hash(M1 || ... || Mn), over all handshake messages
+// written to the transcript. The function does not modify the
+// transcript. It returns nil if the transcript is not initialized.
 func (conn *Conn) Transcript() []byte {
+	if conn.transcript == nil {
+		return nil
+	}
 	return conn.transcript.Sum(nil)
 }
 
+// TranscriptReset replaces the current transcript with the synthetic
+// message_hash handshake message containing the current transcript
+// digest. This is used when the server sends a HelloRetryRequest:
+//
+//	Transcript-Hash(ClientHello1, HelloRetryRequest, ... Mn) =
+//	    Hash(message_hash ||        /* Handshake type */
+//	         00 00 Hash.length  ||  /* Handshake message length (bytes) */
+//	         Hash(ClientHello1) ||  /* Hash of ClientHello1 */
+//	         HelloRetryRequest  || ... || Mn)
+func (conn *Conn) TranscriptReset() {
+	var hdr [4]byte
+	hdr[0] = byte(HTMessageHash)
+	hdr[3] = byte(conn.transcript.Size())
+
+	digest := conn.transcript.Sum(nil)
+
+	conn.transcript.Reset()
+	conn.WriteTranscript(hdr[:])
+	conn.WriteTranscript(digest)
+}
+
 func (conn *Conn) writeHandshakeMsg(ht HandshakeType, data []byte) error {
 	// Set TypeLen
 	typeLen := uint32(ht)<<24 | uint32(len(data)-4)
@@ -173,18 +502,72 @@ func (conn *Conn) writeHandshakeMsg(ht HandshakeType, data []byte) error {
 	return conn.WriteRecord(CTHandshake, data)
 }
 
-// ClientHandshake runs the client handshake protocol.
-func (conn *Conn) ClientHandshake() error {
+// ClientHandshake runs the client handshake protocol. The serverName
+// specifies the server name for the server_name extension. If it is
+// empty, the client uses the server name from the configuration.
+func (conn *Conn) ClientHandshake(serverName string) error {
+	if len(serverName) == 0 {
+		serverName = conn.config.ServerName
+	}
+	if len(serverName) > 0 {
+		conn.serverNames = []string{serverName}
+	}
 	ecdhCurve := ecdh.P256()
 	ecdhPriv, err := ecdhCurve.GenerateKey(rand.Reader)
 	if err != nil {
 		return conn.internalErrorf("failed to generate DH key: %v", err)
 	}
+	err = conn.sendClientHello(ecdhPriv.PublicKey().Bytes())
+	if err != nil {
+		return err
+	}
+
+	// Process server messages until server's handshake is done.
+	for conn.handshakeState != HSServerDone {
+		_, data, err := conn.readHandshakeMsg()
+		if err != nil {
+			return err
+		}
+		err = conn.recvServerHandshake(data, ecdhCurve, ecdhPriv)
+		if err != nil {
+			return err
+		}
+	}
+	conn.handshakeState = HSServerDone
+
+	transcript := conn.transcript.Sum(nil)
 
-	// ClientHello
+	// Finished.
+	verifyData := conn.finished(false)
+	var vd32 [32]byte
+	copy(vd32[0:], verifyData)
+	finished := &Finished{
+		VerifyData: vd32,
+	}
+	data, err := Marshal(finished)
+	if err != nil {
+		return conn.internalErrorf("marshal failed: %v", err)
+	}
+	conn.Debugf(" > Finished: %v bytes\n", len(data))
+	err = conn.writeHandshakeMsg(HTFinished, data)
+	if err != nil {
+		return conn.internalErrorf("write failed: %v", err)
+	}
+	conn.handshakeState = HSDone
 
+	err = conn.deriveKeys(false, transcript)
+	if err != nil {
+		return conn.internalErrorf("key derivation failed: %v", err)
+	}
+
+	return nil
+}
+
+// sendClientHello sends the ClientHello message with the secp256r1
+// key share kex and initializes the transcript.
+func (conn *Conn) sendClientHello(kex []byte) error {
 	var legacySessionID [32]byte
-	_, err = rand.Read(legacySessionID[:])
+	_, err := rand.Read(legacySessionID[:])
 	if err != nil {
 		return conn.internalErrorf("failed to create legacy_session_id: %v",
 			err)
@@ -192,15 +575,13 @@ func (conn *Conn) ClientHandshake() error {
 
 	keyShare := &KeyShareEntry{
 		Group:       GroupSecp256r1,
-		KeyExchange: ecdhPriv.PublicKey().Bytes(),
+		KeyExchange: kex,
 	}
 
 	conn.clientHello = &ClientHello{
-		LegacyVersion:   VersionTLS12,
-		LegacySessionID: legacySessionID[:],
-		CipherSuites: []CipherSuite{
-			CipherTLSAes128GcmSha256,
-		},
+		LegacyVersion:            VersionTLS12,
+		LegacySessionID:          legacySessionID[:],
+		CipherSuites:             conn.config.clientCipherSuites(),
 		LegacyCompressionMethods: []byte{0},
 		Extensions: []Extension{
 			NewExtension(ETSupportedGroups, GroupSecp256r1),
@@ -221,12 +602,23 @@ func (conn *Conn) ClientHandshake() error {
 			NewExtension(ETKeyShare, keyShare),
 		},
 	}
-	if len(conn.config.ServerName) > 0 {
+	if len(conn.serverNames) > 0 {
 		conn.clientHello.Extensions = append(conn.clientHello.Extensions,
 			NewExtension(ETServerName, &ServerName{
-				Hostname: []byte(conn.config.ServerName),
+				Hostname: []byte(conn.serverNames[0]),
 			}))
 	}
+	if len(conn.config.NextProtos) > 0 {
+		var protos []interface{}
+		for _, proto := range conn.config.NextProtos {
+			if len(proto) == 0 || len(proto) > 255 {
+				return conn.internalErrorf("invalid ALPN protocol: %q", proto)
+			}
+			protos = append(protos, ProtocolName(proto))
+		}
+		conn.clientHello.Extensions = append(conn.clientHello.Extensions,
+			NewExtension(ETApplicationLayerProtocolNegotiation, protos...))
+	}
 
 	_, err = rand.Read(conn.clientHello.Random[:])
 	if err != nil {
@@ -248,44 +640,6 @@ func (conn *Conn) ClientHandshake() error {
 	}
 	conn.handshakeState = HSServerHello
 
-	// Process server messages until server's handshake is done.
-	for conn.handshakeState != HSServerDone {
-		_, data, err = conn.readHandshakeMsg()
-		if err != nil {
-			return err
-		}
-		err = conn.recvServerHandshake(data, ecdhCurve, ecdhPriv)
-		if err != nil {
-			return err
-		}
-	}
-	conn.handshakeState = HSServerDone
-
-	transcript := conn.transcript.Sum(nil)
-
-	// Finished.
-	verifyData := conn.finished(false)
-	var vd32 [32]byte
-	copy(vd32[0:], verifyData)
-	finished := &Finished{
-		VerifyData: vd32,
-	}
-	data, err = Marshal(finished)
-	if err != nil {
-		return conn.internalErrorf("marshal failed: %v", err)
-	}
-	conn.Debugf(" > Finished: %v bytes\n", len(data))
-	err = conn.writeHandshakeMsg(HTFinished, data)
-	if err != nil {
-		return conn.internalErrorf("write failed: %v", err)
-	}
-	conn.handshakeState = HSDone
-
-	err = conn.deriveKeys(false, transcript)
-	if err != nil {
-		return conn.internalErrorf("key derivation failed: %v", err)
-	}
-
 	return nil
 }
 
@@ -326,7 +680,9 @@ func (conn *Conn) ServerHandshake() ([]byte, error) {
 	}
 
 	// Init transcript.
-	conn.transcript = conn.cipherSuites[0].Hash()
+	conn.version = VersionTLS13
+	conn.cipherSuite = conn.cipherSuites[0]
+	conn.transcript = conn.cipherSuite.Hash()
 	conn.WriteTranscript(data)
 
 	if conn.peerKeyShare == nil {
@@ -334,18 +690,10 @@ func (conn *Conn) ServerHandshake() ([]byte, error) {
 
 		// ClientHello1 is replaced with a special synthetic handshake
 		// message.
-
-		var hdr [4]byte
-		hdr[0] = byte(HTMessageHash)
-		hdr[3] = byte(conn.transcript.Size())
-
-		digest := conn.transcript.Sum(nil)
-
-		conn.transcript.Reset()
-		conn.WriteTranscript(hdr[:])
-		conn.WriteTranscript(digest)
+		conn.TranscriptReset()
 
 		// Create HelloRetryRequest message.
+		group := conn.groups[0]
 		req := &ServerHello{
 			LegacyVersion:   VersionTLS12,
 			Random:          HelloRetryRequestRandom,
@@ -358,7 +706,7 @@ func (conn *Conn) ServerHandshake() ([]byte, error) {
 				},
 				Extension{
 					Type: ETKeyShare,
-					Data: GroupSecp256r1.Bytes(),
+					Data: group.Bytes(),
 				},
 			},
 		}
@@ -387,6 +735,11 @@ func (conn *Conn) ServerHandshake() ([]byte, error) {
 		if conn.peerKeyShare == nil {
 			return nil, conn.alert(AlertHandshakeFailure)
 		}
+		if conn.peerKeyShare.Group != group {
+			return nil, conn.illegalParameterf(
+				"key_share group %v, expected %v",
+				conn.peerKeyShare.Group, group)
+		}
 	}
 	conn.handshakeState = HSServerHello
 
@@ -429,7 +782,16 @@ func (conn *Conn) ServerHandshakeServerHello(sharedSecret, kex []byte) error {
 	}
 
 	// Certificate.
-	data, err = conn.MakeCertificate(conn.config.Certificate)
+	var serverName string
+	if len(conn.serverNames) > 0 {
+		serverName = conn.serverNames[0]
+	}
+	cert, priv, err := conn.config.certificate(serverName)
+	if err != nil {
+		return conn.alertf(AlertUnrecognizedName, "server name %q: %v",
+			serverName, err)
+	}
+	data, err = conn.MakeCertificate(cert)
 	if err != nil {
 		return conn.internalErrorf("make certificate failed: %v", err)
 	}
@@ -442,7 +804,7 @@ func (conn *Conn) ServerHandshakeServerHello(sharedSecret, kex []byte) error {
 	// CertificateVerify.
 	hashFunc := crypto.SHA256
 	digest := conn.CertificateVerify(hashFunc)
-	signature, err := conn.config.PrivateKey.Sign(rand.Reader, digest, hashFunc)
+	signature, err := priv.Sign(rand.Reader, digest, hashFunc)
 	if err != nil {
 		return conn.internalErrorf("make certificate_verify failed: %v", err)
 	}
@@ -468,16 +830,32 @@ func (conn *Conn) ServerHandshakeServerHello(sharedSecret, kex []byte) error {
 	}
 	conn.handshakeState = HSServerDone
 
-	// Server handshake done. We could now derive the server
-	// application keys but since we won't send any data before the
-	// client handshake is finished below, we can derive the
-	// application keys once the handshake is complete. Please, note
-	// that the client Finished is encrypted with the handshake keys.
+	// Server handshake done. Derive the application keys so that we
+	// can send 0.5-RTT data before the client handshake is
+	// finished. Please, note that the client Finished is encrypted
+	// with the handshake keys so we keep the handshake read cipher
+	// until the client handshake is complete.
 
 	transcript := conn.transcript.Sum(nil)
 
-	// Server handshake done. Read client messages until Finished to
-	// complete the handshake.
+	hsReadCipher := conn.readCipher
+	err = conn.deriveKeys(true, transcript)
+	if err != nil {
+		return conn.internalErrorf("key derivation failed: %v", err)
+	}
+	appReadCipher := conn.readCipher
+	conn.readCipher = hsReadCipher
+
+	if conn.config.OnServerFinished != nil {
+		conn.halfRTT = true
+		err = conn.config.OnServerFinished(conn)
+		conn.halfRTT = false
+		if err != nil {
+			return conn.internalErrorf("0.5-RTT data failed: %v", err)
+		}
+	}
+
+	// Read client messages until Finished to complete the handshake.
 	for conn.handshakeState != HSDone {
 		_, data, err := conn.readHandshakeMsg()
 		if err != nil {
@@ -488,18 +866,30 @@ func (conn *Conn) ServerHandshakeServerHello(sharedSecret, kex []byte) error {
 			return err
 		}
 	}
+	conn.readCipher = appReadCipher
 
-	err = conn.deriveKeys(true, transcript)
+	return nil
+}
+
+// Write0RTT writes 0.5-RTT application data to the connection. The
+// data is written with the server's application traffic keys. The
+// function can be called only from the Config.OnServerFinished
+// callback i.e. after the server Finished and before the client
+// Finished.
+func (conn *Conn) Write0RTT(data []byte) (int, error) {
+	if !conn.halfRTT {
+		return 0, errors.New("0.5-RTT data outside server Finished")
+	}
+	err := conn.WriteRecord(CTApplicationData, data)
 	if err != nil {
-		return conn.internalErrorf("key derivation failed: %v", err)
+		return 0, err
 	}
-
-	return nil
+	return len(data), nil
 }
 
 func (conn *Conn) Read(p []byte) (n int, err error) {
 	if conn.readCipher == nil {
-		return 0, errors.New("handshake not completed")
+		return 0, ErrHandshakeNotCompleted
 	}
 
 	for len(conn.appData) == 0 {
@@ -521,7 +911,11 @@ func (conn *Conn) Read(p []byte) (n int, err error) {
 			conn.appData = data
 
 		case CTHandshake:
-			err = conn.recvServerHandshake(data, nil, nil)
+			if len(data) > 0 && HandshakeType(data[0]) == HTKeyUpdate {
+				err = conn.recvKeyUpdate(data)
+			} else {
+				err = conn.recvServerHandshake(data, nil, nil)
+			}
 			if err != nil {
 				return 0, err
 			}
@@ -539,19 +933,125 @@ func (conn *Conn) Read(p []byte) (n int, err error) {
 
 func (conn *Conn) Write(p []byte) (int, error) {
 	if conn.writeCipher == nil {
-		return 0, errors.New("handshake not completed")
+		return 0, ErrHandshakeNotCompleted
+	}
+	if conn.keyLimitReached(len(p)) {
+		err := conn.sendKeyUpdate(UpdateNotRequested)
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	err := conn.WriteRecord(CTApplicationData, p)
 	if err != nil {
 		return 0, err
 	}
+	if !conn.config.ProtectRecords {
+		// The protected records are counted in Cipher.Encrypt.
+		conn.writeCipher.count(len(p))
+	}
+
 	return len(p), nil
 }
 
-// Close implements io.Closer.Close.
+// keyLimitReached tests if the write key must be updated before
+// sending n bytes of application data. The limit reserves one record
+// for the KeyUpdate message.
+func (conn *Conn) keyLimitReached(n int) bool {
+	if conn.handshakeState != HSDone || conn.writeAppTr == nil {
+		// Handshake not completed or 0.5-RTT data.
+		return false
+	}
+	limit := conn.config.KeyUpdateRecords
+	if limit == 0 {
+		limit = AESGCMRecordLimit
+	}
+	records, bytes := conn.writeCipher.Usage()
+	if records+1 >= limit {
+		return true
+	}
+	byteLimit := conn.config.KeyUpdateBytes
+	return byteLimit > 0 && bytes+uint64(n) > byteLimit
+}
+
+// UpdateKeys sends a KeyUpdate message and updates our application
+// traffic keys. The message requests the peer to update its keys too
+// so both directions get fresh keys. The connection must have
+// completed its handshake.
+func (conn *Conn) UpdateKeys() error {
+	return conn.sendKeyUpdate(UpdateRequested)
+}
+
+func (conn *Conn) sendKeyUpdate(req KeyUpdateRequest) error {
+	if conn.handshakeState != HSDone || conn.writeAppTr == nil {
+		return ErrHandshakeNotCompleted
+	}
+	data, err := Marshal(&KeyUpdate{
+		RequestUpdate: req,
+	})
+	if err != nil {
+		return conn.internalErrorf("marshal failed: %v", err)
+	}
+	// KeyUpdate is not part of the handshake transcript.
+	typeLen := uint32(HTKeyUpdate)<<24 | uint32(len(data)-4)
+	bo.PutUint32(data[0:4], typeLen)
+
+	conn.Debugf(" > KeyUpdate: %v\n", req)
+	err = conn.WriteRecord(CTHandshake, data)
+	if err != nil {
+		return err
+	}
+	if !conn.config.ProtectRecords {
+		conn.writeCipher.count(len(data))
+	}
+
+	// The KeyUpdate is protected with the old keys and the following
+	// records with the new keys.
+	return conn.updateWriteKeys()
+}
+
+func (conn *Conn) recvKeyUpdate(data []byte) error {
+	var msg KeyUpdate
+
+	if len(data) != 5 {
+		return conn.decodeErrorf("invalid key_update length: %v", len(data))
+	}
+	err := Unmarshal(data, &msg)
+	if err != nil {
+		return conn.decodeErrorf("failed to decode key_update: %v", err)
+	}
+	conn.Debugf(" < KeyUpdate: %v\n", msg.RequestUpdate)
+
+	if conn.handshakeState != HSDone || conn.readAppTr == nil {
+		return conn.alertf(AlertUnexpectedMessage,
+			"key_update before handshake completed")
+	}
+	switch msg.RequestUpdate {
+	case UpdateNotRequested, UpdateRequested:
+	default:
+		return conn.illegalParameterf("invalid request_update: %v",
+			msg.RequestUpdate)
+	}
+
+	err = conn.updateReadKeys()
+	if err != nil {
+		return conn.internalErrorf("key update failed: %v", err)
+	}
+	if msg.RequestUpdate == UpdateRequested {
+		return conn.sendKeyUpdate(UpdateNotRequested)
+	}
+	return nil
+}
+
+// Close implements io.Closer.Close. The function sends the
+// close_notify alert unless the connection has already sent it or a
+// fatal alert, and closes the underlying connection.
 func (conn *Conn) Close() error {
-	conn.alert(AlertCloseNotify)
+	if !conn.closeSent {
+		// The peer may have closed its end already so a failed
+		// close_notify does not fail the close.
+		conn.alert(AlertCloseNotify)
+	}
 	return conn.conn.Close()
 }
 
@@ -656,6 +1156,8 @@ func (conn *Conn) recvClientHello(data []byte) error {
 		conn.Debugf("\n")
 	}
 	conn.Debugf("   }\n")
+	conn.cipherSuites = orderCipherSuites(conn.config.cipherSuitePreference(),
+		conn.cipherSuites)
 
 	conn.Debugf(" - legacy_compression_methods: {")
 	col = 0
@@ -705,7 +1207,7 @@ func (conn *Conn) recvClientHello(data []byte) error {
 			}
 			for _, el := range arr {
 				v := NamedGroup(el)
-				if supportedGroups[v] {
+				if conn.config.acceptGroup(v) {
 					conn.groups = append(conn.groups, v)
 				}
 			}
@@ -749,7 +1251,8 @@ func (conn *Conn) recvClientHello(data []byte) error {
 					return conn.decodeErrorf("%v: invalid data: %v",
 						ext.Type, err)
 				}
-				if supportedGroups[entry.Group] && conn.peerKeyShare == nil {
+				if conn.config.acceptGroup(entry.Group) &&
+					conn.peerKeyShare == nil {
 					conn.peerKeyShare = entry.Clone()
 				}
 				i += n
@@ -779,6 +1282,13 @@ func (conn *Conn) recvClientHello(data []byte) error {
 
 	conn.Debugf(" - versions        : %v\n", conn.versions)
 	conn.Debugf(" - cipherSuites    : %v\n", conn.cipherSuites)
+	// Order the groups by our preference. HelloRetryRequest selects
+	// the first group.
+	pref := conn.config.groupPreference()
+	slices.SortStableFunc(conn.groups, func(a, b NamedGroup) int {
+		return slices.Index(pref, a) - slices.Index(pref, b)
+	})
+
 	conn.Debugf(" - groups          : %v\n", conn.groups)
 	conn.Debugf(" - signatureSchemes: %v\n", conn.signatureSchemes)
 	conn.Debugf(" - peerKeyShare    : %v\n", conn.peerKeyShare)
@@ -802,9 +1312,12 @@ func (conn *Conn) recvClientHello(data []byte) error {
 func (conn *Conn) recvFinished(server bool, data []byte) error {
 	var finished Finished
 
+	if len(data) != 4+len(finished.VerifyData) {
+		return conn.decodeErrorf("invalid finished length: %v", len(data))
+	}
 	err := Unmarshal(data, &finished)
 	if err != nil {
-		return err
+		return conn.decodeErrorf("failed to decode finished: %v", err)
 	}
 	conn.Debugf(" < finished:\n")
 	conn.Debugf(" - verify_data: %x\n", finished.VerifyData)
@@ -814,7 +1327,11 @@ func (conn *Conn) recvFinished(server bool, data []byte) error {
 	verifyData := conn.finished(!server)
 	conn.Debugf(" - computed   : %x\n", verifyData)
 
-	if !bytes.Equal(finished.VerifyData[:], verifyData) {
+	// The verify_data authenticates the handshake. Compare it in
+	// constant time so that a forged Finished does not leak the
+	// expected value.
+	if !hmac.Equal(finished.VerifyData[:], verifyData) {
+		conn.Debugf(" - verify_data mismatch\n")
 		return conn.alert(AlertDecryptError)
 	}
 
@@ -875,6 +1392,33 @@ func (conn *Conn) recvServerHandshake(data []byte, ecdhCurve ecdh.Curve,
 func (conn *Conn) recvServerHello(data []byte, ecdhCurve ecdh.Curve,
 	ecdhPriv *ecdh.PrivateKey) error {
 
+	err := conn.processServerHello(data)
+	if err != nil {
+		return err
+	}
+
+	ecdhServerPub, err := ecdhCurve.NewPublicKey(conn.peerKeyShare.KeyExchange)
+	if err != nil {
+		return conn.decodeErrorf("invalid client public key: %v", err)
+	}
+	conn.sharedSecret, err = ecdhPriv.ECDH(ecdhServerPub)
+	if err != nil {
+		return conn.decodeErrorf("ECDH failed: %v", err)
+	}
+
+	conn.WriteTranscript(data)
+	err = conn.deriveHandshakeKeys(false)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// processServerHello decodes and verifies the server_hello message
+// and sets the server's key share. The function does not update the
+// transcript.
+func (conn *Conn) processServerHello(data []byte) error {
 	conn.Debugf(" < server_hello:\n")
 
 	serverHello := new(ServerHello)
@@ -915,11 +1459,23 @@ func (conn *Conn) recvServerHello(data []byte, ecdhCurve ecdh.Curve,
 	// is used.
 	conn.Debugf(" - random: %x\n", serverHello.Random)
 
+	// We only speak TLS 1.3 so any sentinel indicates that the server
+	// was downgraded.
+	if IsDowngradeRandom(serverHello.Random) {
+		return conn.illegalParameterf("server_hello downgrade detected")
+	}
+
 	if !bytes.Equal(serverHello.LegacySessionID,
 		conn.clientHello.LegacySessionID) {
 		return conn.illegalParameterf("legacy_session_id_echo mismatch")
 	}
 	conn.Debugf(" - cipher_suite: %v\n", serverHello.CipherSuite)
+	if !slices.Contains(conn.clientHello.CipherSuites,
+		serverHello.CipherSuite) {
+		return conn.illegalParameterf("unexpected cipher_suite: %v",
+			serverHello.CipherSuite)
+	}
+	conn.cipherSuite = serverHello.CipherSuite
 	if serverHello.LegacyCompressionMethod != 0 {
 		return conn.illegalParameterf("invalid legacy_compression_method: %v",
 			serverHello.LegacyCompressionMethod)
@@ -937,20 +1493,10 @@ func (conn *Conn) recvServerHello(data []byte, ecdhCurve ecdh.Curve,
 	if conn.versions[0] != VersionTLS13 {
 		return conn.alert(AlertProtocolVersion)
 	}
-
-	ecdhServerPub, err := ecdhCurve.NewPublicKey(conn.peerKeyShare.KeyExchange)
-	if err != nil {
-		return conn.decodeErrorf("invalid client public key: %v", err)
-	}
-	conn.sharedSecret, err = ecdhPriv.ECDH(ecdhServerPub)
-	if err != nil {
-		return conn.decodeErrorf("ECDH failed: %v", err)
-	}
-
-	conn.WriteTranscript(data)
-	err = conn.deriveHandshakeKeys(false)
-	if err != nil {
-		return err
+	conn.version = conn.versions[0]
+	if conn.peerKeyShare.Group != GroupSecp256r1 {
+		return conn.illegalParameterf("unexpected key_share group: %v",
+			conn.peerKeyShare.Group)
 	}
 
 	return nil
@@ -1026,7 +1572,7 @@ func (conn *Conn) recvCertificateVerify(data []byte) error {
 		hashFunc = crypto.SHA512
 
 	default:
-		conn.alert(AlertUnsupportedCertificate)
+		return conn.alert(AlertUnsupportedCertificate)
 	}
 
 	var verifyPubkeyAlg x509.PublicKeyAlgorithm
@@ -1043,7 +1589,7 @@ func (conn *Conn) recvCertificateVerify(data []byte) error {
 		verifyPubkeyAlg = x509.RSA
 
 	default:
-		conn.alert(AlertUnsupportedCertificate)
+		return conn.alert(AlertUnsupportedCertificate)
 	}
 	_ = verifyPubkeyAlg
 
@@ -1192,6 +1738,7 @@ func (conn *Conn) recvAlert(data []byte) error {
 	}
 	desc := AlertDescription(data[1])
 	conn.Debugf(" < alert: %v: %v\n", desc.Level(), desc)
+	conn.onAlert(false, desc)
 
 	if desc == AlertCloseNotify {
 		conn.readEOF = true
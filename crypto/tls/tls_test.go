@@ -0,0 +1,1088 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package tls
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	gotls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServerConfig(t *testing.T) *Config {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "localhost",
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Config{
+		PrivateKey:  priv,
+		Certificate: cert,
+	}
+}
+
+// newTestConns creates a connected client and server connection pair
+// over the loopback interface. Unlike net.Pipe, TCP connections are
+// buffered so both peers can write without waiting for the other.
+func newTestConns(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+// serverHandshake runs the full server handshake with a local ECDH
+// key exchange in the negotiated group.
+func serverHandshake(conn *Conn) error {
+	clientKex, err := conn.ServerHandshake()
+	if err != nil {
+		return err
+	}
+	curve := conn.Group().Curve()
+	priv, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	pub, err := curve.NewPublicKey(clientKex)
+	if err != nil {
+		return err
+	}
+	sharedSecret, err := priv.ECDH(pub)
+	if err != nil {
+		return err
+	}
+	return conn.ServerHandshakeServerHello(sharedSecret,
+		priv.PublicKey().Bytes())
+}
+
+func TestWrite0RTT(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	early := []byte("HTTP/1.1 200 OK\r\n\r\n")
+
+	config := newTestServerConfig(t)
+	config.OnServerFinished = func(conn *Conn) error {
+		_, err := conn.Write0RTT(early)
+		return err
+	}
+	server := NewConnection(sc, config)
+	errC := make(chan error)
+	go func() {
+		errC <- serverHandshake(server)
+	}()
+
+	client := NewConnection(cc, &Config{})
+	err := client.ClientHandshake("")
+	if err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	err = <-errC
+	if err != nil {
+		t.Fatalf("server handshake failed: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("client read failed: %v", err)
+	}
+	if !bytes.Equal(buf[:n], early) {
+		t.Errorf("got %q, expected %q", buf[:n], early)
+	}
+
+	// 0.5-RTT data is not allowed after the handshake.
+	_, err = server.Write0RTT(early)
+	if err == nil {
+		t.Errorf("Write0RTT succeeded after handshake")
+	}
+}
+
+func TestClientDowngradeSentinel(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	server := NewConnection(sc, newTestServerConfig(t))
+	errC := make(chan error)
+	go func() {
+		clientKex, err := server.ServerHandshake()
+		if err != nil {
+			errC <- err
+			return
+		}
+		data, err := server.MakeServerHello(clientKex)
+		if err != nil {
+			errC <- err
+			return
+		}
+		// Set the TLS 1.2 downgrade sentinel to the end of the random.
+		copy(data[30:38], DowngradeTLS12[:])
+		errC <- server.writeHandshakeMsg(HTServerHello, data)
+	}()
+
+	var alert AlertDescription
+	client := NewConnection(cc, &Config{
+		OnAlert: func(sent bool, desc AlertDescription) {
+			if sent {
+				alert = desc
+			}
+		},
+	})
+	err := client.ClientHandshake("")
+	if err == nil {
+		t.Fatalf("client accepted downgrade sentinel")
+	}
+	if alert != AlertIllegalParameter {
+		t.Errorf("got alert %v, expected %v", alert, AlertIllegalParameter)
+	}
+	err = <-errC
+	if err != nil {
+		t.Fatalf("server failed: %v", err)
+	}
+}
+
+func TestIsDowngradeRandom(t *testing.T) {
+	var random [32]byte
+	if IsDowngradeRandom(random) {
+		t.Errorf("zero random detected as downgrade")
+	}
+	copy(random[24:], DowngradeTLS12[:])
+	if !IsDowngradeRandom(random) {
+		t.Errorf("TLS 1.2 sentinel not detected")
+	}
+	copy(random[24:], DowngradeTLS11[:])
+	if !IsDowngradeRandom(random) {
+		t.Errorf("TLS 1.1 sentinel not detected")
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	msgs := [][]byte{
+		{byte(HTClientHello), 0, 0, 2, 1, 2},
+		{byte(HTServerHello), 0, 0, 3, 3, 4, 5},
+	}
+
+	conn := NewConnection(nil, &Config{})
+	if conn.Transcript() != nil {
+		t.Errorf("uninitialized transcript is not nil")
+	}
+	conn.transcript = CipherTLSAes128GcmSha256.Hash()
+
+	h := sha256.New()
+	for _, msg := range msgs {
+		conn.WriteTranscript(msg)
+		h.Write(msg)
+
+		digest := conn.Transcript()
+		expected := h.Sum(nil)
+		if !bytes.Equal(digest, expected) {
+			t.Errorf("got %x, expected %x", digest, expected)
+		}
+	}
+}
+
+func TestTranscriptReset(t *testing.T) {
+	clientHello := []byte{byte(HTClientHello), 0, 0, 2, 1, 2}
+	hrr := []byte{byte(HTServerHello), 0, 0, 3, 3, 4, 5}
+
+	conn := NewConnection(nil, &Config{})
+	conn.transcript = CipherTLSAes128GcmSha256.Hash()
+	conn.WriteTranscript(clientHello)
+	conn.TranscriptReset()
+	conn.WriteTranscript(hrr)
+
+	ch := sha256.Sum256(clientHello)
+	h := sha256.New()
+	h.Write([]byte{byte(HTMessageHash), 0, 0, byte(len(ch))})
+	h.Write(ch[:])
+	h.Write(hrr)
+
+	digest := conn.Transcript()
+	expected := h.Sum(nil)
+	if !bytes.Equal(digest, expected) {
+		t.Errorf("got %x, expected %x", digest, expected)
+	}
+}
+
+func TestHandshakeTranscript(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	server := NewConnection(sc, newTestServerConfig(t))
+	errC := make(chan error)
+	go func() {
+		errC <- serverHandshake(server)
+	}()
+
+	client := NewConnection(cc, &Config{})
+	err := client.ClientHandshake("")
+	if err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	err = <-errC
+	if err != nil {
+		t.Fatalf("server handshake failed: %v", err)
+	}
+	if !bytes.Equal(client.Transcript(), server.Transcript()) {
+		t.Errorf("transcript mismatch: client %x, server %x",
+			client.Transcript(), server.Transcript())
+	}
+}
+
+func TestClientFinishedVerify(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	var alert AlertDescription
+	server := NewConnection(sc, &Config{
+		OnAlert: func(sent bool, desc AlertDescription) {
+			if sent {
+				alert = desc
+			}
+		},
+	})
+	server.transcript = CipherTLSAes128GcmSha256.Hash()
+	server.WriteTranscript([]byte{byte(HTClientHello), 0, 0, 2, 1, 2})
+	server.clientHSTr = make([]byte, 32)
+	_, err := rand.Read(server.clientHSTr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finished, err := server.MakeFinished(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tampered client Finished is rejected.
+	tampered := make([]byte, len(finished))
+	copy(tampered, finished)
+	tampered[len(tampered)-1] ^= 0x01
+
+	err = server.recvFinished(true, tampered)
+	if err == nil {
+		t.Fatalf("tampered finished accepted")
+	}
+	if alert != AlertDecryptError {
+		t.Errorf("got alert %v, expected %v", alert, AlertDecryptError)
+	}
+	if server.handshakeState == HSDone {
+		t.Errorf("handshake done after tampered finished")
+	}
+
+	// Valid client Finished completes the handshake.
+	err = server.recvFinished(true, finished)
+	if err != nil {
+		t.Fatalf("valid finished rejected: %v", err)
+	}
+	if server.handshakeState != HSDone {
+		t.Errorf("got state %v, expected %v", server.handshakeState, HSDone)
+	}
+}
+
+// recordingConn records the data written to the connection.
+type recordingConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.written.Write(p)
+	return c.Conn.Write(p)
+}
+
+func TestHelloRetryRequest(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	rc := &recordingConn{
+		Conn: sc,
+	}
+	server := NewConnection(rc, newTestServerConfig(t))
+	errC := make(chan error)
+	go func() {
+		errC <- serverHandshake(server)
+	}()
+
+	// The client sends the X25519 key_share first. The server
+	// supports only secp256r1 so it must send a HelloRetryRequest.
+	var keyLog bytes.Buffer
+	client := gotls.Client(cc, &gotls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         gotls.VersionTLS13,
+		CurvePreferences:   []gotls.CurveID{gotls.X25519, gotls.CurveP256},
+		KeyLogWriter:       &keyLog,
+	})
+
+	// The record protection is implemented in MPC and this package
+	// writes the handshake records without encryption. Therefore, the
+	// client fails to decrypt the EncryptedExtensions but it has
+	// derived its handshake traffic secrets from the transcript
+	// Hash(message_hash, HelloRetryRequest, ClientHello2, ServerHello).
+	client.Handshake()
+	cc.Close()
+	<-errC
+
+	if !bytes.Contains(rc.written.Bytes(), HelloRetryRequestRandom[:]) {
+		t.Fatalf("handshake completed without HelloRetryRequest")
+	}
+	if server.Group() != GroupSecp256r1 {
+		t.Errorf("got group %v, expected %v", server.Group(), GroupSecp256r1)
+	}
+
+	secrets := make(map[string][]byte)
+	for _, line := range strings.Split(keyLog.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets[fields[0]] = secret
+	}
+	tests := []struct {
+		label    string
+		expected []byte
+	}{
+		{"CLIENT_HANDSHAKE_TRAFFIC_SECRET", server.clientHSTr},
+		{"SERVER_HANDSHAKE_TRAFFIC_SECRET", server.serverHSTr},
+	}
+	for _, test := range tests {
+		secret, ok := secrets[test.label]
+		if !ok {
+			t.Errorf("client did not derive %v", test.label)
+			continue
+		}
+		if !bytes.Equal(secret, test.expected) {
+			t.Errorf("%v: server %x, client %x", test.label, test.expected,
+				secret)
+		}
+	}
+}
+
+func TestX25519(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	rc := &recordingConn{
+		Conn: sc,
+	}
+	config := newTestServerConfig(t)
+	config.Groups = []NamedGroup{GroupSecp256r1, GroupX25519}
+	server := NewConnection(rc, config)
+	errC := make(chan error)
+	go func() {
+		errC <- serverHandshake(server)
+	}()
+
+	// The client offers only X25519.
+	var keyLog bytes.Buffer
+	client := gotls.Client(cc, &gotls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         gotls.VersionTLS13,
+		CurvePreferences:   []gotls.CurveID{gotls.X25519},
+		KeyLogWriter:       &keyLog,
+	})
+
+	// See TestHelloRetryRequest for the unencrypted handshake
+	// records.
+	client.Handshake()
+	cc.Close()
+	<-errC
+
+	if bytes.Contains(rc.written.Bytes(), HelloRetryRequestRandom[:]) {
+		t.Errorf("server sent HelloRetryRequest")
+	}
+	if server.Group() != GroupX25519 {
+		t.Errorf("got group %v, expected %v", server.Group(), GroupX25519)
+	}
+	if !strings.Contains(keyLog.String(),
+		fmt.Sprintf("SERVER_HANDSHAKE_TRAFFIC_SECRET %x %x",
+			server.clientHello.Random, server.serverHSTr)) {
+		t.Errorf("client did not derive the server handshake secret")
+	}
+}
+
+func TestRecordPadding(t *testing.T) {
+	key := make([]byte, 16)
+	iv := make([]byte, 12)
+
+	for _, msg := range []string{
+		"", "a", "hello, world", "0123456789abcdef0123456789abcdef!",
+	} {
+		enc, err := NewCipher(key, iv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc.padding = PadToBlock(32)
+		dec, err := NewCipher(key, iv)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := enc.Encrypt(CTApplicationData, []byte(msg))
+		// The content length is padded to a multiple of 32.
+		expected := (len(msg)+31)/32*32 + 1 + enc.cipher.Overhead()
+		if len(data) != expected {
+			t.Errorf("%q: got record length %v, expected %v",
+				msg, len(data), expected)
+		}
+
+		ct, plain, err := dec.Decrypt(data)
+		if err != nil {
+			t.Fatalf("%q: decrypt failed: %v", msg, err)
+		}
+		if ct != CTApplicationData {
+			t.Errorf("%q: got content type %v, expected %v",
+				msg, ct, CTApplicationData)
+		}
+		if string(plain) != msg {
+			t.Errorf("got %q, expected %q", plain, msg)
+		}
+	}
+}
+
+func TestClientHandshakeHello(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	curve := ecdh.P256()
+	serverPriv, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKex := serverPriv.PublicKey().Bytes()
+
+	server := NewConnection(sc, &Config{})
+	errC := make(chan error)
+	go func() {
+		_, err := server.ServerHandshake()
+		if err != nil {
+			errC <- err
+			return
+		}
+		data, err := server.MakeServerHello(serverKex)
+		if err != nil {
+			errC <- err
+			return
+		}
+		server.WriteTranscript(data)
+		errC <- server.WriteRecord(CTHandshake, data)
+	}()
+
+	clientPriv, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewConnection(cc, &Config{
+		ServerName: "localhost",
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+	kex, err := client.ClientHandshakeHello(clientPriv.PublicKey().Bytes())
+	if err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	err = <-errC
+	if err != nil {
+		t.Fatalf("server handshake failed: %v", err)
+	}
+	if !bytes.Equal(kex, serverKex) {
+		t.Errorf("got server key share %x, expected %x", kex, serverKex)
+	}
+	if !bytes.Equal(client.Transcript(), server.Transcript()) {
+		t.Errorf("transcript mismatch: client %x, server %x",
+			client.Transcript(), server.Transcript())
+	}
+}
+
+func TestKeyUpdate(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	server := NewConnection(sc, newTestServerConfig(t))
+	errC := make(chan error)
+	go func() {
+		errC <- serverHandshake(server)
+	}()
+
+	client := NewConnection(cc, &Config{})
+	err := client.ClientHandshake("")
+	if err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	err = <-errC
+	if err != nil {
+		t.Fatalf("server handshake failed: %v", err)
+	}
+
+	exchange := func(from, to *Conn, msg string) {
+		_, err := from.Write([]byte(msg))
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		buf := make([]byte, 1024)
+		n, err := to.Read(buf)
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if string(buf[:n]) != msg {
+			t.Errorf("got %q, expected %q", buf[:n], msg)
+		}
+	}
+	verify := func(from, to *Conn) {
+		if !bytes.Equal(from.writeAppTr, to.readAppTr) {
+			t.Fatalf("traffic secret mismatch")
+		}
+		if from.writeCipher.seq != 0 || to.readCipher.seq != 0 {
+			t.Errorf("sequence numbers not reset")
+		}
+		ct := from.writeCipher.Encrypt(CTApplicationData, []byte("data"))
+		_, pt, err := to.readCipher.Decrypt(ct)
+		if err != nil {
+			t.Fatalf("decrypt failed: %v", err)
+		}
+		if string(pt) != "data" {
+			t.Errorf("got %q, expected %q", pt, "data")
+		}
+	}
+
+	exchange(client, server, "before")
+	exchange(server, client, "before")
+
+	for _, c := range []struct {
+		name     string
+		from, to *Conn
+	}{
+		{"client", client, server},
+		{"server", server, client},
+	} {
+		fromWrite := c.from.writeAppTr
+		toWrite := c.to.writeAppTr
+
+		err = c.from.UpdateKeys()
+		if err != nil {
+			t.Fatalf("%s: UpdateKeys failed: %v", c.name, err)
+		}
+		// The peer updates its read keys and responds with its own
+		// KeyUpdate which the sender processes on its next read.
+		exchange(c.from, c.to, "after "+c.name)
+		exchange(c.to, c.from, "reply "+c.name)
+
+		if bytes.Equal(fromWrite, c.from.writeAppTr) {
+			t.Errorf("%s: write secret not updated", c.name)
+		}
+		if bytes.Equal(toWrite, c.to.writeAppTr) {
+			t.Errorf("%s: peer write secret not updated", c.name)
+		}
+		verify(c.from, c.to)
+		verify(c.to, c.from)
+	}
+}
+
+func TestKeyUpdateBeforeHandshake(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	client := NewConnection(cc, &Config{})
+	err := client.UpdateKeys()
+	if err == nil {
+		t.Errorf("UpdateKeys succeeded before handshake")
+	}
+}
+
+func TestKeyUpdateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		records uint64
+		bytes   uint64
+		msg     string
+		count   int
+	}{
+		{"records", 4, 0, "record", 10},
+		{"bytes", 0, 32, "0123456789", 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, sc := newTestConns(t)
+			defer cc.Close()
+			defer sc.Close()
+
+			server := NewConnection(sc, newTestServerConfig(t))
+			errC := make(chan error)
+			go func() {
+				errC <- serverHandshake(server)
+			}()
+
+			client := NewConnection(cc, &Config{
+				KeyUpdateRecords: test.records,
+				KeyUpdateBytes:   test.bytes,
+			})
+			err := client.ClientHandshake("")
+			if err != nil {
+				t.Fatalf("client handshake failed: %v", err)
+			}
+			err = <-errC
+			if err != nil {
+				t.Fatalf("server handshake failed: %v", err)
+			}
+			initial := client.writeAppTr
+
+			buf := make([]byte, 1024)
+			for i := 0; i < test.count; i++ {
+				_, err = client.Write([]byte(test.msg))
+				if err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+				n, err := server.Read(buf)
+				if err != nil {
+					t.Fatalf("read failed: %v", err)
+				}
+				if string(buf[:n]) != test.msg {
+					t.Errorf("got %q, expected %q", buf[:n], test.msg)
+				}
+				records, size := client.writeCipher.Usage()
+				if test.records > 0 && records >= test.records {
+					t.Errorf("record limit exceeded: %v", records)
+				}
+				if test.bytes > 0 && size > test.bytes {
+					t.Errorf("byte limit exceeded: %v", size)
+				}
+			}
+			if bytes.Equal(initial, client.writeAppTr) {
+				t.Errorf("keys not updated")
+			}
+			if !bytes.Equal(client.writeAppTr, server.readAppTr) {
+				t.Fatalf("traffic secret mismatch")
+			}
+			ct := client.writeCipher.Encrypt(CTApplicationData, []byte("data"))
+			_, pt, err := server.readCipher.Decrypt(ct)
+			if err != nil {
+				t.Fatalf("decrypt failed: %v", err)
+			}
+			if string(pt) != "data" {
+				t.Errorf("got %q, expected %q", pt, "data")
+			}
+		})
+	}
+}
+
+func TestCipherPreference(t *testing.T) {
+	offered := []CipherSuite{
+		CipherTLSAes128GcmSha256,
+		CipherTLSChacha20Poly1305Sha256,
+	}
+	defer func(v bool) {
+		hasAESGCMHardware = v
+	}(hasAESGCMHardware)
+
+	tests := []struct {
+		config   *Config
+		hasAES   bool
+		expected CipherSuite
+	}{
+		{&Config{}, true, CipherTLSAes128GcmSha256},
+		{&Config{}, false, CipherTLSChacha20Poly1305Sha256},
+		{
+			&Config{CipherPreference: PreferAESGCM},
+			false, CipherTLSAes128GcmSha256,
+		},
+		{
+			&Config{CipherPreference: PreferChaCha20},
+			true, CipherTLSChacha20Poly1305Sha256,
+		},
+		{
+			&Config{
+				CipherSuites: []CipherSuite{
+					CipherTLSChacha20Poly1305Sha256,
+				},
+				CipherPreference: PreferAESGCM,
+			},
+			true, CipherTLSChacha20Poly1305Sha256,
+		},
+	}
+	for idx, test := range tests {
+		hasAESGCMHardware = test.hasAES
+		suites := orderCipherSuites(test.config.cipherSuitePreference(),
+			offered)
+		if len(suites) != len(offered) {
+			t.Fatalf("test%d: got %v, expected %v suites", idx, suites,
+				len(offered))
+		}
+		if suites[0] != test.expected {
+			t.Errorf("test%d: got %v, expected %v", idx, suites[0],
+				test.expected)
+		}
+	}
+
+	// The client's suites which the server does not list follow in
+	// the client's order.
+	suites := orderCipherSuites([]CipherSuite{CipherTLSAes256GcmSha384},
+		offered)
+	if !slices.Equal(suites, offered) {
+		t.Errorf("got %v, expected %v", suites, offered)
+	}
+}
+
+func TestClientHelloCipherSuites(t *testing.T) {
+	tests := []struct {
+		protect  bool
+		expected []CipherSuite
+	}{
+		{
+			false,
+			[]CipherSuite{
+				CipherTLSAes128GcmSha256,
+				CipherTLSChacha20Poly1305Sha256,
+			},
+		},
+		{
+			true,
+			[]CipherSuite{
+				CipherTLSAes128GcmSha256,
+			},
+		},
+	}
+	for idx, test := range tests {
+		config := &Config{
+			ProtectRecords: test.protect,
+		}
+		suites := config.clientCipherSuites()
+		if !slices.Equal(suites, test.expected) {
+			t.Errorf("test%d: got %v, expected %v", idx, suites,
+				test.expected)
+		}
+	}
+}
+
+func TestConnectionState(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	config := newTestServerConfig(t)
+	server := NewConnection(sc, config)
+	client := NewConnection(cc, &Config{
+		ServerName: "ephemelier.com",
+	})
+
+	state := client.ConnectionState()
+	if state.HandshakeComplete || state.Version != 0 || state.CipherSuite != 0 {
+		t.Errorf("state before handshake: %+v", state)
+	}
+
+	errC := make(chan error)
+	go func() {
+		errC <- serverHandshake(server)
+	}()
+	err := client.ClientHandshake("")
+	if err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	err = <-errC
+	if err != nil {
+		t.Fatalf("server handshake failed: %v", err)
+	}
+
+	cs := client.ConnectionState()
+	ss := server.ConnectionState()
+	for _, state := range []ConnectionState{cs, ss} {
+		if state.Version != VersionTLS13 {
+			t.Errorf("got version %v, expected %v", state.Version,
+				VersionTLS13)
+		}
+		if !state.HandshakeComplete {
+			t.Errorf("handshake not complete")
+		}
+		if state.DidResume {
+			t.Errorf("unexpected resumption")
+		}
+		if state.CipherSuite != CipherTLSChacha20Poly1305Sha256 {
+			t.Errorf("got cipher suite %v, expected %v", state.CipherSuite,
+				CipherTLSChacha20Poly1305Sha256)
+		}
+		if state.Group != GroupSecp256r1 {
+			t.Errorf("got group %v, expected %v", state.Group, GroupSecp256r1)
+		}
+		if state.ServerName != "ephemelier.com" {
+			t.Errorf("got server name %q, expected %q", state.ServerName,
+				"ephemelier.com")
+		}
+		if len(state.NegotiatedProtocol) != 0 {
+			t.Errorf("unexpected ALPN protocol %q", state.NegotiatedProtocol)
+		}
+	}
+	if len(cs.PeerCertificates) != 1 ||
+		!cs.PeerCertificates[0].Equal(config.Certificate) {
+		t.Errorf("client: invalid peer certificates %v", cs.PeerCertificates)
+	}
+	if len(ss.PeerCertificates) != 0 {
+		t.Errorf("server: unexpected peer certificates")
+	}
+}
+
+// newGoServer creates a standard library TLS 1.3 server for the
+// connection. The server uses a P-256 certificate and key exchange.
+func newGoServer(t *testing.T, conn net.Conn) *gotls.Conn {
+	cert := newTestServerConfig(t)
+	return gotls.Server(conn, &gotls.Config{
+		Certificates: []gotls.Certificate{
+			{
+				Certificate: [][]byte{cert.Certificate.Raw},
+				PrivateKey:  cert.PrivateKey,
+			},
+		},
+		MinVersion:       gotls.VersionTLS13,
+		CurvePreferences: []gotls.CurveID{gotls.CurveP256},
+	})
+}
+
+func TestClientHandshakeGoServer(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	server := newGoServer(t, sc)
+	errC := make(chan error)
+	nameC := make(chan string, 1)
+	go func() {
+		err := server.Handshake()
+		if err != nil {
+			errC <- err
+			return
+		}
+		nameC <- server.ConnectionState().ServerName
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(server, buf)
+		if err == nil {
+			_, err = server.Write(bytes.ToUpper(buf))
+		}
+		errC <- err
+	}()
+
+	client := NewConnection(cc, &Config{
+		ProtectRecords: true,
+	})
+	err := client.ClientHandshake("localhost")
+	if err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	state := client.ConnectionState()
+	if state.CipherSuite != CipherTLSAes128GcmSha256 {
+		t.Errorf("got %v, expected %v", state.CipherSuite,
+			CipherTLSAes128GcmSha256)
+	}
+	if state.ServerName != "localhost" {
+		t.Errorf("got %q, expected %q", state.ServerName, "localhost")
+	}
+
+	_, err = client.Write([]byte("ping"))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(client, buf)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(buf) != "PING" {
+		t.Errorf("got %q, expected %q", buf, "PING")
+	}
+	err = <-errC
+	if err != nil {
+		t.Fatalf("server failed: %v", err)
+	}
+	name := <-nameC
+	if name != "localhost" {
+		t.Errorf("server got %q, expected %q", name, "localhost")
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	hosts := map[string]*Config{
+		"a.example": newTestServerConfig(t),
+		"b.example": newTestServerConfig(t),
+	}
+	config := newTestServerConfig(t)
+	config.GetCertificate = func(serverName string) (*x509.Certificate,
+		*ecdsa.PrivateKey, error) {
+
+		if len(serverName) == 0 {
+			return nil, nil, nil
+		}
+		host, ok := hosts[serverName]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown host")
+		}
+		return host.Certificate, host.PrivateKey, nil
+	}
+
+	tests := []struct {
+		serverName string
+		expected   *x509.Certificate
+	}{
+		{"a.example", hosts["a.example"].Certificate},
+		{"b.example", hosts["b.example"].Certificate},
+		{"", config.Certificate},
+		{"c.example", nil},
+	}
+	for _, test := range tests {
+		cc, sc := newTestConns(t)
+
+		server := NewConnection(sc, config)
+		errC := make(chan error)
+		go func() {
+			errC <- serverHandshake(server)
+		}()
+
+		client := NewConnection(cc, &Config{})
+		err := client.ClientHandshake(test.serverName)
+		serverErr := <-errC
+		cc.Close()
+		sc.Close()
+
+		if test.expected == nil {
+			if !errors.Is(serverErr, AlertUnrecognizedName) {
+				t.Errorf("%q: got %v, expected %v", test.serverName,
+					serverErr, AlertUnrecognizedName)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: client handshake failed: %v", test.serverName, err)
+		}
+		if serverErr != nil {
+			t.Fatalf("%q: server handshake failed: %v", test.serverName,
+				serverErr)
+		}
+		certs := client.ConnectionState().PeerCertificates
+		if len(certs) != 1 || !certs[0].Equal(test.expected) {
+			t.Errorf("%q: wrong certificate", test.serverName)
+		}
+	}
+}
+
+func TestKeyUpdateGoServer(t *testing.T) {
+	cc, sc := newTestConns(t)
+	defer cc.Close()
+	defer sc.Close()
+
+	const rounds = 3
+
+	server := newGoServer(t, sc)
+	errC := make(chan error)
+	go func() {
+		// Echo the messages. The server responds to the client's
+		// KeyUpdate with its own KeyUpdate before the echo.
+		buf := make([]byte, 4)
+		for i := 0; i < rounds; i++ {
+			_, err := io.ReadFull(server, buf)
+			if err != nil {
+				errC <- err
+				return
+			}
+			_, err = server.Write(bytes.ToUpper(buf))
+			if err != nil {
+				errC <- err
+				return
+			}
+		}
+		errC <- nil
+	}()
+
+	client := NewConnection(cc, &Config{
+		ProtectRecords: true,
+	})
+	err := client.ClientHandshake("localhost")
+	if err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	for i := 0; i < rounds; i++ {
+		writeSecret := client.writeAppTr
+		readSecret := client.readAppTr
+
+		err = client.UpdateKeys()
+		if err != nil {
+			t.Fatalf("UpdateKeys failed: %v", err)
+		}
+		_, err = client.Write([]byte("ping"))
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(client, buf)
+		if err != nil {
+			t.Fatalf("round %v: read failed: %v", i, err)
+		}
+		if string(buf) != "PING" {
+			t.Errorf("round %v: got %q, expected %q", i, buf, "PING")
+		}
+		if bytes.Equal(writeSecret, client.writeAppTr) {
+			t.Errorf("round %v: write secret not updated", i)
+		}
+		if bytes.Equal(readSecret, client.readAppTr) {
+			t.Errorf("round %v: read secret not updated", i)
+		}
+	}
+	err = <-errC
+	if err != nil {
+		t.Fatalf("server failed: %v", err)
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -8,6 +8,7 @@ package tls
 
 import (
 	"bytes"
+	"crypto/ecdh"
 	"crypto/sha256"
 	"crypto/sha512"
 	"fmt"
@@ -163,6 +164,22 @@ var HelloRetryRequestRandom = [32]byte{
 	0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
 }
 
+// Downgrade protection sentinels. TLS 1.3 servers set the last 8
+// bytes of the ServerHello.Random to these values when negotiating
+// TLS 1.2 or TLS 1.1 and below.
+var (
+	DowngradeTLS12 = [8]byte{0x44, 0x4F, 0x57, 0x4E, 0x47, 0x52, 0x44, 0x01}
+	DowngradeTLS11 = [8]byte{0x44, 0x4F, 0x57, 0x4E, 0x47, 0x52, 0x44, 0x00}
+)
+
+// IsDowngradeRandom tests if the random value carries one of the
+// downgrade protection sentinels.
+func IsDowngradeRandom(random [32]byte) bool {
+	tail := random[len(random)-len(DowngradeTLS12):]
+	return bytes.Equal(tail, DowngradeTLS12[:]) ||
+		bytes.Equal(tail, DowngradeTLS11[:])
+}
+
 // EncryptedExtensions implements the encrypted_extensions handshake
 // message.
 type EncryptedExtensions struct {
@@ -198,6 +215,32 @@ type Finished struct {
 	VerifyData       [32]byte
 }
 
+// KeyUpdate implements the key_update message.
+type KeyUpdate struct {
+	HandshakeTypeLen uint32
+	RequestUpdate    KeyUpdateRequest
+}
+
+// KeyUpdateRequest defines the key_update request_update values.
+type KeyUpdateRequest uint8
+
+// KeyUpdate request values.
+const (
+	UpdateNotRequested KeyUpdateRequest = 0
+	UpdateRequested    KeyUpdateRequest = 1
+)
+
+func (req KeyUpdateRequest) String() string {
+	switch req {
+	case UpdateNotRequested:
+		return "update_not_requested"
+	case UpdateRequested:
+		return "update_requested"
+	default:
+		return fmt.Sprintf("{KeyUpdateRequest %d}", int(req))
+	}
+}
+
 // NewSessionTicket implements the new_session_ticket message.
 type NewSessionTicket struct {
 	HandshakeTypeLen uint32
@@ -280,6 +323,23 @@ func (group NamedGroup) Bytes() []byte {
 	return buf
 }
 
+// Curve returns the ECDH curve of the group or nil if the group is
+// not an ECDH group.
+func (group NamedGroup) Curve() ecdh.Curve {
+	switch group {
+	case GroupSecp256r1:
+		return ecdh.P256()
+	case GroupSecp384r1:
+		return ecdh.P384()
+	case GroupSecp521r1:
+		return ecdh.P521()
+	case GroupX25519:
+		return ecdh.X25519()
+	default:
+		return nil
+	}
+}
+
 var tls13NamedGroups = map[NamedGroup]string{
 	GroupSecp256r1:      "secp256r1",
 	GroupSecp384r1:      "secp384r1",
@@ -363,6 +423,10 @@ type ServerName struct {
 	Hostname []byte `tls:"u16"`
 }
 
+// ProtocolName defines an application protocol name in the ALPN
+// extension.
+type ProtocolName string
+
 // Extension defines protocol extensions.
 type Extension struct {
 	Type ExtensionType
@@ -376,7 +440,8 @@ func NewExtension(t ExtensionType, values ...interface{}) Extension {
 
 	var ll int
 	switch t {
-	case ETSupportedGroups, ETSignatureAlgorithms, ETKeyShare, ETServerName:
+	case ETSupportedGroups, ETSignatureAlgorithms, ETKeyShare, ETServerName,
+		ETApplicationLayerProtocolNegotiation:
 		ll = 2
 	case ETSupportedVersions:
 		ll = 1
@@ -415,6 +480,10 @@ func NewExtension(t ExtensionType, values ...interface{}) Extension {
 			}
 			result.Write(data)
 
+		case ProtocolName:
+			result.WriteByte(byte(len(v)))
+			result.WriteString(string(v))
+
 		default:
 			panic(fmt.Sprintf("unsupported extension value %T", v))
 		}
@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package tss
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/bnb-chain/tss-lib/v2/common"
+	"github.com/bnb-chain/tss-lib/v2/crypto"
+	"github.com/bnb-chain/tss-lib/v2/eddsa/keygen"
+	"github.com/bnb-chain/tss-lib/v2/eddsa/signing"
+	"github.com/bnb-chain/tss-lib/v2/tss"
+)
+
+// EdDSAKeygen implements the threshold Ed25519 key generation. All
+// parties must participate in the key generation.
+func (peer *Peer) EdDSAKeygen() (*keygen.LocalPartySaveData, error) {
+	ids, id := makePartyIDs(peer.parties, peer.PartyID.Id, 0)
+	r, err := peer.newRouter(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	errC := make(chan *tss.Error)
+	outC := make(chan tss.Message)
+	defer r.close(outC)
+	endC := make(chan *keygen.LocalPartySaveData, 1)
+
+	params := tss.NewParameters(tss.Edwards(), tss.NewPeerContext(ids), id,
+		len(ids), peer.threshold-1)
+	party := keygen.NewLocalParty(params, outC, endC).(*keygen.LocalParty)
+
+	r.run(func() {
+		if err := party.Start(); err != nil {
+			r.fail(errC, err)
+		}
+	})
+
+	inC := make(chan []byte)
+	r.start(party, inC, errC)
+
+	for {
+		select {
+		case err := <-errC:
+			return nil, r.sendError(err)
+
+		case msg := <-outC:
+			err := r.send(msg)
+			if err != nil {
+				return nil, r.sendError(party.WrapError(err))
+			}
+
+		case save := <-endC:
+			peer.debugf("save: id=%v\n", peer.PartyID.Id)
+			err := r.sendDone()
+			r.wait()
+
+			return save, err
+
+		case in := <-inC:
+			msg, err := unmarshalTSSMessage(in)
+			if err != nil {
+				return nil, r.sendError(err)
+			}
+			peer.debugf("input: src=%v\n", msg.GetFrom().Id)
+			r.run(func() {
+				_, err := party.Update(msg)
+				if err != nil {
+					r.fail(errC, party.WrapError(err))
+				}
+			})
+		}
+	}
+}
+
+// EdDSASign implements the threshold Ed25519 signature for the
+// message msg using the local key share key. All parties participate
+// in the signature. The function returns the signature and an
+// optional error.
+func (peer *Peer) EdDSASign(key *keygen.LocalPartySaveData, msg []byte) (
+	[]byte, error) {
+
+	return peer.EdDSASignWith(key, msg, peer.parties)
+}
+
+// EdDSASignWith implements the threshold Ed25519 signature for the
+// message msg using the local key share key. The signers specify the
+// IDs of the signing parties, including this peer. The number of
+// signers must be at least the threshold. The function returns the
+// signature and an optional error.
+func (peer *Peer) EdDSASignWith(key *keygen.LocalPartySaveData, msg []byte,
+	signers []string) ([]byte, error) {
+
+	for _, signer := range signers {
+		if !slices.Contains(peer.parties, signer) {
+			return nil, fmt.Errorf("unknown signer %v", signer)
+		}
+	}
+	ids, id := makePartyIDs(signers, peer.PartyID.Id, 0)
+	if id == nil {
+		return nil, fmt.Errorf("party %v not in signers %v",
+			peer.PartyID.Id, signers)
+	}
+	if len(ids) < peer.threshold {
+		return nil, fmt.Errorf("%v signers, threshold is %v",
+			len(ids), peer.threshold)
+	}
+	r, err := peer.newRouter(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	errC := make(chan *tss.Error)
+	outC := make(chan tss.Message)
+	defer r.close(outC)
+	endC := make(chan *common.SignatureData, 1)
+
+	params := tss.NewParameters(tss.Edwards(), tss.NewPeerContext(ids), id,
+		len(ids), peer.threshold-1)
+
+	// The fullBytesLen keeps the message's leading zero bytes.
+	party := signing.NewLocalParty(new(big.Int).SetBytes(msg), params, *key,
+		outC, endC, len(msg)).(*signing.LocalParty)
+
+	r.run(func() {
+		if err := party.Start(); err != nil {
+			r.fail(errC, err)
+		}
+	})
+
+	inC := make(chan []byte)
+	r.start(party, inC, errC)
+
+	for {
+		select {
+		case err := <-errC:
+			return nil, r.sendError(err)
+
+		case msg := <-outC:
+			err := r.send(msg)
+			if err != nil {
+				return nil, r.sendError(party.WrapError(err))
+			}
+
+		case signature := <-endC:
+			if len(signature.Signature) != ed25519.SignatureSize {
+				return nil, r.sendError(errors.New("invalid signature"))
+			}
+			err = r.sendDone()
+			r.wait()
+
+			return signature.Signature, err
+
+		case in := <-inC:
+			msg, err := unmarshalTSSMessage(in)
+			if err != nil {
+				return nil, r.sendError(err)
+			}
+			peer.debugf("input: src=%v\n", msg.GetFrom().Id)
+			r.run(func() {
+				_, err := party.Update(msg)
+				if err != nil {
+					r.fail(errC, party.WrapError(err))
+				}
+			})
+		}
+	}
+}
+
+// EdDSAPublicKey returns the Ed25519 public key of the key share.
+func EdDSAPublicKey(key *keygen.LocalPartySaveData) ed25519.PublicKey {
+	return encodeEdwardsPoint(key.EDDSAPub)
+}
+
+// encodeEdwardsPoint encodes the point in the RFC 8032 format: the
+// little-endian y coordinate with the sign of x in the most
+// significant bit.
+func encodeEdwardsPoint(p *crypto.ECPoint) []byte {
+	var buf [ed25519.PublicKeySize]byte
+	p.Y().FillBytes(buf[:])
+	slices.Reverse(buf[:])
+	buf[len(buf)-1] |= byte(p.X().Bit(0) << 7)
+	return buf[:]
+}
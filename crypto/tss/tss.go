@@ -9,7 +9,9 @@
 package tss
 
 import (
+	"bytes"
 	"crypto/elliptic"
+	"crypto/sha256"
 	"encoding/asn1"
 	"encoding/binary"
 	"encoding/json"
@@ -18,11 +20,14 @@ import (
 	"io"
 	"math/big"
 	"os"
+	"slices"
 	"sync"
 
 	"github.com/bnb-chain/tss-lib/v2/common"
 	"github.com/bnb-chain/tss-lib/v2/ecdsa/keygen"
+	"github.com/bnb-chain/tss-lib/v2/ecdsa/resharing"
 	"github.com/bnb-chain/tss-lib/v2/ecdsa/signing"
+	eddsakeygen "github.com/bnb-chain/tss-lib/v2/eddsa/keygen"
 	"github.com/bnb-chain/tss-lib/v2/tss"
 	"github.com/markkurossi/mpc/ot"
 )
@@ -30,14 +35,31 @@ import (
 var (
 	bo           = binary.BigEndian
 	errTruncated = errors.New("truncated message")
-	curve        = elliptic.P256()
 )
 
+// moniker defines the moniker of the party IDs. The party ID keys
+// are derived from the party ID and the moniker.
+const moniker = "Ephemelier"
+
+// maxMessageSize defines the maximum size of a marshalled tss-lib
+// wire message.
+const maxMessageSize = 16 * 1024 * 1024
+
 type msgType byte
 
 const (
 	msgTSS msgType = iota
 	msgDone
+	msgReshare
+)
+
+// committee identifies the resharing committee of the message
+// recipient.
+type committee byte
+
+const (
+	committeeOld committee = iota
+	committeeNew
 )
 
 type ecdsaSig struct {
@@ -45,44 +67,81 @@ type ecdsaSig struct {
 	S *big.Int
 }
 
-// Peer implements a two-party peer for threshold signature scheme.
+// Peer implements a peer for the t-of-n threshold signature scheme.
 type Peer struct {
-	Debug   bool
-	io      ot.IO
-	ctx     *tss.PeerContext
-	PartyID *tss.PartyID
+	Debug bool
+
+	// PreParams specifies optional pre-generated Paillier and safe
+	// prime parameters for Keygen. If nil, Keygen generates the
+	// parameters which can take minutes.
+	PreParams *keygen.LocalPreParams
+
+	// Curve specifies the elliptic curve of the key. If nil, the
+	// P-256 curve is used. The curve must be registered with
+	// tss.RegisterCurve; the secp256k1 curve is registered by
+	// tss-lib.
+	Curve elliptic.Curve
+
+	PartyID   *tss.PartyID
+	parties   []string
+	threshold int
+	links     map[string]ot.IO
 }
 
 func init() {
 	tss.RegisterCurve("secp256r1", elliptic.P256())
 }
 
-func makePartyID(id string) *tss.PartyID {
+// makePartyID creates the party ID for the id. The epoch specifies
+// the key generation: it is 0 for Keygen and it is incremented by each
+// Reshare since the old and new committees must have distinct party
+// keys.
+func makePartyID(id string, epoch uint32) *tss.PartyID {
 	var keyData []byte
-	const moniker = "Ephemelier"
 
 	keyData = append(keyData, []byte(id)...)
 	keyData = append(keyData, []byte(moniker)...)
+	if epoch > 0 {
+		keyData = bo.AppendUint32(keyData, epoch)
+	}
 
 	key := new(big.Int).SetBytes(keyData)
 
 	return tss.NewPartyID(id, moniker, key)
 }
 
-// NewPeer creates a new two-party peer for threshold signature
-// scheme. The argument specifies the peer's ID (evaluator / garbler).
-func NewPeer(io ot.IO, evaluator bool) (*Peer, error) {
-	ids := tss.SortPartyIDs(tss.UnSortedPartyIDs{
-		makePartyID("E"),
-		makePartyID("G"),
-	})
+// keyEpoch returns the epoch of the party id's key share key.
+func keyEpoch(id string, key *keygen.LocalPartySaveData) (uint32, error) {
+	if key.ShareID == nil {
+		return 0, errors.New("key share has no share ID")
+	}
+	prefix := append([]byte(id), []byte(moniker)...)
+	data := key.ShareID.Bytes()
+	if !bytes.HasPrefix(data, prefix) {
+		return 0, fmt.Errorf("key share is not for party %v", id)
+	}
+	switch len(data) - len(prefix) {
+	case 0:
+		return 0, nil
+	case 4:
+		return bo.Uint32(data[len(prefix):]), nil
+	default:
+		return 0, fmt.Errorf("invalid share ID for party %v", id)
+	}
+}
 
-	var this string
-	if evaluator {
-		this = "E"
-	} else {
-		this = "G"
+// makePartyIDs creates the sorted party IDs of the epoch for the
+// parties and returns them and the ID of the party this. The IDs are
+// created for each protocol run because sorting sets the party
+// indices.
+func makePartyIDs(parties []string, this string, epoch uint32) (
+	tss.SortedPartyIDs, *tss.PartyID) {
+
+	var unsorted tss.UnSortedPartyIDs
+	for _, party := range parties {
+		unsorted = append(unsorted, makePartyID(party, epoch))
 	}
+	ids := tss.SortPartyIDs(unsorted)
 
 	var id *tss.PartyID
 	for _, i := range ids {
@@ -90,14 +149,66 @@ func NewPeer(io ot.IO, evaluator bool) (*Peer, error) {
 			id = i
 		}
 	}
+	return ids, id
+}
+
+// NewPeer creates a new two-party peer for threshold signature
+// scheme. The argument specifies the peer's ID (evaluator / garbler).
+// Both parties are needed to sign.
+func NewPeer(io ot.IO, evaluator bool) (*Peer, error) {
+	this, other := "G", "E"
+	if evaluator {
+		this, other = "E", "G"
+	}
+	return NewThresholdPeer(this, []string{"E", "G"}, 2,
+		map[string]ot.IO{
+			other: io,
+		})
+}
+
+// NewThresholdPeer creates a new peer for the t-of-n threshold
+// signature scheme. The id specifies the peer's ID and the parties
+// specify the IDs of all n parties, including this peer. The
+// threshold specifies the number of parties t needed to sign. The
+// links map the other parties' IDs to their connections. Keygen needs
+// links to all parties and Sign to the signing parties.
+func NewThresholdPeer(id string, parties []string, threshold int,
+	links map[string]ot.IO) (*Peer, error) {
+
+	if !slices.Contains(parties, id) {
+		return nil, fmt.Errorf("party %v not in parties %v", id, parties)
+	}
+	for idx, party := range parties {
+		if slices.Contains(parties[idx+1:], party) {
+			return nil, fmt.Errorf("duplicate party %v", party)
+		}
+	}
+	if threshold < 2 || threshold > len(parties) {
+		return nil, fmt.Errorf("invalid threshold %v for %v parties",
+			threshold, len(parties))
+	}
+	for party := range links {
+		if party == id || !slices.Contains(parties, party) {
+			return nil, fmt.Errorf("invalid link to party %v", party)
+		}
+	}
+	_, partyID := makePartyIDs(parties, id, 0)
 
 	return &Peer{
-		io:      io,
-		ctx:     tss.NewPeerContext(ids),
-		PartyID: id,
+		PartyID:   partyID,
+		parties:   slices.Clone(parties),
+		threshold: threshold,
+		links:     links,
 	}, nil
 }
 
+func (peer *Peer) curve() elliptic.Curve {
+	if peer.Curve != nil {
+		return peer.Curve
+	}
+	return elliptic.P256()
+}
+
 func (peer *Peer) debugf(format string, a ...interface{}) {
 	if !peer.Debug {
 		return
@@ -106,134 +217,158 @@ func (peer *Peer) debugf(format string, a ...interface{}) {
 	fmt.Printf("%v: %v", peer.PartyID.Id, msg)
 }
 
-// Keygen implements the threshold key generation.
+// Keygen implements the threshold key generation. All parties must
+// participate in the key generation.
 func (peer *Peer) Keygen() (*keygen.LocalPartySaveData, error) {
+	ids, id := makePartyIDs(peer.parties, peer.PartyID.Id, 0)
+	r, err := peer.newRouter(ids)
+	if err != nil {
+		return nil, err
+	}
+
 	errC := make(chan *tss.Error)
 	outC := make(chan tss.Message)
-	endC := make(chan *keygen.LocalPartySaveData)
+	defer r.close(outC)
+	endC := make(chan *keygen.LocalPartySaveData, 1)
 
-	n := len(peer.ctx.IDs())
+	params := tss.NewParameters(peer.curve(), tss.NewPeerContext(ids), id,
+		len(ids), peer.threshold-1)
 
-	params := tss.NewParameters(curve, peer.ctx, peer.PartyID, n, 1)
-	party := keygen.NewLocalParty(params, outC, endC).(*keygen.LocalParty)
-
-	var wg sync.WaitGroup
+	var party *keygen.LocalParty
+	if peer.PreParams != nil {
+		party = keygen.NewLocalParty(params, outC, endC,
+			*peer.PreParams).(*keygen.LocalParty)
+	} else {
+		party = keygen.NewLocalParty(params, outC, endC).(*keygen.LocalParty)
+	}
 
-	wg.Go(func() {
+	r.run(func() {
 		if err := party.Start(); err != nil {
-			errC <- err
+			r.fail(errC, err)
 		}
 	})
 
 	inC := make(chan []byte)
-	wg.Go(func() {
-		peer.ioReader(party, inC, errC)
-	})
+	r.start(party, inC, errC)
 
 	for {
 		select {
 		case err := <-errC:
-			return nil, peer.sendError(err)
+			return nil, r.sendError(err)
 
 		case msg := <-outC:
-			dst := msg.GetTo()
-			peer.debugf("msg: src=%v, dst=%v\n", msg.GetFrom().Id, dst)
-
-			if dst != nil && dst[0].Index == msg.GetFrom().Index {
-				return nil, peer.sendError(
-					fmt.Errorf("party %v sending a message to itself",
-						peer.PartyID))
-			}
-
-			// Send message to our peer.
-			data, err := marshalTSSMessage(msg)
+			err := r.send(msg)
 			if err != nil {
-				return nil, peer.sendError(party.WrapError(err))
-			}
-			if err := peer.io.SendData(data); err != nil {
-				return nil, party.WrapError(err)
-			}
-			if err := peer.io.Flush(); err != nil {
-				return nil, party.WrapError(err)
+				return nil, r.sendError(party.WrapError(err))
 			}
 
 		case save := <-endC:
 			peer.debugf("save: id=%v\n", peer.PartyID.Id)
-			err := peer.sendDone()
-			wg.Wait()
+			err := r.sendDone()
+			r.wait()
 
 			return save, err
 
 		case in := <-inC:
 			msg, err := unmarshalTSSMessage(in)
 			if err != nil {
-				return nil, peer.sendError(err)
+				return nil, r.sendError(err)
 			}
 			peer.debugf("input: src=%v\n", msg.GetFrom().Id)
-			go func() {
+			r.run(func() {
 				_, err := party.Update(msg)
 				if err != nil {
-					errC <- party.WrapError(err)
+					r.fail(errC, party.WrapError(err))
 				}
-			}()
+			})
 		}
 	}
 }
 
 // Sign implements the threshold signature for the message msg using
-// the local key share key. The function returns the message hash,
-// signature, and an optional error.
+// the local key share key. The message is hashed with SHA-256. All
+// parties participate in the signature. The function returns the
+// message hash, signature, and an optional error.
 func (peer *Peer) Sign(key *keygen.LocalPartySaveData, msg []byte) (
 	[]byte, []byte, error) {
 
-	errC := make(chan *tss.Error)
-	outC := make(chan tss.Message)
-	endC := make(chan *common.SignatureData)
+	hash := sha256.Sum256(msg)
+	return peer.SignHash(key, hash[:])
+}
+
+// SignHash implements the threshold signature for the pre-computed
+// message hash using the local key share key. All parties participate
+// in the signature. The function returns the message hash, signature,
+// and an optional error.
+func (peer *Peer) SignHash(key *keygen.LocalPartySaveData, hash []byte) (
+	[]byte, []byte, error) {
 
-	n := len(peer.ctx.IDs())
+	return peer.SignWith(key, hash, peer.parties)
+}
+
+// SignWith implements the threshold signature for the pre-computed
+// message hash using the local key share key. The signers specify the
+// IDs of the signing parties, including this peer. The number of
+// signers must be at least the threshold. The function returns the
+// message hash, signature, and an optional error.
+func (peer *Peer) SignWith(key *keygen.LocalPartySaveData, hash []byte,
+	signers []string) ([]byte, []byte, error) {
+
+	for _, signer := range signers {
+		if !slices.Contains(peer.parties, signer) {
+			return nil, nil, fmt.Errorf("unknown signer %v", signer)
+		}
+	}
+	if !tss.SameCurve(key.ECDSAPub.Curve(), peer.curve()) {
+		return nil, nil, errors.New("key share curve does not match peer")
+	}
+	epoch, err := keyEpoch(peer.PartyID.Id, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids, id := makePartyIDs(signers, peer.PartyID.Id, epoch)
+	if id == nil {
+		return nil, nil, fmt.Errorf("party %v not in signers %v",
+			peer.PartyID.Id, signers)
+	}
+	if len(ids) < peer.threshold {
+		return nil, nil, fmt.Errorf("%v signers, threshold is %v",
+			len(ids), peer.threshold)
+	}
+	r, err := peer.newRouter(ids)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	params := tss.NewParameters(curve, peer.ctx, peer.PartyID, n, 1)
-	party := signing.NewLocalParty(new(big.Int).SetBytes(msg), params, *key,
-		outC, endC, len(msg)).(*signing.LocalParty)
+	errC := make(chan *tss.Error)
+	outC := make(chan tss.Message)
+	defer r.close(outC)
+	endC := make(chan *common.SignatureData, 1)
 
-	var wg sync.WaitGroup
+	params := tss.NewParameters(peer.curve(), tss.NewPeerContext(ids), id,
+		len(ids), peer.threshold-1)
+	subset := keygen.BuildLocalSaveDataSubset(*key, ids)
+	party := signing.NewLocalParty(hashToInt(hash, peer.curve()), params,
+		subset, outC, endC).(*signing.LocalParty)
 
-	wg.Go(func() {
+	r.run(func() {
 		if err := party.Start(); err != nil {
-			errC <- err
+			r.fail(errC, err)
 		}
 	})
 
 	inC := make(chan []byte)
-	wg.Go(func() {
-		peer.ioReader(party, inC, errC)
-	})
+	r.start(party, inC, errC)
 
 	for {
 		select {
 		case err := <-errC:
-			return nil, nil, peer.sendError(err)
+			return nil, nil, r.sendError(err)
 
 		case msg := <-outC:
-			dst := msg.GetTo()
-			peer.debugf("msg: src=%v, dst=%v\n", msg.GetFrom().Id, dst)
-
-			if dst != nil && dst[0].Index == msg.GetFrom().Index {
-				return nil, nil, peer.sendError(
-					fmt.Errorf("party %v sending a message to itself",
-						peer.PartyID))
-			}
-
-			// Send message to our peer.
-			data, err := marshalTSSMessage(msg)
+			err := r.send(msg)
 			if err != nil {
-				return nil, nil, peer.sendError(party.WrapError(err))
-			}
-			if err := peer.io.SendData(data); err != nil {
-				return nil, nil, err
-			}
-			if err := peer.io.Flush(); err != nil {
-				return nil, nil, err
+				return nil, nil, r.sendError(party.WrapError(err))
 			}
 
 		case signature := <-endC:
@@ -244,83 +379,415 @@ func (peer *Peer) Sign(key *keygen.LocalPartySaveData, msg []byte) (
 
 			data, err := asn1.Marshal(sig)
 			if err != nil {
-				peer.sendError(err)
-				wg.Wait()
+				r.sendError(err)
+				r.wait()
 				return nil, nil, err
 			}
-			err = peer.sendDone()
-			wg.Wait()
+			err = r.sendDone()
+			r.wait()
 
-			return signature.M, data, err
+			return hash, data, err
 
 		case in := <-inC:
 			msg, err := unmarshalTSSMessage(in)
 			if err != nil {
-				return nil, nil, peer.sendError(err)
+				return nil, nil, r.sendError(err)
 			}
 			peer.debugf("input: src=%v\n", msg.GetFrom().Id)
-			wg.Go(func() {
+			r.run(func() {
 				_, err := party.Update(msg)
 				if err != nil {
-					errC <- party.WrapError(err)
+					r.fail(errC, party.WrapError(err))
 				}
 			})
 		}
 	}
 }
 
-func (peer *Peer) sendError(err error) error {
+// Reshare implements the threshold key resharing. It creates fresh
+// key shares for the public key of the local key share old. All
+// parties must participate in the resharing and the threshold stays
+// the same. The old key share is zeroed when the protocol completes
+// and it can't be combined with the new key shares. The new key share
+// uses the peer's PreParams if set; otherwise the protocol generates
+// new parameters.
+func (peer *Peer) Reshare(old *keygen.LocalPartySaveData) (
+	*keygen.LocalPartySaveData, error) {
+
+	if !tss.SameCurve(old.ECDSAPub.Curve(), peer.curve()) {
+		return nil, errors.New("key share curve does not match peer")
+	}
+	epoch, err := keyEpoch(peer.PartyID.Id, old)
+	if err != nil {
+		return nil, err
+	}
+	oldIDs, oldID := makePartyIDs(peer.parties, peer.PartyID.Id, epoch)
+	newIDs, newID := makePartyIDs(peer.parties, peer.PartyID.Id, epoch+1)
+	r, err := peer.newRouter(oldIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	errC := make(chan *tss.Error)
+	outC := make(chan tss.Message)
+	defer r.close(outC)
+	oldEndC := make(chan *keygen.LocalPartySaveData, 1)
+	newEndC := make(chan *keygen.LocalPartySaveData, 1)
+
+	oldCtx := tss.NewPeerContext(oldIDs)
+	newCtx := tss.NewPeerContext(newIDs)
+	n := len(peer.parties)
+	t := peer.threshold - 1
+
+	// Each peer is a member of both the old and the new committee.
+	c := peer.curve()
+	oldParty := resharing.NewLocalParty(
+		tss.NewReSharingParameters(c, oldCtx, newCtx, oldID, n, t, n, t),
+		*old, outC, oldEndC).(*resharing.LocalParty)
+
+	save := keygen.NewLocalPartySaveData(n)
+	if peer.PreParams != nil {
+		save.LocalPreParams = *peer.PreParams
+	}
+	newParty := resharing.NewLocalParty(
+		tss.NewReSharingParameters(c, oldCtx, newCtx, newID, n, t, n, t),
+		save, outC, newEndC).(*resharing.LocalParty)
+
+	for _, party := range []*resharing.LocalParty{newParty, oldParty} {
+		r.run(func() {
+			if err := party.Start(); err != nil {
+				r.fail(errC, err)
+			}
+		})
+	}
+
+	inC := make(chan []byte)
+	r.start(oldParty, inC, errC)
+
+	update := func(data []byte) error {
+		cm, msg, err := unmarshalReshareMessage(data)
+		if err != nil {
+			return err
+		}
+		peer.debugf("input: src=%v, committee=%v\n", msg.GetFrom().Id, cm)
+		party := oldParty
+		if cm == committeeNew {
+			party = newParty
+		}
+		r.run(func() {
+			_, err := party.Update(msg)
+			if err != nil {
+				r.fail(errC, party.WrapError(err))
+			}
+		})
+		return nil
+	}
+
+	var result *keygen.LocalPartySaveData
+	var oldDone bool
+
+	for result == nil || !oldDone {
+		select {
+		case err := <-errC:
+			return nil, r.sendError(err)
+
+		case msg := <-outC:
+			err := r.sendReshare(msg, len(oldIDs), update)
+			if err != nil {
+				return nil, r.sendError(err)
+			}
+
+		case <-oldEndC:
+			oldDone = true
+
+		case result = <-newEndC:
+			peer.debugf("save: id=%v\n", peer.PartyID.Id)
+
+		case in := <-inC:
+			if err := update(in); err != nil {
+				return nil, r.sendError(err)
+			}
+		}
+	}
+	if !result.ECDSAPub.Equals(old.ECDSAPub) {
+		return nil, r.sendError(errors.New("resharing changed the public key"))
+	}
+	err = r.sendDone()
+	r.wait()
+
+	return result, err
+}
+
+// hashToInt converts the hash to an integer like crypto/ecdsa: the
+// hash is truncated to the bit length of the curve order.
+func hashToInt(hash []byte, c elliptic.Curve) *big.Int {
+	orderBits := c.Params().N.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+	ret := new(big.Int).SetBytes(hash)
+	excess := len(hash)*8 - orderBits
+	if excess > 0 {
+		ret.Rsh(ret, uint(excess))
+	}
+	return ret
+}
+
+// router routes the tss-lib messages between the parties of one
+// protocol run. The links are keyed by the party IDs. The router also
+// tracks the goroutines of the run: the link readers and the local
+// party goroutines. The done channel is closed when the run ends.
+type router struct {
+	peer    *Peer
+	links   map[string]ot.IO
+	done    chan struct{}
+	ended   bool
+	readers sync.WaitGroup
+	parties sync.WaitGroup
+}
+
+// newRouter creates a router for the parties ids. The peer must have
+// links to all other parties.
+func (peer *Peer) newRouter(ids tss.SortedPartyIDs) (*router, error) {
+	r := &router{
+		peer:  peer,
+		links: make(map[string]ot.IO),
+		done:  make(chan struct{}),
+	}
+	for _, id := range ids {
+		if id.Id == peer.PartyID.Id {
+			continue
+		}
+		link, ok := peer.links[id.Id]
+		if !ok {
+			return nil, fmt.Errorf("no link to party %v", id.Id)
+		}
+		r.links[id.Id] = link
+	}
+	return r, nil
+}
+
+// start starts the readers for the links. The readers pass the
+// received tss-lib messages to inC until the peers are done. After
+// the run has ended, the readers discard the messages.
+func (r *router) start(party tss.Party, inC chan []byte,
+	errC chan *tss.Error) {
+
+	for _, link := range r.links {
+		r.readers.Go(func() {
+			ioReader(link, party, inC, errC, r.done)
+		})
+	}
+}
+
+// wait ends the run and waits until the readers have received the
+// peers' done messages.
+func (r *router) wait() {
+	r.end()
+	r.readers.Wait()
+}
+
+func (r *router) end() {
+	if !r.ended {
+		r.ended = true
+		close(r.done)
+	}
+}
+
+// run runs f in a local party goroutine.
+func (r *router) run(f func()) {
+	r.parties.Go(f)
+}
+
+// fail passes the error to errC unless the run has ended.
+func (r *router) fail(errC chan *tss.Error, err *tss.Error) {
+	fail(errC, err, r.done)
+}
+
+func fail(errC chan *tss.Error, err *tss.Error, done chan struct{}) {
+	select {
+	case errC <- err:
+	case <-done:
+	}
+}
+
+// close ends the run. The goroutines blocked on passing messages to
+// the run exit and the messages the local parties still output to
+// outC are discarded until the party goroutines have exited.
+func (r *router) close(outC chan tss.Message) {
+	r.end()
+	go func() {
+		idle := make(chan struct{})
+		go func() {
+			r.parties.Wait()
+			close(idle)
+		}()
+		for {
+			select {
+			case <-outC:
+			case <-idle:
+				return
+			}
+		}
+	}()
+}
+
+// send sends the message to its recipients. Broadcast messages are
+// sent to all parties.
+func (r *router) send(msg tss.Message) error {
+	dst := msg.GetTo()
+	r.peer.debugf("msg: src=%v, dst=%v\n", msg.GetFrom().Id, dst)
+
+	for _, to := range dst {
+		if to.Index == msg.GetFrom().Index {
+			return fmt.Errorf("party %v sending a message to itself",
+				r.peer.PartyID)
+		}
+	}
+	data, err := marshalTSSMessage(msg)
+	if err != nil {
+		return err
+	}
+	if dst == nil {
+		return r.sendAll(data)
+	}
+	for _, to := range dst {
+		link, ok := r.links[to.Id]
+		if !ok {
+			return fmt.Errorf("no link to party %v", to.Id)
+		}
+		err = sendData(link, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendReshare sends the resharing message to its recipients in the
+// old and new committees. The nOld specifies the size of the old
+// committee. The messages to this peer's other committee party are
+// passed to local.
+func (r *router) sendReshare(msg tss.Message, nOld int,
+	local func(data []byte) error) error {
+
+	dst := msg.GetTo()
+	r.peer.debugf("msg: src=%v, dst=%v\n", msg.GetFrom().Id, dst)
+
+	var oldDst, newDst []*tss.PartyID
+	switch {
+	case dst == nil:
+		return fmt.Errorf("party %v broadcasting a resharing message",
+			r.peer.PartyID)
+	case msg.IsToOldAndNewCommittees():
+		if len(dst) < nOld {
+			return fmt.Errorf("invalid resharing recipients %v", dst)
+		}
+		oldDst, newDst = dst[:nOld], dst[nOld:]
+	case msg.IsToOldCommittee():
+		oldDst = dst
+	default:
+		newDst = dst
+	}
+	data, err := marshalTSSMessage(msg)
+	if err != nil {
+		return err
+	}
+	from := msg.GetFrom().KeyInt()
+
+	for c, ids := range [][]*tss.PartyID{oldDst, newDst} {
+		frame := make([]byte, 2+len(data))
+		frame[0] = byte(msgReshare)
+		frame[1] = byte(c)
+		copy(frame[2:], data)
+
+		for _, to := range ids {
+			if to.KeyInt().Cmp(from) == 0 {
+				continue
+			}
+			if to.Id == r.peer.PartyID.Id {
+				err = local(frame)
+			} else {
+				link, ok := r.links[to.Id]
+				if !ok {
+					return fmt.Errorf("no link to party %v", to.Id)
+				}
+				err = sendData(link, frame)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *router) sendError(err error) error {
 	msg := []byte(err.Error())
 	buf := make([]byte, 1+len(msg))
 	buf[0] = byte(msgDone)
 	copy(buf[1:], msg)
 
-	if err := peer.sendDoneMsg(buf); err != nil {
+	if err := r.sendAll(buf); err != nil {
 		return err
 	}
 
 	return err
 }
 
-func (peer *Peer) sendDone() error {
-	return peer.sendDoneMsg([]byte{byte(msgDone)})
+func (r *router) sendDone() error {
+	return r.sendAll([]byte{byte(msgDone)})
 }
 
-func (peer *Peer) sendDoneMsg(data []byte) error {
-	if err := peer.io.SendData(data); err != nil {
+func (r *router) sendAll(data []byte) error {
+	for _, link := range r.links {
+		if err := sendData(link, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendData(link ot.IO, data []byte) error {
+	if err := link.SendData(data); err != nil {
 		return err
 	}
-	if err := peer.io.Flush(); err != nil {
+	if err := link.Flush(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (peer *Peer) ioReader(party tss.Party, inC chan []byte,
-	errC chan *tss.Error) {
+func ioReader(link ot.IO, party tss.Party, inC chan []byte,
+	errC chan *tss.Error, done chan struct{}) {
 
 	for {
-		data, err := peer.io.ReceiveData()
+		data, err := link.ReceiveData()
 		if err != nil {
-			errC <- party.WrapError(err)
+			fail(errC, party.WrapError(err), done)
 			return
 		}
 		if len(data) == 0 {
-			errC <- party.WrapError(errTruncated)
+			fail(errC, party.WrapError(errTruncated), done)
 			return
 		}
 		switch msgType(data[0]) {
-		case msgTSS:
-			inC <- data
+		case msgTSS, msgReshare:
+			select {
+			case inC <- data:
+			case <-done:
+			}
 
 		case msgDone:
 			if len(data) > 1 {
-				errC <- party.WrapError(errors.New(string(data[1:])))
+				fail(errC, party.WrapError(errors.New(string(data[1:]))), done)
 			}
 			return
 
 		default:
-			errC <- party.WrapError(fmt.Errorf("invalid message %d", data[0]))
+			fail(errC, party.WrapError(fmt.Errorf("invalid message %d", data[0])),
+				done)
 			return
 		}
 	}
@@ -351,30 +818,87 @@ func marshalTSSMessage(msg tss.Message) ([]byte, error) {
 }
 
 func unmarshalTSSMessage(data []byte) (tss.ParsedMessage, error) {
-	if len(data) < 6 {
-		return nil, errTruncated
+	msgData, fromData, isBroadcast, err := parseTSSMessage(data)
+	if err != nil {
+		return nil, err
 	}
-	msgLen := int(bo.Uint32(data[1:]))
-	if 1+4+msgLen+1 > len(data) {
-		return nil, errTruncated
+	var from tss.PartyID
+	err = json.Unmarshal(fromData, &from)
+	if err != nil {
+		return nil, err
+	}
+	return tss.ParseWireMessage(msgData, &from, isBroadcast)
+}
+
+// unmarshalReshareMessage decodes the resharing message frame:
+//
+//	[1-byte type][1-byte committee][TSS message]
+func unmarshalReshareMessage(data []byte) (
+	committee, tss.ParsedMessage, error) {
+
+	if len(data) < 2 {
+		return 0, nil, errTruncated
+	}
+	if msgType(data[0]) != msgReshare {
+		return 0, nil, fmt.Errorf("invalid resharing message: %d", data[0])
+	}
+	c := committee(data[1])
+	if c != committeeOld && c != committeeNew {
+		return 0, nil, fmt.Errorf("invalid committee: %d", data[1])
+	}
+	msg, err := unmarshalTSSMessage(data[2:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return c, msg, nil
+}
+
+// parseTSSMessage validates the framing of the marshalled TSS message
+// and returns its wire message, sender, and broadcast flag. The
+// message must consist of exactly one frame:
+//
+//	[1-byte type][4-byte len][msg][from json][1-byte broadcast]
+func parseTSSMessage(data []byte) ([]byte, []byte, bool, error) {
+	if len(data) < 1+4+1 {
+		return nil, nil, false, errTruncated
 	}
 	if msgType(data[0]) != msgTSS {
-		return nil, fmt.Errorf("invalid TSS message: %d", data[0])
+		return nil, nil, false, fmt.Errorf("invalid TSS message: %d", data[0])
+	}
+	msgLen := int(bo.Uint32(data[1:]))
+	if msgLen > maxMessageSize || 1+4+msgLen+1 > len(data) {
+		return nil, nil, false, errTruncated
 	}
 	msgData := data[5 : 5+msgLen]
-	fromData := data[5+msgLen : len(data)-1]
-	isBroadcast := data[len(data)-1] == 1
 
-	var from tss.PartyID
-	err := json.Unmarshal(fromData, &from)
+	// The from JSON is not length-prefixed. Decode one JSON value to
+	// find its length.
+	dec := json.NewDecoder(bytes.NewReader(data[5+msgLen:]))
+	var from json.RawMessage
+	err := dec.Decode(&from)
 	if err != nil {
-		return nil, err
+		return nil, nil, false, errTruncated
 	}
-	return tss.ParseWireMessage(msgData, &from, isBroadcast)
+	fromLen := int(dec.InputOffset())
+	if len(data) != 1+4+msgLen+fromLen+1 {
+		return nil, nil, false, errTruncated
+	}
+	fromData := data[5+msgLen : 5+msgLen+fromLen]
+
+	var isBroadcast bool
+	switch data[len(data)-1] {
+	case 0:
+	case 1:
+		isBroadcast = true
+	default:
+		return nil, nil, false, errTruncated
+	}
+	return msgData, fromData, isBroadcast, nil
 }
 
-// WriteSaveData writes the local party save data to file.
-func WriteSaveData(file string, save *keygen.LocalPartySaveData) error {
+// WriteSaveData writes the local party save data to file. The save
+// data is either an ECDSA or an EdDSA key share.
+func WriteSaveData(file string, save interface{}) error {
 	data, err := json.Marshal(save)
 	if err != nil {
 		return err
@@ -389,22 +913,36 @@ func WriteSaveData(file string, save *keygen.LocalPartySaveData) error {
 	return err
 }
 
-// ReadSaveData reads the local party save data from file.
+// ReadSaveData reads the ECDSA local party save data from file.
 func ReadSaveData(file string) (*keygen.LocalPartySaveData, error) {
-	f, err := os.Open(file)
+	result := new(keygen.LocalPartySaveData)
+	err := readSaveData(file, result)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return result, nil
+}
 
-	data, err := io.ReadAll(f)
+// ReadEdDSASaveData reads the EdDSA local party save data from file.
+func ReadEdDSASaveData(file string) (*eddsakeygen.LocalPartySaveData, error) {
+	result := new(eddsakeygen.LocalPartySaveData)
+	err := readSaveData(file, result)
 	if err != nil {
 		return nil, err
 	}
-	result := new(keygen.LocalPartySaveData)
-	err = json.Unmarshal(data, result)
+	return result, nil
+}
+
+func readSaveData(file string, result interface{}) error {
+	f, err := os.Open(file)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return result, nil
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
 }
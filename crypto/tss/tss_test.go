@@ -0,0 +1,453 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package tss
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bnb-chain/tss-lib/v2/ecdsa/keygen"
+	eddsakeygen "github.com/bnb-chain/tss-lib/v2/eddsa/keygen"
+	"github.com/bnb-chain/tss-lib/v2/tss"
+	"github.com/markkurossi/mpc/ot"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+func makeFrame(msg, from []byte, broadcast byte) []byte {
+	data := []byte{byte(msgTSS), 0, 0, 0, 0}
+	bo.PutUint32(data[1:], uint32(len(msg)))
+	data = append(data, msg...)
+	data = append(data, from...)
+	return append(data, broadcast)
+}
+
+func TestParseTSSMessage(t *testing.T) {
+	msg := []byte{1, 2, 3, 4}
+	from := []byte(`{"id":"garbler","moniker":"garbler","key":"AQ=="}`)
+
+	frame := makeFrame(msg, from, 1)
+	msgData, fromData, isBroadcast, err := parseTSSMessage(frame)
+	if err != nil {
+		t.Fatalf("parseTSSMessage failed: %v", err)
+	}
+	if !bytes.Equal(msgData, msg) {
+		t.Errorf("got msg %x, expected %x", msgData, msg)
+	}
+	if !bytes.Equal(fromData, from) {
+		t.Errorf("got from %s, expected %s", fromData, from)
+	}
+	if !isBroadcast {
+		t.Errorf("broadcast flag not set")
+	}
+
+	tooLong := makeFrame(msg, from, 0)
+	bo.PutUint32(tooLong[1:], maxMessageSize+1)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"header", frame[:5]},
+		{"truncated", frame[:len(frame)-1]},
+		{"truncated msg", frame[:7]},
+		{"truncated from", frame[:len(frame)-10]},
+		{"concatenated", append(append([]byte{}, frame...), frame...)},
+		{"trailing data", append(append([]byte{}, frame...), 0)},
+		{"missing from", makeFrame(msg, nil, 0)},
+		{"invalid broadcast", makeFrame(msg, from, 2)},
+		{"msg length", tooLong},
+	}
+	for _, test := range tests {
+		_, _, _, err := parseTSSMessage(test.data)
+		if !errors.Is(err, errTruncated) {
+			t.Errorf("%s: got %v, expected %v", test.name, err, errTruncated)
+		}
+	}
+}
+
+// newTestPeers creates threshold peers for the parties. The peers are
+// connected with pipes to all other peers.
+func newTestPeers(t *testing.T, parties []string, threshold int) []*Peer {
+	links := make([]map[string]ot.IO, len(parties))
+	for i := range parties {
+		links[i] = make(map[string]ot.IO)
+	}
+	for i := range parties {
+		for j := i + 1; j < len(parties); j++ {
+			a, b := p2p.Pipe()
+			links[i][parties[j]] = a
+			links[j][parties[i]] = b
+		}
+	}
+	fixtures, _, err := keygen.LoadKeygenTestFixtures(len(parties))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var peers []*Peer
+	for i, party := range parties {
+		peer, err := NewThresholdPeer(party, parties, threshold, links[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer.PreParams = &fixtures[i].LocalPreParams
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+func TestNewThresholdPeer(t *testing.T) {
+	parties := []string{"A", "B", "C"}
+	tests := []struct {
+		id        string
+		parties   []string
+		threshold int
+	}{
+		{"D", parties, 2},
+		{"A", []string{"A", "B", "A"}, 2},
+		{"A", parties, 1},
+		{"A", parties, 4},
+	}
+	for _, test := range tests {
+		_, err := NewThresholdPeer(test.id, test.parties, test.threshold, nil)
+		if err == nil {
+			t.Errorf("NewThresholdPeer(%v, %v, %v) succeeded", test.id,
+				test.parties, test.threshold)
+		}
+	}
+	_, err := NewThresholdPeer("A", parties, 2, map[string]ot.IO{
+		"A": nil,
+	})
+	if err == nil {
+		t.Errorf("NewThresholdPeer accepted a link to itself")
+	}
+}
+
+func TestThresholdSign(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping threshold keygen in short mode")
+	}
+	parties := []string{"A", "B", "C"}
+	peers := newTestPeers(t, parties, 2)
+
+	keys := make([]*keygen.LocalPartySaveData, len(peers))
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Go(func() {
+			keys[i], errs[i] = peer.Keygen()
+		})
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("%v: keygen failed: %v", parties[i], err)
+		}
+	}
+
+	// Sign with A and C. B is offline.
+	digest := sha256.Sum256([]byte("Hello, world!"))
+	signers := []int{0, 2}
+	signatures := make([][]byte, len(peers))
+	for _, i := range signers {
+		wg.Go(func() {
+			_, signatures[i], errs[i] = peers[i].SignWith(keys[i], digest[:],
+				[]string{"A", "C"})
+		})
+	}
+	wg.Wait()
+
+	pub := keys[0].ECDSAPub.ToECDSAPubKey()
+	for _, i := range signers {
+		if errs[i] != nil {
+			t.Fatalf("%v: sign failed: %v", parties[i], errs[i])
+		}
+		if !ecdsa.VerifyASN1(pub, digest[:], signatures[i]) {
+			t.Errorf("%v: signature verification failed", parties[i])
+		}
+	}
+
+	_, _, err := peers[0].SignWith(keys[0], digest[:], []string{"A"})
+	if err == nil {
+		t.Errorf("SignWith succeeded below threshold")
+	}
+}
+
+func TestReshare(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping threshold keygen in short mode")
+	}
+	parties := []string{"E", "G"}
+	peers := newTestPeers(t, parties, 2)
+
+	run := func(f func(i int, peer *Peer) error) {
+		errs := make([]error, len(peers))
+		var wg sync.WaitGroup
+		for i, peer := range peers {
+			wg.Go(func() {
+				errs[i] = f(i, peer)
+			})
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("%v: %v", parties[i], err)
+			}
+		}
+	}
+
+	keys := make([]*keygen.LocalPartySaveData, len(peers))
+	run(func(i int, peer *Peer) (err error) {
+		keys[i], err = peer.Keygen()
+		return
+	})
+	pub := keys[0].ECDSAPub.ToECDSAPubKey()
+
+	for round := 1; round <= 2; round++ {
+		shares := make([]*keygen.LocalPartySaveData, len(peers))
+		run(func(i int, peer *Peer) (err error) {
+			shares[i], err = peer.Reshare(keys[i])
+			return
+		})
+		for i, share := range shares {
+			if keys[i].Xi.Sign() != 0 {
+				t.Errorf("%v: old share not zeroed", parties[i])
+			}
+			epoch, err := keyEpoch(parties[i], share)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if epoch != uint32(round) {
+				t.Errorf("got epoch %v, expected %v", epoch, round)
+			}
+		}
+		keys = shares
+
+		digest := sha256.Sum256([]byte("Hello, world!"))
+		signatures := make([][]byte, len(peers))
+		run(func(i int, peer *Peer) (err error) {
+			_, signatures[i], err = peer.SignHash(keys[i], digest[:])
+			return
+		})
+		for i, signature := range signatures {
+			if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+				t.Errorf("%v: signature verification failed", parties[i])
+			}
+		}
+	}
+}
+
+func TestSignHash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping threshold keygen in short mode")
+	}
+	secp256k1, ok := tss.GetCurveByName(tss.Secp256k1)
+	if !ok {
+		t.Fatal("secp256k1 not registered")
+	}
+	parties := []string{"E", "G"}
+	peers := newTestPeers(t, parties, 2)
+	for _, peer := range peers {
+		peer.Curve = secp256k1
+	}
+
+	keys := make([]*keygen.LocalPartySaveData, len(peers))
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Go(func() {
+			keys[i], errs[i] = peer.Keygen()
+		})
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("%v: keygen failed: %v", parties[i], err)
+		}
+	}
+	pub := keys[0].ECDSAPub.ToECDSAPubKey()
+	if pub.Curve != secp256k1 {
+		t.Fatalf("got curve %v, expected secp256k1", pub.Curve.Params().Name)
+	}
+
+	msg := []byte("Hello, world!")
+	digest := sha256.Sum256(msg)
+
+	tests := []struct {
+		name string
+		sign func(peer *Peer, key *keygen.LocalPartySaveData) (
+			[]byte, []byte, error)
+	}{
+		{"message", func(peer *Peer, key *keygen.LocalPartySaveData) (
+			[]byte, []byte, error) {
+			return peer.Sign(key, msg)
+		}},
+		{"hash", func(peer *Peer, key *keygen.LocalPartySaveData) (
+			[]byte, []byte, error) {
+			return peer.SignHash(key, digest[:])
+		}},
+	}
+	for _, test := range tests {
+		hashes := make([][]byte, len(peers))
+		signatures := make([][]byte, len(peers))
+		for i, peer := range peers {
+			wg.Go(func() {
+				hashes[i], signatures[i], errs[i] = test.sign(peer, keys[i])
+			})
+		}
+		wg.Wait()
+		for i := range peers {
+			if errs[i] != nil {
+				t.Fatalf("%s: %v: sign failed: %v", test.name, parties[i],
+					errs[i])
+			}
+			if !bytes.Equal(hashes[i], digest[:]) {
+				t.Errorf("%s: got hash %x, expected %x", test.name, hashes[i],
+					digest)
+			}
+			if !ecdsa.VerifyASN1(pub, digest[:], signatures[i]) {
+				t.Errorf("%s: %v: signature verification failed", test.name,
+					parties[i])
+			}
+		}
+	}
+
+	peers[0].Curve = nil
+	_, _, err := peers[0].SignHash(keys[0], digest[:])
+	if err == nil {
+		t.Errorf("SignHash accepted a key for a different curve")
+	}
+}
+
+func TestEdDSASign(t *testing.T) {
+	parties := []string{"E", "G"}
+	peers := newTestPeers(t, parties, 2)
+
+	keys := make([]*eddsakeygen.LocalPartySaveData, len(peers))
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Go(func() {
+			keys[i], errs[i] = peer.EdDSAKeygen()
+		})
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("%v: keygen failed: %v", parties[i], err)
+		}
+	}
+
+	// Store and reload the key shares.
+	for i := range keys {
+		file := filepath.Join(t.TempDir(), "share")
+		err := WriteSaveData(file, keys[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i], err = ReadEdDSASaveData(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pub := EdDSAPublicKey(keys[0])
+	if !bytes.Equal(pub, EdDSAPublicKey(keys[1])) {
+		t.Fatalf("public keys differ")
+	}
+
+	for _, msg := range [][]byte{
+		[]byte("Hello, world!"),
+		{0, 0, 1, 2},
+	} {
+		signatures := make([][]byte, len(peers))
+		for i, peer := range peers {
+			wg.Go(func() {
+				signatures[i], errs[i] = peer.EdDSASign(keys[i], msg)
+			})
+		}
+		wg.Wait()
+		for i := range peers {
+			if errs[i] != nil {
+				t.Fatalf("%v: sign failed: %v", parties[i], errs[i])
+			}
+			if !ed25519.Verify(pub, msg, signatures[i]) {
+				t.Errorf("%v: signature verification failed for %x",
+					parties[i], msg)
+			}
+		}
+	}
+}
+
+// waitGoroutines waits until the number of goroutines drops to n.
+func waitGoroutines(n int) int {
+	var count int
+	for i := 0; i < 100; i++ {
+		count = runtime.NumGoroutine()
+		if count <= n {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return count
+}
+
+func TestGoroutineLeak(t *testing.T) {
+	parties := []string{"E", "G"}
+	peers := newTestPeers(t, parties, 2)
+	start := runtime.NumGoroutine()
+
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for round := 0; round < 100; round++ {
+		for i, peer := range peers {
+			wg.Go(func() {
+				_, errs[i] = peer.EdDSAKeygen()
+			})
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("%v: keygen failed: %v", parties[i], err)
+			}
+		}
+	}
+	if count := waitGoroutines(start); count > start {
+		t.Errorf("got %v goroutines, expected %v", count, start)
+	}
+
+	// A protocol error ends the run and its goroutines.
+	a, b := p2p.Pipe()
+	peer, err := NewThresholdPeer("E", parties, 2, map[string]ot.IO{
+		"G": a,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start = runtime.NumGoroutine()
+	err = b.SendData([]byte{0xff})
+	if err == nil {
+		err = b.Flush()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = peer.EdDSAKeygen()
+	if err == nil {
+		t.Fatalf("keygen succeeded with an invalid message")
+	}
+	if count := waitGoroutines(start); count > start {
+		t.Errorf("got %v goroutines after error, expected %v", count, start)
+	}
+}
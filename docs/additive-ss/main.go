@@ -49,7 +49,13 @@ func NewServerPeer(name string) (*ServerPeer, error) {
 
 // ComputePartialDH computes αᵢ·(β·G) - the peer's contribution to the
 // DH result.
-func (p *ServerPeer) ComputePartialDH(serverPublicKey *Point) *Point {
+func (p *ServerPeer) ComputePartialDH(serverPublicKey *Point) (*Point, error) {
+	// Reject invalid-curve points. P-256 has cofactor 1 so no
+	// subgroup check is needed.
+	if !curve.IsOnCurve(serverPublicKey.X, serverPublicKey.Y) {
+		return nil, fmt.Errorf("%s: server public key not on curve", p.Name)
+	}
+
 	// Compute αᵢ·(β·G)
 	partialX, partialY := curve.ScalarMult(serverPublicKey.X, serverPublicKey.Y,
 		p.AlphaI.Bytes())
@@ -57,7 +63,7 @@ func (p *ServerPeer) ComputePartialDH(serverPublicKey *Point) *Point {
 	return &Point{
 		X: partialX,
 		Y: partialY,
-	}
+	}, nil
 }
 
 // ServerSide represents the distributed TLS client (N servers acting
@@ -116,7 +122,10 @@ func (s *ServerSide) DeriveSharedSecret(tlsServerPublicKey *Point) (
 
 	fmt.Println("\n  Partial DH Computations:")
 	for i, peer := range s.Peers {
-		partial := peer.ComputePartialDH(tlsServerPublicKey)
+		partial, err := peer.ComputePartialDH(tlsServerPublicKey)
+		if err != nil {
+			return nil, err
+		}
 		partialResults[i] = partial
 		fmt.Printf("  • %s computes αᵢ·(β·G): (%s..., %s...)\n",
 			peer.Name,
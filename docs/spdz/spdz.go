@@ -391,6 +391,19 @@ func SPDZPointAdd(conn *p2p.Conn, id int, x1, y1, x2, y2 *Share, triples []*Trip
 	return x3, y3, nil
 }
 
+// TripleBudgetPointAdd returns the exact number of Beaver triples that
+// SPDZPointAdd consumes: the square-and-multiply inversion of x2-x1
+// takes one triple per bit and one per set bit of the exponent p-2,
+// and the lam, lam^2, and lam*(x1-x3) multiplications take one each.
+func TripleBudgetPointAdd() int {
+	exp := new(big.Int).Sub(p256P, big.NewInt(2))
+	n := exp.BitLen()
+	for i := 0; i < exp.BitLen(); i++ {
+		n += int(exp.Bit(i))
+	}
+	return n + 3
+}
+
 // ---------- Input sharing ----------
 
 // ShareInput shares with the peer: owner==true => mask with random s
@@ -463,7 +476,7 @@ func Peer(oti ot.OT, id int, conn *p2p.Conn, xInput, yInput *big.Int) (xOut, yOu
 	}
 
 	// Generate Beaver triples (dealer = peer 0)
-	triplesNeeded := 1400 // safe upper bound for inversion + intermediate multiplications
+	triplesNeeded := TripleBudgetPointAdd()
 	triples, err := GenerateBeaverTriplesOTBatch(conn, oti, id, triplesNeeded, 0)
 	if err != nil {
 		return nil, nil, err
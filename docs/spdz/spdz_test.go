@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// dealerTriples returns n Beaver triples split into additive shares
+// for peers 0 and 1.
+func dealerTriples(t *testing.T, n int) ([]*Triple, []*Triple) {
+	var t0, t1 []*Triple
+	for i := 0; i < n; i++ {
+		var v [3]*big.Int
+		var s [3]*big.Int
+		for j := 0; j < 2; j++ {
+			var err error
+			v[j], err = randomFieldElement(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		v[2] = modReduce(new(big.Int).Mul(v[0], v[1]))
+		for j := range s {
+			var err error
+			s[j], err = randomFieldElement(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		t0 = append(t0, &Triple{
+			A: NewShare(s[0]),
+			B: NewShare(s[1]),
+			C: NewShare(s[2]),
+		})
+		t1 = append(t1, &Triple{
+			A: NewShare(new(big.Int).Sub(v[0], s[0])),
+			B: NewShare(new(big.Int).Sub(v[1], s[1])),
+			C: NewShare(new(big.Int).Sub(v[2], s[2])),
+		})
+	}
+	return t0, t1
+}
+
+func TestTripleBudgetPointAdd(t *testing.T) {
+	curve := elliptic.P256()
+	px, py := curve.ScalarBaseMult(randField().Bytes())
+	qx, qy := curve.ScalarBaseMult(randField().Bytes())
+	rx, ry := curve.Add(px, py, qx, qy)
+
+	budget := TripleBudgetPointAdd()
+	triples0, triples1 := dealerTriples(t, budget)
+
+	// Peer 0 holds the points, peer 1 holds zero shares.
+	points := []*big.Int{px, py, qx, qy}
+
+	run := func(conn *p2p.Conn, id int, triples []*Triple) (
+		*Share, *Share, int, error) {
+
+		var shares []*Share
+		for _, v := range points {
+			if id == 1 {
+				v = new(big.Int)
+			}
+			shares = append(shares, NewShare(v))
+		}
+		tripleIndex := 0
+		x3, y3, err := SPDZPointAdd(conn, id, shares[0], shares[1],
+			shares[2], shares[3], triples, &tripleIndex)
+		return x3, y3, tripleIndex, err
+	}
+
+	c0, c1 := p2p.Pipe()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	var x31, y31 *Share
+	var used1 int
+	var err1 error
+	go func() {
+		defer wg.Done()
+		x31, y31, used1, err1 = run(c1, 1, triples1)
+	}()
+	x30, y30, used0, err0 := run(c0, 0, triples0)
+	wg.Wait()
+
+	if err0 != nil {
+		t.Fatalf("peer0 error: %v", err0)
+	}
+	if err1 != nil {
+		t.Fatalf("peer1 error: %v", err1)
+	}
+	if used0 != budget || used1 != budget {
+		t.Errorf("used %v/%v triples, expected %v", used0, used1, budget)
+	}
+	if rec2(x30, x31).Cmp(rx) != 0 || rec2(y30, y31).Cmp(ry) != 0 {
+		t.Errorf("point addition mismatch")
+	}
+}
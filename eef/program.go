@@ -8,7 +8,10 @@
 package eef
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path"
@@ -29,6 +32,10 @@ type Program struct {
 	ByName   map[string]*Circuit
 	ByPC     map[int]*Circuit
 	Missing  map[int]string
+
+	// Digest is the SHA-256 digest of the program files. Nodes with
+	// identical programs have identical digests.
+	Digest [sha256.Size]byte
 }
 
 // Circuit implements a program state.
@@ -52,11 +59,20 @@ func NewProgram(file string) (*Program, error) {
 		ByPC:     make(map[int]*Circuit),
 		Missing:  make(map[int]string),
 	}
+	digest := sha256.New()
 
 	for _, entry := range entries {
 		name := entry.Name()
 		path := filepath.Join(file, name)
 
+		if name == "symtab" || circuit.IsFilename(name) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			digestFile(digest, name, data)
+		}
+
 		if name == "symtab" {
 			params := utils.NewParams()
 			err = params.LoadSymbolIDs(path)
@@ -85,6 +101,7 @@ func NewProgram(file string) (*Program, error) {
 			if err != nil {
 				return nil, err
 			}
+			digestFile(digest, name, data)
 			dmpcl := &Circuit{
 				Name:  MakeName(name),
 				DMPCL: data,
@@ -93,6 +110,8 @@ func NewProgram(file string) (*Program, error) {
 		}
 	}
 
+	digest.Sum(prog.Digest[:0])
+
 	// Create mappings from PC to circuit.
 	for name, circ := range prog.ByName {
 		id, ok := prog.Symtab[name]
@@ -150,6 +169,19 @@ func NewProgram(file string) (*Program, error) {
 	return prog, nil
 }
 
+// digestFile adds the program file name and its data to the program
+// digest.
+func digestFile(h hash.Hash, name string, data []byte) {
+	var buf [8]byte
+
+	binary.BigEndian.PutUint64(buf[:], uint64(len(name)))
+	h.Write(buf[:])
+	h.Write([]byte(name))
+	binary.BigEndian.PutUint64(buf[:], uint64(len(data)))
+	h.Write(buf[:])
+	h.Write(data)
+}
+
 // StateName returns the name of the state.
 func (prog *Program) StateName(pc int) string {
 	circ, ok := prog.ByPC[pc]
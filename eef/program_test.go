@@ -0,0 +1,62 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package eef
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSymtab = `package main
+
+const (
+	Init = 0
+)
+`
+
+func writeTestProgram(t *testing.T, dir, init string) string {
+	file := filepath.Join(dir, "prog")
+	err := os.MkdirAll(file, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(file, "symtab"), []byte(testSymtab),
+		0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(file, "init.dmpcl"), []byte(init), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestProgramDigest(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		match bool
+	}{
+		{"package main\n", "package main\n", true},
+		{"package main\n", "package main\n\n", false},
+	}
+	for idx, test := range tests {
+		pa, err := NewProgram(writeTestProgram(t, t.TempDir(), test.a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pb, err := NewProgram(writeTestProgram(t, t.TempDir(), test.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (pa.Digest == pb.Digest) != test.match {
+			t.Errorf("test %d: got match %v, expected %v",
+				idx, pa.Digest == pb.Digest, test.match)
+		}
+	}
+}
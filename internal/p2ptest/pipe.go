@@ -0,0 +1,231 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+// Package p2ptest implements a recording p2p connection pipe for
+// tests. The pipe connects two p2p.Conn peers like p2p.Pipe and
+// records every message the peers flush to each other. Tests can
+// assert on the recorded protocol exchange, dump it for debugging,
+// and replay the recorded messages to a peer.
+package p2ptest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markkurossi/mpc/p2p"
+)
+
+// Direction specifies the message direction.
+type Direction int
+
+// Message directions.
+const (
+	// P0ToP1 messages are sent from the first peer to the second
+	// peer.
+	P0ToP1 Direction = iota
+	// P1ToP0 messages are sent from the second peer to the first
+	// peer.
+	P1ToP0
+)
+
+func (d Direction) String() string {
+	switch d {
+	case P0ToP1:
+		return "0->1"
+	case P1ToP0:
+		return "1->0"
+	default:
+		return fmt.Sprintf("{Direction %d}", int(d))
+	}
+}
+
+// Message is a recorded message. The p2p.Conn buffers its writes so
+// each message contains the data one Flush sent to the peer.
+type Message struct {
+	Seq  int
+	Dir  Direction
+	Data []byte
+	Time time.Time
+}
+
+// Recorder records the messages of a pipe. The messages are recorded
+// in the order the peers sent them.
+type Recorder struct {
+	m        sync.Mutex
+	messages []Message
+}
+
+// Pipe creates a connected p2p.Conn pair and a recorder for their
+// messages. Unlike net.Pipe, the pipe is buffered so both peers can
+// send without waiting for the other to receive.
+func Pipe() (*p2p.Conn, *p2p.Conn, *Recorder) {
+	rec := new(Recorder)
+	q0 := newQueue()
+	q1 := newQueue()
+
+	c0 := p2p.NewConn(&pipeEnd{
+		dir: P0ToP1,
+		in:  q1,
+		out: q0,
+		rec: rec,
+	})
+	c1 := p2p.NewConn(&pipeEnd{
+		dir: P1ToP0,
+		in:  q0,
+		out: q1,
+		rec: rec,
+	})
+	return c0, c1, rec
+}
+
+// Messages returns the recorded messages.
+func (rec *Recorder) Messages() []Message {
+	rec.m.Lock()
+	defer rec.m.Unlock()
+
+	result := make([]Message, len(rec.messages))
+	copy(result, rec.messages)
+	return result
+}
+
+// Data returns the concatenated data of all messages sent in the
+// direction dir.
+func (rec *Recorder) Data(dir Direction) []byte {
+	var result []byte
+	for _, msg := range rec.Messages() {
+		if msg.Dir == dir {
+			result = append(result, msg.Data...)
+		}
+	}
+	return result
+}
+
+// Reset clears the recorded messages.
+func (rec *Recorder) Reset() {
+	rec.m.Lock()
+	rec.messages = nil
+	rec.m.Unlock()
+}
+
+// Replay creates a connection which receives the recorded messages
+// sent in the direction dir. The data the connection sends is
+// discarded. Replay lets tests run one peer against a captured
+// session without the other peer.
+func (rec *Recorder) Replay(dir Direction) *p2p.Conn {
+	return p2p.NewConn(&replayEnd{
+		data: rec.Data(dir),
+	})
+}
+
+// Dump writes the recorded messages to w in a human readable format.
+func (rec *Recorder) Dump(w io.Writer) {
+	messages := rec.Messages()
+	var start time.Time
+	if len(messages) > 0 {
+		start = messages[0].Time
+	}
+	for _, msg := range messages {
+		fmt.Fprintf(w, "#%d %v +%v %d bytes\n", msg.Seq, msg.Dir,
+			msg.Time.Sub(start), len(msg.Data))
+		dump := strings.TrimRight(hex.Dump(msg.Data), "\n")
+		for _, line := range strings.Split(dump, "\n") {
+			if len(line) > 0 {
+				fmt.Fprintf(w, "  %s\n", line)
+			}
+		}
+	}
+}
+
+func (rec *Recorder) record(dir Direction, data []byte) {
+	rec.m.Lock()
+	defer rec.m.Unlock()
+
+	rec.messages = append(rec.messages, Message{
+		Seq:  len(rec.messages),
+		Dir:  dir,
+		Data: append([]byte(nil), data...),
+		Time: time.Now(),
+	})
+}
+
+type queue struct {
+	m      sync.Mutex
+	c      *sync.Cond
+	buf    []byte
+	closed bool
+}
+
+func newQueue() *queue {
+	q := new(queue)
+	q.c = sync.NewCond(&q.m)
+	return q
+}
+
+type pipeEnd struct {
+	dir Direction
+	in  *queue
+	out *queue
+	rec *Recorder
+}
+
+func (p *pipeEnd) Read(b []byte) (int, error) {
+	p.in.m.Lock()
+	defer p.in.m.Unlock()
+
+	for len(p.in.buf) == 0 {
+		if p.in.closed {
+			return 0, io.EOF
+		}
+		p.in.c.Wait()
+	}
+	n := copy(b, p.in.buf)
+	p.in.buf = p.in.buf[n:]
+	return n, nil
+}
+
+func (p *pipeEnd) Write(b []byte) (int, error) {
+	p.out.m.Lock()
+	defer p.out.m.Unlock()
+
+	if p.out.closed {
+		return 0, io.ErrClosedPipe
+	}
+	p.rec.record(p.dir, b)
+	p.out.buf = append(p.out.buf, b...)
+	p.out.c.Broadcast()
+	return len(b), nil
+}
+
+func (p *pipeEnd) Close() error {
+	for _, q := range []*queue{p.in, p.out} {
+		q.m.Lock()
+		q.closed = true
+		q.c.Broadcast()
+		q.m.Unlock()
+	}
+	return nil
+}
+
+type replayEnd struct {
+	data []byte
+}
+
+func (r *replayEnd) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *replayEnd) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package p2ptest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	c0, c1, rec := Pipe()
+	defer c0.Close()
+	defer c1.Close()
+
+	err := c0.SendUint32(42)
+	if err == nil {
+		err = c0.Flush()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := c1.ReceiveUint32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 42 {
+		t.Errorf("got %v, expected 42", v)
+	}
+
+	err = c1.SendData([]byte("hello"))
+	if err == nil {
+		err = c1.Flush()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c0.ReceiveData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("got %q, expected %q", data, "hello")
+	}
+
+	msgs := rec.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("got %v messages, expected 2", len(msgs))
+	}
+	tests := []struct {
+		dir  Direction
+		size int
+	}{
+		{P0ToP1, 4},
+		{P1ToP0, 4 + 5},
+	}
+	for idx, test := range tests {
+		msg := msgs[idx]
+		if msg.Seq != idx {
+			t.Errorf("message %d: got seq %v", idx, msg.Seq)
+		}
+		if msg.Dir != test.dir {
+			t.Errorf("message %d: got %v, expected %v", idx, msg.Dir, test.dir)
+		}
+		if len(msg.Data) != test.size {
+			t.Errorf("message %d: got %v bytes, expected %v",
+				idx, len(msg.Data), test.size)
+		}
+	}
+
+	var buf bytes.Buffer
+	rec.Dump(&buf)
+	if !strings.Contains(buf.String(), "#1 1->0") {
+		t.Errorf("unexpected dump:\n%s", buf.String())
+	}
+
+	// Replay the first peer's messages.
+	replay := rec.Replay(P0ToP1)
+	v, err = replay.ReceiveUint32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 42 {
+		t.Errorf("replay: got %v, expected 42", v)
+	}
+
+	rec.Reset()
+	if len(rec.Messages()) != 0 {
+		t.Errorf("Reset did not clear messages")
+	}
+}
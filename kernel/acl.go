@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// ParseCIDRs parses the CIDR prefixes for the listener access control
+// list.
+func ParseCIDRs(cidrs []string) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		result = append(result, prefix.Masked())
+	}
+	return result, nil
+}
+
+// acl implements IP-based access control for accepted connections.
+type acl struct {
+	enabled  bool
+	prefixes []netip.Prefix
+}
+
+func newACL(cidrs []string) (*acl, error) {
+	result := &acl{
+		enabled: len(cidrs) > 0,
+	}
+	prefixes, err := ParseCIDRs(cidrs)
+	if err != nil {
+		// Deny all connections.
+		return result, err
+	}
+	result.prefixes = prefixes
+	return result, nil
+}
+
+// Allowed tests if the ACL allows connections from the address.
+func (acl *acl) Allowed(addr net.Addr) bool {
+	if acl == nil || !acl.enabled {
+		return true
+	}
+	var ip netip.Addr
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.AddrPort().Addr()
+	case *net.UDPAddr:
+		ip = a.AddrPort().Addr()
+	default:
+		ap, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return false
+		}
+		ip = ap.Addr()
+	}
+	ip = ip.Unmap()
+	for _, prefix := range acl.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"net"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	acl, err := newACL([]string{"10.0.0.0/8", "192.168.1.1/32", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"10.1.2.3:443", true},
+		{"11.1.2.3:443", false},
+		{"192.168.1.1:80", true},
+		{"192.168.1.2:80", false},
+		{"[::ffff:10.0.0.1]:80", true},
+		{"[fd12::1]:80", true},
+		{"[fe80::1]:80", false},
+	}
+	for _, test := range tests {
+		addr, err := net.ResolveTCPAddr("tcp", test.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allowed := acl.Allowed(addr)
+		if allowed != test.allowed {
+			t.Errorf("Allowed(%v)=%v, expected %v",
+				test.addr, allowed, test.allowed)
+		}
+	}
+
+	// Empty ACL allows all connections.
+	acl, err = newACL(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.TCPAddr{
+		IP: net.IPv4(1, 2, 3, 4),
+	}
+	if !acl.Allowed(addr) {
+		t.Errorf("empty ACL denied %v", addr)
+	}
+
+	// Invalid ACL denies all connections.
+	acl, err = newACL([]string{"10.0.0.0/33"})
+	if err == nil {
+		t.Errorf("invalid CIDR accepted")
+	}
+	if acl.Allowed(addr) {
+		t.Errorf("invalid ACL allowed %v", addr)
+	}
+
+	// The kernel does not start with an invalid ACL.
+	_, err = New(&Params{
+		AllowCIDRs: []string{"10.0.0.0/8", "10.0.0.1"},
+	})
+	if err == nil {
+		t.Errorf("kernel started with invalid AllowCIDRs")
+	}
+}
@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"time"
+)
+
+// Clocks for the clock_gettime syscall.
+const (
+	ClockRealtime  int32 = 0
+	ClockMonotonic int32 = 1
+)
+
+// TimespecSize defines the size of the gettimeofday and clock_gettime
+// syscall results: 64-bit seconds followed by 32-bit nanoseconds.
+const TimespecSize = 12
+
+// clockBase is the reference point of the monotonic clock.
+var clockBase = time.Now()
+
+// clockNanosleep implements the clock_nanosleep syscall. The process
+// sleeps until the garbler's clock reaches the absolute deadline,
+// given as nanoseconds since the Unix epoch. The garbler drives the
+// wakeup and syncs the result with the evaluator. If the process is
+// interrupted, the syscall returns EINTR and the remaining time in
+// nanoseconds.
+func (proc *Process) clockNanosleep(sys *syscall) {
+	var result int
+	var remaining []byte
+	var err error
+
+	if proc.role == RoleGarbler {
+		var data []byte
+		data, err = sys.argData()
+		if err != nil || len(data) != 8 {
+			result = int(-EINVAL)
+		} else {
+			deadline := time.Unix(0, int64(bo.Uint64(data)))
+			if proc.sleep(deadline) {
+				result = int(-EINTR)
+				rem := time.Until(deadline)
+				if rem < 0 {
+					rem = 0
+				}
+				remaining = make([]byte, 8)
+				bo.PutUint64(remaining, uint64(rem.Nanoseconds()))
+			}
+		}
+		err = proc.conn.SendUint32(result)
+		if err == nil && result == int(-EINTR) {
+			err = proc.conn.SendData(remaining)
+		}
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+		if err == nil && result == int(-EINTR) {
+			remaining, err = proc.conn.ReceiveData()
+			if err == nil && len(remaining) != 8 {
+				err = EPROTO
+			}
+		}
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+	if remaining != nil {
+		sys.argBuf = remaining
+		sys.arg1 = int32(len(remaining))
+	}
+}
+
+// alarm implements the alarm syscall. The garbler schedules an
+// interrupt for the process after arg0 seconds and syncs the result
+// with the evaluator. The zero seconds cancels the pending alarm. The
+// syscall returns the number of seconds left in the previous alarm.
+func (proc *Process) alarm(sys *syscall) {
+	var result int
+	var err error
+
+	if proc.role == RoleGarbler {
+		if sys.arg0 < 0 {
+			result = int(-EINVAL)
+		} else {
+			result = proc.setAlarm(time.Duration(sys.arg0) * time.Second)
+		}
+		err = proc.conn.SendUint32(result)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+}
+
+// setAlarm sets the process' alarm to interrupt the process after
+// the duration d. The zero duration cancels the alarm. The function
+// returns the number of seconds left in the previous alarm, rounded
+// up.
+func (proc *Process) setAlarm(d time.Duration) int {
+	proc.m.Lock()
+	defer proc.m.Unlock()
+
+	var remaining int
+	if proc.alarmTimer != nil && proc.alarmTimer.Stop() {
+		rem := time.Until(proc.alarmAt)
+		remaining = int((rem + time.Second - 1) / time.Second)
+		if remaining < 1 {
+			remaining = 1
+		}
+	}
+	proc.alarmTimer = nil
+	if d > 0 {
+		proc.alarmAt = time.Now().Add(d)
+		proc.alarmTimer = time.AfterFunc(d, proc.Interrupt)
+	}
+	return remaining
+}
+
+// clockGettime implements the gettimeofday and clock_gettime
+// syscalls. The garbler samples its clock and syncs the time with the
+// evaluator so both parties return the same value.
+func (proc *Process) clockGettime(sys *syscall) {
+	clock := ClockRealtime
+	if sys.call == SysClockGettime {
+		clock = sys.arg0
+	}
+	if clock != ClockRealtime && clock != ClockMonotonic {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+
+	var ts []byte
+	var err error
+
+	if proc.role == RoleGarbler {
+		var d time.Duration
+		if clock == ClockMonotonic {
+			d = time.Since(clockBase)
+		} else {
+			d = time.Duration(time.Now().UnixNano())
+		}
+		ts = make([]byte, TimespecSize)
+		bo.PutUint64(ts, uint64(d/time.Second))
+		bo.PutUint32(ts[8:], uint32(d%time.Second))
+
+		err = proc.conn.SendData(ts)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		ts, err = proc.conn.ReceiveData()
+		if err == nil && len(ts) != TimespecSize {
+			err = EPROTO
+		}
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(0)
+	sys.argBuf = ts
+	sys.arg1 = int32(len(ts))
+}
@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
+)
+
+func TestClockGettime(t *testing.T) {
+	c0, c1, _ := p2ptest.Pipe()
+	garbler := &Process{
+		role: RoleGarbler,
+		conn: c0,
+	}
+	evaluator := &Process{
+		role: RoleEvaluator,
+		conn: c1,
+	}
+
+	gettime := func(call Syscall, clock int32) (*syscall, *syscall) {
+		gsys := &syscall{
+			call: call,
+			arg0: clock,
+		}
+		esys := &syscall{
+			call: call,
+			arg0: clock,
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.clockGettime(gsys)
+		})
+		wg.Go(func() {
+			evaluator.clockGettime(esys)
+		})
+		wg.Wait()
+		return gsys, esys
+	}
+	decode := func(buf []byte) time.Duration {
+		return time.Duration(bo.Uint64(buf))*time.Second +
+			time.Duration(bo.Uint32(buf[8:]))
+	}
+
+	tests := []struct {
+		call  Syscall
+		clock int32
+	}{
+		{SysGettimeofday, 0},
+		{SysGettimeofday, 42},
+		{SysClockGettime, ClockRealtime},
+		{SysClockGettime, ClockMonotonic},
+	}
+	var mono time.Duration
+	for idx, test := range tests {
+		before := time.Now()
+		gsys, esys := gettime(test.call, test.clock)
+		after := time.Now()
+
+		if gsys.arg0 != 0 || esys.arg0 != 0 {
+			t.Fatalf("test%d: got %v/%v, expected 0", idx, gsys.arg0,
+				esys.arg0)
+		}
+		if len(gsys.argBuf) != TimespecSize || gsys.arg1 != TimespecSize {
+			t.Fatalf("test%d: invalid timespec length %v/%v", idx,
+				len(gsys.argBuf), gsys.arg1)
+		}
+		if !bytes.Equal(gsys.argBuf, esys.argBuf) || gsys.arg1 != esys.arg1 {
+			t.Errorf("test%d: garbler %x and evaluator %x differ", idx,
+				gsys.argBuf, esys.argBuf)
+		}
+		if bo.Uint32(gsys.argBuf[8:]) >= uint32(time.Second) {
+			t.Errorf("test%d: invalid nanoseconds %v", idx,
+				bo.Uint32(gsys.argBuf[8:]))
+		}
+		d := decode(gsys.argBuf)
+		if test.clock == ClockMonotonic && test.call == SysClockGettime {
+			mono = d
+			continue
+		}
+		ts := time.Unix(0, int64(d))
+		if ts.Before(before) || ts.After(after) {
+			t.Errorf("test%d: time %v not in [%v,%v]", idx, ts, before, after)
+		}
+	}
+
+	// The monotonic clock does not go backwards.
+	gsys, _ := gettime(SysClockGettime, ClockMonotonic)
+	if d := decode(gsys.argBuf); d < mono {
+		t.Errorf("monotonic clock went backwards: %v < %v", d, mono)
+	}
+
+	// Invalid clocks are rejected by both parties without syncing.
+	gsys, esys := gettime(SysClockGettime, 2)
+	if gsys.arg0 != -int32(EINVAL) || esys.arg0 != -int32(EINVAL) {
+		t.Errorf("got %v/%v, expected %v", gsys.arg0, esys.arg0,
+			-int32(EINVAL))
+	}
+}
+
+func TestAlarm(t *testing.T) {
+	c0, c1, _ := p2ptest.Pipe()
+	garbler := &Process{
+		kern:  newTestKernel(t, nil),
+		role:  RoleGarbler,
+		conn:  c0,
+		state: SRUN,
+	}
+	garbler.c = sync.NewCond(&garbler.m)
+	evaluator := &Process{
+		kern:  newTestKernel(t, nil),
+		role:  RoleEvaluator,
+		conn:  c1,
+		state: SRUN,
+	}
+	evaluator.c = sync.NewCond(&evaluator.m)
+
+	call := func(call Syscall, arg0 int32) (int32, int32) {
+		gsys := &syscall{
+			call: call,
+			arg0: arg0,
+		}
+		esys := &syscall{
+			call: call,
+			arg0: arg0,
+		}
+		var gerr, eerr error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			gerr = garbler.syscall(gsys)
+		})
+		wg.Go(func() {
+			eerr = evaluator.syscall(esys)
+		})
+		wg.Wait()
+		if gerr != nil || eerr != nil {
+			t.Fatalf("%v: garbler=%v, evaluator=%v", call, gerr, eerr)
+		}
+		return gsys.arg0, esys.arg0
+	}
+
+	tests := []struct {
+		seconds  int32
+		expected int32
+	}{
+		{-1, -int32(EINVAL)},
+		{60, 0},
+		{0, 60},
+		{0, 0},
+		{1, 0},
+	}
+	for idx, test := range tests {
+		g, e := call(SysAlarm, test.seconds)
+		if g != test.expected || e != test.expected {
+			t.Errorf("test%d: alarm(%v)=%v/%v, expected %v", idx,
+				test.seconds, g, e, test.expected)
+		}
+	}
+
+	// The alarm interrupts the paused process.
+	start := time.Now()
+	g, e := call(SysPause, 0)
+	if g != -int32(EINTR) || e != -int32(EINTR) {
+		t.Errorf("pause: got %v/%v, expected %v", g, e, -int32(EINTR))
+	}
+	if time.Since(start) < 500*time.Millisecond {
+		t.Errorf("pause returned before the alarm")
+	}
+}
@@ -7,13 +7,13 @@
 package kernel
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/elliptic"
 	"fmt"
 	"math/big"
 	"time"
 
-	"github.com/markkurossi/ephemelier/crypto/spdz"
 	"github.com/markkurossi/ephemelier/crypto/tls"
 	"github.com/markkurossi/ephemelier/crypto/tss"
 )
@@ -76,28 +76,33 @@ var (
 	curveParams = curve.Params()
 )
 
-func (proc *Process) tlsServer(sys *syscall) {
+// tlsServer implements the tlsserver syscall. The function returns
+// an error only if the MAC check of the SPDZ key exchange fails. In
+// that case, the process is aborted without returning the shared
+// secret.
+func (proc *Process) tlsServer(sys *syscall) error {
 	// arg0 is the socket fd.
 	fd, ok := proc.fds[sys.arg0]
 	if !ok {
 		sys.SetArg0(int32(-EBADF))
-		return
+		return nil
 	}
 	socketfd, ok := fd.Impl.(*FDSocket)
 	if !ok {
 		sys.SetArg0(int32(-ENOTSOCK))
-		return
+		return nil
 	}
 
 	// arg1 is the key fd.
 	fd, ok = proc.fds[sys.arg1]
 	if !ok {
 		sys.SetArg0(int32(-EBADF))
+		return nil
 	}
 	keyfd, ok := fd.Impl.(*Key)
 	if !ok {
 		sys.SetArg0(int32(-EINVAL))
-		return
+		return nil
 	}
 
 	var err error
@@ -108,7 +113,11 @@ func (proc *Process) tlsServer(sys *syscall) {
 	}
 	if err != nil {
 		sys.SetArg0(mapError(err))
+		if isSecurityAbort(err) {
+			return fmt.Errorf("tlsserver: security abort: %w", err)
+		}
 	}
+	return nil
 }
 
 func (proc *Process) tlsServerGarbler(sock *FDSocket, key *Key,
@@ -132,6 +141,15 @@ func (proc *Process) tlsServerGarbler(sock *FDSocket, key *Key,
 		return err
 	}
 
+	// Compute partial DH αᵢ·(β·G). This also validates the client
+	// public key before the evaluator uses it.
+	partial, err := dhPeer.ComputePartialDH(peerPublicKey)
+	if err != nil {
+		conn.Alert(tls.AlertIllegalParameter)
+		proc.tlsPeerErrf(err, "invalid client public key: %v", err)
+		return err
+	}
+
 	// Communicate client public key with evaluator.
 	data, err := Marshal(&TLSKEX{
 		KeyShare: clientKex,
@@ -180,16 +198,14 @@ func (proc *Process) tlsServerGarbler(sock *FDSocket, key *Key,
 		// Encode public key into uncompressed SEC 1 format.
 		pubkey := EncodePublicKey(pubkeyX, pubkeyY)
 
-		// Compute partial DH αᵢ·(β·G)
-		partial := dhPeer.ComputePartialDH(peerPublicKey)
-
 		// Compute shared secret αβ·G = Σ(αᵢ·(β·G)) with SPDZ. The
 		// function returns our arithmetic share of the secret.
 		start := time.Now()
-		spdzFinalX, spdzFinalY, err := spdz.P256Add(spdz.Sender, proc.conn,
-			partial.X, partial.Y)
+		spdzFinalX, spdzFinalY, err := proc.spdzAdd(partial.X, partial.Y)
 		if err != nil {
-			proc.tlsPeerErrf(err, "SPDZ P256Add failed: %v", err)
+			err = mpcError("SPDZ P256Add", err)
+			proc.tlsPeerErrf(err, "%v", err)
+			conn.Alert(tlsErrnoToAlert[EMPC])
 			return err
 		}
 		proc.rusage.SPDZTime += time.Since(start)
@@ -240,12 +256,13 @@ func (proc *Process) tlsServerGarbler(sock *FDSocket, key *Key,
 		}
 
 		// Return TLS FD.
-		fd := NewTLSFD(conn, key)
+		share := secretShareBytes(spdzFinalX)
+		fd := NewTLSFD(conn, key, share)
 		sys.SetArg0(proc.AllocFD(fd))
 
-		// Return our share of the shared secret | transcript.
-		sys.argBuf = spdzFinalX.Bytes()
-		sys.argBuf = append(sys.argBuf, conn.Transcript()...)
+		// Return our share of the shared secret. The program reads
+		// the transcript with a separate tlshs syscall.
+		sys.argBuf = bytes.Clone(share)
 
 		// Sync FD with evaluator.
 		err = proc.conn.SendUint32(int(sys.arg0))
@@ -312,7 +329,11 @@ func (proc *Process) tlsServerEvaluator(sock *FDSocket, key *Key,
 		}
 
 		// Compute partial Diffie-Hellman.
-		partial := dhPeer.ComputePartialDH(peerPublicKey)
+		partial, err := dhPeer.ComputePartialDH(peerPublicKey)
+		if err != nil {
+			proc.tlsPeerErrf(err, "invalid client public key: %v", err)
+			return err
+		}
 
 		// Return our public key share.
 		kexResult := &TLSKEXResult{
@@ -345,10 +366,10 @@ func (proc *Process) tlsServerEvaluator(sock *FDSocket, key *Key,
 		// Compute shared secret αβ·G = Σ(αᵢ·(β·G)) with SPDZ. The
 		// function returns our arithmetic share of the secret.
 		start := time.Now()
-		spdzFinalX, spdzFinalY, err := spdz.P256Add(spdz.Receiver, proc.conn,
-			partial.X, partial.Y)
+		spdzFinalX, spdzFinalY, err := proc.spdzAdd(partial.X, partial.Y)
 		if err != nil {
-			proc.tlsPeerErrf(err, "SPDZ P256Add failed: %v", err)
+			err = mpcError("SPDZ P256Add", err)
+			proc.tlsPeerErrf(err, "%v", err)
 			return err
 		}
 		proc.rusage.SPDZTime += time.Since(start)
@@ -368,7 +389,8 @@ func (proc *Process) tlsServerEvaluator(sock *FDSocket, key *Key,
 		}
 
 		// Return TLS FD.
-		fd := NewTLSFD(nil, key)
+		share := secretShareBytes(spdzFinalX)
+		fd := NewTLSFD(nil, key, share)
 
 		// Get FD from garbler.
 		gfd, err := proc.conn.ReceiveUint32()
@@ -376,7 +398,7 @@ func (proc *Process) tlsServerEvaluator(sock *FDSocket, key *Key,
 			sys.SetArg0(int32(gfd))
 
 			// Return our share of the shared secret.
-			sys.argBuf = spdzFinalX.Bytes()
+			sys.argBuf = bytes.Clone(share)
 
 			err = proc.SetFD(sys.arg0, fd)
 		}
@@ -406,6 +428,13 @@ func (proc *Process) tlsServerEvaluator(sock *FDSocket, key *Key,
 	}
 }
 
+// secretShareBytes encodes the secret share x as a fixed-size
+// big-endian byte array so that its length does not depend on the
+// share value.
+func secretShareBytes(x *big.Int) []byte {
+	return x.FillBytes(make([]byte, (curveParams.BitSize+7)/8))
+}
+
 func (proc *Process) tlsHandshake(sys *syscall) {
 	fd, ok := proc.fds[sys.arg0]
 	if !ok {
@@ -434,9 +463,9 @@ func (proc *Process) tlsHandshake(sys *syscall) {
 				sys.SetArg0(mapError(err))
 				return
 			}
-			_, _, err = peer.Sign(tlsfd.key.Share, digest)
+			_, _, err = peer.SignHash(tlsfd.key.Share, digest)
 			if err != nil {
-				sys.SetArg0(int32(-EIO))
+				sys.SetArg0(mapError(mpcError("TSS sign", err)))
 				return
 			}
 			proc.rusage.TSSTime += time.Since(start)
@@ -510,9 +539,10 @@ func (proc *Process) tlsHandshake(sys *syscall) {
 			sys.SetArg0(mapError(err))
 			return
 		}
-		_, signature, err := peer.Sign(tlsfd.key.Share, digest)
+		_, signature, err := peer.SignHash(tlsfd.key.Share, digest)
 		if err != nil {
-			sys.SetArg0(int32(-EIO))
+			tlsfd.conn.Alert(tlsErrnoToAlert[EMPC])
+			sys.SetArg0(mapError(mpcError("TSS sign", err)))
 			return
 		}
 		proc.rusage.TSSTime += time.Since(start)
@@ -522,6 +552,11 @@ func (proc *Process) tlsHandshake(sys *syscall) {
 			return
 		}
 
+	case tls.HTServerHello:
+		// Return the transcript digest up to ServerHello for the
+		// handshake key derivation.
+		sys.argBuf = tlsfd.conn.Transcript()
+
 	case tls.HTFinished:
 		// Set transcript digest directly to argBuf so we don't
 		// include it to the transcript. The next call with ct=0
@@ -560,6 +595,184 @@ func (proc *Process) tlsStatus(sys *syscall) {
 	sys.SetArg0(0)
 }
 
+// TLSInfoSize defines the size of the tlsinfo syscall result. The
+// result has the following big-endian fields:
+//
+//	cipherSuite uint16
+//	group       uint16
+//	alpn        uint16
+//	flags       uint16
+const TLSInfoSize = 8
+
+// TLS connection info flags.
+const (
+	TLSInfoHandshakeDone uint16 = 1 << iota
+	TLSInfoPeerCertificate
+	TLSInfoServerName
+)
+
+// Info returns the TLS connection info in the tlsinfo syscall result
+// format. The info is a subset of the connection state. Since ALPN
+// is not supported, the alpn field is always 0.
+func (fd *FDTLS) Info() []byte {
+	state := fd.conn.ConnectionState()
+
+	var flags uint16
+	if fd.handshakeDone || state.HandshakeComplete {
+		flags |= TLSInfoHandshakeDone
+	}
+	if len(state.PeerCertificates) > 0 {
+		flags |= TLSInfoPeerCertificate
+	}
+	if len(fd.conn.ServerNames()) > 0 {
+		flags |= TLSInfoServerName
+	}
+
+	buf := make([]byte, TLSInfoSize)
+	bo.PutUint16(buf[0:], uint16(state.CipherSuite))
+	bo.PutUint16(buf[2:], uint16(state.Group))
+	bo.PutUint16(buf[4:], 0)
+	bo.PutUint16(buf[6:], flags)
+
+	return buf
+}
+
+func (proc *Process) tlsInfo(sys *syscall) {
+	fd, ok := proc.fds[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+	tlsfd, ok := fd.Impl.(*FDTLS)
+	if !ok {
+		sys.SetArg0(int32(-ENOTSOCK))
+		return
+	}
+
+	// Only the garbler has the TLS connection. Sync the info with
+	// evaluator.
+	var info []byte
+	var err error
+	if proc.role == RoleGarbler {
+		info = tlsfd.Info()
+		err = proc.conn.SendData(info)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		info, err = proc.conn.ReceiveData()
+		if err == nil && len(info) != TLSInfoSize {
+			err = EPROTO
+		}
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.arg0 = int32(len(info))
+	sys.argBuf = info
+	sys.arg1 = 0
+}
+
+// getSharedSecret implements the getsharedsecret syscall. It returns
+// this party's share of the key exchange shared secret of the TLS FD.
+// Each party returns its own share so the syscall does not
+// communicate with the peer.
+func (proc *Process) getSharedSecret(sys *syscall) {
+	fd, ok := proc.fds[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+	tlsfd, ok := fd.Impl.(*FDTLS)
+	if !ok {
+		sys.SetArg0(int32(-ENOTSOCK))
+		return
+	}
+	if len(tlsfd.share) == 0 {
+		sys.SetArg0(int32(-ENOENT))
+		return
+	}
+	sys.arg0 = int32(len(tlsfd.share))
+	sys.argBuf = bytes.Clone(tlsfd.share)
+	sys.arg1 = 0
+}
+
+// TLSCtl defines the tlsctl syscall commands.
+type TLSCtl int32
+
+// TLS control commands.
+const (
+	TLSCtlKeyUpdate TLSCtl = iota + 1
+	TLSCtlClientAuth
+	TLSCtlSessionTicket
+	TLSCtlCloseNotify
+)
+
+var tlsCtlNames = map[TLSCtl]string{
+	TLSCtlKeyUpdate:     "KeyUpdate",
+	TLSCtlClientAuth:    "ClientAuth",
+	TLSCtlSessionTicket: "SessionTicket",
+	TLSCtlCloseNotify:   "CloseNotify",
+}
+
+func (cmd TLSCtl) String() string {
+	name, ok := tlsCtlNames[cmd]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{TLSCtl %d}", int(cmd))
+}
+
+// tlsCtl implements the tlsctl syscall. Only the garbler has the TLS
+// connection so it runs the command and syncs the result with the
+// evaluator. Post-handshake client authentication and session tickets
+// are not supported and return EINVAL.
+func (proc *Process) tlsCtl(sys *syscall) error {
+	fd, ok := proc.fds[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return nil
+	}
+	tlsfd, ok := fd.Impl.(*FDTLS)
+	if !ok {
+		sys.SetArg0(int32(-ENOTSOCK))
+		return nil
+	}
+	cmd := TLSCtl(sys.arg1)
+	switch cmd {
+	case TLSCtlKeyUpdate, TLSCtlCloseNotify:
+	default:
+		sys.SetArg0(int32(-EINVAL))
+		return nil
+	}
+
+	var result int32
+	if proc.role == RoleGarbler {
+		switch cmd {
+		case TLSCtlKeyUpdate:
+			result = mapError(tlsfd.conn.UpdateKeys())
+		case TLSCtlCloseNotify:
+			result = mapError(tlsfd.conn.Alert(tls.AlertCloseNotify))
+		}
+		err := proc.conn.SendUint32(int(result))
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		v, err := proc.conn.ReceiveUint32()
+		if err != nil {
+			return err
+		}
+		result = int32(v)
+	}
+	sys.SetArg0(result)
+	return nil
+}
+
 func (proc *Process) tlsPeerErrf(err error, format string, a ...interface{}) {
 	msg := fmt.Sprintf(format, a...)
 	data, err := Marshal(&TLSError{
@@ -624,6 +837,14 @@ var tlsAlertToErrno = map[tls.AlertDescription]Errno{
 	tls.AlertNoApplicationProtocol: EPROTONOSUPPORT, // Protocol not supported
 }
 
+// tlsErrnoToAlert maps kernel errors to the TLS alerts sent to the
+// client.
+var tlsErrnoToAlert = map[Errno]tls.AlertDescription{
+	// The secure computation failed. The client sees an internal
+	// error and the kernel reports EMPC to the programs.
+	EMPC: tls.AlertInternalError,
+}
+
 // Add computes x+y mod P-256 Prime.
 func add(x, y *big.Int) *big.Int {
 	r := new(big.Int).Add(x, y)
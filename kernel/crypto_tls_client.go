@@ -0,0 +1,367 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/markkurossi/ephemelier/crypto/tls"
+)
+
+// ConnectTLSArgs define the arguments of the connecttls syscall. The
+// arguments are encoded into argBuf as NUL-separated fields:
+//
+//	network:address \0 serverName \0 alpn[,alpn...]
+//
+// The serverName and alpn fields are optional.
+type ConnectTLSArgs struct {
+	Network    string
+	Address    string
+	ServerName string
+	ALPN       []string
+}
+
+// ParseConnectTLSArgs parses the connecttls syscall arguments.
+func ParseConnectTLSArgs(buf []byte) (*ConnectTLSArgs, Errno) {
+	fields := bytes.Split(buf, []byte{0})
+	if len(fields) > 3 {
+		return nil, EINVAL
+	}
+	network, address, errno := ParseNetAddress(fields[0])
+	if errno != 0 {
+		return nil, errno
+	}
+	args := &ConnectTLSArgs{
+		Network: network,
+		Address: address,
+	}
+	if len(fields) > 1 {
+		args.ServerName = string(fields[1])
+	}
+	if len(fields) > 2 && len(fields[2]) > 0 {
+		for _, proto := range strings.Split(string(fields[2]), ",") {
+			if len(proto) == 0 || len(proto) > 255 {
+				return nil, EINVAL
+			}
+			args.ALPN = append(args.ALPN, proto)
+		}
+	}
+	return args, 0
+}
+
+// connectTLS implements the connecttls syscall. The syscall connects
+// to the server and runs the client key exchange with a
+// secret-shared ECDH key. Like tlsserver, it returns the TLS FD and
+// the peer's share of the ECDH shared secret in argBuf. The program
+// reads the transcript with the tlshs syscall and completes the
+// handshake in the MPC space. The function returns an error only if
+// the MAC check of the SPDZ key exchange fails.
+func (proc *Process) connectTLS(sys *syscall) error {
+	data, err := sys.argData()
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return nil
+	}
+	args, errno := ParseConnectTLSArgs(data)
+	if errno != 0 {
+		sys.SetArg0(-int32(errno))
+		return nil
+	}
+	if proc.role == RoleGarbler {
+		err = proc.connectTLSGarbler(args, sys)
+	} else {
+		err = proc.connectTLSEvaluator(sys)
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		if isSecurityAbort(err) {
+			return fmt.Errorf("connecttls: security abort: %w", err)
+		}
+	}
+	return nil
+}
+
+func (proc *Process) connectTLSGarbler(args *ConnectTLSArgs,
+	sys *syscall) error {
+
+	sock, err := net.Dial(args.Network, args.Address)
+	if err != nil {
+		proc.tlsPeerErrf(err, "dial failed: %v", err)
+		return err
+	}
+
+	// Start key exchange with the evaluator.
+	err = proc.conn.SendByte(byte(tlsMsgInit))
+	if err == nil {
+		err = proc.conn.Flush()
+	}
+	if err != nil {
+		sock.Close()
+		return err
+	}
+
+	// Read evaluator's public key share.
+	b, err := proc.conn.ReceiveByte()
+	if err != nil {
+		sock.Close()
+		return err
+	}
+	proc.debugf("recv %v\n", tlsMsg(b))
+	switch tlsMsg(b) {
+	case tlsMsgKEXResult:
+
+	case tlsMsgError:
+		sock.Close()
+		errno, err := proc.recvTLSError()
+		if err != nil {
+			return err
+		}
+		sys.SetArg0(-int32(errno))
+		return nil
+
+	default:
+		sock.Close()
+		return fmt.Errorf("unknown message %d from evaluator", b)
+	}
+	data, err := proc.conn.ReceiveData()
+	if err != nil {
+		sock.Close()
+		return err
+	}
+	var kexResult TLSKEXResult
+	_, err = UnmarshalFrom(data, &kexResult)
+	if err != nil {
+		sock.Close()
+		proc.tlsPeerErrf(err, "failed to unmarshal message: %v", err)
+		return err
+	}
+
+	dhPeer, err := NewDHPeer("Garbler", curve)
+	if err != nil {
+		sock.Close()
+		proc.tlsPeerErrf(err, "failed to create DH peer: %v", err)
+		return err
+	}
+
+	// Compute our public key: α·G = Σ(αᵢ·G)
+	pubkeyX, pubkeyY := curve.Add(dhPeer.Pubkey.X, dhPeer.Pubkey.Y,
+		new(big.Int).SetBytes(kexResult.PubkeyX),
+		new(big.Int).SetBytes(kexResult.PubkeyY))
+
+	conn := tls.NewConnection(sock, &tls.Config{
+		ServerName: args.ServerName,
+		NextProtos: args.ALPN,
+	})
+	serverKex, err := conn.ClientHandshakeHello(
+		EncodePublicKey(pubkeyX, pubkeyY))
+	if err != nil {
+		conn.Close()
+		proc.tlsPeerErrf(err, "handshake failed: %v", err)
+		return err
+	}
+	peerPublicKey, err := DecodePublicKey(serverKex)
+	if err != nil {
+		conn.Alert(tls.AlertIllegalParameter)
+		conn.Close()
+		proc.tlsPeerErrf(err, "invalid server public key: %v", err)
+		return err
+	}
+
+	// Compute partial DH αᵢ·(β·G). This also validates the server
+	// public key before the evaluator uses it.
+	partial, err := dhPeer.ComputePartialDH(peerPublicKey)
+	if err != nil {
+		conn.Alert(tls.AlertIllegalParameter)
+		conn.Close()
+		proc.tlsPeerErrf(err, "invalid server public key: %v", err)
+		return err
+	}
+
+	// Communicate server public key with evaluator.
+	data, err = Marshal(&TLSKEX{
+		KeyShare: serverKex,
+	})
+	if err != nil {
+		conn.Close()
+		proc.tlsPeerErrf(err, "failed to marshal message: %v", err)
+		return err
+	}
+	err = proc.conn.SendByte(byte(tlsMsgKEX))
+	if err == nil {
+		err = proc.conn.SendData(data)
+	}
+	if err == nil {
+		err = proc.conn.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	// Compute the shared secret αβ·G with SPDZ.
+	start := time.Now()
+	spdzFinalX, _, err := proc.spdzAdd(partial.X, partial.Y)
+	if err != nil {
+		conn.Alert(tlsErrnoToAlert[EMPC])
+		conn.Close()
+		return mpcError("SPDZ P256Add", err)
+	}
+	proc.rusage.SPDZTime += time.Since(start)
+
+	// Return TLS FD and our share of the shared secret.
+	share := secretShareBytes(spdzFinalX)
+	fd := NewTLSFD(conn, nil, share)
+	sys.SetArg0(proc.AllocFD(fd))
+	sys.argBuf = bytes.Clone(share)
+
+	// Sync FD with evaluator.
+	err = proc.conn.SendUint32(int(sys.arg0))
+	if err == nil {
+		err = proc.conn.Flush()
+	}
+	if err != nil {
+		fd.Close()
+		proc.FreeFD(sys.arg0)
+		sys.SetArg0(mapError(err))
+	}
+	return nil
+}
+
+func (proc *Process) connectTLSEvaluator(sys *syscall) error {
+	b, err := proc.conn.ReceiveByte()
+	if err != nil {
+		return err
+	}
+	proc.debugf("recv %v\n", tlsMsg(b))
+	switch tlsMsg(b) {
+	case tlsMsgInit:
+
+	case tlsMsgError:
+		errno, err := proc.recvTLSError()
+		if err != nil {
+			return err
+		}
+		sys.SetArg0(-int32(errno))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown message %d from garbler", b)
+	}
+
+	dhPeer, err := NewDHPeer("Evaluator", curve)
+	if err != nil {
+		proc.tlsPeerErrf(err, "failed to create DH peer: %v", err)
+		return err
+	}
+
+	// Send our public key share.
+	data, err := Marshal(&TLSKEXResult{
+		PubkeyX: dhPeer.Pubkey.X.Bytes(),
+		PubkeyY: dhPeer.Pubkey.Y.Bytes(),
+	})
+	if err != nil {
+		proc.tlsPeerErrf(err, "failed to marshal message: %v", err)
+		return err
+	}
+	err = proc.conn.SendByte(byte(tlsMsgKEXResult))
+	if err == nil {
+		err = proc.conn.SendData(data)
+	}
+	if err == nil {
+		err = proc.conn.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	// Read server's public key.
+	b, err = proc.conn.ReceiveByte()
+	if err != nil {
+		return err
+	}
+	proc.debugf("recv %v\n", tlsMsg(b))
+	switch tlsMsg(b) {
+	case tlsMsgKEX:
+
+	case tlsMsgError:
+		errno, err := proc.recvTLSError()
+		if err != nil {
+			return err
+		}
+		sys.SetArg0(-int32(errno))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown message %d from garbler", b)
+	}
+	data, err = proc.conn.ReceiveData()
+	if err != nil {
+		return err
+	}
+	var msg TLSKEX
+	_, err = UnmarshalFrom(data, &msg)
+	if err != nil {
+		return err
+	}
+	peerPublicKey, err := DecodePublicKey(msg.KeyShare)
+	if err != nil {
+		return err
+	}
+
+	// Compute partial DH αᵢ·(β·G) and the shared secret αβ·G with
+	// SPDZ.
+	partial, err := dhPeer.ComputePartialDH(peerPublicKey)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	spdzFinalX, _, err := proc.spdzAdd(partial.X, partial.Y)
+	if err != nil {
+		return mpcError("SPDZ P256Add", err)
+	}
+	proc.rusage.SPDZTime += time.Since(start)
+
+	// Get FD from garbler.
+	share := secretShareBytes(spdzFinalX)
+	fd := NewTLSFD(nil, nil, share)
+	gfd, err := proc.conn.ReceiveUint32()
+	if err == nil {
+		sys.SetArg0(int32(gfd))
+
+		// Return our share of the shared secret.
+		sys.argBuf = bytes.Clone(share)
+
+		err = proc.SetFD(sys.arg0, fd)
+	}
+	if err != nil {
+		fd.Close()
+		sys.SetArg0(mapError(err))
+	}
+	return nil
+}
+
+// recvTLSError receives the tlsMsgError message payload from the peer
+// and returns its errno.
+func (proc *Process) recvTLSError() (Errno, error) {
+	data, err := proc.conn.ReceiveData()
+	if err != nil {
+		return 0, err
+	}
+	var msgError TLSError
+	_, err = UnmarshalFrom(data, &msgError)
+	if err != nil {
+		return 0, err
+	}
+	proc.debugf("peer error: %v\n", string(msgError.Message))
+	return Errno(msgError.Errno), nil
+}
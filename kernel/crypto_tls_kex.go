@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -47,8 +47,20 @@ func NewDHPeer(name string, curve elliptic.Curve) (*DHPeer, error) {
 }
 
 // ComputePartialDH computes αᵢ·(β·G) - the peer's contribution to the
-// DH result.
-func (p *DHPeer) ComputePartialDH(peerPublicKey *Point) *Point {
+// DH result. The function returns tls.AlertIllegalParameter if the
+// peer public key is not a valid point on the curve.
+func (p *DHPeer) ComputePartialDH(peerPublicKey *Point) (*Point, error) {
+	// Reject invalid-curve points. The point at infinity (0,0) is not
+	// on the curve either. P-256 has cofactor 1 so all other curve
+	// points are in the prime-order subgroup and no separate subgroup
+	// check is needed.
+	if peerPublicKey == nil || peerPublicKey.X == nil ||
+		peerPublicKey.Y == nil ||
+		!p.Curve.IsOnCurve(peerPublicKey.X, peerPublicKey.Y) {
+		return nil, fmt.Errorf("%s: peer public key not on curve: %w",
+			p.Name, tls.AlertIllegalParameter)
+	}
+
 	// Compute αᵢ·(β·G)
 	partialX, partialY := p.Curve.ScalarMult(peerPublicKey.X, peerPublicKey.Y,
 		p.AlphaI.Bytes())
@@ -56,7 +68,7 @@ func (p *DHPeer) ComputePartialDH(peerPublicKey *Point) *Point {
 	return &Point{
 		X: partialX,
 		Y: partialY,
-	}
+	}, nil
 }
 
 // EncodePublicKey encodes the public key x,y into the SEC 1
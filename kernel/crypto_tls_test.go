@@ -0,0 +1,503 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/markkurossi/ephemelier/crypto/tls"
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
+)
+
+func TestSecretShareBytes(t *testing.T) {
+	values := []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		new(big.Int).Lsh(big.NewInt(1), 200),
+		new(big.Int).Sub(curveParams.P, big.NewInt(1)),
+	}
+	for _, v := range values {
+		data := secretShareBytes(v)
+		if len(data) != 32 {
+			t.Errorf("share %v: got %v bytes, expected 32", v, len(data))
+		}
+		if new(big.Int).SetBytes(data).Cmp(v) != 0 {
+			t.Errorf("share %v: got %x", v, data)
+		}
+	}
+}
+
+func TestComputePartialDH(t *testing.T) {
+	alice, err := NewDHPeer("Alice", curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := NewDHPeer("Bob", curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ab, err := alice.ComputePartialDH(bob.Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ba, err := bob.ComputePartialDH(alice.Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ab.X.Cmp(ba.X) != 0 || ab.Y.Cmp(ba.Y) != 0 {
+		t.Errorf("got %v, expected %v", ab, ba)
+	}
+
+	invalid := []*Point{
+		{
+			// Off-curve point.
+			X: new(big.Int).Set(bob.Pubkey.X),
+			Y: new(big.Int).Add(bob.Pubkey.Y, big.NewInt(1)),
+		},
+		{
+			// Point at infinity.
+			X: big.NewInt(0),
+			Y: big.NewInt(0),
+		},
+		{
+			// Coordinate outside the field.
+			X: new(big.Int).Add(bob.Pubkey.X, curveParams.P),
+			Y: new(big.Int).Set(bob.Pubkey.Y),
+		},
+	}
+	for idx, point := range invalid {
+		_, err := alice.ComputePartialDH(point)
+		if !errors.Is(err, tls.AlertIllegalParameter) {
+			t.Errorf("point-%v: got %v, expected %v",
+				idx, err, tls.AlertIllegalParameter)
+		}
+		if mapError(err) != int32(-EINVAL) {
+			t.Errorf("point-%v: mapError=%v, expected %v",
+				idx, mapError(err), -EINVAL)
+		}
+	}
+}
+
+func TestTLSServerResult(t *testing.T) {
+	c0, c1 := net.Pipe()
+	defer c0.Close()
+	defer c1.Close()
+
+	client := tls.NewConnection(c0, &tls.Config{})
+	go client.ClientHandshake("")
+
+	server := tls.NewConnection(c1, &tls.Config{})
+	kex, err := server.ServerHandshake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverHello, err := server.MakeServerHello(kex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.WriteTranscript(serverHello)
+	transcript := server.Transcript()
+
+	proc := &Process{
+		role: RoleGarbler,
+		fds:  make(map[int32]*FD),
+	}
+	fd := proc.AllocFD(NewTLSFD(server, nil, nil))
+
+	// The tlsserver syscall returns only the secret share and the
+	// transcript is read with the tlshs syscall.
+	sys := &syscall{
+		arg0: fd,
+		arg1: int32(tls.HTServerHello),
+	}
+	proc.tlsHandshake(sys)
+	if sys.arg0 != int32(tls.HTServerHello) {
+		t.Fatalf("tlshs: got %v, expected %v", sys.arg0, tls.HTServerHello)
+	}
+	if !bytes.Equal(sys.argBuf, transcript) {
+		t.Errorf("transcript: got %x, expected %x", sys.argBuf, transcript)
+	}
+}
+
+func TestTLSInfo(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "localhost",
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// TCP connections are buffered so both TLS peers can write
+	// without waiting for the other.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	cc, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	sc, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	server := tls.NewConnection(sc, &tls.Config{
+		PrivateKey:  priv,
+		Certificate: cert,
+	})
+
+	c0, c1, _ := p2ptest.Pipe()
+	garbler := &Process{
+		role: RoleGarbler,
+		conn: c0,
+		fds:  make(map[int32]*FD),
+	}
+	evaluator := &Process{
+		role: RoleEvaluator,
+		conn: c1,
+		fds:  make(map[int32]*FD),
+	}
+	fd := garbler.AllocFD(NewTLSFD(server, nil, nil))
+	err = evaluator.SetFD(fd, NewTLSFD(nil, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsinfo := func() (*syscall, *syscall) {
+		gsys := &syscall{
+			call: SysTlsinfo,
+			arg0: fd,
+		}
+		esys := &syscall{
+			call: SysTlsinfo,
+			arg0: fd,
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.tlsInfo(gsys)
+		})
+		wg.Go(func() {
+			evaluator.tlsInfo(esys)
+		})
+		wg.Wait()
+		for _, sys := range []*syscall{gsys, esys} {
+			if sys.arg0 != TLSInfoSize || len(sys.argBuf) != TLSInfoSize {
+				t.Fatalf("tlsinfo: got %v/%v bytes, expected %v",
+					sys.arg0, len(sys.argBuf), TLSInfoSize)
+			}
+		}
+		if !bytes.Equal(gsys.argBuf, esys.argBuf) {
+			t.Errorf("tlsinfo: garbler %x != evaluator %x",
+				gsys.argBuf, esys.argBuf)
+		}
+		return gsys, esys
+	}
+
+	gsys, _ := tlsinfo()
+	if !bytes.Equal(gsys.argBuf, make([]byte, TLSInfoSize)) {
+		t.Errorf("tlsinfo before handshake: got %x, expected zero info",
+			gsys.argBuf)
+	}
+
+	// Run the handshake with a local ECDH key exchange.
+	errC := make(chan error)
+	go func() {
+		client := tls.NewConnection(cc, &tls.Config{})
+		errC <- client.ClientHandshake("ephemelier.com")
+	}()
+	clientKex, err := server.ServerHandshake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kexPriv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, err := ecdh.P256().NewPublicKey(clientKex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedSecret, err := kexPriv.ECDH(clientPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.ServerHandshakeServerHello(sharedSecret,
+		kexPriv.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+
+	gsys, _ = tlsinfo()
+	info := gsys.argBuf
+	suite := tls.CipherSuite(bo.Uint16(info[0:]))
+	group := tls.NamedGroup(bo.Uint16(info[2:]))
+	alpn := bo.Uint16(info[4:])
+	flags := bo.Uint16(info[6:])
+
+	if suite != tls.CipherTLSChacha20Poly1305Sha256 {
+		t.Errorf("cipher suite: got %v, expected %v", suite,
+			tls.CipherTLSChacha20Poly1305Sha256)
+	}
+	if group != tls.GroupSecp256r1 {
+		t.Errorf("group: got %v, expected %v", group, tls.GroupSecp256r1)
+	}
+	if alpn != 0 {
+		t.Errorf("alpn: got %v, expected 0", alpn)
+	}
+	expected := TLSInfoHandshakeDone | TLSInfoServerName
+	if flags != expected {
+		t.Errorf("flags: got %b, expected %b", flags, expected)
+	}
+}
+
+var connectTLSArgsTests = []struct {
+	input string
+	errno Errno
+	args  ConnectTLSArgs
+}{
+	{
+		input: "tcp:example.com:443",
+		args: ConnectTLSArgs{
+			Network: "tcp",
+			Address: "example.com:443",
+		},
+	},
+	{
+		input: "tcp:example.com:443\x00example.com",
+		args: ConnectTLSArgs{
+			Network:    "tcp",
+			Address:    "example.com:443",
+			ServerName: "example.com",
+		},
+	},
+	{
+		input: "tcp:127.0.0.1:8443\x00localhost\x00h2,http/1.1",
+		args: ConnectTLSArgs{
+			Network:    "tcp",
+			Address:    "127.0.0.1:8443",
+			ServerName: "localhost",
+			ALPN:       []string{"h2", "http/1.1"},
+		},
+	},
+	{
+		input: "tcp:example.com:443\x00\x00",
+		args: ConnectTLSArgs{
+			Network: "tcp",
+			Address: "example.com:443",
+		},
+	},
+	{
+		input: "tcp:example.com:443\x00example.com\x00h2,",
+		errno: EINVAL,
+	},
+	{
+		input: "tcp:example.com:443\x00a\x00b\x00c",
+		errno: EINVAL,
+	},
+}
+
+func TestParseConnectTLSArgs(t *testing.T) {
+	for idx, test := range connectTLSArgsTests {
+		args, errno := ParseConnectTLSArgs([]byte(test.input))
+		if errno != test.errno {
+			t.Errorf("test-%v: got errno %v, expected %v",
+				idx, errno, test.errno)
+			continue
+		}
+		if errno != 0 {
+			continue
+		}
+		if args.Network != test.args.Network ||
+			args.Address != test.args.Address ||
+			args.ServerName != test.args.ServerName ||
+			!slices.Equal(args.ALPN, test.args.ALPN) {
+			t.Errorf("test-%v: got %+v, expected %+v", idx, args, test.args)
+		}
+	}
+}
+
+func TestGetSharedSecret(t *testing.T) {
+	share := secretShareBytes(big.NewInt(42))
+	proc := &Process{
+		fds: make(map[int32]*FD),
+	}
+	tlsfd := proc.AllocFD(NewTLSFD(nil, nil, share))
+	nofd := proc.AllocFD(NewTLSFD(nil, nil, nil))
+	memfd := proc.AllocFD(NewMemFD(0))
+
+	tests := []struct {
+		fd    int32
+		errno Errno
+	}{
+		{tlsfd, 0},
+		{nofd, ENOENT},
+		{memfd, ENOTSOCK},
+		{99, EBADF},
+	}
+	for _, test := range tests {
+		sys := &syscall{
+			call: SysGetsharedsecret,
+			arg0: test.fd,
+		}
+		proc.getSharedSecret(sys)
+		if test.errno != 0 {
+			if sys.arg0 != -int32(test.errno) {
+				t.Errorf("fd %v: got %v, expected %v", test.fd, sys.arg0,
+					-int32(test.errno))
+			}
+			continue
+		}
+		if int(sys.arg0) != len(share) || !bytes.Equal(sys.argBuf, share) {
+			t.Errorf("fd %v: got %v %x, expected %x", test.fd, sys.arg0,
+				sys.argBuf, share)
+		}
+	}
+
+	// Close clears the share.
+	proc.fds[tlsfd].Close()
+	sys := &syscall{
+		call: SysGetsharedsecret,
+		arg0: tlsfd,
+	}
+	proc.getSharedSecret(sys)
+	if sys.arg0 != -int32(ENOENT) {
+		t.Errorf("closed: got %v, expected %v", sys.arg0, -int32(ENOENT))
+	}
+}
+
+func TestTLSCtl(t *testing.T) {
+	c0, c1, rec := p2ptest.Pipe()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// Read the records the garbler's TLS connection sends.
+	records := make(chan tls.ContentType, 10)
+	go func() {
+		conn := tls.NewConnection(client, &tls.Config{})
+		for {
+			ct, _, err := conn.ReadRecord()
+			if err != nil {
+				close(records)
+				return
+			}
+			records <- ct
+		}
+	}()
+
+	garbler := &Process{
+		role: RoleGarbler,
+		conn: c0,
+		fds:  make(map[int32]*FD),
+	}
+	evaluator := &Process{
+		role: RoleEvaluator,
+		conn: c1,
+		fds:  make(map[int32]*FD),
+	}
+	fd := garbler.AllocFD(NewTLSFD(tls.NewConnection(server, &tls.Config{}),
+		nil, nil))
+	err := evaluator.SetFD(fd, NewTLSFD(nil, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsctl := func(fd int32, cmd TLSCtl) (int32, int32) {
+		gsys := &syscall{
+			call: SysTlsctl,
+			arg0: fd,
+			arg1: int32(cmd),
+		}
+		esys := &syscall{
+			call: SysTlsctl,
+			arg0: fd,
+			arg1: int32(cmd),
+		}
+		var gerr, eerr error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			gerr = garbler.tlsCtl(gsys)
+		})
+		wg.Go(func() {
+			eerr = evaluator.tlsCtl(esys)
+		})
+		wg.Wait()
+		if gerr != nil || eerr != nil {
+			t.Fatalf("tlsctl: garbler=%v, evaluator=%v", gerr, eerr)
+		}
+		return gsys.arg0, esys.arg0
+	}
+
+	tests := []struct {
+		fd    int32
+		cmd   TLSCtl
+		errno Errno
+		msgs  int
+	}{
+		{fd, TLSCtlClientAuth, EINVAL, 0},
+		{fd, TLSCtlSessionTicket, EINVAL, 0},
+		{fd, TLSCtl(99), EINVAL, 0},
+		{fd + 1, TLSCtlCloseNotify, EBADF, 0},
+		// No application traffic keys.
+		{fd, TLSCtlKeyUpdate, ENOTCONN, 1},
+		{fd, TLSCtlCloseNotify, 0, 1},
+	}
+	for _, test := range tests {
+		rec.Reset()
+		g, e := tlsctl(test.fd, test.cmd)
+		if g != -int32(test.errno) || e != -int32(test.errno) {
+			t.Errorf("%v: got %v/%v, expected %v", test.cmd, g, e,
+				-int32(test.errno))
+		}
+		if len(rec.Messages()) != test.msgs {
+			rec.Dump(t.Output())
+			t.Errorf("%v: got %v messages, expected %v", test.cmd,
+				len(rec.Messages()), test.msgs)
+		}
+	}
+	ct := <-records
+	if ct != tls.CTAlert {
+		t.Errorf("got %v, expected %v", ct, tls.CTAlert)
+	}
+}
@@ -0,0 +1,94 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"log"
+)
+
+// Flags for the reboot syscall.
+const (
+	// RebootDrain drains the node: the kernel stops spawning new
+	// processes and accepting new connections and the running
+	// processes continue until they exit.
+	RebootDrain int32 = 1
+)
+
+// Drain starts draining the kernel. After Drain, the kernel does not
+// spawn new processes and the accept syscall fails with ESHUTDOWN.
+// The running processes continue until they exit. Drain can be
+// called multiple times.
+func (kern *Kernel) Drain() {
+	kern.drainOnce.Do(func() {
+		log.Printf("Draining kernel")
+		close(kern.drained)
+	})
+}
+
+// Draining tests if the kernel is draining.
+func (kern *Kernel) Draining() bool {
+	select {
+	case <-kern.drained:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drained returns a channel that is closed when the kernel starts
+// draining.
+func (kern *Kernel) Drained() <-chan struct{} {
+	return kern.drained
+}
+
+// reboot implements the reboot syscall. The process identity is
+// garbler-side state so the garbler checks the privileges and syncs
+// the result with the evaluator; on success, both nodes drain
+// together. Only RootUID processes which are not chrooted can reboot
+// the kernel.
+func (proc *Process) reboot(sys *syscall) {
+	var result int
+	var err error
+
+	if proc.role == RoleGarbler {
+		err = proc.checkReboot(sys.arg0)
+		if err != nil {
+			result = int(mapError(err))
+		}
+		err = proc.conn.SendUint32(result)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	if result == 0 {
+		proc.kern.Drain()
+	}
+	sys.SetArg0(int32(result))
+}
+
+// checkReboot checks if the process can reboot the kernel with the
+// howto flags.
+func (proc *Process) checkReboot(howto int32) error {
+	if proc.uid != RootUID || proc.root != "/" {
+		return EPERM
+	}
+	switch howto {
+	case RebootDrain:
+		return nil
+
+	default:
+		return EINVAL
+	}
+}
@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+// dup implements the dup and dup2 syscalls. The new descriptor is a
+// copy of the old one and shares its underlying FD implementation.
+// The garbler allocates the new descriptor and syncs it with the
+// evaluator so both parties register the copy with the same number.
+func (proc *Process) dup(sys *syscall) {
+	var result int
+	var err error
+
+	if proc.role == RoleGarbler {
+		if sys.call == SysDup {
+			result = int(proc.dupFD(sys.arg0))
+		} else {
+			result = int(proc.dup2FD(sys.arg0, sys.arg1))
+		}
+		err = proc.sendFD(result)
+	} else {
+		result, err = proc.recvFD()
+		if err == nil {
+			old, ok := proc.fds[sys.arg0]
+			if !ok {
+				err = EBADF
+			} else if int32(result) != sys.arg0 {
+				proc.replaceFD(int32(result), old.Copy())
+			}
+		}
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+}
+
+// dupFD duplicates the file descriptor oldfd to the lowest free
+// descriptor. It returns the new descriptor or -Errno on error.
+func (proc *Process) dupFD(oldfd int32) int32 {
+	old, ok := proc.fds[oldfd]
+	if !ok {
+		return int32(-EBADF)
+	}
+	return proc.AllocFD(old.Copy())
+}
+
+// dup2FD duplicates the file descriptor oldfd to newfd, closing the
+// file newfd referred to. It returns newfd or -Errno on error.
+func (proc *Process) dup2FD(oldfd, newfd int32) int32 {
+	old, ok := proc.fds[oldfd]
+	if !ok || newfd < 0 {
+		return int32(-EBADF)
+	}
+	if newfd == oldfd {
+		return newfd
+	}
+	_, ok = proc.fds[newfd]
+	if !ok && proc.fdLimit() {
+		return int32(-EMFILE)
+	}
+	proc.replaceFD(newfd, old.Copy())
+
+	return newfd
+}
+
+// replaceFD sets the FD implementation for the file descriptor fd. If
+// fd is open, its old implementation is closed.
+func (proc *Process) replaceFD(fd int32, impl *FD) {
+	proc.m.Lock()
+	defer proc.m.Unlock()
+
+	prev, ok := proc.fds[fd]
+	if ok {
+		prev.Close()
+	}
+	proc.fds[fd] = impl
+}
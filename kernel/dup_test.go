@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
+)
+
+func TestDup(t *testing.T) {
+	c0, c1, _ := p2ptest.Pipe()
+	garbler := &Process{
+		role: RoleGarbler,
+		conn: c0,
+		fds:  make(map[int32]*FD),
+	}
+	evaluator := &Process{
+		role: RoleEvaluator,
+		conn: c1,
+		fds:  make(map[int32]*FD),
+	}
+	stdout := NewMemFD(16)
+	for fd := int32(0); fd < 3; fd++ {
+		impl := NewDevNullFD()
+		if fd == 1 {
+			impl = stdout
+		}
+		err := garbler.SetFD(fd, impl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = evaluator.SetFD(fd, NewMemFD(16))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dup := func(call Syscall, fd, newfd int32) (int32, int32) {
+		gsys := &syscall{
+			call: call,
+			arg0: fd,
+			arg1: newfd,
+		}
+		esys := &syscall{
+			call: call,
+			arg0: fd,
+			arg1: newfd,
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.dup(gsys)
+		})
+		wg.Go(func() {
+			evaluator.dup(esys)
+		})
+		wg.Wait()
+		return gsys.arg0, esys.arg0
+	}
+
+	// Duplicate stdout onto fd 5 and write through it.
+	g, e := dup(SysDup2, 1, 5)
+	if g != 5 || e != 5 {
+		t.Fatalf("dup2: got %v/%v, expected 5", g, e)
+	}
+	if n := garbler.fds[5].Write([]byte("hello")); n != 5 {
+		t.Fatalf("write: got %v, expected 5", n)
+	}
+	if string(stdout.Impl.(*FDMem).buf[:5]) != "hello" {
+		t.Errorf("stdout: got %q, expected %q", stdout.Impl.(*FDMem).buf,
+			"hello")
+	}
+	if evaluator.fds[5].Impl != evaluator.fds[1].Impl {
+		t.Errorf("evaluator fd 5 does not share stdout")
+	}
+
+	// Closing the copy keeps stdout open.
+	garbler.fds[5].Close()
+	if stdout.Impl.(*FDMem).buf == nil {
+		t.Errorf("closing fd 5 closed stdout")
+	}
+
+	// Dup returns the lowest free fd in both parties.
+	g, e = dup(SysDup, 1, 0)
+	if g != 3 || e != 3 {
+		t.Errorf("dup: got %v/%v, expected 3", g, e)
+	}
+
+	// Dup2 replaces the open fd 3.
+	g, e = dup(SysDup2, 2, 3)
+	if g != 3 || e != 3 {
+		t.Errorf("dup2 replace: got %v/%v, expected 3", g, e)
+	}
+	if garbler.fds[3].Impl != garbler.fds[2].Impl ||
+		evaluator.fds[3].Impl != evaluator.fds[2].Impl {
+		t.Errorf("dup2 did not replace fd 3")
+	}
+
+	// Dup2 onto itself is a no-op.
+	g, e = dup(SysDup2, 1, 1)
+	if g != 1 || e != 1 {
+		t.Errorf("dup2 self: got %v/%v, expected 1", g, e)
+	}
+
+	tests := []struct {
+		call  Syscall
+		fd    int32
+		newfd int32
+	}{
+		{SysDup, 42, 0},
+		{SysDup2, 42, 6},
+		{SysDup2, 1, -1},
+	}
+	for idx, test := range tests {
+		g, e = dup(test.call, test.fd, test.newfd)
+		if g != -int32(EBADF) || e != -int32(EBADF) {
+			t.Errorf("test%d: got %v/%v, expected %v", idx, g, e,
+				-int32(EBADF))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"strings"
+)
+
+// Getenv returns the value of the environment variable name. The
+// boolean result tells if the variable is set.
+func (proc *Process) Getenv(name string) (string, bool) {
+	for _, kv := range proc.env {
+		k, v, ok := strings.Cut(kv, "=")
+		if ok && k == name {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// getenv implements the getenv syscall. The environment is captured
+// when the garbler spawns the process so the garbler looks up the
+// variable and syncs the value with the evaluator.
+func (proc *Process) getenv(sys *syscall) error {
+	name, err := sys.argString()
+	if err != nil || len(name) == 0 || strings.ContainsRune(name, '=') {
+		sys.SetArg0(int32(-EINVAL))
+		return nil
+	}
+
+	var value []byte
+	if proc.role == RoleGarbler {
+		v, ok := proc.Getenv(name)
+		if ok {
+			value = []byte(v)
+			err = proc.conn.SendUint32(len(value))
+			if err == nil {
+				err = proc.conn.SendData(value)
+			}
+		} else {
+			err = proc.conn.SendUint32(int(-ENOENT))
+		}
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			sys.SetArg0(int32(-ENOENT))
+			return nil
+		}
+	} else {
+		v, err := proc.conn.ReceiveUint32()
+		if err != nil {
+			return err
+		}
+		if int32(v) < 0 {
+			sys.SetArg0(int32(v))
+			return nil
+		}
+		value, err = proc.conn.ReceiveData()
+		if err != nil {
+			return err
+		}
+	}
+	sys.SetArg0(int32(len(value)))
+	sys.argBuf = value
+	sys.arg1 = int32(len(value))
+
+	return nil
+}
@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
+)
+
+func TestGetenv(t *testing.T) {
+	c0, c1, _ := p2ptest.Pipe()
+	garbler := &Process{
+		role: RoleGarbler,
+		conn: c0,
+		env:  []string{"FOO=bar", "EMPTY=", "PATH=/bin:/usr/bin"},
+	}
+	evaluator := &Process{
+		role: RoleEvaluator,
+		conn: c1,
+	}
+
+	getenv := func(name string) (*syscall, *syscall) {
+		gsys := &syscall{
+			call:   SysGetenv,
+			argBuf: []byte(name),
+			arg1:   int32(len(name)),
+		}
+		esys := &syscall{
+			call:   SysGetenv,
+			argBuf: []byte(name),
+			arg1:   int32(len(name)),
+		}
+		var gerr, eerr error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			gerr = garbler.getenv(gsys)
+		})
+		wg.Go(func() {
+			eerr = evaluator.getenv(esys)
+		})
+		wg.Wait()
+		if gerr != nil || eerr != nil {
+			t.Fatalf("getenv: garbler=%v, evaluator=%v", gerr, eerr)
+		}
+		return gsys, esys
+	}
+
+	tests := []struct {
+		name   string
+		result int32
+		value  string
+	}{
+		{"FOO", 3, "bar"},
+		{"EMPTY", 0, ""},
+		{"PATH", 13, "/bin:/usr/bin"},
+		{"BAR", -int32(ENOENT), ""},
+		{"", -int32(EINVAL), ""},
+		{"FOO=bar", -int32(EINVAL), ""},
+	}
+	for idx, test := range tests {
+		gsys, esys := getenv(test.name)
+		if gsys.arg0 != test.result || esys.arg0 != test.result {
+			t.Errorf("test%d: got %v/%v, expected %v", idx, gsys.arg0,
+				esys.arg0, test.result)
+			continue
+		}
+		if string(gsys.argBuf) != test.value ||
+			string(esys.argBuf) != test.value {
+			t.Errorf("test%d: got %q/%q, expected %q", idx, gsys.argBuf,
+				esys.argBuf, test.value)
+		}
+	}
+}
@@ -55,6 +55,7 @@ import (
 	"net"
 	"strings"
 
+	"github.com/markkurossi/ephemelier/crypto/spdz"
 	"github.com/markkurossi/ephemelier/crypto/tls"
 )
 
@@ -163,6 +164,11 @@ const (
 	ENOTRECOVERABLE Errno = 98 /* State not recoverable */
 )
 
+// Ephemelier error numbers.
+const (
+	EMPC Errno = 128 /* Secure computation failed */
+)
+
 func (err Errno) String() string {
 	name, ok := errnoNames[err]
 	if ok {
@@ -287,6 +293,7 @@ var errnoNames = map[Errno]string{
 	EPROTO:          "EPROTO",
 	EOWNERDEAD:      "EOWNERDEAD",
 	ENOTRECOVERABLE: "ENOTRECOVERABLE",
+	EMPC:            "EMPC",
 }
 
 var errnoDescriptions = map[Errno]string{
@@ -388,12 +395,56 @@ var errnoDescriptions = map[Errno]string{
 	EPROTO:          "Protocol error",
 	EOWNERDEAD:      "Previous owner died",
 	ENOTRECOVERABLE: "State not recoverable",
+	EMPC:            "Secure computation failed",
+}
+
+// MPCError reports a failure in the secure computation protocols:
+// garbled circuit evaluation, oblivious transfer, SPDZ, or threshold
+// signatures. The failure can be caused by a cheating peer so it is
+// mapped to EMPC instead of the generic protocol and I/O errors.
+type MPCError struct {
+	Op  string
+	Err error
+}
+
+func (err *MPCError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", err.Op, EMPC.Description(), err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err *MPCError) Unwrap() error {
+	return err.Err
+}
+
+// isSecurityAbort tests if the error is a MAC check failure in the
+// secure computation. The failure means that the peer is cheating or
+// its state is corrupted and the process must be aborted without
+// revealing any outputs of the computation.
+func isSecurityAbort(err error) bool {
+	var macErr *spdz.MACError
+	return errors.As(err, &macErr)
+}
+
+// mpcError wraps the error err from the MPC operation op into
+// MPCError. It returns nil if err is nil.
+func mpcError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &MPCError{
+		Op:  op,
+		Err: err,
+	}
 }
 
 func mapError(err error) int32 {
 	if err == nil {
 		return 0
 	}
+	var mpcErr *MPCError
+	if errors.As(err, &mpcErr) {
+		return int32(-EMPC)
+	}
 	errno, ok := err.(Errno)
 	if ok {
 		return int32(-errno)
@@ -405,8 +456,23 @@ func mapError(err error) int32 {
 	var perr *fs.PathError
 	if errors.As(err, &perr) {
 		fsErr := perr.Err.Error()
-		if strings.Contains(fsErr, "no such file or dir") {
+		switch {
+		case strings.Contains(fsErr, "no such file or dir"):
 			return int32(-ENOENT)
+		case errors.Is(perr.Err, fs.ErrExist):
+			return int32(-EEXIST)
+		case errors.Is(perr.Err, fs.ErrPermission):
+			return int32(-EACCES)
+		case strings.Contains(fsErr, "not a directory"):
+			return int32(-ENOTDIR)
+		case strings.Contains(fsErr, "is a directory"):
+			return int32(-EISDIR)
+		case strings.Contains(fsErr, "directory not empty"):
+			return int32(-ENOTEMPTY)
+		case strings.Contains(fsErr, "invalid argument"):
+			return int32(-EINVAL)
+		case strings.Contains(fsErr, "illegal seek"):
+			return int32(-ESPIPE)
 		}
 		fmt.Printf("fs.PathError:\n")
 		fmt.Printf(" - Op  : %v\n", perr.Op)
@@ -419,6 +485,9 @@ func mapError(err error) int32 {
 		return int32(-EBADF)
 	}
 
+	if errors.Is(err, tls.ErrHandshakeNotCompleted) {
+		return int32(-ENOTCONN)
+	}
 	var tlsAlert tls.AlertDescription
 	if errors.As(err, &tlsAlert) {
 		errno, ok := tlsAlertToErrno[tlsAlert]
@@ -442,6 +511,14 @@ func mapError(err error) int32 {
 			return int32(-ECONNRESET)
 		} else if strings.Contains(opError, "broken pipe") {
 			return int32(-EPIPE)
+		} else if strings.Contains(opError, "connection refused") {
+			return int32(-ECONNREFUSED)
+		} else if netOpError.Timeout() {
+			return int32(-ETIMEDOUT)
+		}
+		var dnsError *net.DNSError
+		if errors.As(netOpError.Err, &dnsError) {
+			return int32(-EHOSTUNREACH)
 		}
 	}
 
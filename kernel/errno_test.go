@@ -7,8 +7,13 @@
 package kernel
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"testing"
+
+	"github.com/markkurossi/ephemelier/crypto/spdz"
+	"github.com/markkurossi/ephemelier/crypto/tls"
 )
 
 var mapErrorTests = []struct {
@@ -23,6 +28,33 @@ var mapErrorTests = []struct {
 		err:   fmt.Errorf("invalid EncrFileMagic %08x: %w", 0, ENOEXEC),
 		errno: int32(-ENOEXEC),
 	},
+	{
+		err:   mpcError("SPDZ P256Add", EPROTO),
+		errno: int32(-EMPC),
+	},
+	{
+		err:   fmt.Errorf("handshake failed: %w", mpcError("garbler", EIO)),
+		errno: int32(-EMPC),
+	},
+	{
+		err: &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: errors.New("connect: connection refused"),
+		},
+		errno: int32(-ECONNREFUSED),
+	},
+	{
+		err: &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: &net.DNSError{
+				Err:  "no such host",
+				Name: "example.invalid",
+			},
+		},
+		errno: int32(-EHOSTUNREACH),
+	},
 }
 
 func TestMapError(t *testing.T) {
@@ -34,3 +66,35 @@ func TestMapError(t *testing.T) {
 		}
 	}
 }
+
+func TestMPCError(t *testing.T) {
+	if mpcError("garbler", nil) != nil {
+		t.Errorf("mpcError(nil) returned non-nil error")
+	}
+	err := mpcError("garbler", EPROTO)
+	if !errors.Is(err, EPROTO) {
+		t.Errorf("MPCError does not wrap %v", EPROTO)
+	}
+	if Errno(-mapError(err)) != EMPC {
+		t.Errorf("got %v, expected %v", Errno(-mapError(err)), EMPC)
+	}
+	if tlsErrnoToAlert[EMPC] != tls.AlertInternalError {
+		t.Errorf("EMPC alert %v, expected %v", tlsErrnoToAlert[EMPC],
+			tls.AlertInternalError)
+	}
+}
+
+func TestSecurityAbort(t *testing.T) {
+	err := mpcError("SPDZ P256Add", &spdz.MACError{
+		Index: 1,
+	})
+	if !isSecurityAbort(err) {
+		t.Errorf("MAC failure is not a security abort: %v", err)
+	}
+	if Errno(-mapError(err)) != EMPC {
+		t.Errorf("got %v, expected %v", Errno(-mapError(err)), EMPC)
+	}
+	if isSecurityAbort(mpcError("garbler", EPROTO)) {
+		t.Errorf("protocol error is a security abort")
+	}
+}
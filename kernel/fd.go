@@ -9,6 +9,7 @@ package kernel
 // FD defines a file descriptor.
 type FD struct {
 	refcount int
+	cloexec  bool
 	Impl     FDImpl
 }
 
@@ -30,6 +31,15 @@ func (fd *FD) Copy() *FD {
 	return fd
 }
 
+// Inherit returns the FD for a spawned child process. The
+// close-on-exec FDs are replaced with null FDs.
+func (fd *FD) Inherit() *FD {
+	if fd.cloexec {
+		return NewDevNullFD()
+	}
+	return fd.Copy()
+}
+
 // Close removes a reference from the FD. If this was the last
 // reference, the underlying implementation is closed.
 func (fd *FD) Close() int {
@@ -70,5 +80,7 @@ var (
 	_ FDImpl = &FDListener{}
 	_ FDImpl = &FDPort{}
 	_ FDImpl = &FDDevNull{}
+	_ FDImpl = &FDMem{}
+	_ FDImpl = &FDDir{}
 	_ FDImpl = &Key{}
 )
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// readdirBatch defines how many names FDDir reads from the directory
+// at a time.
+const readdirBatch = 64
+
+// FDDir implements directory FDs. The directory is read with the
+// readdir syscall; the FD keeps the names read from the directory but
+// not yet returned to the program.
+type FDDir struct {
+	f       *os.File
+	pending []string
+	eof     bool
+}
+
+// NewDirFD creates a new directory FD.
+func NewDirFD(f *os.File) *FD {
+	return NewFD(&FDDir{
+		f: f,
+	})
+}
+
+// Close implements FD.Close.
+func (fd *FDDir) Close() int {
+	err := fd.f.Close()
+	return int(mapError(err))
+}
+
+// Read implements FD.Read.
+func (fd *FDDir) Read(b []byte) int {
+	return int(-EISDIR)
+}
+
+// Write implements FD.Write.
+func (fd *FDDir) Write(b []byte) int {
+	return int(-EISDIR)
+}
+
+// Readdir returns the next batch of directory entry names encoded in
+// at most size bytes. Each name is encoded as a 16-bit big-endian
+// length followed by the name. The function returns an empty batch at
+// the end of the directory and EINVAL if the next name does not fit
+// in size bytes.
+func (fd *FDDir) Readdir(size int) ([]byte, error) {
+	var buf []byte
+	for {
+		if len(fd.pending) == 0 && !fd.eof {
+			names, err := fd.f.Readdirnames(readdirBatch)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			if len(names) == 0 {
+				fd.eof = true
+			}
+			fd.pending = names
+		}
+		if len(fd.pending) == 0 {
+			return buf, nil
+		}
+		name := fd.pending[0]
+		if len(buf)+2+len(name) > size {
+			if len(buf) == 0 {
+				return nil, EINVAL
+			}
+			return buf, nil
+		}
+		buf = bo.AppendUint16(buf, uint16(len(name)))
+		buf = append(buf, name...)
+		fd.pending = fd.pending[1:]
+	}
+}
+
+// readdir implements the readdir syscall. Only the garbler has the
+// filesystem so it reads the directory and syncs the names with the
+// evaluator.
+func (proc *Process) readdir(sys *syscall) {
+	fd, ok := proc.fds[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+	if sys.arg1 <= 0 {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+
+	var result int
+	var names []byte
+	var err error
+
+	if proc.role == RoleGarbler {
+		dir, ok := fd.Impl.(*FDDir)
+		if !ok {
+			err = ENOTDIR
+		} else {
+			names, err = dir.Readdir(int(sys.arg1))
+		}
+		if err != nil {
+			result = int(mapError(err))
+		} else {
+			result = len(names)
+		}
+		err = proc.conn.SendUint32(result)
+		if err == nil && result > 0 {
+			err = proc.conn.SendData(names)
+		}
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+		if err == nil && result > 0 {
+			names, err = proc.conn.ReceiveData()
+			if err == nil && len(names) != result {
+				err = EPROTO
+			}
+		}
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+	if result > 0 {
+		sys.argBuf = names
+	}
+}
@@ -0,0 +1,179 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
+)
+
+func parseNames(t *testing.T, data []byte) []string {
+	var names []string
+	for len(data) > 0 {
+		if len(data) < 2 {
+			t.Fatalf("truncated name length")
+		}
+		l := int(bo.Uint16(data))
+		if 2+l > len(data) {
+			t.Fatalf("truncated name")
+		}
+		names = append(names, string(data[2:2+l]))
+		data = data[2+l:]
+	}
+	return names
+}
+
+func TestReaddir(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "www"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("file%03d.html", i)
+		err = os.WriteFile(filepath.Join(dir, "www", name), []byte(name),
+			0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, name)
+	}
+
+	c0, c1, _ := p2ptest.Pipe()
+
+	var kern Kernel
+	kern.params.Filesystem = dir
+
+	garbler := &Process{
+		kern: &kern,
+		role: RoleGarbler,
+		conn: c0,
+		root: "/",
+		cwd:  "/",
+		fds:  make(map[int32]*FD),
+	}
+	evaluator := &Process{
+		kern: &kern,
+		role: RoleEvaluator,
+		conn: c1,
+		root: "/",
+		cwd:  "/",
+		fds:  make(map[int32]*FD),
+	}
+
+	path := "/www"
+	sys := &syscall{
+		call:   SysOpen,
+		argBuf: []byte(path),
+		arg1:   int32(len(path)),
+	}
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		garbler.open(sys)
+	})
+	wg.Go(func() {
+		evaluator.recvFD()
+	})
+	wg.Wait()
+	fd := sys.arg0
+	if fd < 0 {
+		t.Fatalf("open failed: %v", Errno(-fd))
+	}
+	err = evaluator.SetFD(fd, NewDevNullFD())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := garbler.fds[fd].Read(make([]byte, 10)); n != -int(EISDIR) {
+		t.Errorf("read: got %v, expected %v", n, -int(EISDIR))
+	}
+
+	readdir := func(size int32) (*syscall, *syscall) {
+		gsys := &syscall{
+			call: SysReaddir,
+			arg0: fd,
+			arg1: size,
+		}
+		esys := &syscall{
+			call: SysReaddir,
+			arg0: fd,
+			arg1: size,
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.readdir(gsys)
+		})
+		wg.Go(func() {
+			evaluator.readdir(esys)
+		})
+		wg.Wait()
+		return gsys, esys
+	}
+
+	// The names do not fit in a 5 byte buffer.
+	g, e := readdir(5)
+	if g.arg0 != -int32(EINVAL) || e.arg0 != -int32(EINVAL) {
+		t.Errorf("got %v/%v, expected %v", g.arg0, e.arg0, -int32(EINVAL))
+	}
+
+	// Each 128 byte batch has 9 names.
+	var names []string
+	var batches int
+	for {
+		g, e := readdir(128)
+		if g.arg0 < 0 {
+			t.Fatalf("readdir failed: %v", Errno(-g.arg0))
+		}
+		if g.arg0 != e.arg0 || string(g.argBuf) != string(e.argBuf) {
+			t.Fatalf("garbler %v:%x, evaluator %v:%x", g.arg0, g.argBuf,
+				e.arg0, e.argBuf)
+		}
+		if g.arg0 == 0 {
+			break
+		}
+		if int(g.arg0) != len(g.argBuf) || g.arg0 > 128 {
+			t.Fatalf("got %v bytes, argBuf %v", g.arg0, len(g.argBuf))
+		}
+		names = append(names, parseNames(t, g.argBuf)...)
+		batches++
+	}
+	if batches != 12 {
+		t.Errorf("got %v batches, expected 12", batches)
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, expected) {
+		t.Errorf("got %v, expected %v", names, expected)
+	}
+
+	// Readdir on a regular file.
+	gsys := &syscall{
+		call: SysReaddir,
+		arg0: garbler.AllocFD(NewMemFD(10)),
+		arg1: 128,
+	}
+	var result int
+	wg.Go(func() {
+		garbler.readdir(gsys)
+	})
+	wg.Go(func() {
+		result, err = c1.ReceiveUint32()
+	})
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gsys.arg0 != -int32(ENOTDIR) || int32(result) != -int32(ENOTDIR) {
+		t.Errorf("got %v/%v, expected %v", gsys.arg0, int32(result),
+			-int32(ENOTDIR))
+	}
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"io"
+)
+
+// FDMem implements anonymous in-memory file FDs. The file has a
+// fixed size and it is zero-initialized. Both parties have their own
+// identical copy of the file.
+type FDMem struct {
+	buf []byte
+	ofs int64
+}
+
+// NewMemFD creates a new in-memory file FD with size bytes.
+func NewMemFD(size int) *FD {
+	return NewFD(&FDMem{
+		buf: make([]byte, size),
+	})
+}
+
+// Close implements FD.Close.
+func (fd *FDMem) Close() int {
+	fd.buf = nil
+	return 0
+}
+
+// Read implements FD.Read.
+func (fd *FDMem) Read(b []byte) int {
+	if fd.ofs >= int64(len(fd.buf)) {
+		return 0
+	}
+	n := copy(b, fd.buf[fd.ofs:])
+	fd.ofs += int64(n)
+	return n
+}
+
+// Write implements FD.Write.
+func (fd *FDMem) Write(b []byte) int {
+	if len(b) == 0 {
+		return 0
+	}
+	if fd.ofs >= int64(len(fd.buf)) {
+		return int(-ENOSPC)
+	}
+	n := copy(fd.buf[fd.ofs:], b)
+	fd.ofs += int64(n)
+	return n
+}
+
+// Seek sets the offset for the next Read or Write. The whence values
+// are as in io.Seeker. Seeking beyond the end of the file is allowed
+// but reads return 0 and writes fail with ENOSPC.
+func (fd *FDMem) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += fd.ofs
+	case io.SeekEnd:
+		offset += int64(len(fd.buf))
+	default:
+		return 0, EINVAL
+	}
+	if offset < 0 {
+		return 0, EINVAL
+	}
+	fd.ofs = offset
+	return offset, nil
+}
+
+// memfdSize validates the memfd syscall size argument.
+func (proc *Process) memfdSize(size int32) Errno {
+	if size < 0 {
+		return EINVAL
+	}
+	max := proc.kern.params.MaxProcMem
+	if max > 0 && int(size) > max {
+		return ENOMEM
+	}
+	return 0
+}
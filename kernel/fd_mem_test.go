@@ -0,0 +1,62 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMemFD(t *testing.T) {
+	fd := NewMemFD(16)
+	memfd := fd.Impl.(*FDMem)
+
+	data := []byte("Hello, world!")
+	n := fd.Write(data)
+	if n != len(data) {
+		t.Fatalf("write: got %v, expected %v", n, len(data))
+	}
+
+	ofs, err := memfd.Seek(7, io.SeekStart)
+	if err != nil || ofs != 7 {
+		t.Fatalf("seek: got %v %v, expected 7", ofs, err)
+	}
+	buf := make([]byte, 32)
+	n = fd.Read(buf)
+	expected := []byte("world!\x00\x00\x00")
+	if !bytes.Equal(buf[:n], expected) {
+		t.Errorf("read: got %q, expected %q", buf[:n], expected)
+	}
+	n = fd.Read(buf)
+	if n != 0 {
+		t.Errorf("read at EOF: got %v, expected 0", n)
+	}
+
+	// Writes are limited to the file size.
+	_, err = memfd.Seek(-2, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n = fd.Write(data)
+	if n != 2 {
+		t.Errorf("write at end: got %v, expected 2", n)
+	}
+	n = fd.Write(data)
+	if n != int(-ENOSPC) {
+		t.Errorf("write past end: got %v, expected %v", n, -ENOSPC)
+	}
+
+	_, err = memfd.Seek(-1, io.SeekStart)
+	if err == nil {
+		t.Errorf("seek to negative offset succeeded")
+	}
+
+	if ret := fd.Close(); ret != 0 {
+		t.Errorf("close failed: %v", Errno(-ret))
+	}
+}
@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// packetNetworks define the datagram networks for which the dial and
+// listen syscalls create packet FDs.
+var packetNetworks = map[string]bool{
+	"udp":  true,
+	"udp4": true,
+	"udp6": true,
+}
+
+// FDPacket implements datagram socket FDs. The listen syscall creates
+// unconnected packet FDs which send to explicit addresses and the
+// dial syscall creates connected packet FDs which send to the dialed
+// address. The evaluator's packet FD does not have a network
+// connection.
+type FDPacket struct {
+	conn      net.PacketConn
+	network   string
+	connected bool
+}
+
+// NewPacketFD creates a new packet FD. The connected argument tells
+// if the conn is a connected socket, created with net.Dial.
+func NewPacketFD(conn net.PacketConn, network string, connected bool) *FD {
+	return NewFD(&FDPacket{
+		conn:      conn,
+		network:   network,
+		connected: connected,
+	})
+}
+
+// Close implements FD.Close.
+func (fd *FDPacket) Close() int {
+	if fd.conn == nil {
+		return 0
+	}
+	err := fd.conn.Close()
+	return int(mapError(err))
+}
+
+// Read implements FD.Read. The function reads the next datagram and
+// discards the sender address.
+func (fd *FDPacket) Read(b []byte) int {
+	n, _, err := fd.Recvfrom(b)
+	if err != nil {
+		return int(mapError(err))
+	}
+	return n
+}
+
+// Write implements FD.Write. The FD must be connected.
+func (fd *FDPacket) Write(b []byte) int {
+	n, err := fd.Sendto(b, "")
+	if err != nil {
+		return int(mapError(err))
+	}
+	return n
+}
+
+// Recvfrom reads the next datagram into b. The function returns the
+// datagram length and the sender address. Datagrams longer than b are
+// truncated.
+func (fd *FDPacket) Recvfrom(b []byte) (int, net.Addr, error) {
+	if fd.conn == nil {
+		return 0, nil, EBADF
+	}
+	return fd.conn.ReadFrom(b)
+}
+
+// Sendto sends the datagram b to the address. The empty address
+// sends to the connected FD's peer.
+func (fd *FDPacket) Sendto(b []byte, address string) (int, error) {
+	if fd.conn == nil {
+		return 0, EBADF
+	}
+	if len(address) == 0 {
+		if !fd.connected {
+			return 0, EDESTADDRREQ
+		}
+		return fd.conn.(net.Conn).Write(b)
+	}
+	if fd.connected {
+		return 0, EISCONN
+	}
+	addr, err := net.ResolveUDPAddr(fd.network, address)
+	if err != nil {
+		return 0, EINVAL
+	}
+	return fd.conn.WriteTo(b, addr)
+}
+
+// sendto implements the sendto and recvfrom syscalls. Only the
+// garbler has the network sockets so it performs the operation and
+// syncs the result with the evaluator. The datagram addresses are
+// encoded as a 16-bit big-endian length followed by the address.
+func (proc *Process) sendto(sys *syscall) {
+	fd, ok := proc.fds[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+	var arg []byte
+	var err error
+	if sys.call == SysSendto {
+		arg, err = sys.argData()
+		if err == nil && (len(arg) < 2 || 2+int(bo.Uint16(arg)) > len(arg)) {
+			err = EINVAL
+		}
+	} else if sys.arg1 <= 0 {
+		err = EINVAL
+	}
+	if err != nil {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+
+	var result int
+	var data []byte
+
+	if proc.role == RoleGarbler {
+		packet, ok := fd.Impl.(*FDPacket)
+		if !ok {
+			err = ENOTSOCK
+		} else if sys.call == SysSendto {
+			alen := int(bo.Uint16(arg))
+			result, err = packet.Sendto(arg[2+alen:], string(arg[2:2+alen]))
+		} else {
+			data, err = proc.recvfrom(packet, int(sys.arg1))
+			result = len(data)
+		}
+		if err != nil {
+			result = int(mapError(err))
+		}
+		err = proc.conn.SendUint32(result)
+		if err == nil && result > 0 && sys.call == SysRecvfrom {
+			err = proc.conn.SendData(data)
+		}
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+		if err == nil && result > 0 && sys.call == SysRecvfrom {
+			data, err = proc.conn.ReceiveData()
+			if err == nil && len(data) != result {
+				err = EPROTO
+			}
+		}
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+	if sys.call == SysRecvfrom && result > 0 {
+		sys.argBuf = data
+	}
+}
+
+// recvfrom receives the next datagram from the packet FD. The
+// datagrams from addresses denied by the access control list are
+// dropped. The function returns the sender address and the datagram,
+// encoded in at most size bytes.
+func (proc *Process) recvfrom(packet *FDPacket, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	for {
+		n, addr, err := packet.Recvfrom(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, ENOTCONN
+			}
+			return nil, err
+		}
+		if !proc.kern.acl.Allowed(addr) {
+			proc.debugf("recvfrom: datagram from %s denied\n", addr)
+			continue
+		}
+		address := addr.String()
+		if 2+len(address) > size {
+			return nil, EINVAL
+		}
+		result := bo.AppendUint16(nil, uint16(len(address)))
+		result = append(result, address...)
+		return append(result, buf[:min(n, size-len(result))]...), nil
+	}
+}
+
+// packetNetwork tests if the dial or listen syscall's address is in a
+// datagram network.
+func packetNetwork(sys *syscall) bool {
+	addrData, err := sys.argData()
+	if err != nil {
+		return false
+	}
+	network, _, errno := ParseNetAddress(addrData)
+	return errno == 0 && packetNetworks[network]
+}
@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
+)
+
+func udpEchoServer(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], addr)
+		}
+	}()
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn
+}
+
+func TestPacketSyscalls(t *testing.T) {
+	echo := udpEchoServer(t)
+
+	var kern Kernel
+	c0, c1, _ := p2ptest.Pipe()
+	garbler := &Process{
+		kern: &kern,
+		role: RoleGarbler,
+		conn: c0,
+		fds:  make(map[int32]*FD),
+	}
+	evaluator := &Process{
+		kern: &kern,
+		role: RoleEvaluator,
+		conn: c1,
+		fds:  make(map[int32]*FD),
+	}
+
+	// Connected FD.
+	conn, err := net.Dial("udp", echo.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialed := garbler.AllocFD(NewPacketFD(conn.(net.PacketConn), "udp", true))
+	err = evaluator.SetFD(dialed, NewPacketFD(nil, "", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unconnected FD.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listened := garbler.AllocFD(NewPacketFD(pc, "udp", false))
+	err = evaluator.SetFD(listened, NewPacketFD(nil, "", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock := garbler.AllocFD(NewSocketFD(NewConnDevNull()))
+	err = evaluator.SetFD(sock, NewSocketFD(NewConnDevNull()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(call Syscall, fd int32, argBuf []byte, arg1 int32) (
+		*syscall, *syscall) {
+
+		gsys := &syscall{
+			call:   call,
+			arg0:   fd,
+			argBuf: argBuf,
+			arg1:   arg1,
+		}
+		esys := &syscall{
+			call:   call,
+			arg0:   fd,
+			argBuf: argBuf,
+			arg1:   arg1,
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.sendto(gsys)
+		})
+		wg.Go(func() {
+			evaluator.sendto(esys)
+		})
+		wg.Wait()
+		return gsys, esys
+	}
+	sendto := func(fd int32, addr, data string) (int32, int32) {
+		arg := bo.AppendUint16(nil, uint16(len(addr)))
+		arg = append(arg, addr...)
+		arg = append(arg, data...)
+		g, e := call(SysSendto, fd, arg, int32(len(arg)))
+		return g.arg0, e.arg0
+	}
+	recvfrom := func(fd int32, size int32) (string, string) {
+		g, e := call(SysRecvfrom, fd, nil, size)
+		if g.arg0 <= 0 || g.arg0 != e.arg0 {
+			t.Fatalf("recvfrom: got %v/%v", g.arg0, e.arg0)
+		}
+		if string(g.argBuf) != string(e.argBuf) {
+			t.Fatalf("recvfrom: garbler and evaluator data differ")
+		}
+		alen := int(bo.Uint16(g.argBuf))
+		return string(g.argBuf[2 : 2+alen]), string(g.argBuf[2+alen:])
+	}
+
+	// Round-trip a datagram with the connected FD.
+	g, e := sendto(dialed, "", "Hello, UDP!")
+	if g != 11 || e != 11 {
+		t.Errorf("sendto: got %v/%v, expected 11", g, e)
+	}
+	addr, data := recvfrom(dialed, 1024)
+	if addr != echo.LocalAddr().String() {
+		t.Errorf("got address %v, expected %v", addr, echo.LocalAddr())
+	}
+	if data != "Hello, UDP!" {
+		t.Errorf("got %q, expected %q", data, "Hello, UDP!")
+	}
+
+	// Round-trip a datagram with the unconnected FD.
+	g, e = sendto(listened, echo.LocalAddr().String(), "ping")
+	if g != 4 || e != 4 {
+		t.Errorf("sendto: got %v/%v, expected 4", g, e)
+	}
+	addr, data = recvfrom(listened, 1024)
+	if addr != echo.LocalAddr().String() || data != "ping" {
+		t.Errorf("got %v/%q, expected %v/%q", addr, data, echo.LocalAddr(),
+			"ping")
+	}
+
+	// The datagram is truncated to the size.
+	sendto(dialed, "", "0123456789")
+	size := int32(2 + len(echo.LocalAddr().String()) + 4)
+	_, data = recvfrom(dialed, size)
+	if data != "0123" {
+		t.Errorf("got %q, expected %q", data, "0123")
+	}
+
+	tests := []struct {
+		fd     int32
+		addr   string
+		result int32
+	}{
+		{listened, "", -int32(EDESTADDRREQ)},
+		{dialed, echo.LocalAddr().String(), -int32(EISCONN)},
+		{listened, "invalid address", -int32(EINVAL)},
+		{sock, "", -int32(ENOTSOCK)},
+		{100, "", -int32(EBADF)},
+	}
+	for idx, test := range tests {
+		g, e := sendto(test.fd, test.addr, "data")
+		if g != test.result || e != test.result {
+			t.Errorf("test%d: got %v/%v, expected %v", idx, g, e, test.result)
+		}
+	}
+	gsys, esys := call(SysRecvfrom, dialed, nil, 0)
+	if gsys.arg0 != -int32(EINVAL) || esys.arg0 != -int32(EINVAL) {
+		t.Errorf("got %v/%v, expected %v", gsys.arg0, esys.arg0,
+			-int32(EINVAL))
+	}
+
+	for _, fd := range []int32{dialed, listened, sock} {
+		garbler.fds[fd].Close()
+		evaluator.fds[fd].Close()
+	}
+}
+
+func TestPacketNetwork(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected bool
+	}{
+		{"udp:127.0.0.1:53", true},
+		{"udp6:[::1]:53", true},
+		{"tcp:127.0.0.1:80", false},
+		{"unixgram:/tmp/sock", false},
+		{"invalid", false},
+	}
+	for _, test := range tests {
+		sys := &syscall{
+			call:   SysDial,
+			argBuf: []byte(test.address),
+			arg1:   int32(len(test.address)),
+		}
+		if got := packetNetwork(sys); got != test.expected {
+			t.Errorf("packetNetwork(%q)=%v, expected %v", test.address, got,
+				test.expected)
+		}
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -9,8 +9,11 @@ package kernel
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -47,9 +50,68 @@ var knownNetworks = map[string]bool{
 	"unixpacket": true,
 }
 
+// SockFlag defines the flags for the accepted sockets.
+type SockFlag int32
+
+// Flags for the accept syscall.
+const (
+	SockCloexec  SockFlag = 0x10000000
+	SockNonblock SockFlag = 0x20000000
+)
+
+var sockFlags = map[SockFlag]string{
+	SockCloexec:  "SOCK_CLOEXEC",
+	SockNonblock: "SOCK_NONBLOCK",
+}
+
+func (f SockFlag) String() string {
+	if f == 0 {
+		return "0"
+	}
+	var result string
+	for i := 0; i < 32; i++ {
+		flag := SockFlag(1 << i)
+		if f&flag != 0 {
+			if len(result) > 0 {
+				result += "|"
+			}
+			name, ok := sockFlags[flag]
+			if ok {
+				result += name
+			} else {
+				result += fmt.Sprintf("%#x", uint32(flag))
+			}
+		}
+	}
+	return result
+}
+
+// ParseSockFlags parses the accept syscall flags argument.
+func ParseSockFlags(arg int32) (SockFlag, Errno) {
+	flags := SockFlag(arg)
+	if flags&^(SockCloexec|SockNonblock) != 0 {
+		return 0, EINVAL
+	}
+	return flags, 0
+}
+
+// nonblockPoll specifies how long the non-blocking socket reads wait
+// for data before returning EAGAIN.
+const nonblockPoll = time.Millisecond
+
 // FDSocket implements socket FDs.
 type FDSocket struct {
-	conn net.Conn
+	conn     net.Conn
+	nonblock bool
+}
+
+// SetSockFlags sets the socket flags for the socket FD fd.
+func SetSockFlags(fd *FD, flags SockFlag) {
+	fd.cloexec = flags&SockCloexec != 0
+	sock, ok := fd.Impl.(*FDSocket)
+	if ok {
+		sock.nonblock = flags&SockNonblock != 0
+	}
 }
 
 // NewSocketFD creates a new socket FD.
@@ -65,10 +127,18 @@ func (fd *FDSocket) Close() int {
 	return int(mapError(err))
 }
 
-// Read implements FD.Read.
+// Read implements FD.Read. The non-blocking sockets return -EAGAIN
+// if no data is available.
 func (fd *FDSocket) Read(b []byte) int {
+	if fd.nonblock {
+		fd.conn.SetReadDeadline(time.Now().Add(nonblockPoll))
+		defer fd.conn.SetReadDeadline(time.Time{})
+	}
 	n, err := fd.conn.Read(b)
 	if err != nil {
+		if fd.nonblock && errors.Is(err, os.ErrDeadlineExceeded) {
+			return int(-EAGAIN)
+		}
 		if errors.Is(err, io.EOF) {
 			return 0
 		}
@@ -86,21 +156,135 @@ func (fd *FDSocket) Write(b []byte) int {
 	return n
 }
 
-// FDListener implements listener FDs.
+// Listen backlog limits. The backlog specifies how many connections
+// the listener pre-accepts into its accept queue.
+const (
+	DefaultListenBacklog = 16
+	MaxListenBacklog     = 128
+)
+
+// ListenBacklog returns the effective listen backlog for the syscall
+// argument arg. The non-positive values select the default backlog
+// and too large values are clamped to MaxListenBacklog.
+func ListenBacklog(arg int32) int {
+	if arg <= 0 {
+		return DefaultListenBacklog
+	}
+	if arg > MaxListenBacklog {
+		return MaxListenBacklog
+	}
+	return int(arg)
+}
+
+// FDListener implements listener FDs. The garbler's listener
+// pre-accepts connections into a bounded accept queue in a background
+// goroutine. The evaluator's listener does not have a network
+// listener, it only tracks the garbler's accept queue depth.
 type FDListener struct {
 	listener net.Listener
+	queue    chan net.Conn
+	done     chan struct{}
+	once     sync.Once
+	err      error
+	pending  int
 }
 
-// NewListenerFD creates a new listener FD.
-func NewListenerFD(listener net.Listener) *FD {
-	return NewFD(&FDListener{
+// NewListenerFD creates a new listener FD. If the listener is not
+// nil, the FD starts accepting connections into its accept queue
+// which holds at most backlog connections.
+func NewListenerFD(listener net.Listener, backlog int) *FD {
+	fd := &FDListener{
 		listener: listener,
-	})
+	}
+	if listener != nil {
+		fd.queue = make(chan net.Conn, backlog)
+		fd.done = make(chan struct{})
+		go fd.acceptLoop()
+	}
+	return NewFD(fd)
+}
+
+func (fd *FDListener) acceptLoop() {
+	defer close(fd.queue)
+	for {
+		conn, err := fd.listener.Accept()
+		if err != nil {
+			fd.err = err
+			return
+		}
+		select {
+		case fd.queue <- conn:
+		case <-fd.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept returns the next connection from the accept queue. It
+// blocks until a connection is available or the listener fails.
+func (fd *FDListener) Accept() (net.Conn, error) {
+	return fd.AcceptUntil(nil)
+}
+
+// AcceptUntil returns the next connection from the accept queue. It
+// blocks until a connection is available, the listener fails, or
+// the stop channel is closed. If the stop channel is closed,
+// AcceptUntil returns ESHUTDOWN and leaves the queued connections in
+// the accept queue.
+func (fd *FDListener) AcceptUntil(stop <-chan struct{}) (net.Conn, error) {
+	if fd.queue == nil {
+		return nil, EINVAL
+	}
+	select {
+	case <-stop:
+		return nil, ESHUTDOWN
+	default:
+	}
+	var conn net.Conn
+	var ok bool
+	select {
+	case conn, ok = <-fd.queue:
+	case <-stop:
+		return nil, ESHUTDOWN
+	}
+	if !ok {
+		if fd.err != nil {
+			return nil, fd.err
+		}
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+// Pending returns the number of connections in the accept queue. For
+// the evaluator's listener, this returns the queue depth last
+// reported by the garbler.
+func (fd *FDListener) Pending() int {
+	if fd.queue == nil {
+		return fd.pending
+	}
+	return len(fd.queue)
+}
+
+// SetPending sets the accept queue depth reported by the garbler.
+func (fd *FDListener) SetPending(pending int) {
+	fd.pending = pending
 }
 
 // Close implements FD.Close.
 func (fd *FDListener) Close() int {
-	err := fd.listener.Close()
+	if fd.listener == nil {
+		return 0
+	}
+	var err error
+	fd.once.Do(func() {
+		close(fd.done)
+		err = fd.listener.Close()
+		for conn := range fd.queue {
+			conn.Close()
+		}
+	})
 	return int(mapError(err))
 }
 
@@ -0,0 +1,136 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenBacklog(t *testing.T) {
+	tests := []struct {
+		arg      int32
+		expected int
+	}{
+		{-1, DefaultListenBacklog},
+		{0, DefaultListenBacklog},
+		{1, 1},
+		{MaxListenBacklog, MaxListenBacklog},
+		{MaxListenBacklog + 1, MaxListenBacklog},
+	}
+	for _, test := range tests {
+		got := ListenBacklog(test.arg)
+		if got != test.expected {
+			t.Errorf("ListenBacklog(%v)=%v, expected %v",
+				test.arg, got, test.expected)
+		}
+	}
+}
+
+func TestListenerAcceptQueue(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := NewListenerFD(listener, 2)
+	listenerfd := fd.Impl.(*FDListener)
+
+	var clients []net.Conn
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		c, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, c)
+	}
+
+	// The accept queue is bounded by the backlog.
+	deadline := time.Now().Add(5 * time.Second)
+	for listenerfd.Pending() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if listenerfd.Pending() != 2 {
+		t.Fatalf("pending %v, expected 2", listenerfd.Pending())
+	}
+
+	for i := 0; i < 3; i++ {
+		conn, err := listenerfd.Accept()
+		if err != nil {
+			t.Fatalf("accept %v: %v", i, err)
+		}
+		conn.Close()
+	}
+
+	if ret := fd.Close(); ret != 0 {
+		t.Errorf("close failed: %v", Errno(-ret))
+	}
+	_, err = listenerfd.Accept()
+	if err == nil {
+		t.Errorf("accept succeeded on a closed listener")
+	}
+}
+
+func TestParseSockFlags(t *testing.T) {
+	tests := []struct {
+		arg   int32
+		flags SockFlag
+		errno Errno
+	}{
+		{0, 0, 0},
+		{int32(SockNonblock), SockNonblock, 0},
+		{int32(SockCloexec | SockNonblock), SockCloexec | SockNonblock, 0},
+		{0x1, 0, EINVAL},
+		{int32(SockCloexec) | 0x800, 0, EINVAL},
+	}
+	for _, test := range tests {
+		flags, errno := ParseSockFlags(test.arg)
+		if flags != test.flags || errno != test.errno {
+			t.Errorf("ParseSockFlags(%#x)=%v,%v, expected %v,%v",
+				test.arg, flags, errno, test.flags, test.errno)
+		}
+	}
+}
+
+func TestSockFlags(t *testing.T) {
+	c0, c1 := net.Pipe()
+	defer c1.Close()
+
+	fd := NewSocketFD(c0)
+	SetSockFlags(fd, SockNonblock|SockCloexec)
+	defer fd.Close()
+
+	// Non-blocking read without data.
+	var buf [16]byte
+	n := fd.Read(buf[:])
+	if n != int(-EAGAIN) {
+		t.Errorf("read: got %v, expected %v", n, -EAGAIN)
+	}
+
+	go c1.Write([]byte("hello"))
+	deadline := time.Now().Add(5 * time.Second)
+	for n < 0 && time.Now().Before(deadline) {
+		n = fd.Read(buf[:])
+	}
+	if string(buf[:n]) != "hello" {
+		t.Errorf("read: got %q, expected %q", buf[:max(n, 0)], "hello")
+	}
+
+	// Close-on-exec FDs are not inherited.
+	child := fd.Inherit()
+	if _, ok := child.Impl.(*FDDevNull); !ok {
+		t.Errorf("inherit: got %T, expected %T", child.Impl, &FDDevNull{})
+	}
+	if fd.refcount != 1 {
+		t.Errorf("refcount: got %v, expected 1", fd.refcount)
+	}
+}
@@ -9,7 +9,6 @@ package kernel
 import (
 	"crypto/sha256"
 	"errors"
-	"fmt"
 	"io"
 
 	"github.com/markkurossi/ephemelier/crypto/tls"
@@ -20,19 +19,25 @@ type FDTLS struct {
 	conn          *tls.Conn
 	key           *Key
 	handshakeDone bool
+	pending       []byte
+	share         []byte
 }
 
-// NewTLSFD creates a new TLS FD. The arguments must be non-nil for
-// garbler and nil for evaluator.
-func NewTLSFD(conn *tls.Conn, key *Key) *FD {
+// NewTLSFD creates a new TLS FD. The conn and key arguments must be
+// non-nil for garbler and nil for evaluator. The share specifies this
+// party's share of the key exchange shared secret.
+func NewTLSFD(conn *tls.Conn, key *Key, share []byte) *FD {
 	return NewFD(&FDTLS{
-		conn: conn,
-		key:  key,
+		conn:  conn,
+		key:   key,
+		share: share,
 	})
 }
 
 // Close implements FD.Close.
 func (fd *FDTLS) Close() int {
+	clear(fd.share)
+	fd.share = nil
 	if fd.conn == nil {
 		return 0
 	}
@@ -44,12 +49,16 @@ func (fd *FDTLS) Read(b []byte) int {
 	if fd.conn == nil {
 		return 0
 	}
-	ct, data, err := fd.conn.ReadRecord()
-	if err != nil {
-		if errors.Is(err, io.EOF) {
-			return 0
+	data := fd.pending
+	if data == nil {
+		var err error
+		_, data, err = fd.conn.ReadRecord()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0
+			}
+			return int(mapError(err))
 		}
-		return int(mapError(err))
 	}
 	need := len(data)
 	if !fd.handshakeDone {
@@ -57,9 +66,16 @@ func (fd *FDTLS) Read(b []byte) int {
 	}
 
 	if need > len(b) {
-		fmt.Printf("<< %s[%d/%d/%d]\n", ct, len(data), need, len(b))
+		// Keep the record so the program can retry the read with a
+		// larger buffer. The record is decrypted in MPC so we can't
+		// return it in fragments.
+		if fd.pending == nil {
+			fd.pending = append([]byte{}, data...)
+		}
 		return -int(ERANGE)
 	}
+	fd.pending = nil
+
 	var n int
 	if !fd.handshakeDone {
 		n = copy(b, fd.conn.Transcript())
@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"net"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/crypto/tls"
+)
+
+func TestTLSFDReadRange(t *testing.T) {
+	c0, c1 := net.Pipe()
+	defer c0.Close()
+	defer c1.Close()
+
+	records := []string{"GET / HTTP/1.1\r\n\r\n", "next"}
+	go func() {
+		w := tls.NewConnection(c1, &tls.Config{})
+		for _, r := range records {
+			if err := w.WriteRecord(tls.CTApplicationData,
+				[]byte(r)); err != nil {
+				return
+			}
+		}
+	}()
+
+	fd := NewTLSFD(tls.NewConnection(c0, &tls.Config{}), nil, nil)
+	impl := fd.Impl.(*FDTLS)
+	impl.handshakeDone = true
+
+	// Too small buffer keeps the record for the next read.
+	buf := make([]byte, 4)
+	n := impl.Read(buf)
+	if n != -int(ERANGE) {
+		t.Fatalf("got %v, expected %v", n, -int(ERANGE))
+	}
+	n = impl.Read(buf)
+	if n != -int(ERANGE) {
+		t.Fatalf("retry: got %v, expected %v", n, -int(ERANGE))
+	}
+
+	buf = make([]byte, 1024)
+	for _, r := range records {
+		n = impl.Read(buf)
+		if n < 0 {
+			t.Fatalf("read failed: %v", Errno(-n))
+		}
+		if string(buf[:n]) != r {
+			t.Errorf("got %q, expected %q", buf[:n], r)
+		}
+	}
+}
@@ -7,13 +7,20 @@
 package kernel
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	gosyscall "syscall"
 	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 // OpenFlag defines the flags for the open syscall.
@@ -30,12 +37,37 @@ const (
 	Encrypt   OpenFlag = 0x01000000
 )
 
+// The low byte of the encrypted file magic is the header version.
 const (
 	// EncrFileMagic is the magic value for encrypted files.
 	EncrFileMagic uint32 = 0x45464d01
 
+	// EncrFileMagicPerm is the magic value for encrypted files with
+	// the owner and permission fields.
+	EncrFileMagicPerm uint32 = 0x45464d02
+
+	// EncrFileMagicCRC is the magic value for encrypted files with
+	// the owner and permission fields and the header checksum.
+	EncrFileMagicCRC uint32 = 0x45464d03
+
+	// EncrFileVersion is the latest supported header version.
+	EncrFileVersion = int(EncrFileMagicCRC & 0xff)
+
 	// EncrFileHdrSize defines the size of the encrypted file header.
 	EncrFileHdrSize int = 28
+
+	// EncrFilePermSize defines the size of the owner and permission
+	// fields following the EncrFileMagicPerm file header.
+	EncrFilePermSize int = 8
+
+	// EncrFileCRCSize defines the size of the CRC32 checksum
+	// following the owner and permission fields.
+	EncrFileCRCSize int = 4
+
+	// EncrFileMaxHdrSize defines the maximum size of the encrypted
+	// file header.
+	EncrFileMaxHdrSize = EncrFileHdrSize + EncrFilePermSize +
+		EncrFileCRCSize
 )
 
 var oflags = map[OpenFlag]string{
@@ -64,9 +96,36 @@ func (f OpenFlag) String() string {
 	return result
 }
 
+// FileType defines file types returned by the fstat syscall.
+type FileType int32
+
+// File types.
+const (
+	FileTypeUnknown FileType = iota
+	FileTypeRegular
+	FileTypeSocket
+	FileTypeDirectory
+)
+
+var fileTypes = map[FileType]string{
+	FileTypeUnknown:   "unknown",
+	FileTypeRegular:   "regular",
+	FileTypeSocket:    "socket",
+	FileTypeDirectory: "directory",
+}
+
+func (t FileType) String() string {
+	name, ok := fileTypes[t]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{FileType %d}", t)
+}
+
 // FDFile implements file FDs.
 type FDFile struct {
-	f *os.File
+	f   *os.File
+	hdr *FileHeader
 }
 
 // NewFileFD creates a new file FD.
@@ -76,6 +135,16 @@ func NewFileFD(f *os.File) *FD {
 	})
 }
 
+// Stat returns the file information. For encrypted files, the file
+// size is the plaintext size from the file header.
+func (fd *FDFile) Stat() (*FileInfo, error) {
+	info, err := fd.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(info, fd.hdr)
+}
+
 // Close implements FD.Close.
 func (fd *FDFile) Close() int {
 	err := fd.f.Close()
@@ -113,6 +182,242 @@ func (proc *Process) MakePath(path string) string {
 	return filepath.Join(proc.kern.params.Filesystem, proc.root, path)
 }
 
+// ResolvePath resolves the path argument like MakePath and checks
+// that the resolved path is inside the process' root directory. The
+// symbolic links are resolved in the path's directory and, if follow
+// is set, in the final path element. Paths resolving outside the root
+// return EACCES.
+func (proc *Process) ResolvePath(path string, follow bool) (string, error) {
+	root, err := filepath.EvalSymlinks(
+		filepath.Join(proc.kern.params.Filesystem, proc.root))
+	if err != nil {
+		return "", err
+	}
+	path = proc.MakePath(path)
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	path = filepath.Join(dir, filepath.Base(path))
+	if follow {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			path = resolved
+		} else if _, lerr := os.Lstat(path); lerr == nil {
+			// Dangling symbolic link.
+			return "", err
+		}
+	}
+	if !inRoot(root, path) {
+		return "", EACCES
+	}
+	return path, nil
+}
+
+// inRoot tests if the path is the root directory or inside it.
+func inRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// osFlags returns the os.OpenFile flags for the open flags.
+func (f OpenFlag) osFlags() (int, error) {
+	var flags int
+	switch f & (WriteOnly | ReadWrite) {
+	case ReadOnly:
+		flags = os.O_RDONLY
+	case WriteOnly:
+		flags = os.O_WRONLY
+	case ReadWrite:
+		flags = os.O_RDWR
+	default:
+		return 0, EINVAL
+	}
+	if f&Append != 0 {
+		flags |= os.O_APPEND
+	}
+	if f&Create != 0 {
+		flags |= os.O_CREATE
+	}
+	if f&Truncate != 0 {
+		flags |= os.O_TRUNC
+	}
+	// New encrypted files need a file header.
+	if f&Encrypt != 0 && f&(Create|Truncate) != 0 {
+		return 0, EINVAL
+	}
+	return flags, nil
+}
+
+// mkdir implements the mkdir and unlink syscalls. Only the garbler
+// has the filesystem so it performs the operation and syncs the
+// result with the evaluator.
+func (proc *Process) mkdir(sys *syscall) {
+	var result int
+	var err error
+
+	if proc.role == RoleGarbler {
+		var path string
+		path, err = sys.argString()
+		if err != nil || len(path) == 0 {
+			err = EINVAL
+		} else if sys.call == SysMkdir {
+			path, err = proc.ResolvePath(path, false)
+			if err == nil {
+				err = os.Mkdir(path, 0755)
+			}
+		} else {
+			path, err = proc.ResolvePath(path, false)
+			if err == nil {
+				var info os.FileInfo
+				info, err = os.Lstat(path)
+				if err == nil && info.IsDir() {
+					err = EISDIR
+				}
+			}
+			if err == nil {
+				err = os.Remove(path)
+			}
+		}
+		if err != nil {
+			result = int(mapError(err))
+		}
+		err = proc.conn.SendUint32(result)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+}
+
+// open implements the open syscall for the garbler. It opens the file
+// and syncs the allocated FD with the evaluator.
+func (proc *Process) open(sys *syscall) {
+	path, err := sys.argString()
+	if err != nil || len(path) == 0 {
+		sys.SetArg0(int32(-EINVAL))
+		proc.sendFD(int(-EINVAL))
+		return
+	}
+	flags, err := OpenFlag(sys.arg0).osFlags()
+	if err == nil {
+		path, err = proc.ResolvePath(path, true)
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		proc.sendFD(int(sys.arg0))
+		return
+	}
+	// Check the permissions before truncating the file.
+	file, err := os.OpenFile(path, flags&^os.O_TRUNC, 0644)
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		proc.sendFD(int(sys.arg0))
+		return
+	}
+	err = proc.checkAccess(file, OpenFlag(sys.arg0))
+	if err == nil && flags&os.O_TRUNC != 0 {
+		err = file.Truncate(0)
+	}
+	if err != nil {
+		file.Close()
+		sys.SetArg0(mapError(err))
+		proc.sendFD(int(sys.arg0))
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		sys.SetArg0(mapError(err))
+		proc.sendFD(int(sys.arg0))
+		return
+	}
+
+	if info.IsDir() {
+		if OpenFlag(sys.arg0)&Encrypt != 0 {
+			file.Close()
+			sys.SetArg0(int32(-EISDIR))
+			proc.sendFD(int(sys.arg0))
+			return
+		}
+		fd := NewDirFD(file)
+		sys.SetArg0(proc.AllocFD(fd))
+		if sys.arg0 < 0 {
+			proc.sendFD(int(sys.arg0))
+			return
+		}
+		fi, _ := NewFileInfo(info, nil)
+		sys.argBuf = fi.Bytes()
+
+		// Sync FD with evaluator.
+		err = proc.sendFD(int(sys.arg0))
+		if err != nil {
+			fd.Close()
+			proc.FreeFD(sys.arg0)
+			sys.SetArg0(mapError(err))
+		}
+		return
+	}
+
+	// File header for encrypted files.
+	var fileHeader *FileHeader
+	if OpenFlag(sys.arg0)&Encrypt != 0 {
+		fileHeader, err = ReadFileHeader(file)
+		if err == nil && fileHeader.Flags&FileFlagCompressed != 0 {
+			// The programs decrypt fixed-size blocks and can't
+			// decompress the blocks.
+			err = EOPNOTSUPP
+		}
+		if err == nil {
+			_, err = file.Seek(int64(fileHeader.Size()), io.SeekStart)
+		}
+		if err != nil {
+			sys.SetArg0(mapError(err))
+			proc.sendFD(int(sys.arg0))
+			file.Close()
+			return
+		}
+	}
+
+	fd := NewFD(&FDFile{
+		f:   file,
+		hdr: fileHeader,
+	})
+	sys.SetArg0(proc.AllocFD(fd))
+	if sys.arg0 < 0 {
+		proc.sendFD(int(sys.arg0))
+		return
+	}
+
+	fi, err := NewFileInfo(info, fileHeader)
+	if err != nil {
+		fd.Close()
+		proc.FreeFD(sys.arg0)
+		sys.SetArg0(mapError(err))
+		proc.sendFD(int(sys.arg0))
+		return
+	}
+
+	sys.argBuf = fi.Bytes()
+
+	// Sync FD with evaluator.
+	err = proc.sendFD(int(sys.arg0))
+	if err != nil {
+		fd.Close()
+		proc.FreeFD(sys.arg0)
+		sys.SetArg0(mapError(err))
+	}
+}
+
 // Chroot changes the process' root directory.
 func (proc *Process) Chroot(path string) error {
 	path = proc.MakePath(path)
@@ -133,8 +438,324 @@ func (proc *Process) Chroot(path string) error {
 	return nil
 }
 
-// FileInfo defines file information and is returned by the open
-// syscall along with the file descriptor.
+// getcwd implements the getcwd syscall. The arg0 specifies the
+// maximum path length the program accepts; the value 0 returns the
+// path without limit. Both peers have the same working directory so
+// they return the same path without syncing.
+func (proc *Process) getcwd(sys *syscall) {
+	if sys.arg0 < 0 {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+	if sys.arg0 > 0 && int(sys.arg0) < len(proc.cwd) {
+		sys.SetArg0(int32(-ERANGE))
+		return
+	}
+	sys.SetArg0(int32(len(proc.cwd)))
+	sys.argBuf = []byte(proc.cwd)
+}
+
+// fstat returns the file information and type of the file
+// descriptor. Only the garbler has the open files and sockets so it
+// syncs the result with the evaluator.
+func (proc *Process) fstat(sys *syscall) {
+	fd, ok := proc.fds[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+
+	var info []byte
+	var ftype FileType
+	var err error
+
+	if proc.role == RoleGarbler {
+		var fi *FileInfo
+
+		switch impl := fd.Impl.(type) {
+		case *FDFile:
+			ftype = FileTypeRegular
+			fi, err = impl.Stat()
+
+		case *FDMem:
+			ftype = FileTypeRegular
+			fi = &FileInfo{
+				Size:    int64(len(impl.buf)),
+				ModTime: time.UnixMilli(0),
+			}
+
+		case *FDDir:
+			ftype = FileTypeDirectory
+			var info os.FileInfo
+			info, err = impl.f.Stat()
+			if err == nil {
+				fi, err = NewFileInfo(info, nil)
+			}
+
+		case *FDSocket, *FDListener, *FDTLS:
+			// Sockets have no size or modification time.
+			ftype = FileTypeSocket
+			fi = &FileInfo{
+				ModTime: time.UnixMilli(0),
+			}
+
+		default:
+			ftype = FileTypeUnknown
+			fi = &FileInfo{
+				ModTime: time.UnixMilli(0),
+			}
+		}
+		if err != nil {
+			ftype = FileType(mapError(err))
+		} else {
+			info = fi.Bytes()
+		}
+
+		err = proc.conn.SendUint32(int(ftype))
+		if err == nil && ftype >= 0 {
+			err = proc.conn.SendData(info)
+		}
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		ftype = FileType(int32(v))
+		if err == nil && ftype >= 0 {
+			info, err = proc.conn.ReceiveData()
+		}
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	if ftype < 0 {
+		sys.SetArg0(int32(ftype))
+		return
+	}
+	sys.arg0 = int32(len(info))
+	sys.argBuf = info
+	sys.arg1 = int32(ftype)
+}
+
+// StatfsSize defines the size of the statfs syscall result. The
+// result has the following big-endian fields:
+//
+//	total uint64
+//	free  uint64
+const StatfsSize = 16
+
+// Statfs returns the total and free bytes of the filesystem mount
+// containing path. The path must resolve inside the filesystem root
+// params.Filesystem; paths outside it return ENOENT.
+func (proc *Process) Statfs(path string) (total, free uint64, err error) {
+	root, err := filepath.EvalSymlinks(proc.kern.params.Filesystem)
+	if err != nil {
+		return 0, 0, err
+	}
+	path, err = filepath.EvalSymlinks(proc.MakePath(path))
+	if err != nil {
+		return 0, 0, err
+	}
+	if !inRoot(root, path) {
+		return 0, 0, ENOENT
+	}
+	var st gosyscall.Statfs_t
+	err = gosyscall.Statfs(path, &st)
+	if err != nil {
+		return 0, 0, EIO
+	}
+	bsize := uint64(st.Bsize)
+	return uint64(st.Blocks) * bsize, uint64(st.Bavail) * bsize, nil
+}
+
+// statfs implements the statfs syscall. The nodes may have different
+// underlying disks so the garbler is authoritative: it returns its
+// filesystem figures and syncs them with the evaluator.
+func (proc *Process) statfs(sys *syscall) {
+	var result int
+	var info []byte
+	var err error
+
+	if proc.role == RoleGarbler {
+		var path string
+		path, err = sys.argString()
+		if err != nil || len(path) == 0 {
+			err = EINVAL
+		} else {
+			var total, free uint64
+			total, free, err = proc.Statfs(path)
+			if err == nil {
+				info = make([]byte, StatfsSize)
+				bo.PutUint64(info[0:], total)
+				bo.PutUint64(info[8:], free)
+			}
+		}
+		if err != nil {
+			result = int(mapError(err))
+		}
+		err = proc.conn.SendUint32(result)
+		if err == nil && result >= 0 {
+			err = proc.conn.SendData(info)
+		}
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+		if err == nil && result >= 0 {
+			info, err = proc.conn.ReceiveData()
+			if err == nil && len(info) != StatfsSize {
+				err = EPROTO
+			}
+		}
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	if result < 0 {
+		sys.SetArg0(int32(result))
+		return
+	}
+	sys.arg0 = int32(len(info))
+	sys.argBuf = info
+	sys.arg1 = 0
+}
+
+// Truncate truncates the file to size bytes. If the file grows, the
+// new bytes are zero-filled.
+func (fd *FDFile) Truncate(size int64) error {
+	return truncateFile(fd.f, fd.hdr, size)
+}
+
+// truncateFile truncates the file f to size bytes. The hdr is the
+// encrypted file header or nil for plaintext files. Each block of an
+// encrypted file is authenticated with the file's plaintext size and
+// re-encrypting the blocks requires the file key that is secret
+// shared between the parties. Therefore, encrypted files can only be
+// truncated to zero.
+func truncateFile(f *os.File, hdr *FileHeader, size int64) error {
+	if size < 0 {
+		return EINVAL
+	}
+	if hdr == nil {
+		return f.Truncate(size)
+	}
+	if size == hdr.PlainSize {
+		return nil
+	}
+	if size != 0 {
+		return EOPNOTSUPP
+	}
+
+	// Select a new nonce so that the new file content is not
+	// encrypted with the old nonces.
+	_, err := rand.Read(hdr.Nonce[:])
+	if err != nil {
+		return err
+	}
+	hdr.PlainSize = 0
+	_, err = f.WriteAt(hdr.Bytes(), 0)
+	if err != nil {
+		return err
+	}
+	return f.Truncate(int64(hdr.Size()))
+}
+
+// truncatePath truncates the file at path to size bytes. Files
+// starting with a valid encrypted file header are truncated as
+// encrypted files if their permissions allow the uid to write them.
+func truncatePath(path string, uid UID, size int64) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hdr, _ := ReadFileHeader(f)
+	if hdr != nil {
+		err = hdr.Access(uid, WriteOnly)
+		if err != nil {
+			return err
+		}
+	}
+	return truncateFile(f, hdr, size)
+}
+
+// truncate implements the truncate and ftruncate syscalls. Only the
+// garbler has the filesystem so it performs the operation and syncs
+// the result with the evaluator. Truncating an encrypted file selects
+// a new nonce so ftruncate returns the refreshed file info which the
+// process must use for the new file content.
+func (proc *Process) truncate(sys *syscall) {
+	var result int
+	var info []byte
+	var err error
+
+	if proc.role == RoleGarbler {
+		switch sys.call {
+		case SysTruncate:
+			var path string
+			path, err = sys.argString()
+			if err != nil || len(path) == 0 {
+				err = EINVAL
+			} else {
+				path = proc.MakePath(path)
+				err = truncatePath(path, proc.uid, int64(sys.arg0))
+			}
+
+		case SysFtruncate:
+			fd, ok := proc.fds[sys.arg0]
+			if !ok {
+				err = EBADF
+			} else if filefd, ok := fd.Impl.(*FDFile); ok {
+				err = filefd.Truncate(int64(sys.arg1))
+				if err == nil {
+					var fi *FileInfo
+					fi, err = filefd.Stat()
+					if err == nil {
+						info = fi.Bytes()
+					}
+				}
+			} else {
+				err = EINVAL
+			}
+		}
+		if err != nil {
+			result = int(mapError(err))
+		}
+		err = proc.conn.SendUint32(result)
+		if err == nil && result == 0 && sys.call == SysFtruncate {
+			err = proc.conn.SendData(info)
+		}
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+		if err == nil && result == 0 && sys.call == SysFtruncate {
+			info, err = proc.conn.ReceiveData()
+		}
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+	if result == 0 && sys.call == SysFtruncate {
+		sys.argBuf = info
+		sys.arg1 = int32(len(info))
+	}
+}
+
+// FileInfo defines file information and is returned by the open and
+// fstat syscalls.
 type FileInfo struct {
 	Size      int64
 	ModTime   time.Time
@@ -188,7 +809,10 @@ func (fi *FileInfo) Bytes() []byte {
 	return buf
 }
 
-// FileHeader defines the file header for encrypted files.
+// FileHeader defines the file header for encrypted files. The Owner
+// and Mode are serialized only in the version 2 and later headers.
+// The version 3 headers end with the CRC32 checksum of the header
+// fields.
 type FileHeader struct {
 	Magic     uint32
 	BlockSize uint16
@@ -196,18 +820,76 @@ type FileHeader struct {
 	Flags     uint8
 	PlainSize int64
 	Nonce     [12]byte
+	Owner     UID
+	Mode      FileMode
+}
+
+// ReadFileHeader reads the encrypted file header from the beginning
+// of r.
+func ReadFileHeader(r io.ReaderAt) (*FileHeader, error) {
+	buf := make([]byte, EncrFileMaxHdrSize)
+	n, err := r.ReadAt(buf, 0)
+	if n < EncrFileHdrSize {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = fmt.Errorf("short encryption header: %w", ENOEXEC)
+		}
+		return nil, err
+	}
+	size, err := fileHeaderSize(bo.Uint32(buf[0:]))
+	if err != nil {
+		return nil, err
+	}
+	if n < size {
+		return nil, fmt.Errorf("short encryption header: %w", ENOEXEC)
+	}
+	return NewFileHeader(buf[:size])
+}
+
+// fileHeaderSize returns the size of the encrypted file header with
+// the magic.
+func fileHeaderSize(magic uint32) (int, error) {
+	if magic&^0xff != EncrFileMagic&^0xff || magic&0xff == 0 {
+		return 0, fmt.Errorf("invalid EncrFileMagic %08x: %w", magic, ENOEXEC)
+	}
+	switch version := int(magic & 0xff); version {
+	case 1:
+		return EncrFileHdrSize, nil
+	case 2:
+		return EncrFileHdrSize + EncrFilePermSize, nil
+	case 3:
+		return EncrFileMaxHdrSize, nil
+	default:
+		return 0, fmt.Errorf("unsupported encryption header version %v, "+
+			"latest supported is %v: %w", version, EncrFileVersion, ENOEXEC)
+	}
 }
 
 // NewFileHeader creates a new FileHeader from the serialized data.
+// The block size must be bigger than the authentication tag so that
+// each block carries at least one byte of data. The function returns
+// EBADMSG if the header checksum does not match the header fields.
 func NewFileHeader(buf []byte) (*FileHeader, error) {
-	if len(buf) != int(EncrFileHdrSize) {
+	if len(buf) < int(EncrFileHdrSize) {
 		return nil, fmt.Errorf("invalid encryption header length %v: %w",
 			len(buf), ENOEXEC)
 	}
 
 	magic := bo.Uint32(buf[0:])
-	if magic != EncrFileMagic {
-		return nil, fmt.Errorf("invalid EncrFileMagic %08x: %w", magic, ENOEXEC)
+	size, err := fileHeaderSize(magic)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) != size {
+		return nil, fmt.Errorf("invalid encryption header length %v: %w",
+			len(buf), ENOEXEC)
+	}
+	if magic == EncrFileMagicCRC {
+		ofs := size - EncrFileCRCSize
+		sum := crc32.ChecksumIEEE(buf[:ofs])
+		if stored := bo.Uint32(buf[ofs:]); stored != sum {
+			return nil, fmt.Errorf("invalid encryption header checksum "+
+				"%08x, expected %08x: %w", stored, sum, EBADMSG)
+		}
 	}
 	hdr := &FileHeader{
 		Magic:     magic,
@@ -216,14 +898,68 @@ func NewFileHeader(buf []byte) (*FileHeader, error) {
 		Flags:     buf[7],
 		PlainSize: int64(bo.Uint64(buf[8:])),
 	}
+	if hdr.BlockSize <= TagSize {
+		return nil, fmt.Errorf("invalid block size %v, must be bigger than %v: %w",
+			hdr.BlockSize, TagSize, EINVAL)
+	}
+	if hdr.PlainSize < 0 {
+		return nil, fmt.Errorf("invalid plain size %v: %w", hdr.PlainSize,
+			EINVAL)
+	}
 	copy(hdr.Nonce[:], buf[16:])
 
+	if hdr.Version() >= 2 {
+		hdr.Owner = UID(bo.Uint32(buf[28:]))
+		hdr.Mode = FileMode(bo.Uint16(buf[32:]))
+		if hdr.Mode&^ModePerm != 0 {
+			return nil, fmt.Errorf("invalid file mode %v: %w", hdr.Mode,
+				EINVAL)
+		}
+	}
+
 	return hdr, nil
 }
 
+// Version returns the header version.
+func (hdr *FileHeader) Version() int {
+	return int(hdr.Magic & 0xff)
+}
+
+// Size returns the size of the serialized file header.
+func (hdr *FileHeader) Size() int {
+	switch hdr.Version() {
+	case 2:
+		return EncrFileHdrSize + EncrFilePermSize
+	case 3:
+		return EncrFileMaxHdrSize
+	default:
+		return EncrFileHdrSize
+	}
+}
+
+// NewAEAD creates the block cipher of the header's algorithm with the
+// key. The AES algorithm uses AES-GCM with the key size selecting
+// between AES-128, AES-192, and AES-256.
+func (hdr *FileHeader) NewAEAD(key []byte) (cipher.AEAD, error) {
+	switch hdr.Algorithm {
+	case KeyTypeAES:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+
+	case KeyTypeChaCha20:
+		return chacha20poly1305.New(key)
+
+	default:
+		return nil, fmt.Errorf("unsupported file algorithm %v", hdr.Algorithm)
+	}
+}
+
 // Bytes return the serialized file header.
 func (hdr *FileHeader) Bytes() []byte {
-	buf := make([]byte, EncrFileHdrSize)
+	buf := make([]byte, hdr.Size())
 
 	bo.PutUint32(buf[0:], hdr.Magic)
 	bo.PutUint16(buf[4:], hdr.BlockSize)
@@ -232,5 +968,14 @@ func (hdr *FileHeader) Bytes() []byte {
 	bo.PutUint64(buf[8:], uint64(hdr.PlainSize))
 	copy(buf[16:], hdr.Nonce[:])
 
+	if hdr.Version() >= 2 {
+		bo.PutUint32(buf[28:], uint32(hdr.Owner))
+		bo.PutUint16(buf[32:], uint16(hdr.Mode))
+	}
+	if hdr.Version() >= 3 {
+		ofs := len(buf) - EncrFileCRCSize
+		bo.PutUint32(buf[ofs:], crc32.ChecksumIEEE(buf[:ofs]))
+	}
+
 	return buf
 }
@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// FileFlagCompressed is the FileHeader flag for files with compressed
+// blocks. Each block of BlockSize-TagSize plaintext bytes is
+// compressed before encryption and the encrypted block is stored as
+// a record of a 32-bit big-endian length followed by the ciphertext.
+// The blocks are compressed independently so each block can be
+// decrypted without the other blocks.
+const FileFlagCompressed uint8 = 0x01
+
+// CompressedRecordHdrSize defines the size of the compressed block
+// record header.
+const CompressedRecordHdrSize = 4
+
+// Compression methods of the compressed blocks. The method is the
+// first byte of the block plaintext.
+const (
+	blockStored  byte = 0
+	blockDeflate byte = 1
+)
+
+// CompressBlock compresses the plaintext block with DEFLATE. The
+// blocks that do not compress are stored uncompressed.
+func CompressBlock(plain []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(blockDeflate)
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err == nil {
+		_, err = w.Write(plain)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil || buf.Len() > len(plain) {
+		return append([]byte{blockStored}, plain...)
+	}
+	return buf.Bytes()
+}
+
+// decompressBlock decompresses the compressed block data. The size
+// is the expected plaintext size of the block.
+func decompressBlock(data []byte, size int) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty compressed block: %w", EBADMSG)
+	}
+	var plain []byte
+	switch data[0] {
+	case blockStored:
+		plain = data[1:]
+
+	case blockDeflate:
+		var err error
+		r := flate.NewReader(bytes.NewReader(data[1:]))
+		plain, err = io.ReadAll(io.LimitReader(r, int64(size)+1))
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid compressed block: %w", EBADMSG)
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid compression method %v: %w", data[0],
+			EBADMSG)
+	}
+	if len(plain) != size {
+		return nil, fmt.Errorf("invalid compressed block size %v, "+
+			"expected %v: %w", len(plain), size, EBADMSG)
+	}
+	return plain, nil
+}
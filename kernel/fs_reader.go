@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Reader implements random access reads of encrypted files. Each
+// block has its own nonce and AAD so the Reader decrypts only the
+// blocks containing the requested range. The Reader needs the
+// plaintext file key so it is meant for tools which hold the key; the
+// kernel nodes only have key shares and the programs decrypt the
+// blocks in MPC. The Reader also decompresses the blocks of files
+// with the FileFlagCompressed flag.
+type Reader struct {
+	m     sync.Mutex
+	r     io.ReaderAt
+	hdr   *FileHeader
+	aead  cipher.AEAD
+	ofs   int64
+	block int64
+	buf   []byte
+	plain []byte
+
+	// Record offsets of the blocks of compressed files.
+	records []int64
+}
+
+var (
+	_ io.ReaderAt   = &Reader{}
+	_ io.ReadSeeker = &Reader{}
+)
+
+// NewReader creates a new Reader for the encrypted file r with the
+// header hdr. The r reads the file from its beginning, including the
+// file header.
+func NewReader(r io.ReaderAt, hdr *FileHeader, key []byte) (*Reader, error) {
+	if hdr.BlockSize <= TagSize || hdr.PlainSize < 0 {
+		return nil, EINVAL
+	}
+	aead, err := hdr.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if aead.Overhead() != TagSize {
+		return nil, fmt.Errorf("invalid tag size %v: %w", aead.Overhead(),
+			EINVAL)
+	}
+	return &Reader{
+		r:     r,
+		hdr:   hdr,
+		aead:  aead,
+		block: -1,
+		buf:   make([]byte, hdr.BlockSize),
+	}, nil
+}
+
+// ReadAt implements io.ReaderAt. The offset is a plaintext position.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.readAt(p, off)
+}
+
+func (r *Reader) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, EINVAL
+	}
+	psize := int64(r.hdr.BlockSize) - TagSize
+
+	var n int
+	for n < len(p) && off < r.hdr.PlainSize {
+		block := off / psize
+		plain, err := r.readBlock(block)
+		if err != nil {
+			return n, err
+		}
+		l := copy(p[n:], plain[off-block*psize:])
+		n += l
+		off += int64(l)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readBlock reads and decrypts the block. The function caches the
+// last decrypted block.
+func (r *Reader) readBlock(block int64) ([]byte, error) {
+	if block == r.block {
+		return r.plain, nil
+	}
+	r.block = -1
+
+	bsize := int64(r.hdr.BlockSize)
+	psize := bsize - TagSize
+	plainSize := min(psize, r.hdr.PlainSize-block*psize)
+	size := plainSize + TagSize
+	start := int64(r.hdr.Size()) + block*bsize
+
+	compressed := r.hdr.Flags&FileFlagCompressed != 0
+	if compressed {
+		var err error
+		start, size, err = r.record(block)
+		if err != nil {
+			return nil, fmt.Errorf("block %v: %w", block, err)
+		}
+		if size < TagSize+1 || size > bsize+1 {
+			return nil, fmt.Errorf("block %v: invalid record size %v: %w",
+				block, size, EBADMSG)
+		}
+		if size > int64(len(r.buf)) {
+			r.buf = make([]byte, size)
+		}
+	}
+
+	buf := r.buf[:size]
+	err := readFull(r.r, buf, start)
+	if err != nil {
+		return nil, err
+	}
+	nonce := r.hdr.blockNonce(block)
+	aad := r.hdr.blockAAD(block)
+	plain, err := r.aead.Open(buf[:0], nonce[:], buf, aad[:])
+	if err != nil {
+		return nil, fmt.Errorf("block %v: %w", block, err)
+	}
+	if compressed {
+		plain, err = decompressBlock(plain, int(plainSize))
+		if err != nil {
+			return nil, fmt.Errorf("block %v: %w", block, err)
+		}
+	}
+	r.block = block
+	r.plain = plain
+
+	return plain, nil
+}
+
+// record returns the file offset and the ciphertext size of the
+// compressed block. The records are located by walking the record
+// headers from the last known record.
+func (r *Reader) record(block int64) (int64, int64, error) {
+	if len(r.records) == 0 {
+		r.records = append(r.records, int64(r.hdr.Size()))
+	}
+	size := func(ofs int64) (int64, error) {
+		var hdr [CompressedRecordHdrSize]byte
+		err := readFull(r.r, hdr[:], ofs)
+		if err != nil {
+			return 0, err
+		}
+		return int64(bo.Uint32(hdr[:])), nil
+	}
+	for int64(len(r.records)) <= block {
+		ofs := r.records[len(r.records)-1]
+		n, err := size(ofs)
+		if err != nil {
+			return 0, 0, err
+		}
+		r.records = append(r.records, ofs+CompressedRecordHdrSize+n)
+	}
+	ofs := r.records[block]
+	n, err := size(ofs)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ofs + CompressedRecordHdrSize, n, nil
+}
+
+// readFull reads len(buf) bytes from r at offset ofs.
+func readFull(r io.ReaderAt, buf []byte, ofs int64) error {
+	n, err := r.ReadAt(buf, ofs)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	n, err := r.readAt(p, r.ofs)
+	r.ofs += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker. The offsets are plaintext positions.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.ofs
+	case io.SeekEnd:
+		offset += r.hdr.PlainSize
+	default:
+		return 0, EINVAL
+	}
+	if offset < 0 {
+		return 0, EINVAL
+	}
+	r.ofs = offset
+	return offset, nil
+}
+
+// blockNonce returns the nonce of the block: the header's random
+// nonce XORed with the 64-bit big-endian block number in its last 8
+// bytes.
+func (hdr *FileHeader) blockNonce(block int64) [12]byte {
+	nonce := hdr.Nonce
+	var seq [8]byte
+	bo.PutUint64(seq[:], uint64(block))
+	for i := 0; i < len(seq); i++ {
+		nonce[4+i] ^= seq[i]
+	}
+	return nonce
+}
+
+// blockAAD returns the additional authenticated data of the block.
+func (hdr *FileHeader) blockAAD(block int64) [14]byte {
+	var aad [14]byte
+	bo.PutUint32(aad[0:], uint32(block))
+	bo.PutUint64(aad[4:], uint64(hdr.PlainSize))
+	bo.PutUint16(aad[12:], uint16(hdr.Flags))
+	return aad
+}
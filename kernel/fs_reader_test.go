@@ -0,0 +1,150 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encryptTestFile(t *testing.T, hdr *FileHeader, key, data []byte) []byte {
+	aead, err := hdr.NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr.PlainSize = int64(len(data))
+	file := hdr.Bytes()
+	psize := int(hdr.BlockSize) - TagSize
+	for block := 0; len(data) > 0; block++ {
+		n := min(psize, len(data))
+		nonce := hdr.blockNonce(int64(block))
+		aad := hdr.blockAAD(int64(block))
+		file = aead.Seal(file, nonce[:], data[:n], aad[:])
+		data = data[n:]
+	}
+	return file
+}
+
+func TestReader(t *testing.T) {
+	// 48 plaintext bytes per block; 10 blocks with the last block
+	// having 20 bytes.
+	data := make([]byte, 9*48+20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	key := bytes.Repeat([]byte{0x42}, 32)
+	hdr := &FileHeader{
+		Magic:     EncrFileMagic,
+		BlockSize: 64,
+		Algorithm: KeyTypeChaCha20,
+		Nonce:     [12]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+	}
+	file := encryptTestFile(t, hdr, key, data)
+
+	r, err := NewReader(bytes.NewReader(file), hdr, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		offset int64
+		size   int
+	}{
+		{0, 1},
+		{0, 48},
+		{5, 10},
+		{47, 2},
+		{48, 48},
+		{100, 200},
+		{400, 52},
+		{431, 1},
+		{432, 20},
+		{445, 100},
+		{0, len(data)},
+	}
+	for idx, test := range tests {
+		buf := make([]byte, test.size)
+		n, err := r.ReadAt(buf, test.offset)
+		end := min(test.offset+int64(test.size), int64(len(data)))
+		expected := data[test.offset:end]
+		if test.offset+int64(test.size) > int64(len(data)) {
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("test%d: got %v, expected %v", idx, err, io.EOF)
+			}
+		} else if err != nil {
+			t.Errorf("test%d: ReadAt failed: %v", idx, err)
+			continue
+		}
+		if !bytes.Equal(buf[:n], expected) {
+			t.Errorf("test%d: got %x, expected %x", idx, buf[:n], expected)
+		}
+	}
+
+	n, err := r.ReadAt(make([]byte, 10), int64(len(data)))
+	if n != 0 || !errors.Is(err, io.EOF) {
+		t.Errorf("got %v/%v, expected 0/%v", n, err, io.EOF)
+	}
+	_, err = r.ReadAt(make([]byte, 10), -1)
+	if !errors.Is(err, EINVAL) {
+		t.Errorf("got %v, expected %v", err, EINVAL)
+	}
+
+	// Seek and read.
+	ofs, err := r.Seek(-30, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ofs != int64(len(data))-30 {
+		t.Errorf("got offset %v, expected %v", ofs, len(data)-30)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, data[ofs:]) {
+		t.Errorf("got %x, expected %x", rest, data[ofs:])
+	}
+	_, err = r.Seek(100, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ofs, err = r.Seek(-50, io.SeekCurrent)
+	if err != nil || ofs != 50 {
+		t.Errorf("got %v/%v, expected 50", ofs, err)
+	}
+	_, err = r.Seek(-1, io.SeekStart)
+	if !errors.Is(err, EINVAL) {
+		t.Errorf("got %v, expected %v", err, EINVAL)
+	}
+
+	// Modified blocks fail authentication.
+	file[EncrFileHdrSize+3*64+10] ^= 0x80
+	r, err = NewReader(bytes.NewReader(file), hdr, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.ReadAt(make([]byte, 10), 2*48)
+	if err != nil {
+		t.Errorf("unmodified block: %v", err)
+	}
+	_, err = r.ReadAt(make([]byte, 10), 3*48)
+	if err == nil {
+		t.Errorf("modified block decrypted")
+	}
+
+	// Truncated files.
+	r, err = NewReader(bytes.NewReader(file[:len(file)-1]), hdr, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.ReadAt(make([]byte, 1), int64(len(data))-1)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+}
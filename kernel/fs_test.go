@@ -7,8 +7,16 @@
 package kernel
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
 )
 
 var pathTests = []struct {
@@ -98,3 +106,600 @@ func TestPaths(t *testing.T) {
 func TestOpenFlags(t *testing.T) {
 	fmt.Printf("0x601 = %v\n", OpenFlag(0x601))
 }
+
+func TestFileStat(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(file, make([]byte, 100), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := &FDFile{
+		f: f,
+	}
+	defer fd.Close()
+
+	fi, err := fd.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fi.Bytes()) != 16 {
+		t.Errorf("got %v bytes, expected 16", len(fi.Bytes()))
+	}
+	if fi.Size != 100 {
+		t.Errorf("got size %v, expected 100", fi.Size)
+	}
+
+	// Encrypted files report the plaintext size.
+	fd.hdr = &FileHeader{
+		Magic:     EncrFileMagic,
+		BlockSize: 64,
+		PlainSize: 42,
+	}
+	fi, err = fd.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := fi.Bytes()
+	if len(buf) != 32 {
+		t.Errorf("got %v bytes, expected 32", len(buf))
+	}
+	size := bo.Uint64(buf)
+	if size != 42 {
+		t.Errorf("got size %v, expected 42", size)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	dir := t.TempDir()
+
+	// Plaintext files.
+	file := filepath.Join(dir, "plain")
+	err := os.WriteFile(file, []byte("Hello, world!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = truncatePath(file, RootUID, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = truncatePath(file, RootUID, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte("Hello\x00\x00\x00")
+	if !bytes.Equal(data, expected) {
+		t.Errorf("got %q, expected %q", data, expected)
+	}
+	err = truncatePath(file, RootUID, -1)
+	if !errors.Is(err, EINVAL) {
+		t.Errorf("got %v, expected %v", err, EINVAL)
+	}
+
+	// Encrypted files.
+	hdr := &FileHeader{
+		Magic:     EncrFileMagic,
+		BlockSize: 64,
+		PlainSize: 42,
+	}
+	file = filepath.Join(dir, "encrypted")
+	err = os.WriteFile(file, append(hdr.Bytes(), make([]byte, 100)...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = truncatePath(file, RootUID, 10)
+	if !errors.Is(err, EOPNOTSUPP) {
+		t.Errorf("got %v, expected %v", err, EOPNOTSUPP)
+	}
+	err = truncatePath(file, RootUID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != EncrFileHdrSize {
+		t.Fatalf("got %v bytes, expected %v", len(data), EncrFileHdrSize)
+	}
+	nhdr, err := NewFileHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nhdr.PlainSize != 0 {
+		t.Errorf("got plain size %v, expected 0", nhdr.PlainSize)
+	}
+	if nhdr.Nonce == hdr.Nonce {
+		t.Errorf("nonce not changed")
+	}
+}
+
+func TestFtruncate(t *testing.T) {
+	c0, c1, _ := p2ptest.Pipe()
+
+	hdr := &FileHeader{
+		Magic:     EncrFileMagic,
+		BlockSize: 64,
+		PlainSize: 42,
+	}
+	file := filepath.Join(t.TempDir(), "encrypted")
+	err := os.WriteFile(file, append(hdr.Bytes(), make([]byte, 100)...),
+		0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fhdr := *hdr
+	fd := NewFD(&FDFile{
+		f:   f,
+		hdr: &fhdr,
+	})
+	defer fd.Close()
+
+	garbler := &Process{
+		kern: newTestKernel(t, nil),
+		role: RoleGarbler,
+		conn: c0,
+		fds: map[int32]*FD{
+			3: fd,
+		},
+	}
+	evaluator := &Process{
+		kern: newTestKernel(t, nil),
+		role: RoleEvaluator,
+		conn: c1,
+	}
+
+	ftruncate := func(size int32) (*syscall, *syscall) {
+		gsys := &syscall{
+			call: SysFtruncate,
+			arg0: 3,
+			arg1: size,
+		}
+		esys := &syscall{
+			call: SysFtruncate,
+			arg0: 3,
+			arg1: size,
+		}
+		var gerr, eerr error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			gerr = garbler.syscall(gsys)
+		})
+		wg.Go(func() {
+			eerr = evaluator.syscall(esys)
+		})
+		wg.Wait()
+		if gerr != nil || eerr != nil {
+			t.Fatalf("ftruncate: garbler=%v, evaluator=%v", gerr, eerr)
+		}
+		return gsys, esys
+	}
+
+	gsys, esys := ftruncate(10)
+	if gsys.arg0 != int32(-EOPNOTSUPP) || esys.arg0 != int32(-EOPNOTSUPP) {
+		t.Errorf("ftruncate: got %v/%v, expected %v",
+			gsys.arg0, esys.arg0, -EOPNOTSUPP)
+	}
+	if gsys.argBuf != nil || esys.argBuf != nil {
+		t.Errorf("ftruncate: file info returned on error")
+	}
+
+	// Both parties get the file info with the new nonce.
+	gsys, esys = ftruncate(0)
+	if gsys.arg0 != 0 || esys.arg0 != 0 {
+		t.Fatalf("ftruncate: got %v/%v, expected 0", gsys.arg0, esys.arg0)
+	}
+	if !bytes.Equal(gsys.argBuf, esys.argBuf) {
+		t.Errorf("file info: garbler=%x, evaluator=%x",
+			gsys.argBuf, esys.argBuf)
+	}
+	if int(gsys.arg1) != len(gsys.argBuf) ||
+		int(esys.arg1) != len(esys.argBuf) {
+		t.Errorf("file info size: got %v/%v, expected %v",
+			gsys.arg1, esys.arg1, len(gsys.argBuf))
+	}
+	info := gsys.argBuf
+	if len(info) != 32 {
+		t.Fatalf("file info: got %v bytes, expected 32", len(info))
+	}
+	if size := bo.Uint64(info); size != 0 {
+		t.Errorf("file info: got size %v, expected 0", size)
+	}
+	if !bytes.Equal(info[20:], fhdr.Nonce[:]) {
+		t.Errorf("file info: got nonce %x, expected %x",
+			info[20:], fhdr.Nonce[:])
+	}
+	if fhdr.Nonce == hdr.Nonce {
+		t.Errorf("nonce not changed")
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	tests := []struct {
+		blockSize uint16
+		plainSize int64
+		err       error
+	}{
+		{1024, 100, nil},
+		{TagSize + 1, 0, nil},
+		{TagSize, 0, EINVAL},
+		{8, 0, EINVAL},
+		{0, 0, EINVAL},
+		{1024, -1, EINVAL},
+	}
+	for idx, test := range tests {
+		hdr := &FileHeader{
+			Magic:     EncrFileMagic,
+			BlockSize: test.blockSize,
+			Algorithm: KeyTypeChaCha20,
+			PlainSize: test.plainSize,
+		}
+		nhdr, err := NewFileHeader(hdr.Bytes())
+		if !errors.Is(err, test.err) {
+			t.Errorf("test%d: got %v, expected %v", idx, err, test.err)
+			continue
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), "invalid") {
+				t.Errorf("test%d: error %q is not descriptive", idx, err)
+			}
+			continue
+		}
+		if *nhdr != *hdr {
+			t.Errorf("test%d: got %v, expected %v", idx, nhdr, hdr)
+		}
+	}
+}
+
+var getcwdTests = []struct {
+	cwd    string
+	size   int32
+	result int32
+}{
+	{
+		cwd:    "/",
+		size:   0,
+		result: 1,
+	},
+	{
+		cwd:    "/static",
+		size:   0,
+		result: 7,
+	},
+	{
+		cwd:    "/static",
+		size:   7,
+		result: 7,
+	},
+	{
+		cwd:    "/static",
+		size:   6,
+		result: int32(-ERANGE),
+	},
+	{
+		cwd:    "/static",
+		size:   -1,
+		result: int32(-EINVAL),
+	},
+}
+
+func TestGetcwd(t *testing.T) {
+	proc := &Process{}
+
+	for idx, test := range getcwdTests {
+		proc.cwd = test.cwd
+		sys := &syscall{
+			call: SysGetcwd,
+			arg0: test.size,
+		}
+		proc.getcwd(sys)
+		if sys.arg0 != test.result {
+			t.Errorf("test%d: got %v, expected %v", idx, sys.arg0, test.result)
+			continue
+		}
+		if sys.arg0 > 0 && string(sys.argBuf) != test.cwd {
+			t.Errorf("test%d: got %q, expected %q", idx, sys.argBuf, test.cwd)
+		}
+	}
+}
+
+func TestStatfs(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "etc"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(os.TempDir(), filepath.Join(dir, "tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c0, c1, _ := p2ptest.Pipe()
+
+	var kern Kernel
+	kern.params.Filesystem = dir
+
+	garbler := &Process{
+		kern: &kern,
+		role: RoleGarbler,
+		conn: c0,
+		root: "/",
+		cwd:  "/",
+	}
+	evaluator := &Process{
+		kern: &kern,
+		role: RoleEvaluator,
+		conn: c1,
+		root: "/",
+		cwd:  "/",
+	}
+
+	statfs := func(path string) (*syscall, *syscall) {
+		gsys := &syscall{
+			call:   SysStatfs,
+			argBuf: []byte(path),
+			arg1:   int32(len(path)),
+		}
+		esys := &syscall{
+			call: SysStatfs,
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.statfs(gsys)
+		})
+		wg.Go(func() {
+			evaluator.statfs(esys)
+		})
+		wg.Wait()
+		return gsys, esys
+	}
+
+	tests := []struct {
+		path  string
+		errno Errno
+	}{
+		{"/", 0},
+		{"etc", 0},
+		{"/etc/../etc", 0},
+		{"missing", ENOENT},
+		{"tmp", ENOENT},
+		{"", EINVAL},
+	}
+	for _, test := range tests {
+		g, e := statfs(test.path)
+		if test.errno != 0 {
+			if g.arg0 != -int32(test.errno) || e.arg0 != -int32(test.errno) {
+				t.Errorf("%q: got %v/%v, expected %v", test.path,
+					g.arg0, e.arg0, -int32(test.errno))
+			}
+			continue
+		}
+		if g.arg0 != StatfsSize || e.arg0 != StatfsSize {
+			t.Errorf("%q: got %v/%v, expected %v", test.path,
+				g.arg0, e.arg0, StatfsSize)
+			continue
+		}
+		if !bytes.Equal(g.argBuf, e.argBuf) {
+			t.Errorf("%q: garbler %x, evaluator %x", test.path,
+				g.argBuf, e.argBuf)
+		}
+		total := bo.Uint64(g.argBuf[0:])
+		free := bo.Uint64(g.argBuf[8:])
+		if total == 0 || free > total {
+			t.Errorf("%q: got total=%v, free=%v", test.path, total, free)
+		}
+	}
+}
+
+func TestOpenMkdirUnlink(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "motd"), []byte("Hello!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	err = os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(outside, filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(outside, "secret"),
+		filepath.Join(dir, "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c0, c1, _ := p2ptest.Pipe()
+
+	var kern Kernel
+	kern.params.Filesystem = dir
+
+	garbler := &Process{
+		kern: &kern,
+		role: RoleGarbler,
+		conn: c0,
+		root: "/",
+		cwd:  "/",
+		fds:  make(map[int32]*FD),
+	}
+	evaluator := &Process{
+		kern: &kern,
+		role: RoleEvaluator,
+		conn: c1,
+		root: "/",
+		cwd:  "/",
+		fds:  make(map[int32]*FD),
+	}
+
+	open := func(path string, flags OpenFlag) int32 {
+		sys := &syscall{
+			call:   SysOpen,
+			arg0:   int32(flags),
+			argBuf: []byte(path),
+			arg1:   int32(len(path)),
+		}
+		var efd int
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.open(sys)
+		})
+		wg.Go(func() {
+			var err error
+			efd, err = evaluator.recvFD()
+			if err != nil {
+				efd = int(mapError(err))
+			}
+		})
+		wg.Wait()
+		if int32(efd) != sys.arg0 {
+			t.Errorf("open(%q): evaluator got %v, expected %v", path, efd,
+				sys.arg0)
+		}
+		return sys.arg0
+	}
+	fsop := func(call Syscall, path string) int32 {
+		gsys := &syscall{
+			call:   call,
+			argBuf: []byte(path),
+			arg1:   int32(len(path)),
+		}
+		esys := &syscall{
+			call: call,
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.mkdir(gsys)
+		})
+		wg.Go(func() {
+			evaluator.mkdir(esys)
+		})
+		wg.Wait()
+		if gsys.arg0 != esys.arg0 {
+			t.Errorf("%v(%q): got %v/%v", call, path, gsys.arg0, esys.arg0)
+		}
+		return gsys.arg0
+	}
+
+	openTests := []struct {
+		path  string
+		flags OpenFlag
+		errno Errno
+	}{
+		{"motd", ReadOnly, 0},
+		{"/../../motd", ReadOnly, 0},
+		{"missing", ReadOnly, ENOENT},
+		{"out/secret", ReadOnly, EACCES},
+		{"secret", ReadOnly, EACCES},
+		{"out/new", WriteOnly | Create, EACCES},
+		{"new", WriteOnly | Create, 0},
+		{"new", WriteOnly | Create | Encrypt, EINVAL},
+		{"", ReadOnly, EINVAL},
+	}
+	for _, test := range openTests {
+		fd := open(test.path, test.flags)
+		if test.errno != 0 {
+			if fd != -int32(test.errno) {
+				t.Errorf("open(%q): got %v, expected %v", test.path, fd,
+					-int32(test.errno))
+			}
+			continue
+		}
+		if fd < 0 {
+			t.Errorf("open(%q) failed: %v", test.path, Errno(-fd))
+			continue
+		}
+		garbler.fds[fd].Close()
+		garbler.FreeFD(fd)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+		t.Errorf("open created a file outside the root")
+	}
+
+	fsTests := []struct {
+		call  Syscall
+		path  string
+		errno Errno
+	}{
+		{SysMkdir, "etc", 0},
+		{SysMkdir, "etc", EEXIST},
+		{SysMkdir, "out/etc", EACCES},
+		{SysMkdir, "missing/etc", ENOENT},
+		{SysUnlink, "etc", EISDIR},
+		{SysUnlink, "new", 0},
+		{SysUnlink, "new", ENOENT},
+		{SysUnlink, "out/secret", EACCES},
+		{SysUnlink, "secret", 0},
+		{SysUnlink, "", EINVAL},
+	}
+	for _, test := range fsTests {
+		ret := fsop(test.call, test.path)
+		if ret != -int32(test.errno) {
+			t.Errorf("%v(%q): got %v, expected %v", test.call, test.path,
+				ret, -int32(test.errno))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "secret")); err != nil {
+		t.Errorf("unlink removed the symbolic link target: %v", err)
+	}
+}
+
+func TestFileHeaderChecksum(t *testing.T) {
+	hdr := &FileHeader{
+		Magic:     EncrFileMagicCRC,
+		BlockSize: 1024,
+		Algorithm: KeyTypeChaCha20,
+		PlainSize: 100,
+		Nonce:     [12]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+		Owner:     1000,
+		Mode:      0600,
+	}
+	data := hdr.Bytes()
+	if len(data) != EncrFileMaxHdrSize {
+		t.Fatalf("got %v bytes, expected %v", len(data), EncrFileMaxHdrSize)
+	}
+	nhdr, err := ReadFileHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *nhdr != *hdr {
+		t.Errorf("got %v, expected %v", nhdr, hdr)
+	}
+	if nhdr.Version() != EncrFileVersion {
+		t.Errorf("got version %v, expected %v", nhdr.Version(),
+			EncrFileVersion)
+	}
+
+	// Bit-flipped headers.
+	for i := 4; i < len(data); i++ {
+		corrupt := bytes.Clone(data)
+		corrupt[i] ^= 0x10
+		_, err := NewFileHeader(corrupt)
+		if !errors.Is(err, EBADMSG) {
+			t.Errorf("byte %v: got %v, expected %v", i, err, EBADMSG)
+		}
+	}
+
+	// Future version.
+	future := bytes.Clone(data)
+	bo.PutUint32(future, EncrFileMagicCRC+1)
+	_, err = ReadFileHeader(bytes.NewReader(future))
+	if !errors.Is(err, ENOEXEC) {
+		t.Errorf("future version: got %v, expected %v", err, ENOEXEC)
+	} else if !strings.Contains(err.Error(), "version") {
+		t.Errorf("error %q does not describe the version", err)
+	}
+}
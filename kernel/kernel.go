@@ -9,10 +9,13 @@ package kernel
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"slices"
 	"sync"
 
+	"github.com/markkurossi/ephemelier/crypto/spdz"
 	"github.com/markkurossi/ephemelier/eef"
 	"github.com/markkurossi/mpc/env"
 	"github.com/markkurossi/mpc/ot"
@@ -86,22 +89,89 @@ type Params struct {
 	Stdout      *FD
 	Stderr      *FD
 	MPCConfig   *env.Config
+
+	// ProgramCacheSize specifies how many parsed programs the kernel
+	// caches. The value 0 disables the program cache.
+	ProgramCacheSize int
+
+	// MaxProcMem specifies the maximum size of the process' in-memory
+	// files in bytes. The value 0 disables the limit.
+	MaxProcMem int
+
+	// AllowCIDRs specify the client IP prefixes the listening
+	// programs accept connections from. If the list is empty, all
+	// connections are accepted.
+	AllowCIDRs []string
+
+	// PortCipher specifies the cipher for encrypting the messages
+	// between the processes' ports.
+	PortCipher PortCipher
+
+	// OT specifies the base OT protocol for the circuit evaluation
+	// and SPDZ triple generation. Both nodes must use the same
+	// protocol.
+	OT spdz.OTType
+
+	// MaxProcesses specifies the maximum number of live processes.
+	// The value 0 disables the limit.
+	MaxProcesses int
+
+	// MaxFDs specifies the maximum number of open file descriptors
+	// per process. The value 0 disables the limit.
+	MaxFDs int
+
+	// MaxMem specifies the maximum size of the program memory in
+	// bytes. The garbler kills the process if its program returns a
+	// larger memory. The value 0 disables the limit.
+	MaxMem int
+
+	// TraceWriter specifies the writer for the trace and diagnostics
+	// output. If nil, the output is written to os.Stderr.
+	TraceWriter io.Writer
+
+	// TraceFormat specifies the ktrace output format. The TraceJSON
+	// format writes one JSON object per line.
+	TraceFormat TraceFormat
+
+	// TriplePool specifies the SPDZ triple pool file for the point
+	// additions. The MAC key share of the pool is read from the file
+	// with the .key suffix and its consumption state from the file
+	// with the .used suffix. The pools of the nodes must be generated
+	// together with the triples command. If the pool is not set or it
+	// runs out of triples, the processes generate the triples.
+	TriplePool string
+
+	// UID specifies the user identity of the processes. The file
+	// permissions of the encrypted files are checked against the
+	// identity; RootUID bypasses the checks.
+	UID UID
 }
 
 // Kernel implements the Ephemelier kernel.
 type Kernel struct {
 	m            sync.Mutex
+	traceM       sync.Mutex
 	params       Params
 	nextPID      PartyID
 	processes    map[PartyID]*Process
+	live         int
+	stateStats   map[StateKey]*StateStats
 	processPorts map[PartyID]*Port
+	programs     *programCache
+	acl          *acl
+	triples      *triplePool
+	drained      chan struct{}
+	drainOnce    sync.Once
 }
 
-// New creates a new kernel.
-func New(params *Params) *Kernel {
+// New creates a new kernel. The function returns an error if the
+// parameters are invalid.
+func New(params *Params) (*Kernel, error) {
 	kern := &Kernel{
 		processes:    make(map[PartyID]*Process),
 		processPorts: make(map[PartyID]*Port),
+		stateStats:   make(map[StateKey]*StateStats),
+		drained:      make(chan struct{}),
 	}
 	if params != nil {
 		kern.params = *params
@@ -109,37 +179,91 @@ func New(params *Params) *Kernel {
 	if kern.params.MPCConfig == nil {
 		kern.params.MPCConfig = &env.Config{}
 	}
-	return kern
+	kern.programs = newProgramCache(kern.params.ProgramCacheSize)
+
+	var err error
+	kern.acl, err = newACL(kern.params.AllowCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AllowCIDRs: %w", err)
+	}
+	if len(kern.params.TriplePool) > 0 {
+		kern.triples, err = loadTriplePool(kern.params.TriplePool)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TriplePool: %w", err)
+		}
+	}
+	return kern, nil
+}
+
+// LoadProgram loads the program from the file. The program is
+// returned from the program cache if the cache is enabled and the
+// program file has not been modified since it was cached.
+func (kern *Kernel) LoadProgram(file string) (*eef.Program, error) {
+	return kern.programs.Load(file)
+}
+
+// PurgeProgramCache removes all programs from the program cache. The
+// programs are reloaded from their files on next use.
+func (kern *Kernel) PurgeProgramCache() {
+	kern.programs.Purge()
 }
 
-// Evaluator runs the evaluator with the stdio FDs.
+// Evaluator runs the evaluator with the stdio FDs. When the kernel
+// is drained, Evaluator stops accepting new MPC connections, waits
+// for the running processes to exit, and returns nil.
 func (kern *Kernel) Evaluator(stdin, stdout, stderr *FD) error {
 	listener, err := net.Listen("tcp", kern.params.Port)
 	if err != nil {
 		return err
 	}
 	log.Printf("Listening for MPC connections at %s", kern.params.Port)
+
+	go func() {
+		<-kern.Drained()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if kern.Draining() {
+				wg.Wait()
+				return nil
+			}
 			return err
 		}
 		log.Printf("New MPC connection from %s", conn.RemoteAddr())
 
 		proc, err := kern.CreateProcess(p2p.NewConn(conn), RoleEvaluator, nil,
 			stdin.Copy(), stdout.Copy(), stderr.Copy())
+		if err == EPROCLIM {
+			log.Printf("Process limit reached, rejecting %s",
+				conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
 		if err != nil {
 			return err
 		}
-		go proc.Run()
+		wg.Go(func() {
+			proc.Run()
+		})
 	}
 }
 
-// Spawn creates a new process for the file, arguments, and stdio FDs.
-func (kern *Kernel) Spawn(file string, args []string,
+// Spawn creates a new process for the file, arguments, environment,
+// and stdio FDs. The environment variables are NAME=value strings.
+func (kern *Kernel) Spawn(file string, args, env []string,
 	stdin, stdout, stderr *FD) (*Process, error) {
 
-	prog, err := eef.NewProgram(file)
+	if kern.Draining() {
+		return nil, ESHUTDOWN
+	}
+	if kern.procLimit() {
+		return nil, EPROCLIM
+	}
+	prog, err := kern.LoadProgram(file)
 	if err != nil {
 		return nil, err
 	}
@@ -155,42 +279,71 @@ func (kern *Kernel) Spawn(file string, args []string,
 		mpc.Close()
 		return nil, err
 	}
+	proc.env = slices.Clone(env)
 
 	err = proc.SetProgram(prog)
 	if err != nil {
-		mpc.Close()
+		kern.abortSpawn(proc, mpc)
 		return nil, err
 	}
 
-	// Send our pid and program name.
+	// Send our pid, program name, base OT, and program digest.
 	err = proc.conn.SendUint16(int(proc.pid.G()))
 	if err != nil {
-		mpc.Close()
+		kern.abortSpawn(proc, mpc)
 		return nil, err
 	}
 	err = proc.conn.SendString(proc.prog.Filename)
 	if err != nil {
-		mpc.Close()
+		kern.abortSpawn(proc, mpc)
+		return nil, err
+	}
+	err = proc.conn.SendByte(byte(kern.params.OT))
+	if err != nil {
+		kern.abortSpawn(proc, mpc)
+		return nil, err
+	}
+	err = proc.conn.SendData(proc.prog.Digest[:])
+	if err != nil {
+		kern.abortSpawn(proc, mpc)
 		return nil, err
 	}
 	err = proc.conn.Flush()
 	if err != nil {
-		mpc.Close()
+		kern.abortSpawn(proc, mpc)
 		return nil, err
 	}
 
-	// Receive peer pid.
+	// Receive peer pid. The evaluator returns pid 0 and the reason
+	// if it rejects the process setup.
 	eid, err := proc.conn.ReceiveUint16()
 	if err != nil {
-		mpc.Close()
+		kern.abortSpawn(proc, mpc)
 		return nil, err
 	}
+	if eid == 0 {
+		reason, err := proc.conn.ReceiveByte()
+		kern.abortSpawn(proc, mpc)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: evaluator rejected process setup: %v",
+			file, setupReject(reason))
+	}
 	proc.pid.SetE(PartyID(eid))
 
 	return proc, nil
 }
 
-// CreateProcess creates a new process.
+// abortSpawn closes the MPC connection and removes the process that
+// failed to start.
+func (kern *Kernel) abortSpawn(proc *Process, conn net.Conn) {
+	conn.Close()
+	kern.RemoveProcess(proc.pid.G())
+}
+
+// CreateProcess creates a new process. The function returns EPROCLIM
+// if the kernel has Params.MaxProcesses live processes.
 func (kern *Kernel) CreateProcess(conn *p2p.Conn, role Role, args []string,
 	stdin, stdout, stderr *FD) (*Process, error) {
 
@@ -203,22 +356,31 @@ func (kern *Kernel) CreateProcess(conn *p2p.Conn, role Role, args []string,
 	}
 
 	proc := &Process{
-		kern:    kern,
-		role:    role,
-		args:    args,
-		cwd:     "/",
-		root:    "/",
-		conn:    conn,
-		oti:     ot.NewCOT(ot.NewCO(rand), rand, false, true),
-		iostats: p2p.NewIOStats(),
-		key:     key[:],
-		fds:     make(map[int32]*FD),
+		kern:     kern,
+		role:     role,
+		args:     args,
+		cwd:      "/",
+		root:     "/",
+		conn:     conn,
+		oti:      ot.NewCOT(kern.params.OT.New(rand), rand, false, true),
+		iostats:  p2p.NewIOStats(),
+		key:      key[:],
+		fds:      make(map[int32]*FD),
+		states:   make(map[string]*StateStats),
+		priority: PrioDefault,
+		uid:      kern.params.UID,
+		stop:     make(chan struct{}),
 	}
 	proc.c = sync.NewCond(&proc.m)
 
 	var pid PartyID
 
 	kern.m.Lock()
+	if kern.procLimitLocked() {
+		kern.m.Unlock()
+		return nil, EPROCLIM
+	}
+	kern.live++
 	for {
 		kern.nextPID++
 		if kern.nextPID >= 0b1000000000000000 {
@@ -255,6 +417,24 @@ func (kern *Kernel) CreateProcess(conn *p2p.Conn, role Role, args []string,
 	return proc, nil
 }
 
+// procLimit tests if the kernel has reached its process limit.
+func (kern *Kernel) procLimit() bool {
+	kern.m.Lock()
+	defer kern.m.Unlock()
+	return kern.procLimitLocked()
+}
+
+func (kern *Kernel) procLimitLocked() bool {
+	return kern.params.MaxProcesses > 0 && kern.live >= kern.params.MaxProcesses
+}
+
+// processExited decrements the live process count.
+func (kern *Kernel) processExited() {
+	kern.m.Lock()
+	kern.live--
+	kern.m.Unlock()
+}
+
 // GetProcess gets a process by its PartyID.
 func (kern *Kernel) GetProcess(pid PartyID) (*Process, bool) {
 	kern.m.Lock()
@@ -264,22 +444,43 @@ func (kern *Kernel) GetProcess(pid PartyID) (*Process, bool) {
 	return proc, ok
 }
 
+// Interrupt delivers an interrupt to the process.
+func (kern *Kernel) Interrupt(pid PartyID) error {
+	proc, ok := kern.GetProcess(pid)
+	if !ok {
+		return ESRCH
+	}
+	proc.Interrupt()
+	return nil
+}
+
+// Kill kills the process with the signal sig.
+func (kern *Kernel) Kill(pid PartyID, sig int32) error {
+	proc, ok := kern.GetProcess(pid)
+	if !ok {
+		return ESRCH
+	}
+	proc.Kill(sig)
+	return nil
+}
+
 // RemoveProcess removes a process from the kernel.
 func (kern *Kernel) RemoveProcess(pid PartyID) {
 	kern.m.Lock()
-	defer kern.m.Unlock()
-
 	proc, ok := kern.processes[pid]
-	if !ok {
-		return
+	if ok {
+		delete(kern.processes, pid)
+	}
+	kern.m.Unlock()
+
+	if ok {
+		proc.SetState(SDEAD)
 	}
-	proc.SetState(SDEAD)
-	delete(kern.processes, pid)
 }
 
 // CreateProcessPort creates the process port for the PartyID.
 func (kern *Kernel) CreateProcessPort(pid PartyID, role Role) error {
-	port, err := NewPort(role)
+	port, err := NewPort(role, kern.params.PortCipher)
 	if err != nil {
 		return err
 	}
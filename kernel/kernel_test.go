@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -7,7 +7,15 @@
 package kernel
 
 import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
 )
 
 func TestSyscall(t *testing.T) {
@@ -17,6 +25,88 @@ func TestSyscall(t *testing.T) {
 	if SysChroot != 22 {
 		t.Errorf("SysChroot=%v, expected 22", int(SysChroot))
 	}
+	if SysTlsinfo != 24 {
+		t.Errorf("SysTlsinfo=%v, expected 24", int(SysTlsinfo))
+	}
+	if SysFstat != 25 {
+		t.Errorf("SysFstat=%v, expected 25", int(SysFstat))
+	}
+	if SysPause != 26 {
+		t.Errorf("SysPause=%v, expected 26", int(SysPause))
+	}
+	if SysFtruncate != 28 {
+		t.Errorf("SysFtruncate=%v, expected 28", int(SysFtruncate))
+	}
+	if SysClockNanosleep != 29 {
+		t.Errorf("SysClockNanosleep=%v, expected 29", int(SysClockNanosleep))
+	}
+	if SysMemfd != 30 {
+		t.Errorf("SysMemfd=%v, expected 30", int(SysMemfd))
+	}
+	if SysSendfile != 31 {
+		t.Errorf("SysSendfile=%v, expected 31", int(SysSendfile))
+	}
+	if SysGetpriority != 32 {
+		t.Errorf("SysGetpriority=%v, expected 32", int(SysGetpriority))
+	}
+	if SysSetpriority != 33 {
+		t.Errorf("SysSetpriority=%v, expected 33", int(SysSetpriority))
+	}
+	if SysReboot != 34 {
+		t.Errorf("SysReboot=%v, expected 34", int(SysReboot))
+	}
+	if SysGetcwd != 35 {
+		t.Errorf("SysGetcwd=%v, expected 35", int(SysGetcwd))
+	}
+	if SysConnecttls != 36 {
+		t.Errorf("SysConnecttls=%v, expected 36", int(SysConnecttls))
+	}
+	if SysWaitpid != 37 {
+		t.Errorf("SysWaitpid=%v, expected 37", int(SysWaitpid))
+	}
+	if SysGetsharedsecret != 38 {
+		t.Errorf("SysGetsharedsecret=%v, expected 38",
+			int(SysGetsharedsecret))
+	}
+	if SysTlsctl != 39 {
+		t.Errorf("SysTlsctl=%v, expected 39", int(SysTlsctl))
+	}
+	if SysShmwrite != 42 {
+		t.Errorf("SysShmwrite=%v, expected 42", int(SysShmwrite))
+	}
+	if SysStatfs != 43 {
+		t.Errorf("SysStatfs=%v, expected 43", int(SysStatfs))
+	}
+	if SysPwrite != 45 {
+		t.Errorf("SysPwrite=%v, expected 45", int(SysPwrite))
+	}
+	if SysReaddir != 48 {
+		t.Errorf("SysReaddir=%v, expected 48", int(SysReaddir))
+	}
+	if SysLseek != 49 {
+		t.Errorf("SysLseek=%v, expected 49", int(SysLseek))
+	}
+	if SysRecvfrom != 51 {
+		t.Errorf("SysRecvfrom=%v, expected 51", int(SysRecvfrom))
+	}
+	if SysClockGettime != 53 {
+		t.Errorf("SysClockGettime=%v, expected 53", int(SysClockGettime))
+	}
+	if SysDup2 != 55 {
+		t.Errorf("SysDup2=%v, expected 55", int(SysDup2))
+	}
+	if SysKill != 56 {
+		t.Errorf("SysKill=%v, expected 56", int(SysKill))
+	}
+	if SysGetenv != 57 {
+		t.Errorf("SysGetenv=%v, expected 57", int(SysGetenv))
+	}
+	if SysChmod != 58 {
+		t.Errorf("SysChmod=%v, expected 58", int(SysChmod))
+	}
+	if SysAlarm != 59 {
+		t.Errorf("SysAlarm=%v, expected 59", int(SysAlarm))
+	}
 	if SysGetport != 100 {
 		t.Errorf("SysGetport=%v, expected 100", int(SysGetport))
 	}
@@ -38,3 +128,547 @@ func TestPID(t *testing.T) {
 		t.Errorf("E: got %v, expected %v", pid.E(), eid)
 	}
 }
+
+func TestPause(t *testing.T) {
+	proc := &Process{
+		state: SRUN,
+	}
+	proc.c = sync.NewCond(&proc.m)
+
+	done := make(chan bool)
+	go func() {
+		proc.pause()
+		done <- true
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("pause returned without interrupt")
+	case <-time.After(50 * time.Millisecond):
+	}
+	proc.Interrupt()
+	<-done
+	if proc.state != SRUN {
+		t.Errorf("got state %v, expected %v", proc.state, SRUN)
+	}
+
+	// Pending interrupt wakes up the next pause immediately.
+	proc.Interrupt()
+	proc.pause()
+}
+
+// newTestKernel creates a kernel with the parameters.
+func newTestKernel(t testing.TB, params *Params) *Kernel {
+	kern, err := New(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kern
+}
+
+func TestSleep(t *testing.T) {
+	proc := &Process{
+		state: SRUN,
+	}
+	proc.c = sync.NewCond(&proc.m)
+
+	deadline := time.Now().Add(20 * time.Millisecond)
+	if proc.sleep(deadline) {
+		t.Errorf("sleep interrupted")
+	}
+	if time.Now().Before(deadline) {
+		t.Errorf("sleep returned before deadline")
+	}
+
+	// Past deadline returns immediately.
+	if proc.sleep(deadline) {
+		t.Errorf("sleep interrupted")
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- proc.sleep(time.Now().Add(time.Hour))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	proc.Interrupt()
+	if !<-done {
+		t.Errorf("sleep not interrupted")
+	}
+}
+
+func TestPriority(t *testing.T) {
+	proc := &Process{
+		priority: PrioDefault,
+	}
+	tests := []struct {
+		prio     int32
+		errno    int32
+		expected int32
+	}{
+		{PrioMax, 0, PrioMax},
+		{PrioMin, 0, PrioMin},
+		{PrioMax + 1, int32(-EINVAL), PrioMin},
+		{PrioMin - 1, int32(-EINVAL), PrioMin},
+	}
+	for _, test := range tests {
+		sys := &syscall{
+			call: SysSetpriority,
+			arg0: test.prio,
+		}
+		err := proc.syscall(sys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sys.arg0 != test.errno {
+			t.Errorf("setpriority(%v)=%v, expected %v",
+				test.prio, sys.arg0, test.errno)
+		}
+		sys = &syscall{
+			call: SysGetpriority,
+		}
+		err = proc.syscall(sys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sys.arg0 != test.expected {
+			t.Errorf("getpriority()=%v, expected %v", sys.arg0, test.expected)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	c0, c1, _ := p2ptest.Pipe()
+
+	garbler := &Process{
+		kern: newTestKernel(t, nil),
+		role: RoleGarbler,
+		conn: c0,
+		root: "/chroot",
+	}
+	evaluator := &Process{
+		kern: newTestKernel(t, nil),
+		role: RoleEvaluator,
+		conn: c1,
+		root: "/",
+		uid:  NobodyUID,
+	}
+	kern := garbler.kern
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := NewListenerFD(listener, 1)
+	defer fd.Close()
+	lfd := fd.Impl.(*FDListener)
+
+	reboot := func(howto int32) (int32, int32) {
+		gsys := &syscall{
+			call: SysReboot,
+			arg0: howto,
+		}
+		esys := &syscall{
+			call: SysReboot,
+			arg0: howto,
+		}
+		var gerr, eerr error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			gerr = garbler.syscall(gsys)
+		})
+		wg.Go(func() {
+			eerr = evaluator.syscall(esys)
+		})
+		wg.Wait()
+		if gerr != nil || eerr != nil {
+			t.Fatalf("reboot: garbler=%v, evaluator=%v", gerr, eerr)
+		}
+		return gsys.arg0, esys.arg0
+	}
+	draining := func() bool {
+		g := garbler.kern.Draining()
+		e := evaluator.kern.Draining()
+		if g != e {
+			t.Fatalf("draining: garbler=%v, evaluator=%v", g, e)
+		}
+		return g
+	}
+
+	// The garbler decides with its process identity; the
+	// evaluator's identity is not checked.
+	g, e := reboot(RebootDrain)
+	if g != int32(-EPERM) || e != int32(-EPERM) {
+		t.Errorf("chrooted reboot: got %v/%v, expected %v", g, e, -EPERM)
+	}
+	garbler.root = "/"
+	garbler.uid = NobodyUID
+	g, e = reboot(RebootDrain)
+	if g != int32(-EPERM) || e != int32(-EPERM) {
+		t.Errorf("non-root reboot: got %v/%v, expected %v", g, e, -EPERM)
+	}
+	if draining() {
+		t.Fatalf("kernel draining after denied reboot")
+	}
+
+	// Drain wakes up the blocked accept.
+	errC := make(chan error)
+	go func() {
+		_, err := lfd.AcceptUntil(kern.Drained())
+		errC <- err
+	}()
+
+	garbler.uid = RootUID
+	g, e = reboot(RebootDrain + 1)
+	if g != int32(-EINVAL) || e != int32(-EINVAL) {
+		t.Errorf("invalid reboot: got %v/%v, expected %v", g, e, -EINVAL)
+	}
+	g, e = reboot(RebootDrain)
+	if g != 0 || e != 0 {
+		t.Fatalf("reboot: got %v/%v, expected 0", g, e)
+	}
+	if !draining() {
+		t.Errorf("kernel not draining")
+	}
+	select {
+	case err = <-errC:
+		if err != ESHUTDOWN {
+			t.Errorf("accept: got %v, expected %v", err, ESHUTDOWN)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("accept not interrupted by drain")
+	}
+
+	_, err = kern.Spawn("bin/hello", nil, nil, nil, nil, nil)
+	if err != ESHUTDOWN {
+		t.Errorf("spawn: got %v, expected %v", err, ESHUTDOWN)
+	}
+
+	// Drain is idempotent.
+	kern.Drain()
+}
+
+func TestWaitpid(t *testing.T) {
+	c0, c1, rec := p2ptest.Pipe()
+
+	var pid PID
+	pid.SetG(2)
+	pid.SetE(3)
+
+	newChild := func() *Process {
+		child := &Process{
+			state: SRUN,
+		}
+		child.c = sync.NewCond(&child.m)
+		return child
+	}
+	gchild := newChild()
+	echild := newChild()
+
+	garbler := &Process{
+		kern: newTestKernel(t, nil),
+		role: RoleGarbler,
+		conn: c0,
+	}
+	garbler.kern.processes[pid.G()] = gchild
+
+	evaluator := &Process{
+		kern: newTestKernel(t, nil),
+		role: RoleEvaluator,
+		conn: c1,
+	}
+	evaluator.kern.processes[pid.E()] = echild
+
+	waitpid := func(p PID, options int32) (int32, int32) {
+		gsys := &syscall{
+			call: SysWaitpid,
+			arg0: int32(p),
+			arg1: options,
+		}
+		esys := &syscall{
+			call: SysWaitpid,
+			arg0: int32(p),
+			arg1: options,
+		}
+		var gerr, eerr error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			gerr = garbler.syscall(gsys)
+		})
+		wg.Go(func() {
+			eerr = evaluator.syscall(esys)
+		})
+		wg.Wait()
+		if gerr != nil || eerr != nil {
+			t.Fatalf("waitpid: garbler=%v, evaluator=%v", gerr, eerr)
+		}
+		return gsys.arg0, esys.arg0
+	}
+
+	// Running child. The garbler syncs the result with the
+	// evaluator.
+	g, e := waitpid(pid, WNOHANG)
+	if g != int32(-EAGAIN) || e != int32(-EAGAIN) {
+		t.Errorf("running: got %v/%v, expected %v", g, e, -EAGAIN)
+	}
+	msgs := rec.Messages()
+	if len(msgs) != 1 || msgs[0].Dir != p2ptest.P0ToP1 ||
+		len(msgs[0].Data) != 4 {
+		rec.Dump(t.Output())
+		t.Errorf("running: unexpected messages")
+	}
+	rec.Reset()
+
+	// Invalid options. Both peers fail without communication.
+	g, e = waitpid(pid, WNOHANG<<1)
+	if g != int32(-EINVAL) || e != int32(-EINVAL) {
+		t.Errorf("options: got %v/%v, expected %v", g, e, -EINVAL)
+	}
+	if len(rec.Messages()) != 0 {
+		rec.Dump(t.Output())
+		t.Errorf("options: unexpected messages")
+	}
+
+	// Exited child.
+	gchild.exitVal = 42
+	gchild.SetState(SZOMB)
+	echild.exitVal = 42
+	echild.SetState(SZOMB)
+
+	g, e = waitpid(pid, WNOHANG)
+	if g != 42 || e != 42 {
+		t.Errorf("exited: got %v/%v, expected 42", g, e)
+	}
+
+	// Reaped child.
+	g, e = waitpid(pid, WNOHANG)
+	if g != int32(-ECHILD) || e != int32(-ECHILD) {
+		t.Errorf("reaped: got %v/%v, expected %v", g, e, -ECHILD)
+	}
+}
+
+func TestProcessLimit(t *testing.T) {
+	kern := newTestKernel(t, &Params{
+		MaxProcesses: 2,
+	})
+
+	var procs []*Process
+	for i := 0; i < 2; i++ {
+		proc, err := kern.CreateProcess(nil, RoleGarbler, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		procs = append(procs, proc)
+	}
+	_, err := kern.CreateProcess(nil, RoleEvaluator, nil, nil, nil, nil)
+	if err != EPROCLIM {
+		t.Errorf("create: got %v, expected %v", err, EPROCLIM)
+	}
+	_, err = kern.Spawn("bin/hello", nil, nil, nil, nil, nil)
+	if err != EPROCLIM {
+		t.Errorf("spawn: got %v, expected %v", err, EPROCLIM)
+	}
+
+	// Exited processes do not count towards the limit.
+	procs[0].SetState(SZOMB)
+	proc, err := kern.CreateProcess(nil, RoleGarbler, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create after exit: %v", err)
+	}
+
+	// Reaping a zombie does not change the count.
+	kern.RemoveProcess(procs[0].pid.G())
+	_, err = kern.CreateProcess(nil, RoleGarbler, nil, nil, nil, nil)
+	if err != EPROCLIM {
+		t.Errorf("create after reap: got %v, expected %v", err, EPROCLIM)
+	}
+
+	// Removing a process that never ran releases its slot.
+	kern.RemoveProcess(proc.pid.G())
+	_, err = kern.CreateProcess(nil, RoleGarbler, nil, nil, nil, nil)
+	if err != nil {
+		t.Errorf("create after remove: %v", err)
+	}
+}
+
+func TestFDLimit(t *testing.T) {
+	kern := newTestKernel(t, &Params{
+		MaxFDs: 5,
+	})
+	proc, err := kern.CreateProcess(nil, RoleGarbler, nil, NewDevNullFD(),
+		NewDevNullFD(), NewDevNullFD())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The standard FDs count towards the limit.
+	for i := 3; i < 5; i++ {
+		fd := proc.AllocFD(NewMemFD(0))
+		if fd != int32(i) {
+			t.Fatalf("alloc: got %v, expected %v", fd, i)
+		}
+	}
+	memfd := NewMemFD(0)
+	fd := proc.AllocFD(memfd)
+	if fd != -int32(EMFILE) {
+		t.Fatalf("alloc past limit: got %v, expected %v", fd, -int32(EMFILE))
+	}
+	if memfd.refcount != 0 {
+		t.Errorf("rejected fd not closed: refcount %v", memfd.refcount)
+	}
+
+	// The freed FDs can be reallocated.
+	proc.FreeFD(3)
+	fd = proc.AllocFD(NewMemFD(0))
+	if fd != 3 {
+		t.Errorf("alloc after free: got %v, expected 3", fd)
+	}
+}
+
+func TestStateStats(t *testing.T) {
+	kern := newTestKernel(t, nil)
+	key := StateKey{
+		Program: "bin/hello",
+		State:   "Init",
+	}
+	kern.addStateStats(key, false, time.Millisecond)
+	kern.addStateStats(key, true, 2*time.Millisecond)
+	kern.addStateStats(key, true, 3*time.Millisecond)
+
+	stats := kern.StateStats()
+	if len(stats) != 1 {
+		t.Fatalf("got %v states, expected 1", len(stats))
+	}
+	expected := StateStats{
+		Precompiled:     1,
+		PrecompiledTime: time.Millisecond,
+		Streaming:       2,
+		StreamingTime:   5 * time.Millisecond,
+	}
+	if stats[key] != expected {
+		t.Errorf("got %v, expected %v", stats[key], expected)
+	}
+	if key.String() != "bin/hello:Init" {
+		t.Errorf("got %v, expected bin/hello:Init", key)
+	}
+}
+
+func TestProgramMismatch(t *testing.T) {
+	prog := filepath.Join(t.TempDir(), "prog")
+	err := os.MkdirAll(prog, 0755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(prog, "symtab"),
+			[]byte("const (\n\tInit = 0\n)\n"), 0644)
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(prog, "init.dmpcl"),
+			[]byte("package main\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c0, c1, _ := p2ptest.Pipe()
+	kern := newTestKernel(t, nil)
+	proc, err := kern.CreateProcess(c1, RoleEvaluator, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Garbler's process setup with a different program digest.
+	err = c0.SendUint16(1)
+	if err == nil {
+		err = c0.SendString(prog)
+	}
+	if err == nil {
+		err = c0.SendByte(byte(kern.params.OT))
+	}
+	if err == nil {
+		err = c0.SendData(make([]byte, 32))
+	}
+	if err == nil {
+		err = c0.Flush()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = proc.runEvaluator()
+	if err == nil || !strings.Contains(err.Error(), "program mismatch") {
+		t.Errorf("got %v, expected program mismatch", err)
+	}
+	eid, err := c0.ReceiveUint16()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reason, err := c0.ReceiveByte()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eid != 0 || setupReject(reason) != rejectProgram {
+		t.Errorf("got %v/%v, expected 0/%v", eid, setupReject(reason),
+			rejectProgram)
+	}
+}
+
+func TestShm(t *testing.T) {
+	proc := &Process{
+		kern: newTestKernel(t, &Params{
+			MaxProcMem: 3 * ShmMaxSize,
+		}),
+	}
+	call := func(call Syscall, arg0 int32, data []byte) *syscall {
+		sys := &syscall{
+			call:   call,
+			arg0:   arg0,
+			argBuf: data,
+			arg1:   int32(len(data)),
+		}
+		switch call {
+		case SysShmalloc:
+			proc.shmAlloc(sys)
+		case SysShmread:
+			proc.shmRead(sys)
+		case SysShmwrite:
+			proc.shmWrite(sys)
+		}
+		return sys
+	}
+
+	tests := []struct {
+		size     int32
+		expected int32
+	}{
+		{0, int32(-EINVAL)},
+		{ShmMaxSize + 1, int32(-EINVAL)},
+		{16, 1},
+		{ShmMaxSize, 2},
+		{ShmMaxSize, 3},
+		{ShmMaxSize, int32(-ENOMEM)},
+	}
+	for _, test := range tests {
+		sys := call(SysShmalloc, test.size, nil)
+		if sys.arg0 != test.expected {
+			t.Errorf("shmalloc(%v): got %v, expected %v",
+				test.size, sys.arg0, test.expected)
+		}
+	}
+
+	data := []byte("hello, world")
+	sys := call(SysShmwrite, 1, data)
+	if sys.arg0 != int32(len(data)) {
+		t.Errorf("shmwrite: got %v, expected %v", sys.arg0, len(data))
+	}
+	sys = call(SysShmwrite, 1, make([]byte, 17))
+	if sys.arg0 != int32(-ERANGE) {
+		t.Errorf("shmwrite: got %v, expected %v", sys.arg0, -ERANGE)
+	}
+	sys = call(SysShmread, 1, nil)
+	if sys.arg0 != int32(len(data)) || string(sys.argBuf) != string(data) {
+		t.Errorf("shmread: got %v %q, expected %q", sys.arg0, sys.argBuf,
+			data)
+	}
+	sys = call(SysShmread, 99, nil)
+	if sys.arg0 != int32(-EBADF) {
+		t.Errorf("shmread: got %v, expected %v", sys.arg0, -EBADF)
+	}
+}
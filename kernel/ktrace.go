@@ -7,31 +7,173 @@
 package kernel
 
 import (
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/markkurossi/ephemelier/crypto/tls"
 	"github.com/markkurossi/mpc/circuit"
 )
 
-func (proc *Process) ktracePrefix() {
+// TraceFormat defines the ktrace output formats.
+type TraceFormat int
+
+// Trace formats.
+const (
+	TraceText TraceFormat = iota
+	TraceJSON
+)
+
+var traceFormats = map[TraceFormat]string{
+	TraceText: "text",
+	TraceJSON: "json",
+}
+
+func (f TraceFormat) String() string {
+	name, ok := traceFormats[f]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{TraceFormat %d}", f)
+}
+
+// ParseTraceFormat parses the trace format name. The empty name
+// selects TraceText.
+func ParseTraceFormat(name string) (TraceFormat, error) {
+	if len(name) == 0 {
+		return TraceText, nil
+	}
+	for f, n := range traceFormats {
+		if n == name {
+			return f, nil
+		}
+	}
+	return TraceText, fmt.Errorf("unknown trace format: %s", name)
+}
+
+// ktraceRecord defines the JSON trace records. Each record is written
+// as one line. The Event specifies the record type: call, ret, info,
+// exit, debug, or error.
+type ktraceRecord struct {
+	PID       string       `json:"pid"`
+	PC        uint16       `json:"pc"`
+	Program   string       `json:"program"`
+	Event     string       `json:"event"`
+	Syscall   string       `json:"syscall,omitempty"`
+	Arg0      *int32       `json:"arg0,omitempty"`
+	Arg1      *int32       `json:"arg1,omitempty"`
+	ArgBuf    string       `json:"argBuf,omitempty"`
+	ArgBufLen int          `json:"argBufLen,omitempty"`
+	Ret       *int32       `json:"ret,omitempty"`
+	Errno     string       `json:"errno,omitempty"`
+	Exit      *int32       `json:"exit,omitempty"`
+	Stats     *ktraceUsage `json:"stats,omitempty"`
+	Message   string       `json:"message,omitempty"`
+}
+
+// ktraceUsage defines the resource usage of the JSON trace records.
+type ktraceUsage struct {
+	Gates  uint64 `json:"gates"`
+	Wires  uint64 `json:"wires"`
+	XOR    uint64 `json:"xor"`
+	NonXOR uint64 `json:"nonXOR"`
+	Utime  int64  `json:"utimeNs"`
+}
+
+func newKtraceUsage(rusage RUsage) *ktraceUsage {
+	return &ktraceUsage{
+		Gates:  rusage.NumGates,
+		Wires:  rusage.NumWires,
+		XOR:    rusage.NumXOR,
+		NonXOR: rusage.NumNonXOR,
+		Utime:  int64(rusage.Utime),
+	}
+}
+
+func (proc *Process) ktraceJSON() bool {
+	return proc.kern.params.TraceFormat == TraceJSON
+}
+
+// ktraceRecord writes the JSON trace record rec.
+func (proc *Process) ktraceRecord(rec *ktraceRecord) {
+	rec.PID = proc.pid.String()
+	rec.PC = proc.pc
+	rec.Program = proc.prog.Name
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	proc.kern.ktraceWrite(bytes.NewBuffer(append(data, '\n')))
+}
+
+// ktraceSyscall creates the JSON trace record for the syscall. The
+// argBuf is included in full if hex dumps are enabled, and its first
+// dataLimit bytes otherwise.
+func (proc *Process) ktraceSyscall(event string, sys *syscall) *ktraceRecord {
+	arg1 := sys.arg1
+	rec := &ktraceRecord{
+		Event:     event,
+		Syscall:   sys.call.String(),
+		Arg1:      &arg1,
+		ArgBufLen: len(sys.argBuf),
+	}
+	data := sys.argBuf
+	if !proc.kern.params.TraceHex && len(data) > dataLimit {
+		data = data[:dataLimit]
+	}
+	rec.ArgBuf = hex.EncodeToString(data)
+	return rec
+}
+
+// ktraceWrite writes the trace record b to the trace writer. The
+// records are written with one Write call under the trace lock so
+// the lines of concurrent processes do not interleave.
+func (kern *Kernel) ktraceWrite(b *bytes.Buffer) {
+	if b.Len() == 0 {
+		return
+	}
+	kern.traceM.Lock()
+	defer kern.traceM.Unlock()
+
+	var w io.Writer = os.Stderr
+	if kern.params.TraceWriter != nil {
+		w = kern.params.TraceWriter
+	}
+	w.Write(b.Bytes())
+}
+
+func (proc *Process) ktracePrefix(b *bytes.Buffer) {
 	if !proc.kern.params.Trace {
 		return
 	}
-	fmt.Printf("%7s %3d %-8s ", proc.pid, proc.pc, proc.prog.Name)
+	fmt.Fprintf(b, "%7s %3d %-8s ", proc.pid, proc.pc, proc.prog.Name)
 }
 
 func (proc *Process) ktraceStats(rusage RUsage) {
 	if !proc.kern.params.Trace {
 		return
 	}
-	proc.ktracePrefix()
-	fmt.Printf("INFO %v", rusage)
-	fmt.Println()
+	if proc.ktraceJSON() {
+		proc.ktraceRecord(&ktraceRecord{
+			Event: "info",
+			Stats: newKtraceUsage(rusage),
+		})
+		return
+	}
+	b := new(bytes.Buffer)
+	defer proc.kern.ktraceWrite(b)
+
+	proc.ktracePrefix(b)
+	fmt.Fprintf(b, "INFO %v", rusage)
+	fmt.Fprintln(b)
 }
 
-func (proc *Process) ktraceHex(data []byte) {
+func (proc *Process) ktraceHex(b *bytes.Buffer, data []byte) {
 	if !proc.kern.params.TraceHex {
 		return
 	}
@@ -39,8 +181,8 @@ func (proc *Process) ktraceHex(data []byte) {
 	lines := strings.Split(dump, "\n")
 
 	var separator = "    -------------------------------------------------------------------------"
-	fmt.Println()
-	fmt.Println(separator)
+	fmt.Fprintln(b)
+	fmt.Fprintln(b, separator)
 
 	for idx, line := range lines {
 		var n string
@@ -53,10 +195,10 @@ func (proc *Process) ktraceHex(data []byte) {
 			}
 		}
 		if idx+1 < len(lines) || len(n) > 0 {
-			fmt.Println(n)
+			fmt.Fprintln(b, n)
 		}
 	}
-	fmt.Print(separator)
+	fmt.Fprint(b, separator)
 }
 
 const dataLimit = 16
@@ -65,152 +207,293 @@ func (proc *Process) ktraceCall(sys *syscall) {
 	if !proc.kern.params.Trace {
 		return
 	}
+	if proc.ktraceJSON() {
+		rec := proc.ktraceSyscall("call", sys)
+		arg0 := sys.arg0
+		rec.Arg0 = &arg0
+		proc.ktraceRecord(rec)
+		return
+	}
+	b := new(bytes.Buffer)
+	defer proc.kern.ktraceWrite(b)
 
-	proc.ktracePrefix()
-	fmt.Printf("CALL %s", sys.call)
+	proc.ktracePrefix(b)
+	fmt.Fprintf(b, "CALL %s", sys.call)
 	switch sys.call {
-	case SysExit, SysClose, SysWait, SysCreatemsg, SysAccept,
-		SysTlsstatus, SysRecvfd:
-		fmt.Printf("(%d)", sys.arg0)
+	case SysExit, SysClose, SysWait, SysCreatemsg,
+		SysTlsstatus, SysTlsinfo, SysFstat, SysMemfd, SysRecvfd,
+		SysSetpriority, SysReboot, SysGetcwd, SysGetsharedsecret,
+		SysShmalloc, SysShmread, SysClockGettime, SysDup, SysAlarm:
+		fmt.Fprintf(b, "(%d)", sys.arg0)
 
 	case SysOpen:
-		fmt.Printf("(%v, ", OpenFlag(sys.arg0))
+		fmt.Fprintf(b, "(%v, ", OpenFlag(sys.arg0))
 		if sys.arg1 < 0 || int(sys.arg1) > len(sys.argBuf) {
-			fmt.Printf("%s:%d/[0-%d])", EINVAL, sys.arg1, len(sys.argBuf))
+			fmt.Fprintf(b, "%s:%d/[0-%d])", EINVAL, sys.arg1, len(sys.argBuf))
 		} else {
-			fmt.Printf("%q)", string(sys.argBuf[:sys.arg1]))
+			fmt.Fprintf(b, "%q)", string(sys.argBuf[:sys.arg1]))
 		}
 
-	case SysSpawn, SysDial, SysListen, SysChroot, SysOpenkey:
+	case SysWaitpid, SysDup2, SysKill:
+		fmt.Fprintf(b, "(%d, %d)", sys.arg0, sys.arg1)
+
+	case SysListen, SysTruncate:
+		fmt.Fprintf(b, "(%d, ", sys.arg0)
 		if sys.arg1 < 0 || int(sys.arg1) > len(sys.argBuf) {
-			fmt.Printf("(%s:%d/[0-%d])", EINVAL, sys.arg1, len(sys.argBuf))
+			fmt.Fprintf(b, "%s:%d/[0-%d])", EINVAL, sys.arg1, len(sys.argBuf))
 		} else {
-			fmt.Printf("(%q)", string(sys.argBuf[:sys.arg1]))
+			fmt.Fprintf(b, "%q)", string(sys.argBuf[:sys.arg1]))
 		}
 
-	case SysRead, SysTlsserver, SysTlsclient, SysSendfd:
-		fmt.Printf("(%d, %d)", sys.arg0, sys.arg1)
+	case SysChmod:
+		fmt.Fprintf(b, "(%v, ", FileMode(sys.arg0))
+		if sys.arg1 < 0 || int(sys.arg1) > len(sys.argBuf) {
+			fmt.Fprintf(b, "%s:%d/[0-%d])", EINVAL, sys.arg1, len(sys.argBuf))
+		} else {
+			fmt.Fprintf(b, "%q)", string(sys.argBuf[:sys.arg1]))
+		}
+
+	case SysAccept:
+		fmt.Fprintf(b, "(%d, %v)", sys.arg0, SockFlag(sys.arg1))
+
+	case SysTlsctl:
+		fmt.Fprintf(b, "(%d, %v)", sys.arg0, TLSCtl(sys.arg1))
+
+	case SysSpawn, SysDial, SysChroot, SysOpenkey, SysConnecttls,
+		SysStatfs, SysMkdir, SysUnlink, SysGetenv:
+		if sys.arg1 < 0 || int(sys.arg1) > len(sys.argBuf) {
+			fmt.Fprintf(b, "(%s:%d/[0-%d])", EINVAL, sys.arg1, len(sys.argBuf))
+		} else {
+			fmt.Fprintf(b, "(%q)", string(sys.argBuf[:sys.arg1]))
+		}
+
+	case SysRead, SysTlsserver, SysTlsclient, SysSendfd, SysFtruncate,
+		SysShmwrite, SysReaddir:
+		fmt.Fprintf(b, "(%d, %d)", sys.arg0, sys.arg1)
 
 	case SysTlshs:
 		ht := tls.HandshakeType(sys.arg1)
-		fmt.Printf("(%d, ", sys.arg0)
+		fmt.Fprintf(b, "(%d, ", sys.arg0)
 		if len(sys.argBuf) == 0 {
-			fmt.Printf("nil, %s)", ht)
+			fmt.Fprintf(b, "nil, %s)", ht)
 		} else if len(sys.argBuf) <= dataLimit {
-			fmt.Printf("%x, %s)", sys.argBuf, ht)
+			fmt.Fprintf(b, "%x, %s)", sys.argBuf, ht)
 		} else {
-			fmt.Printf("%x..., %d)", sys.argBuf[:dataLimit], ht)
-			proc.ktraceHex(sys.argBuf)
+			fmt.Fprintf(b, "%x..., %d)", sys.argBuf[:dataLimit], ht)
+			proc.ktraceHex(b, sys.argBuf)
 		}
 
 	case SysWrite:
-		fmt.Printf("(%d, ", sys.arg0)
+		fmt.Fprintf(b, "(%d, ", sys.arg0)
 		if sys.arg1 <= dataLimit {
-			fmt.Printf("%x, %d)", sys.argBuf[:sys.arg1], sys.arg1)
+			fmt.Fprintf(b, "%x, %d)", sys.argBuf[:sys.arg1], sys.arg1)
 		} else {
-			fmt.Printf("%x..., %d)", sys.argBuf[:dataLimit], sys.arg1)
-			proc.ktraceHex(sys.argBuf)
+			fmt.Fprintf(b, "%x..., %d)", sys.argBuf[:dataLimit], sys.arg1)
+			proc.ktraceHex(b, sys.argBuf)
 		}
 
 	case SysContinue, SysYield:
-		fmt.Printf("(%d)", sys.pc)
+		fmt.Fprintf(b, "(%d)", sys.pc)
+
+	case SysSendfile:
+		if sys.arg1 != 8 || len(sys.argBuf) < 8 {
+			fmt.Fprintf(b, "(%d, %s:%d/[0-%d])", sys.arg0, EINVAL, sys.arg1,
+				len(sys.argBuf))
+		} else {
+			fmt.Fprintf(b, "(%d, %d, %d)", sys.arg0, int32(bo.Uint32(sys.argBuf)),
+				bo.Uint32(sys.argBuf[4:]))
+		}
+
+	case SysPread:
+		if sys.arg1 != PreadArgSize || len(sys.argBuf) < PreadArgSize {
+			fmt.Fprintf(b, "(%d, %s:%d/[0-%d])", sys.arg0, EINVAL, sys.arg1,
+				len(sys.argBuf))
+		} else {
+			fmt.Fprintf(b, "(%d, %d, %d)", sys.arg0, bo.Uint32(sys.argBuf[8:]),
+				int64(bo.Uint64(sys.argBuf)))
+		}
+
+	case SysPwrite:
+		if sys.arg1 < PwriteArgSize || int(sys.arg1) > len(sys.argBuf) {
+			fmt.Fprintf(b, "(%d, %s:%d/[0-%d])", sys.arg0, EINVAL, sys.arg1,
+				len(sys.argBuf))
+		} else {
+			fmt.Fprintf(b, "(%d, %d, %d)", sys.arg0, sys.arg1-PwriteArgSize,
+				int64(bo.Uint64(sys.argBuf)))
+		}
+
+	case SysSendto:
+		arg, err := sys.argData()
+		if err != nil || len(arg) < 2 || 2+int(bo.Uint16(arg)) > len(arg) {
+			fmt.Fprintf(b, "(%d, %s:%d/[0-%d])", sys.arg0, EINVAL, sys.arg1,
+				len(sys.argBuf))
+		} else {
+			alen := int(bo.Uint16(arg))
+			fmt.Fprintf(b, "(%d, %q, %d)", sys.arg0, arg[2:2+alen],
+				len(arg)-2-alen)
+		}
+
+	case SysLseek:
+		if sys.arg1 != LseekArgSize || len(sys.argBuf) < LseekArgSize {
+			fmt.Fprintf(b, "(%d, %s:%d/[0-%d])", sys.arg0, EINVAL, sys.arg1,
+				len(sys.argBuf))
+		} else {
+			fmt.Fprintf(b, "(%d, %d, %d)", sys.arg0, int64(bo.Uint64(sys.argBuf)),
+				bo.Uint32(sys.argBuf[8:]))
+		}
+
+	case SysClockNanosleep:
+		if sys.arg1 != 8 || len(sys.argBuf) < 8 {
+			fmt.Fprintf(b, "(%s:%d/[0-%d])", EINVAL, sys.arg1, len(sys.argBuf))
+		} else {
+			fmt.Fprintf(b, "(%d)", bo.Uint64(sys.argBuf))
+		}
 
 	case SysNext:
-		fmt.Printf("(%d, %d, ", sys.pc, sys.arg0)
+		fmt.Fprintf(b, "(%d, %d, ", sys.pc, sys.arg0)
 		if len(sys.argBuf) <= dataLimit {
-			fmt.Printf("%x, %v)", sys.argBuf, sys.arg1)
+			fmt.Fprintf(b, "%x, %v)", sys.argBuf, sys.arg1)
 		} else {
-			fmt.Printf("%x..., %d)", sys.argBuf[:dataLimit], sys.arg1)
-			proc.ktraceHex(sys.argBuf)
+			fmt.Fprintf(b, "%x..., %d)", sys.argBuf[:dataLimit], sys.arg1)
+			proc.ktraceHex(b, sys.argBuf)
 		}
 
 	case SysGetport:
 		if sys.arg1 > 0 {
-			fmt.Printf("(%s)", sys.argBuf[:sys.arg0])
+			fmt.Fprintf(b, "(%s)", sys.argBuf[:sys.arg0])
 		} else {
-			fmt.Printf("(%s)", PID(sys.arg0))
+			fmt.Fprintf(b, "(%s)", PID(sys.arg0))
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(b)
 }
 
 func (proc *Process) ktraceRet(sys *syscall) {
 	if !proc.kern.params.Trace {
 		return
 	}
-	proc.ktracePrefix()
-	fmt.Printf("RET  %s ", sys.call)
+	if proc.ktraceJSON() {
+		rec := proc.ktraceSyscall("ret", sys)
+		ret := sys.arg0
+		rec.Ret = &ret
+		if ret < 0 {
+			rec.Errno = Errno(-ret).String()
+		}
+		proc.ktraceRecord(rec)
+		return
+	}
+	b := new(bytes.Buffer)
+	defer proc.kern.ktraceWrite(b)
+
+	proc.ktracePrefix(b)
+	fmt.Fprintf(b, "RET  %s ", sys.call)
 	if sys.arg0 < 0 {
-		fmt.Printf("%d %s", sys.arg0, Errno(-sys.arg0))
+		fmt.Fprintf(b, "%d %s", sys.arg0, Errno(-sys.arg0))
 	} else {
 		switch sys.call {
 		case SysSpawn:
-			fmt.Printf("%s", PID(sys.arg0))
+			fmt.Fprintf(b, "%s", PID(sys.arg0))
 
-		case SysRead, SysCreatemsg, SysTlsserver:
-			fmt.Printf("%d", sys.arg0)
+		case SysRead, SysCreatemsg, SysTlsserver, SysTlsinfo,
+			SysConnecttls, SysShmread, SysStatfs, SysPread, SysReaddir,
+			SysRecvfrom:
+			fmt.Fprintf(b, "%d", sys.arg0)
 			if len(sys.argBuf) > 0 {
-				proc.ktraceHex(sys.argBuf)
+				proc.ktraceHex(b, sys.argBuf)
 			} else {
-				fmt.Printf(", nil")
+				fmt.Fprintf(b, ", nil")
+			}
+
+		case SysGetcwd, SysGetenv:
+			fmt.Fprintf(b, "%d %q", sys.arg0, sys.argBuf)
+
+		case SysGettimeofday, SysClockGettime:
+			fmt.Fprintf(b, "%d", sys.arg0)
+			if len(sys.argBuf) == TimespecSize {
+				fmt.Fprintf(b, " %d.%09d", bo.Uint64(sys.argBuf),
+					bo.Uint32(sys.argBuf[8:]))
 			}
 
 		case SysTlshs:
-			fmt.Printf("%d %s", sys.arg0, tls.HandshakeType(sys.arg0))
+			fmt.Fprintf(b, "%d %s", sys.arg0, tls.HandshakeType(sys.arg0))
 			if len(sys.argBuf) > 0 {
-				fmt.Printf(", %d bytes", len(sys.argBuf))
-				proc.ktraceHex(sys.argBuf)
+				fmt.Fprintf(b, ", %d bytes", len(sys.argBuf))
+				proc.ktraceHex(b, sys.argBuf)
 			} else {
-				fmt.Printf(", nil")
+				fmt.Fprintf(b, ", nil")
 			}
 
-		case SysYield, SysNext, SysOpen:
-			fmt.Printf("%d, ", sys.arg0)
+		case SysYield, SysNext, SysOpen, SysFstat:
+			fmt.Fprintf(b, "%d, ", sys.arg0)
 			if len(sys.argBuf) == 0 {
-				fmt.Printf("nil, %d", sys.arg1)
+				fmt.Fprintf(b, "nil, %d", sys.arg1)
 			} else if len(sys.argBuf) <= dataLimit {
-				fmt.Printf("%x, %d", sys.argBuf, sys.arg1)
+				fmt.Fprintf(b, "%x, %d", sys.argBuf, sys.arg1)
 			} else {
-				fmt.Printf("%x..., %d", sys.argBuf[:dataLimit], sys.arg1)
-				proc.ktraceHex(sys.argBuf)
+				fmt.Fprintf(b, "%x..., %d", sys.argBuf[:dataLimit], sys.arg1)
+				proc.ktraceHex(b, sys.argBuf)
 			}
 
 		default:
-			fmt.Printf("%d", sys.arg0)
+			fmt.Fprintf(b, "%d", sys.arg0)
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(b)
 }
 
 func (proc *Process) ktraceExit() {
 	if !proc.kern.params.Trace {
 		return
 	}
-	proc.ktracePrefix()
-	fmt.Printf("EXIT %v\n", proc.exitVal)
+	if proc.ktraceJSON() {
+		exit := proc.exitVal
+		proc.ktraceRecord(&ktraceRecord{
+			Event: "exit",
+			Exit:  &exit,
+			Stats: newKtraceUsage(proc.rusage),
+		})
+		return
+	}
+	b := new(bytes.Buffer)
+	defer proc.kern.ktraceWrite(b)
 
-	proc.ktracePrefix()
-	fmt.Printf("RUSG utime=%v, stime=%v\n", proc.rusage.Utime,
+	proc.ktracePrefix(b)
+	fmt.Fprintf(b, "EXIT %v\n", proc.exitVal)
+
+	proc.ktracePrefix(b)
+	fmt.Fprintf(b, "RUSG utime=%v, stime=%v\n", proc.rusage.Utime,
 		proc.rusage.Stime)
 
-	proc.ktracePrefix()
-	fmt.Printf("RUSG tss=%v, spdz=%v\n", proc.rusage.TSSTime,
+	proc.ktracePrefix(b)
+	fmt.Fprintf(b, "RUSG tss=%v, spdz=%v\n", proc.rusage.TSSTime,
 		proc.rusage.SPDZTime)
 
-	proc.ktracePrefix()
-	fmt.Printf("RUSG cc=%v, stream=%v, g=%v\n", proc.rusage.CompTime,
+	if proc.spdzSession != nil {
+		stats := proc.spdzSession.Stats
+		proc.ktracePrefix(b)
+		fmt.Fprintf(b, "RUSG ot setups=%v/%v, extensions=%v\n", stats.Setups,
+			stats.SetupTime, stats.Extensions)
+	}
+
+	proc.ktracePrefix(b)
+	fmt.Fprintf(b, "RUSG cc=%v, stream=%v, g=%v\n", proc.rusage.CompTime,
 		proc.rusage.StreamTime, proc.rusage.GarbleTime)
 
-	proc.ktracePrefix()
-	fmt.Printf("RUSG g=%v, xor=%v, nxor=%v\n", proc.rusage.NumGates,
+	proc.ktracePrefix(b)
+	fmt.Fprintf(b, "RUSG g=%v, xor=%v, nxor=%v\n", proc.rusage.NumGates,
 		proc.rusage.NumXOR, proc.rusage.NumNonXOR)
 
+	for _, name := range proc.stateNames() {
+		proc.ktracePrefix(b)
+		fmt.Fprintf(b, "RUSG state %s: %v\n", name, proc.states[name])
+	}
+
 	sent := proc.iostats.Sent.Load()
 	rcvd := proc.iostats.Recvd.Load()
 	flcd := proc.iostats.Flushed.Load()
 
-	proc.ktracePrefix()
-	fmt.Printf("RUSG sent=%v, rcvd=%v, flcd=%v\n",
+	proc.ktracePrefix(b)
+	fmt.Fprintf(b, "RUSG sent=%v, rcvd=%v, flcd=%v\n",
 		circuit.FileSize(sent).String(),
 		circuit.FileSize(rcvd).String(),
 		flcd)
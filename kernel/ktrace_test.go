@@ -0,0 +1,246 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/eef"
+)
+
+func TestTraceWriter(t *testing.T) {
+	var trace bytes.Buffer
+	kern := newTestKernel(t, &Params{
+		Trace:       true,
+		Diagnostics: true,
+		TraceWriter: &trace,
+	})
+	prog := &eef.Program{
+		Name: "traced",
+	}
+
+	// Capture stdout to verify the trace does not go there.
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		proc := &Process{
+			kern: kern,
+			pid:  PID(i + 1),
+			prog: prog,
+		}
+		wg.Go(func() {
+			for j := 0; j < 50; j++ {
+				sys := &syscall{
+					call: SysClose,
+					arg0: int32(j),
+				}
+				proc.ktraceCall(sys)
+				proc.ktraceRet(sys)
+				proc.debugf("debug %d\n", j)
+			}
+		})
+	}
+	wg.Wait()
+
+	w.Close()
+	os.Stdout = stdout
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 0 {
+		t.Errorf("trace written to stdout: %q", out)
+	}
+
+	// The lines of the concurrent processes do not interleave.
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+	if len(lines) != 8*50*3 {
+		t.Fatalf("got %v lines, expected %v", len(lines), 8*50*3)
+	}
+	var calls, rets int
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 5 && fields[3] == "CALL":
+			if !strings.HasPrefix(fields[4], "close(") {
+				t.Errorf("invalid CALL line: %q", line)
+			}
+			calls++
+		case len(fields) == 6 && fields[3] == "RET":
+			if fields[4] != "close" {
+				t.Errorf("invalid RET line: %q", line)
+			}
+			rets++
+		case len(fields) == 3 && fields[0] == "traced:":
+			if fields[1] != "debug" {
+				t.Errorf("invalid debug line: %q", line)
+			}
+		default:
+			t.Errorf("invalid line: %q", line)
+		}
+	}
+	if calls != 8*50 || rets != 8*50 {
+		t.Errorf("got %v CALL and %v RET lines, expected %v", calls, rets,
+			8*50)
+	}
+	if !strings.Contains(trace.String(), fmt.Sprintf("CALL close(%d)", 49)) {
+		t.Errorf("trace does not contain the last close call")
+	}
+}
+
+func TestTraceJSON(t *testing.T) {
+	var trace bytes.Buffer
+	kern := newTestKernel(t, &Params{
+		Trace:       true,
+		TraceFormat: TraceJSON,
+		TraceWriter: &trace,
+	})
+	proc := &Process{
+		kern: kern,
+		pid:  PID(7),
+		pc:   3,
+		prog: &eef.Program{
+			Name: "traced",
+		},
+	}
+
+	data := bytes.Repeat([]byte{0xab}, 32)
+	write := &syscall{
+		call:   SysWrite,
+		arg0:   1,
+		argBuf: data,
+		arg1:   int32(len(data)),
+	}
+	proc.ktraceCall(write)
+	write.SetArg0(int32(len(data)))
+	proc.ktraceRet(write)
+
+	closeSys := &syscall{
+		call: SysClose,
+		arg0: 42,
+	}
+	proc.ktraceCall(closeSys)
+	closeSys.SetArg0(-int32(EBADF))
+	proc.ktraceRet(closeSys)
+
+	proc.ktraceStats(RUsage{
+		NumGates:  100,
+		NumWires:  200,
+		NumXOR:    60,
+		NumNonXOR: 40,
+	})
+	proc.exitVal = 0
+	proc.ktraceExit()
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(trace.String(),
+		"\n"), "\n") {
+		var rec map[string]interface{}
+		err := json.Unmarshal([]byte(line), &rec)
+		if err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		if rec["pid"] != PID(7).String() || rec["program"] != "traced" ||
+			rec["pc"] != float64(3) {
+			t.Errorf("invalid record header: %q", line)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 6 {
+		t.Fatalf("got %v records, expected 6", len(records))
+	}
+
+	tests := []map[string]interface{}{
+		{
+			"event":     "call",
+			"syscall":   "write",
+			"arg0":      float64(1),
+			"arg1":      float64(32),
+			"argBuf":    hex.EncodeToString(data[:dataLimit]),
+			"argBufLen": float64(32),
+		},
+		{
+			"event":   "ret",
+			"syscall": "write",
+			"ret":     float64(32),
+		},
+		{
+			"event":   "call",
+			"syscall": "close",
+			"arg0":    float64(42),
+		},
+		{
+			"event":   "ret",
+			"syscall": "close",
+			"ret":     float64(-int32(EBADF)),
+			"errno":   EBADF.String(),
+		},
+		{
+			"event": "info",
+		},
+		{
+			"event": "exit",
+			"exit":  float64(0),
+		},
+	}
+	for idx, test := range tests {
+		for k, v := range test {
+			if records[idx][k] != v {
+				t.Errorf("record%d: %s=%v, expected %v", idx, k,
+					records[idx][k], v)
+			}
+		}
+	}
+	stats, ok := records[4]["stats"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("info record without stats")
+	}
+	if stats["gates"] != float64(100) || stats["nonXOR"] != float64(40) {
+		t.Errorf("invalid stats: %v", stats)
+	}
+}
+
+func TestParseTraceFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected TraceFormat
+		err      bool
+	}{
+		{"", TraceText, false},
+		{"text", TraceText, false},
+		{"json", TraceJSON, false},
+		{"xml", TraceText, true},
+	}
+	for _, test := range tests {
+		f, err := ParseTraceFormat(test.name)
+		if (err != nil) != test.err {
+			t.Errorf("ParseTraceFormat(%q): got error %v", test.name, err)
+			continue
+		}
+		if f != test.expected {
+			t.Errorf("ParseTraceFormat(%q)=%v, expected %v", test.name, f,
+				test.expected)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// UID defines the identity of processes and file owners.
+type UID uint32
+
+// RootUID is the superuser identity. The processes with RootUID
+// bypass the file permission checks.
+const RootUID UID = 0
+
+// NobodyUID is the unprivileged identity the node configuration
+// assigns to processes by default.
+const NobodyUID UID = 65534
+
+// FileMode defines the permission bits of encrypted files. The bits
+// follow the Unix file modes without the group class: the owner bits
+// 0700 apply to the file owner and the other bits 0007 to all other
+// processes. The execute bits are ignored.
+type FileMode uint16
+
+// File permission bits.
+const (
+	ModeOwnerRead  FileMode = 0400
+	ModeOwnerWrite FileMode = 0200
+	ModeOtherRead  FileMode = 0004
+	ModeOtherWrite FileMode = 0002
+	ModePerm       FileMode = 0777
+)
+
+// LegacyFileMode is the permission of encrypted files whose headers
+// have no owner and permission fields. The Owner of the files is
+// RootUID so they are world-readable.
+const LegacyFileMode FileMode = 0644
+
+func (m FileMode) String() string {
+	return fmt.Sprintf("%04o", uint16(m))
+}
+
+// SetUID sets the process' user identity. The processes get their
+// initial identity from Params.UID and the spawned child processes
+// inherit the identity of their parent.
+func (proc *Process) SetUID(uid UID) {
+	proc.uid = uid
+}
+
+// UID returns the process' user identity.
+func (proc *Process) UID() UID {
+	return proc.uid
+}
+
+// Perm returns the file's permissions. The headers without the owner
+// and permission fields have the LegacyFileMode permissions.
+func (hdr *FileHeader) Perm() FileMode {
+	if hdr.Version() < 2 {
+		return LegacyFileMode
+	}
+	return hdr.Mode
+}
+
+// Access tests if the process with the identity uid can open the file
+// with the access mode of flags. The function returns EACCES if the
+// file permissions deny the access.
+func (hdr *FileHeader) Access(uid UID, flags OpenFlag) error {
+	if uid == RootUID {
+		return nil
+	}
+	mode := hdr.Perm()
+	var read, write FileMode
+	if uid == hdr.Owner {
+		read, write = ModeOwnerRead, ModeOwnerWrite
+	} else {
+		read, write = ModeOtherRead, ModeOtherWrite
+	}
+	switch flags & (WriteOnly | ReadWrite) {
+	case ReadOnly:
+		if mode&read == 0 {
+			return EACCES
+		}
+	case WriteOnly:
+		if mode&write == 0 {
+			return EACCES
+		}
+	default:
+		if mode&(read|write) != read|write {
+			return EACCES
+		}
+	}
+	return nil
+}
+
+// checkAccess checks the process' permissions for the opened file
+// with the access mode of flags. Only encrypted files carry owners and
+// permissions so the function allows all access to other files. The
+// header is read from the opened file so the check applies to the
+// file the process gets. The write-only files can't be read so their
+// headers are read from a new descriptor which must refer to the same
+// file.
+func (proc *Process) checkAccess(file *os.File, flags OpenFlag) error {
+	if flags&(WriteOnly|ReadWrite) == WriteOnly {
+		f, err := os.Open(file.Name())
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		rinfo, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if !os.SameFile(info, rinfo) {
+			return EACCES
+		}
+		file = f
+	}
+	hdr, err := ReadFileHeader(file)
+	if err != nil {
+		return nil
+	}
+	return hdr.Access(proc.uid, flags)
+}
+
+// chmod implements the chmod syscall. Only the owner of the encrypted
+// file or RootUID can change the file's permissions. Only the garbler
+// has the filesystem so it performs the operation and syncs the
+// result with the evaluator.
+func (proc *Process) chmod(sys *syscall) {
+	var result int
+	var err error
+
+	if proc.role == RoleGarbler {
+		var path string
+		path, err = sys.argString()
+		if err != nil || len(path) == 0 || FileMode(sys.arg0)&^ModePerm != 0 {
+			err = EINVAL
+		} else {
+			path, err = proc.ResolvePath(path, true)
+			if err == nil {
+				err = chmodPath(path, proc.uid, FileMode(sys.arg0))
+			}
+		}
+		if err != nil {
+			result = int(mapError(err))
+		}
+		err = proc.conn.SendUint32(result)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+}
+
+// chmodPath sets the permissions of the encrypted file at path to
+// mode. The legacy headers have no room for the permissions so their
+// permissions can't be changed.
+func chmodPath(path string, uid UID, mode FileMode) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hdr, err := ReadFileHeader(f)
+	if err != nil {
+		if errors.Is(err, ENOEXEC) {
+			return EOPNOTSUPP
+		}
+		return err
+	}
+	if hdr.Version() < 2 {
+		return EOPNOTSUPP
+	}
+	if uid != RootUID && uid != hdr.Owner {
+		return EPERM
+	}
+	hdr.Mode = mode
+	_, err = f.WriteAt(hdr.Bytes(), 0)
+	return err
+}
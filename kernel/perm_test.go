@@ -0,0 +1,286 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
+)
+
+func TestFileHeaderPerm(t *testing.T) {
+	hdr := &FileHeader{
+		Magic:     EncrFileMagicPerm,
+		BlockSize: 1024,
+		Algorithm: KeyTypeChaCha20,
+		PlainSize: 100,
+		Owner:     1000,
+		Mode:      0640,
+	}
+	data := hdr.Bytes()
+	if len(data) != EncrFileHdrSize+EncrFilePermSize {
+		t.Fatalf("got %v bytes, expected %v", len(data),
+			EncrFileHdrSize+EncrFilePermSize)
+	}
+	nhdr, err := NewFileHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *nhdr != *hdr {
+		t.Errorf("got %v, expected %v", nhdr, hdr)
+	}
+
+	// The legacy headers are world-readable.
+	legacy := &FileHeader{
+		Magic:     EncrFileMagic,
+		BlockSize: 1024,
+		Algorithm: KeyTypeChaCha20,
+	}
+	nhdr, err = NewFileHeader(legacy.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nhdr.Perm() != LegacyFileMode {
+		t.Errorf("legacy mode %v, expected %v", nhdr.Perm(), LegacyFileMode)
+	}
+
+	tests := []struct {
+		hdr   *FileHeader
+		uid   UID
+		flags OpenFlag
+		err   error
+	}{
+		{hdr, RootUID, ReadWrite, nil},
+		{hdr, 1000, ReadWrite, nil},
+		{hdr, 2000, ReadOnly, EACCES},
+		{hdr, 2000, WriteOnly, EACCES},
+		{nhdr, 2000, ReadOnly, nil},
+		{nhdr, 2000, WriteOnly, EACCES},
+		{nhdr, RootUID, ReadWrite, nil},
+	}
+	for idx, test := range tests {
+		err := test.hdr.Access(test.uid, test.flags)
+		if err != test.err {
+			t.Errorf("test%d: got %v, expected %v", idx, err, test.err)
+		}
+	}
+}
+
+// testOpen opens the file with the garbler and the evaluator
+// processes and closes the opened file. The function returns the
+// open result.
+func testOpen(t *testing.T, garbler, evaluator *Process, path string,
+	flags OpenFlag) int32 {
+
+	sys := &syscall{
+		call:   SysOpen,
+		arg0:   int32(flags),
+		argBuf: []byte(path),
+		arg1:   int32(len(path)),
+	}
+	var efd int
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		garbler.open(sys)
+	})
+	wg.Go(func() {
+		var err error
+		efd, err = evaluator.recvFD()
+		if err != nil {
+			efd = int(mapError(err))
+		}
+	})
+	wg.Wait()
+	if int32(efd) != sys.arg0 {
+		t.Errorf("open(%q): evaluator got %v, expected %v", path, efd,
+			sys.arg0)
+	}
+	if sys.arg0 >= 0 {
+		garbler.fds[sys.arg0].Close()
+		delete(garbler.fds, sys.arg0)
+		delete(evaluator.fds, sys.arg0)
+	}
+	return sys.arg0
+}
+
+func TestChmod(t *testing.T) {
+	dir := t.TempDir()
+	hdr := &FileHeader{
+		Magic:     EncrFileMagicPerm,
+		BlockSize: 1024,
+		Algorithm: KeyTypeChaCha20,
+		Owner:     1000,
+		Mode:      0600,
+	}
+	err := os.WriteFile(filepath.Join(dir, "key"), hdr.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr.Magic = EncrFileMagic
+	err = os.WriteFile(filepath.Join(dir, "legacy"), hdr.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c0, c1, _ := p2ptest.Pipe()
+
+	var kern Kernel
+	kern.params.Filesystem = dir
+
+	garbler := &Process{
+		kern: &kern,
+		role: RoleGarbler,
+		conn: c0,
+		root: "/",
+		cwd:  "/",
+		fds:  make(map[int32]*FD),
+	}
+	evaluator := &Process{
+		kern: &kern,
+		role: RoleEvaluator,
+		conn: c1,
+		root: "/",
+		cwd:  "/",
+		fds:  make(map[int32]*FD),
+	}
+
+	open := func(path string, flags OpenFlag) int32 {
+		return testOpen(t, garbler, evaluator, path, flags)
+	}
+	chmod := func(path string, mode FileMode) int32 {
+		gsys := &syscall{
+			call:   SysChmod,
+			arg0:   int32(mode),
+			argBuf: []byte(path),
+			arg1:   int32(len(path)),
+		}
+		esys := &syscall{
+			call: SysChmod,
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.chmod(gsys)
+		})
+		wg.Go(func() {
+			evaluator.chmod(esys)
+		})
+		wg.Wait()
+		if gsys.arg0 != esys.arg0 {
+			t.Errorf("chmod(%q): got %v/%v", path, gsys.arg0, esys.arg0)
+		}
+		return gsys.arg0
+	}
+
+	tests := []struct {
+		uid    UID
+		chmod  bool
+		path   string
+		flags  OpenFlag
+		mode   FileMode
+		result int32
+	}{
+		{uid: 2000, path: "key", flags: ReadOnly | Encrypt,
+			result: int32(-EACCES)},
+		{uid: 2000, path: "key", flags: ReadOnly,
+			result: int32(-EACCES)},
+		{uid: 1000, path: "key", flags: ReadWrite | Encrypt},
+		{uid: RootUID, path: "key", flags: ReadOnly | Encrypt},
+		{uid: 2000, path: "legacy", flags: ReadOnly | Encrypt},
+		{uid: 2000, path: "legacy", flags: WriteOnly | Encrypt,
+			result: int32(-EACCES)},
+		{uid: 2000, chmod: true, path: "key", mode: 0644,
+			result: int32(-EPERM)},
+		{uid: 1000, chmod: true, path: "key", mode: 01644,
+			result: int32(-EINVAL)},
+		{uid: 1000, chmod: true, path: "legacy", mode: 0644,
+			result: int32(-EOPNOTSUPP)},
+		{uid: 1000, chmod: true, path: "key", mode: 0644},
+		{uid: 2000, path: "key", flags: ReadOnly | Encrypt},
+		{uid: 2000, path: "key", flags: WriteOnly | Encrypt,
+			result: int32(-EACCES)},
+	}
+	for idx, test := range tests {
+		garbler.SetUID(test.uid)
+		evaluator.SetUID(test.uid)
+
+		var result int32
+		if test.chmod {
+			result = chmod(test.path, test.mode)
+		} else {
+			result = open(test.path, test.flags)
+			if result > 0 {
+				result = 0
+			}
+		}
+		if result != test.result {
+			t.Errorf("test%d: got %v, expected %v", idx, result, test.result)
+		}
+	}
+}
+
+func TestProcessUID(t *testing.T) {
+	dir := t.TempDir()
+	hdr := &FileHeader{
+		Magic:     EncrFileMagicPerm,
+		BlockSize: 1024,
+		Algorithm: KeyTypeChaCha20,
+		Owner:     1000,
+		Mode:      0600,
+	}
+	data := hdr.Bytes()
+	err := os.WriteFile(filepath.Join(dir, "key"), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c0, c1, _ := p2ptest.Pipe()
+
+	// The kernel assigns the process identities from the params.
+	kern := newTestKernel(t, &Params{
+		Filesystem: dir,
+		UID:        2000,
+	})
+	garbler, err := kern.CreateProcess(c0, RoleGarbler, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluator, err := kern.CreateProcess(c1, RoleEvaluator, nil, nil, nil,
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if garbler.UID() != 2000 {
+		t.Errorf("process uid %v, expected 2000", garbler.UID())
+	}
+
+	tests := []OpenFlag{
+		ReadOnly | Encrypt,
+		WriteOnly | Encrypt,
+		ReadOnly,
+		WriteOnly | Truncate,
+	}
+	for idx, flags := range tests {
+		result := testOpen(t, garbler, evaluator, "key", flags)
+		if result != int32(-EACCES) {
+			t.Errorf("test%d: got %v, expected %v", idx, result,
+				int32(-EACCES))
+		}
+	}
+
+	// The denied open does not truncate the file.
+	file, err := os.ReadFile(filepath.Join(dir, "key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(file, data) {
+		t.Errorf("file modified by denied open")
+	}
+}
@@ -0,0 +1,391 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"errors"
+	"io"
+	"math"
+)
+
+// PreadArgSize defines the size of the pread syscall argBuf. The
+// argBuf has the following big-endian fields:
+//
+//	offset uint64
+//	count  uint32
+const PreadArgSize = 12
+
+// PwriteArgSize defines the size of the pwrite syscall argBuf header.
+// The 64-bit big-endian offset is followed by the data.
+const PwriteArgSize = 8
+
+// LseekArgSize defines the size of the lseek syscall argBuf. The
+// argBuf has the following big-endian fields:
+//
+//	offset int64
+//	whence uint32
+const LseekArgSize = 12
+
+// Whence values for the lseek syscall. The values match io.SeekStart,
+// io.SeekCurrent, and io.SeekEnd.
+const (
+	SeekSet = io.SeekStart
+	SeekCur = io.SeekCurrent
+	SeekEnd = io.SeekEnd
+)
+
+// positionedIO is implemented by the FDs which support reading and
+// writing at an explicit offset without changing the FD position.
+type positionedIO interface {
+	// Pread reads up to count bytes at offset.
+	Pread(count int, offset int64) ([]byte, error)
+	// Pwrite writes data at offset and returns the number of bytes
+	// written.
+	Pwrite(data []byte, offset int64) (int, error)
+}
+
+var (
+	_ positionedIO = &FDFile{}
+	_ positionedIO = &FDMem{}
+	_ io.Seeker    = &FDFile{}
+	_ io.Seeker    = &FDMem{}
+)
+
+// Pread implements positionedIO.Pread. For encrypted files, the
+// offset and count are plaintext positions and Pread returns the
+// encrypted blocks containing the plaintext range. The program
+// decrypts the blocks with the file key; the first block's sequence
+// number is offset / (BlockSize - TagSize).
+func (fd *FDFile) Pread(count int, offset int64) ([]byte, error) {
+	if fd.hdr != nil {
+		start, end, err := fd.hdr.blockRange(offset, int64(count))
+		if err != nil {
+			return nil, err
+		}
+		offset = start
+		count = int(end - start)
+	}
+	buf := make([]byte, count)
+	n, err := fd.f.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// Pwrite implements positionedIO.Pwrite. For encrypted files, the
+// offset is a plaintext position and it must be at a block boundary.
+// The data is the re-encrypted blocks starting from the offset. Each
+// block is authenticated with the file's plaintext size so Pwrite
+// can only replace existing blocks and it can't grow the file.
+func (fd *FDFile) Pwrite(data []byte, offset int64) (int, error) {
+	if fd.hdr != nil {
+		info, err := fd.f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset, err = fd.hdr.blockWrite(offset, len(data), info.Size())
+		if err != nil {
+			return 0, err
+		}
+	}
+	return fd.f.WriteAt(data, offset)
+}
+
+// Seek implements io.Seeker. For encrypted files, the offsets are
+// plaintext positions and the new offset must be at a block boundary
+// or at the end of the file.
+func (fd *FDFile) Seek(offset int64, whence int) (int64, error) {
+	if fd.hdr == nil {
+		return fd.f.Seek(offset, whence)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		pos, err := fd.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		cur, err := fd.hdr.plainOffset(pos)
+		if err != nil {
+			return 0, err
+		}
+		offset += cur
+	case io.SeekEnd:
+		offset += fd.hdr.PlainSize
+	default:
+		return 0, EINVAL
+	}
+	pos, err := fd.hdr.fileOffset(offset)
+	if err != nil {
+		return 0, err
+	}
+	_, err = fd.f.Seek(pos, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// fileOffset maps the plaintext offset to the file offset. The offset
+// must be at a block boundary or at the end of the file.
+func (hdr *FileHeader) fileOffset(offset int64) (int64, error) {
+	bsize := int64(hdr.BlockSize)
+	psize := bsize - TagSize
+	if psize <= 0 || offset < 0 || offset > hdr.PlainSize {
+		return 0, EINVAL
+	}
+	pos := int64(hdr.Size()) + offset/psize*bsize
+	if rem := offset % psize; rem != 0 {
+		if offset != hdr.PlainSize {
+			return 0, EINVAL
+		}
+		pos += rem + TagSize
+	}
+	return pos, nil
+}
+
+// plainOffset maps the file offset to the plaintext offset. The file
+// offset must be at a block boundary or at the end of the file.
+func (hdr *FileHeader) plainOffset(pos int64) (int64, error) {
+	bsize := int64(hdr.BlockSize)
+	psize := bsize - TagSize
+	rel := pos - int64(hdr.Size())
+	if psize <= 0 || rel < 0 {
+		return 0, EINVAL
+	}
+	offset := rel / bsize * psize
+	if rem := rel % bsize; rem != 0 {
+		offset += rem - TagSize
+		if rem <= TagSize || offset != hdr.PlainSize {
+			return 0, EINVAL
+		}
+	}
+	if offset > hdr.PlainSize {
+		return 0, EINVAL
+	}
+	return offset, nil
+}
+
+// blockRange maps the plaintext range [offset, offset+count) to the
+// file range [start, end) of the encrypted blocks containing it. The
+// range is clipped to the plaintext size and an empty range is
+// returned for offsets at or after the end of the file.
+func (hdr *FileHeader) blockRange(offset, count int64) (
+	start, end int64, err error) {
+
+	bsize := int64(hdr.BlockSize)
+	psize := bsize - TagSize
+	if psize <= 0 || offset < 0 || count < 0 {
+		return 0, 0, EINVAL
+	}
+	if offset >= hdr.PlainSize || count == 0 {
+		return 0, 0, nil
+	}
+	last := min(offset+count, hdr.PlainSize) - 1
+
+	first := offset / psize
+	lastBlock := last / psize
+
+	start = int64(hdr.Size()) + first*bsize
+	end = int64(hdr.Size()) + lastBlock*bsize +
+		min(psize, hdr.PlainSize-lastBlock*psize) + TagSize
+
+	return start, end, nil
+}
+
+// blockWrite validates the encrypted block write of size bytes at the
+// plaintext offset. The fileSize is the size of the encrypted file.
+// The function returns the file offset of the write.
+func (hdr *FileHeader) blockWrite(offset int64, size int, fileSize int64) (
+	int64, error) {
+
+	bsize := int64(hdr.BlockSize)
+	psize := bsize - TagSize
+	if psize <= 0 || offset < 0 || offset%psize != 0 {
+		return 0, EINVAL
+	}
+	start := int64(hdr.Size()) + offset/psize*bsize
+	end := start + int64(size)
+	if end > fileSize {
+		return 0, EOPNOTSUPP
+	}
+	if int64(size)%bsize != 0 && end != fileSize {
+		return 0, EINVAL
+	}
+	return start, nil
+}
+
+// Pread implements positionedIO.Pread.
+func (fd *FDMem) Pread(count int, offset int64) ([]byte, error) {
+	if offset < 0 || count < 0 {
+		return nil, EINVAL
+	}
+	if offset >= int64(len(fd.buf)) {
+		return nil, nil
+	}
+	end := min(offset+int64(count), int64(len(fd.buf)))
+	buf := make([]byte, end-offset)
+	copy(buf, fd.buf[offset:end])
+	return buf, nil
+}
+
+// Pwrite implements positionedIO.Pwrite.
+func (fd *FDMem) Pwrite(data []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, EINVAL
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if offset >= int64(len(fd.buf)) {
+		return 0, ENOSPC
+	}
+	return copy(fd.buf[offset:], data), nil
+}
+
+// pread implements the pread and pwrite syscalls. The syscalls read
+// and write at an explicit offset without changing the FD position.
+// Only the garbler has the files so it performs the operation and
+// syncs the result with the evaluator. The memory files are
+// replicated in both parties and the evaluator updates its copy too.
+func (proc *Process) pread(sys *syscall) {
+	arg, err := sys.argData()
+	if err != nil {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+	var offset int64
+	var count int
+	var data []byte
+
+	switch sys.call {
+	case SysPread:
+		if len(arg) != PreadArgSize || int32(bo.Uint32(arg[8:])) < 0 {
+			sys.SetArg0(int32(-EINVAL))
+			return
+		}
+		offset = int64(bo.Uint64(arg))
+		count = int(bo.Uint32(arg[8:]))
+
+	case SysPwrite:
+		if len(arg) < PwriteArgSize {
+			sys.SetArg0(int32(-EINVAL))
+			return
+		}
+		offset = int64(bo.Uint64(arg))
+		data = arg[PwriteArgSize:]
+	}
+	if offset < 0 {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+
+	fd, ok := proc.fds[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+
+	var result int
+	var buf []byte
+
+	_, isMem := fd.Impl.(*FDMem)
+	if proc.role == RoleGarbler || isMem {
+		pio, ok := fd.Impl.(positionedIO)
+		if !ok {
+			err = ESPIPE
+		} else if sys.call == SysPread {
+			buf, err = pio.Pread(count, offset)
+			result = len(buf)
+		} else {
+			result, err = pio.Pwrite(data, offset)
+		}
+		if err != nil {
+			result = int(mapError(err))
+			buf = nil
+		}
+	}
+	if proc.role == RoleGarbler {
+		err = proc.conn.SendUint32(result)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+	if sys.call == SysPread && result > 0 {
+		sys.argBuf = buf
+	}
+}
+
+// lseek implements the lseek syscall. Only the garbler has the files
+// so it moves the file position and syncs the new offset with the
+// evaluator. The memory files are replicated in both parties and the
+// evaluator moves its position too.
+func (proc *Process) lseek(sys *syscall) {
+	arg, err := sys.argData()
+	if err != nil || len(arg) != LseekArgSize {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+	offset := int64(bo.Uint64(arg))
+	whence := int(bo.Uint32(arg[8:]))
+	if whence != SeekSet && whence != SeekCur && whence != SeekEnd {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+
+	fd, ok := proc.fds[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+
+	var result int
+
+	_, isMem := fd.Impl.(*FDMem)
+	if proc.role == RoleGarbler || isMem {
+		var pos int64
+		seeker, ok := fd.Impl.(io.Seeker)
+		if !ok {
+			err = ESPIPE
+		} else {
+			pos, err = seeker.Seek(offset, whence)
+		}
+		if err == nil && pos > math.MaxInt32 {
+			err = EOVERFLOW
+		}
+		if err != nil {
+			result = int(mapError(err))
+		} else {
+			result = int(pos)
+		}
+	}
+	if proc.role == RoleGarbler {
+		err = proc.conn.SendUint32(result)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+}
@@ -0,0 +1,374 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
+)
+
+func TestPreadPwrite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data")
+	err := os.WriteFile(file, []byte("Hello, world!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := NewFileFD(f)
+	defer fd.Close()
+	filefd := fd.Impl.(*FDFile)
+
+	data, err := filefd.Pread(5, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "world" {
+		t.Errorf("got %q, expected %q", data, "world")
+	}
+	n, err := filefd.Pwrite([]byte("there"), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("got %v, expected 5", n)
+	}
+	data, err = filefd.Pread(100, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "re!" {
+		t.Errorf("got %q, expected %q", data, "re!")
+	}
+
+	// The positioned I/O does not move the FD position.
+	var buf [5]byte
+	if n := fd.Read(buf[:]); n != 5 || string(buf[:]) != "Hello" {
+		t.Errorf("got %q, expected %q", buf[:n], "Hello")
+	}
+}
+
+func TestPreadMem(t *testing.T) {
+	fd := NewMemFD(8)
+	memfd := fd.Impl.(*FDMem)
+
+	n, err := memfd.Pwrite([]byte("abcdefghij"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("got %v, expected 4", n)
+	}
+	_, err = memfd.Pwrite([]byte("x"), 8)
+	if !errors.Is(err, ENOSPC) {
+		t.Errorf("got %v, expected %v", err, ENOSPC)
+	}
+	data, err := memfd.Pread(10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte("\x00\x00abcd")
+	if !bytes.Equal(data, expected) {
+		t.Errorf("got %q, expected %q", data, expected)
+	}
+	if memfd.ofs != 0 {
+		t.Errorf("got offset %v, expected 0", memfd.ofs)
+	}
+}
+
+func TestEncryptedBlockRange(t *testing.T) {
+	// 48 plaintext bytes per block; the last block has 4 bytes.
+	hdr := &FileHeader{
+		BlockSize: 64,
+		PlainSize: 100,
+	}
+	hs := int64(EncrFileHdrSize)
+
+	tests := []struct {
+		offset int64
+		count  int64
+		start  int64
+		end    int64
+	}{
+		{0, 1, hs, hs + 64},
+		{47, 2, hs, hs + 128},
+		{48, 48, hs + 64, hs + 128},
+		{96, 100, hs + 128, hs + 128 + 4 + TagSize},
+		{0, 100, hs, hs + 128 + 4 + TagSize},
+		{100, 10, 0, 0},
+	}
+	for idx, test := range tests {
+		start, end, err := hdr.blockRange(test.offset, test.count)
+		if err != nil {
+			t.Fatalf("test%d: %v", idx, err)
+		}
+		if start != test.start || end != test.end {
+			t.Errorf("test%d: got [%v,%v), expected [%v,%v)", idx,
+				start, end, test.start, test.end)
+		}
+	}
+
+	fileSize := hs + 128 + 4 + TagSize
+	writeTests := []struct {
+		offset int64
+		size   int
+		start  int64
+		err    error
+	}{
+		{0, 64, hs, nil},
+		{48, 64 + 4 + TagSize, hs + 64, nil},
+		{96, 4 + TagSize, hs + 128, nil},
+		{10, 64, 0, EINVAL},
+		{0, 10, 0, EINVAL},
+		{96, 64, 0, EOPNOTSUPP},
+	}
+	for idx, test := range writeTests {
+		start, err := hdr.blockWrite(test.offset, test.size, fileSize)
+		if !errors.Is(err, test.err) {
+			t.Errorf("write%d: got %v, expected %v", idx, err, test.err)
+			continue
+		}
+		if err == nil && start != test.start {
+			t.Errorf("write%d: got %v, expected %v", idx, start, test.start)
+		}
+	}
+}
+
+func TestPreadSyscall(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data")
+	err := os.WriteFile(file, []byte("Hello, world!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c0, c1, _ := p2ptest.Pipe()
+	garbler := &Process{
+		role: RoleGarbler,
+		conn: c0,
+		fds:  make(map[int32]*FD),
+	}
+	evaluator := &Process{
+		role: RoleEvaluator,
+		conn: c1,
+		fds:  make(map[int32]*FD),
+	}
+	fd := garbler.AllocFD(NewFileFD(f))
+	err = evaluator.SetFD(fd, NewDevNullFD())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := garbler.AllocFD(NewSocketFD(NewConnDevNull()))
+	err = evaluator.SetFD(sock, NewSocketFD(NewConnDevNull()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pread := func(fd int32, offset uint64, count uint32) (*syscall, int32) {
+		arg := make([]byte, PreadArgSize)
+		bo.PutUint64(arg, offset)
+		bo.PutUint32(arg[8:], count)
+
+		gsys := &syscall{
+			call:   SysPread,
+			arg0:   fd,
+			argBuf: arg,
+			arg1:   int32(len(arg)),
+		}
+		esys := &syscall{
+			call:   SysPread,
+			arg0:   fd,
+			argBuf: arg,
+			arg1:   int32(len(arg)),
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.pread(gsys)
+		})
+		wg.Go(func() {
+			evaluator.pread(esys)
+		})
+		wg.Wait()
+		return gsys, esys.arg0
+	}
+
+	gsys, earg0 := pread(fd, 7, 5)
+	if gsys.arg0 != 5 || earg0 != 5 {
+		t.Errorf("got %v/%v, expected 5", gsys.arg0, earg0)
+	}
+	if string(gsys.argBuf) != "world" {
+		t.Errorf("got %q, expected %q", gsys.argBuf, "world")
+	}
+
+	gsys, earg0 = pread(sock, 0, 5)
+	if gsys.arg0 != -int32(ESPIPE) || earg0 != -int32(ESPIPE) {
+		t.Errorf("got %v/%v, expected %v", gsys.arg0, earg0, -int32(ESPIPE))
+	}
+}
+
+func TestEncryptedSeekOffsets(t *testing.T) {
+	// 48 plaintext bytes per block; the last block has 4 bytes.
+	hdr := &FileHeader{
+		BlockSize: 64,
+		PlainSize: 100,
+	}
+	hs := int64(EncrFileHdrSize)
+
+	tests := []struct {
+		offset int64
+		pos    int64
+		err    error
+	}{
+		{0, hs, nil},
+		{48, hs + 64, nil},
+		{96, hs + 128, nil},
+		{100, hs + 128 + 4 + TagSize, nil},
+		{10, 0, EINVAL},
+		{101, 0, EINVAL},
+		{-1, 0, EINVAL},
+	}
+	for idx, test := range tests {
+		pos, err := hdr.fileOffset(test.offset)
+		if !errors.Is(err, test.err) {
+			t.Errorf("test%d: got %v, expected %v", idx, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if pos != test.pos {
+			t.Errorf("test%d: got %v, expected %v", idx, pos, test.pos)
+		}
+		offset, err := hdr.plainOffset(pos)
+		if err != nil {
+			t.Fatalf("test%d: %v", idx, err)
+		}
+		if offset != test.offset {
+			t.Errorf("test%d: got %v, expected %v", idx, offset, test.offset)
+		}
+	}
+	for _, pos := range []int64{0, hs + 10, hs + 128 + 10, hs + 256} {
+		_, err := hdr.plainOffset(pos)
+		if !errors.Is(err, EINVAL) {
+			t.Errorf("plainOffset(%v): got %v, expected %v", pos, err, EINVAL)
+		}
+	}
+}
+
+func TestLseekSyscall(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data")
+	err := os.WriteFile(file, []byte("Hello, world!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c0, c1, _ := p2ptest.Pipe()
+	garbler := &Process{
+		role: RoleGarbler,
+		conn: c0,
+		fds:  make(map[int32]*FD),
+	}
+	evaluator := &Process{
+		role: RoleEvaluator,
+		conn: c1,
+		fds:  make(map[int32]*FD),
+	}
+	fd := garbler.AllocFD(NewFileFD(f))
+	err = evaluator.SetFD(fd, NewDevNullFD())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := garbler.AllocFD(NewSocketFD(NewConnDevNull()))
+	err = evaluator.SetFD(sock, NewSocketFD(NewConnDevNull()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := garbler.AllocFD(NewMemFD(16))
+	err = evaluator.SetFD(mem, NewMemFD(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lseek := func(fd int32, offset int64, whence int) (int32, int32) {
+		arg := make([]byte, LseekArgSize)
+		bo.PutUint64(arg, uint64(offset))
+		bo.PutUint32(arg[8:], uint32(whence))
+
+		gsys := &syscall{
+			call:   SysLseek,
+			arg0:   fd,
+			argBuf: arg,
+			arg1:   int32(len(arg)),
+		}
+		esys := &syscall{
+			call:   SysLseek,
+			arg0:   fd,
+			argBuf: arg,
+			arg1:   int32(len(arg)),
+		}
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			garbler.lseek(gsys)
+		})
+		wg.Go(func() {
+			evaluator.lseek(esys)
+		})
+		wg.Wait()
+		return gsys.arg0, esys.arg0
+	}
+
+	tests := []struct {
+		fd     int32
+		offset int64
+		whence int
+		result int32
+	}{
+		{fd, 7, SeekSet, 7},
+		{fd, 2, SeekCur, 9},
+		{fd, -6, SeekEnd, 7},
+		{fd, -8, SeekCur, -int32(EINVAL)},
+		{fd, 0, 3, -int32(EINVAL)},
+		{fd, 1 << 31, SeekSet, -int32(EOVERFLOW)},
+		{sock, 0, SeekSet, -int32(ESPIPE)},
+		{mem, 4, SeekSet, 4},
+		{mem, -2, SeekEnd, 14},
+		{100, 0, SeekSet, -int32(EBADF)},
+	}
+	for idx, test := range tests {
+		g, e := lseek(test.fd, test.offset, test.whence)
+		if g != test.result || e != test.result {
+			t.Errorf("test%d: got %v/%v, expected %v", idx, g, e, test.result)
+		}
+		if test.fd == fd && test.result == 7 {
+			// The read continues from the new offset.
+			var buf [5]byte
+			n := garbler.fds[fd].Read(buf[:])
+			if string(buf[:n]) != "world" {
+				t.Errorf("test%d: got %q, expected %q", idx, buf[:n], "world")
+			}
+			_, _ = lseek(fd, 7, SeekSet)
+		}
+	}
+	if ofs := evaluator.fds[mem].Impl.(*FDMem).ofs; ofs != 14 {
+		t.Errorf("evaluator memfd offset %v, expected 14", ofs)
+	}
+}
@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -7,11 +7,87 @@
 package kernel
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"errors"
+	"fmt"
 	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// PortCipher defines the ciphers for protecting the port messages
+// inside the kernel.
+type PortCipher int
+
+// Port ciphers.
+const (
+	PortCipherNone PortCipher = iota
+	PortCipherAES128GCM
+	PortCipherChaCha20Poly1305
 )
 
+var portCiphers = map[PortCipher]string{
+	PortCipherNone:             "none",
+	PortCipherAES128GCM:        "aes-128-gcm",
+	PortCipherChaCha20Poly1305: "chacha20-poly1305",
+}
+
+func (c PortCipher) String() string {
+	name, ok := portCiphers[c]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{PortCipher %d}", c)
+}
+
+// ParsePortCipher parses the port cipher name. The empty name
+// selects PortCipherNone.
+func ParsePortCipher(name string) (PortCipher, error) {
+	if len(name) == 0 {
+		return PortCipherNone, nil
+	}
+	for c, n := range portCiphers {
+		if n == name {
+			return c, nil
+		}
+	}
+	return PortCipherNone, fmt.Errorf("unknown port cipher: %s", name)
+}
+
+// newAEAD creates an AEAD for the cipher with a random key. The
+// function returns nil AEAD for PortCipherNone.
+func (c PortCipher) newAEAD() (cipher.AEAD, error) {
+	switch c {
+	case PortCipherNone:
+		return nil, nil
+
+	case PortCipherAES128GCM:
+		var key [16]byte
+		_, err := rand.Read(key[:])
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+
+	case PortCipherChaCha20Poly1305:
+		var key [chacha20poly1305.KeySize]byte
+		_, err := rand.Read(key[:])
+		if err != nil {
+			return nil, err
+		}
+		return chacha20poly1305.New(key[:])
+
+	default:
+		return nil, fmt.Errorf("unknown port cipher: %v", c)
+	}
+}
+
 // Port implements IPC ports.
 type Port struct {
 	m       sync.Mutex
@@ -21,6 +97,11 @@ type Port struct {
 	role    Role
 	server  chan msg
 	client  chan msg
+
+	// The aead protects the messages while they are queued in the
+	// kernel. It is nil if the port messages are not encrypted.
+	aead    cipher.AEAD
+	aeadSeq uint64
 }
 
 type msg struct {
@@ -28,16 +109,23 @@ type msg struct {
 	fd   *FD
 }
 
-// NewPort creates a new port for the role.
-func NewPort(role Role) (*Port, error) {
+// NewPort creates a new port for the role. The port messages are
+// encrypted and authenticated with a random per-port key using the
+// cipher c.
+func NewPort(role Role, c PortCipher) (*Port, error) {
 	var key [KeySize]byte
 	_, err := rand.Read(key[:])
 	if err != nil {
 		return nil, err
 	}
+	aead, err := c.newAEAD()
+	if err != nil {
+		return nil, err
+	}
 	port := &Port{
 		key:  key[:],
 		role: role,
+		aead: aead,
 	}
 	port.server = make(chan msg)
 	port.client = make(chan msg)
@@ -64,6 +152,42 @@ func (p *Port) Nonce(b []byte) error {
 	return nil
 }
 
+// seal encrypts the message data. The sealed message is
+// nonce|ciphertext.
+func (p *Port) seal(data []byte) ([]byte, error) {
+	if p.aead == nil {
+		return data, nil
+	}
+	p.m.Lock()
+	p.aeadSeq++
+	seq := p.aeadSeq
+	p.m.Unlock()
+
+	if seq == 0 {
+		return nil, errors.New("nonce overflow")
+	}
+	nonce := make([]byte, p.aead.NonceSize())
+	bo.PutUint64(nonce[len(nonce)-8:], seq)
+
+	return p.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// open decrypts and verifies the sealed message data.
+func (p *Port) open(data []byte) ([]byte, error) {
+	if p.aead == nil {
+		return data, nil
+	}
+	ns := p.aead.NonceSize()
+	if len(data) < ns {
+		return nil, EBADMSG
+	}
+	plain, err := p.aead.Open(nil, data[:ns], data[ns:], nil)
+	if err != nil {
+		return nil, EBADMSG
+	}
+	return plain, nil
+}
+
 // NewServerFD creates a server FD for the port.
 func (p *Port) NewServerFD() *FD {
 	return NewFD(&FDPort{
@@ -115,12 +239,16 @@ func (fd *FDPort) Read(b []byte) int {
 		msg.fd.Close()
 		return int(-ENOMSG)
 	}
-	msgSize := KeySize + len(msg.data)
+	data, err := fd.port.open(msg.data)
+	if err != nil {
+		return int(mapError(err))
+	}
+	msgSize := KeySize + len(data)
 	if msgSize > len(b) {
 		return int(-ERANGE)
 	}
 	n := copy(b, fd.port.key)
-	n += copy(b[KeySize:], msg.data)
+	n += copy(b[KeySize:], data)
 
 	return n
 }
@@ -134,8 +262,12 @@ func (fd *FDPort) Write(b []byte) int {
 	if fd.port.role == RoleEvaluator {
 		b = nil
 	}
+	data, err := fd.port.seal(b)
+	if err != nil {
+		return int(mapError(err))
+	}
 	fd.write <- msg{
-		data: b,
+		data: data,
 	}
 
 	return n
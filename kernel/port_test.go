@@ -1,5 +1,5 @@
 //
-// Copyright (c) 2025 Markku Rossi
+// Copyright (c) 2025-2026 Markku Rossi
 //
 // All rights reserved.
 //
@@ -12,7 +12,7 @@ import (
 )
 
 func TestPortNonce(t *testing.T) {
-	port, err := NewPort(RoleGarbler)
+	port, err := NewPort(RoleGarbler, PortCipherNone)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -63,7 +63,7 @@ func TestPortNonce(t *testing.T) {
 }
 
 func TestPortGarbler(t *testing.T) {
-	port, err := NewPort(RoleGarbler)
+	port, err := NewPort(RoleGarbler, PortCipherNone)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -80,7 +80,7 @@ func TestPortGarbler(t *testing.T) {
 }
 
 func TestPortEvaluator(t *testing.T) {
-	port, err := NewPort(RoleEvaluator)
+	port, err := NewPort(RoleEvaluator, PortCipherNone)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -95,3 +95,73 @@ func TestPortEvaluator(t *testing.T) {
 		t.Errorf("invalid evaluator msg: %x: %v != %v", msg, len(msg), KeySize)
 	}
 }
+
+func TestPortCipher(t *testing.T) {
+	data := []byte("Hello, world!")
+
+	for _, c := range []PortCipher{
+		PortCipherNone, PortCipherAES128GCM, PortCipherChaCha20Poly1305,
+	} {
+		port, err := NewPort(RoleGarbler, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := port.NewServerFD()
+		client := port.NewClientFD()
+
+		go client.Write(data)
+
+		var buf [KeySize + 64]byte
+		n := server.Read(buf[:])
+		if n != KeySize+len(data) {
+			t.Fatalf("%v: Read=%v, expected %v", c, n, KeySize+len(data))
+		}
+		if !bytes.Equal(buf[KeySize:n], data) {
+			t.Errorf("%v: got %q, expected %q", c, buf[KeySize:n], data)
+		}
+		if c == PortCipherNone {
+			continue
+		}
+
+		// Tampered messages are rejected.
+		sealed, err := port.seal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(sealed, data) {
+			t.Errorf("%v: message not encrypted", c)
+		}
+		sealed[len(sealed)-1] ^= 0x01
+		go func() {
+			port.server <- msg{
+				data: sealed,
+			}
+		}()
+		n = server.Read(buf[:])
+		if n != int(-EBADMSG) {
+			t.Errorf("%v: tampered Read=%v, expected %v", c, n, -EBADMSG)
+		}
+	}
+}
+
+func TestParsePortCipher(t *testing.T) {
+	for _, c := range []PortCipher{
+		PortCipherNone, PortCipherAES128GCM, PortCipherChaCha20Poly1305,
+	} {
+		parsed, err := ParsePortCipher(c.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != c {
+			t.Errorf("got %v, expected %v", parsed, c)
+		}
+	}
+	c, err := ParsePortCipher("")
+	if err != nil || c != PortCipherNone {
+		t.Errorf("got %v, %v, expected %v", c, err, PortCipherNone)
+	}
+	_, err = ParsePortCipher("rot13")
+	if err == nil {
+		t.Errorf("unknown cipher accepted")
+	}
+}
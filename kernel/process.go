@@ -8,16 +8,17 @@ package kernel
 
 import (
 	"bytes"
-	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"maps"
 	"math/big"
 	"net"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/markkurossi/ephemelier/crypto/spdz"
 	"github.com/markkurossi/ephemelier/eef"
 	"github.com/markkurossi/mpc"
 	"github.com/markkurossi/mpc/circuit"
@@ -34,11 +35,19 @@ type Process struct {
 	kern        *Kernel
 	role        Role
 	args        []string
+	env         []string
 	pid         PID
+	parent      PartyID
+	uid         UID
 	cwd         string
 	root        string
 	conn        *p2p.Conn
+	connClose   sync.Once
 	oti         ot.OT
+	spdzSession *spdz.Session
+	states      map[string]*StateStats
+	shm         map[int32]*shmRegion
+	shmNext     int32
 	state       ProcState
 	iostats     p2p.IOStats
 	prog        *eef.Program
@@ -48,6 +57,12 @@ type Process struct {
 	pc          uint16
 	fds         map[int32]*FD
 	exitVal     int32
+	killed      int32
+	stop        chan struct{}
+	intr        bool
+	alarmTimer  *time.Timer
+	alarmAt     time.Time
+	priority    int32
 	rusage      RUsage
 }
 
@@ -122,12 +137,25 @@ func (proc *Process) verbose() bool {
 	return proc.kern.params.Verbose
 }
 
-// SetState sets the process state.
+// State returns the process state.
+func (proc *Process) State() ProcState {
+	proc.m.Lock()
+	defer proc.m.Unlock()
+	return proc.state
+}
+
+// SetState sets the process state. When the process exits, its
+// kernel's live process count is decremented.
 func (proc *Process) SetState(st ProcState) {
 	proc.m.Lock()
+	exited := proc.state < SZOMB && st >= SZOMB
 	proc.state = st
 	proc.m.Unlock()
 	proc.c.Broadcast()
+
+	if exited && proc.kern != nil {
+		proc.kern.processExited()
+	}
 }
 
 // WaitState waits until the process reaches the specified state.
@@ -139,6 +167,52 @@ func (proc *Process) WaitState(st ProcState) {
 	proc.m.Unlock()
 }
 
+// Interrupt delivers an interrupt to the process. A paused process
+// wakes up and its pause syscall returns EINTR. If the process is
+// not paused, the interrupt is kept pending until the next pause.
+// The interrupts are delivered by the kill syscall and by the
+// process' alarm.
+func (proc *Process) Interrupt() {
+	proc.m.Lock()
+	proc.intr = true
+	proc.m.Unlock()
+	proc.c.Broadcast()
+}
+
+// pause blocks the process until it is interrupted.
+func (proc *Process) pause() {
+	proc.sleep(time.Time{})
+}
+
+// sleep blocks the process until the deadline or until it is
+// interrupted. The zero deadline blocks until the process is
+// interrupted. The function returns true if the process was
+// interrupted.
+func (proc *Process) sleep(deadline time.Time) bool {
+	if !deadline.IsZero() {
+		timer := time.AfterFunc(time.Until(deadline), func() {
+			proc.m.Lock()
+			proc.m.Unlock()
+			proc.c.Broadcast()
+		})
+		defer timer.Stop()
+	}
+
+	proc.m.Lock()
+	state := proc.state
+	proc.state = SSLEEP
+	for !proc.intr && (deadline.IsZero() || time.Now().Before(deadline)) {
+		proc.c.Wait()
+	}
+	intr := proc.intr
+	proc.intr = false
+	proc.state = state
+	proc.m.Unlock()
+	proc.c.Broadcast()
+
+	return intr
+}
+
 // SetProgram sets the program for the process.
 func (proc *Process) SetProgram(prog *eef.Program) error {
 	proc.prog = prog
@@ -150,7 +224,10 @@ func (proc *Process) SetProgram(prog *eef.Program) error {
 	proc.mpclcParams.PkgPath = []string{
 		"../../pkg",
 	}
-	proc.mpclcParams.SymbolIDs = prog.Symtab
+
+	// The program can be shared with other processes so we give the
+	// compiler our own copy of the symbol IDs.
+	proc.mpclcParams.SymbolIDs = maps.Clone(prog.Symtab)
 
 	proc.mpclcParams.Warn.ReturnDiff = false
 	proc.mpclcParams.Warn.Unreachable = false
@@ -158,11 +235,18 @@ func (proc *Process) SetProgram(prog *eef.Program) error {
 	return nil
 }
 
-// AllocFD allocates a file descriptor for the FD implementation.
+// AllocFD allocates a file descriptor for the FD implementation. The
+// function returns -EMFILE and closes fd if the process has
+// Params.MaxFDs open file descriptors.
 func (proc *Process) AllocFD(fd *FD) int32 {
 	proc.m.Lock()
 	defer proc.m.Unlock()
 
+	if proc.fdLimit() {
+		fd.Close()
+		return int32(-EMFILE)
+	}
+
 	var ret int32
 	for ret = 0; ; ret++ {
 		_, ok := proc.fds[ret]
@@ -173,6 +257,16 @@ func (proc *Process) AllocFD(fd *FD) int32 {
 	}
 }
 
+// fdLimit tests if the process has Params.MaxFDs open file
+// descriptors.
+func (proc *Process) fdLimit() bool {
+	if proc.kern == nil {
+		return false
+	}
+	max := proc.kern.params.MaxFDs
+	return max > 0 && len(proc.fds) >= max
+}
+
 // SetFD sets the FD implementation for the file descriptor.
 func (proc *Process) SetFD(fd int32, impl *FD) error {
 	proc.m.Lock()
@@ -197,7 +291,7 @@ func (proc *Process) FreeFD(fd int32) {
 
 // Run runs the process.
 func (proc *Process) Run() (err error) {
-	defer proc.conn.Close()
+	defer proc.closeConn()
 
 	proc.SetState(SRUN)
 
@@ -207,14 +301,35 @@ func (proc *Process) Run() (err error) {
 	case RoleEvaluator:
 		err = proc.runEvaluator()
 	}
-	if err != nil {
-		proc.ktracePrefix()
-		fmt.Printf("process error: %v\n", err)
+	proc.m.Lock()
+	sig := proc.killed
+	proc.m.Unlock()
+	if sig != 0 {
+		// The connection was closed when the process was killed.
+		proc.exitVal = SignalExit(sig)
+		err = nil
 	}
-	// Close all FDs.
-	for _, fd := range proc.fds {
-		fd.Close()
+	if err != nil {
+		if proc.kern.params.Trace && proc.ktraceJSON() {
+			proc.ktraceRecord(&ktraceRecord{
+				Event:   "error",
+				Message: err.Error(),
+			})
+		} else {
+			b := new(bytes.Buffer)
+			proc.ktracePrefix(b)
+			fmt.Fprintf(b, "process error: %v\n", err)
+			proc.kern.ktraceWrite(b)
+		}
+
+		var mpcErr *MPCError
+		if errors.As(err, &mpcErr) {
+			proc.exitVal = int32(-EMPC)
+		}
 	}
+	// Close all FDs and cancel the alarm.
+	proc.closeFDs()
+	proc.setAlarm(0)
 	// XXX Close process port. If parent queried port, FD's refcount
 	// is 2 and it was not closed above.
 
@@ -223,6 +338,44 @@ func (proc *Process) Run() (err error) {
 	return err
 }
 
+// setupReject defines the reasons why the evaluator rejects the
+// process setup.
+type setupReject byte
+
+// Process setup rejection reasons.
+const (
+	rejectOT setupReject = iota + 1
+	rejectProgram
+)
+
+var setupRejectNames = map[setupReject]string{
+	rejectOT:      "base OT mismatch",
+	rejectProgram: "program mismatch",
+}
+
+func (r setupReject) String() string {
+	name, ok := setupRejectNames[r]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{setupReject %d}", r)
+}
+
+// rejectSetup rejects the process setup by sending pid 0 and the
+// rejection reason to the garbler.
+func (proc *Process) rejectSetup(reason setupReject) {
+	err := proc.conn.SendUint16(0)
+	if err == nil {
+		err = proc.conn.SendByte(byte(reason))
+	}
+	if err == nil {
+		err = proc.conn.Flush()
+	}
+	if err != nil {
+		proc.debugf("rejectSetup: %v\n", err)
+	}
+}
+
 func (proc *Process) runEvaluator() error {
 	// Receive peer pid and program.
 	gid, err := proc.conn.ReceiveUint16()
@@ -234,10 +387,29 @@ func (proc *Process) runEvaluator() error {
 	if err != nil {
 		return err
 	}
-	prog, err := eef.NewProgram(programName)
+	b, err := proc.conn.ReceiveByte()
+	if err != nil {
+		return err
+	}
+	digest, err := proc.conn.ReceiveData()
+	if err != nil {
+		return err
+	}
+	if spdz.OTType(b) != proc.kern.params.OT {
+		proc.rejectSetup(rejectOT)
+		return fmt.Errorf("base OT mismatch: garbler %v, evaluator %v",
+			spdz.OTType(b), proc.kern.params.OT)
+	}
+	prog, err := proc.kern.LoadProgram(programName)
 	if err != nil {
+		proc.rejectSetup(rejectProgram)
 		return err
 	}
+	if !bytes.Equal(digest, prog.Digest[:]) {
+		proc.rejectSetup(rejectProgram)
+		return fmt.Errorf("%s: program mismatch: garbler %x, evaluator %x",
+			programName, digest, prog.Digest)
+	}
 	err = proc.SetProgram(prog)
 	if err != nil {
 		return err
@@ -313,7 +485,7 @@ run:
 			result, err = circuit.Evaluator(proc.conn, proc.oti, state.Circ,
 				input, proc.verbose())
 			if err != nil {
-				return err
+				return mpcError("evaluator", err)
 			}
 			outputs = state.Circ.Outputs
 
@@ -337,7 +509,7 @@ run:
 			outputs, result, err = circuit.StreamEvaluator(proc.conn,
 				proc.oti, nil, inputs, proc.verbose())
 			if err != nil {
-				return err
+				return mpcError("stream evaluator", err)
 			}
 			if proc.diagnostics() {
 				mpc.PrintResults(result, outputs, 0)
@@ -350,6 +522,7 @@ run:
 		last = now
 		proc.ktraceStats(rusage)
 		proc.rusage.Add(rusage)
+		proc.stateStats(state.Name, state.Circ == nil, rusage.Utime)
 
 		// Decode syscall.
 		err = proc.decodeSyscall(sys, mpc.Results(result, outputs))
@@ -363,10 +536,47 @@ run:
 			proc.exitVal = sys.arg0
 			break run
 
-		case SysSpawn, SysDial, SysListen:
-			// XXX SysDial should sync FD with garbler
+		case SysSpawn:
 			sys.SetArg0(0)
 
+		case SysDial:
+			var fd *FD
+			if packetNetwork(sys) {
+				fd = NewPacketFD(nil, "", true)
+			} else {
+				fd = NewSocketFD(NewConnDevNull())
+			}
+
+			// Get FD from garbler.
+			gfd, err := proc.recvFD()
+			if err == nil {
+				sys.SetArg0(int32(gfd))
+				err = proc.SetFD(sys.arg0, fd)
+			}
+			if err != nil {
+				fd.Close()
+				sys.SetArg0(mapError(err))
+			}
+
+		case SysListen:
+			var fd *FD
+			if packetNetwork(sys) {
+				fd = NewPacketFD(nil, "", false)
+			} else {
+				fd = NewListenerFD(nil, ListenBacklog(sys.arg0))
+			}
+
+			// Get FD from garbler.
+			gfd, err := proc.recvFD()
+			if err == nil {
+				sys.SetArg0(int32(gfd))
+				err = proc.SetFD(sys.arg0, fd)
+			}
+			if err != nil {
+				fd.Close()
+				sys.SetArg0(mapError(err))
+			}
+
 		case SysOpen:
 			fd := NewDevNullFD()
 
@@ -381,11 +591,38 @@ run:
 				sys.SetArg0(mapError(err))
 			}
 
+		case SysMemfd:
+			// Get FD from garbler.
+			gfd, err := proc.recvFD()
+			if err == nil {
+				fd := NewMemFD(int(sys.arg0))
+				sys.SetArg0(int32(gfd))
+				err = proc.SetFD(sys.arg0, fd)
+				if err != nil {
+					fd.Close()
+				}
+			}
+			if err != nil {
+				sys.SetArg0(mapError(err))
+			}
+
 		case SysAccept:
+			listenerfd, _ := proc.listenerFD(sys.arg0)
 			fd := NewSocketFD(NewConnDevNull())
 
-			// Get FD from garbler.
-			gfd, err := proc.conn.ReceiveUint32()
+			// The garbler rejects invalid flags.
+			flags, _ := ParseSockFlags(sys.arg1)
+			SetSockFlags(fd, flags)
+
+			// Get FD and accept queue depth from garbler.
+			gfd, err := proc.recvFD()
+			if err == nil {
+				var pending int
+				pending, err = proc.conn.ReceiveUint32()
+				if err == nil && listenerfd != nil {
+					listenerfd.SetPending(pending)
+				}
+			}
 			if err == nil {
 				sys.SetArg0(int32(gfd))
 				err = proc.SetFD(sys.arg0, fd)
@@ -518,7 +755,9 @@ run:
 			inputs[2] = proc.mem
 		}
 
-		// Argument buffer.
+		// Argument buffer. The shared memory regions are fed to the
+		// program as the argBuf of the shmread syscall result so
+		// they don't need inputs of their own.
 		if numInputs > 3 {
 			inputs[3] = sys.argBuf
 		}
@@ -554,7 +793,7 @@ run:
 			result, err = circuit.Garbler(proc.kern.params.MPCConfig,
 				proc.conn, proc.oti, state.Circ, input, proc.verbose())
 			if err != nil {
-				return err
+				return mpcError("garbler", err)
 			}
 			outputs = state.Circ.Outputs
 			rusage.GarbleTime = time.Since(start)
@@ -594,7 +833,7 @@ run:
 			outputs, result, err = prog.Stream(proc.conn, proc.oti,
 				proc.mpclcParams, input, timing)
 			if err != nil {
-				return err
+				return mpcError("stream garbler", err)
 			}
 			if proc.diagnostics() {
 				mpc.PrintResults(result, outputs, 0)
@@ -619,6 +858,7 @@ run:
 		last = now
 		proc.ktraceStats(rusage)
 		proc.rusage.Add(rusage)
+		proc.stateStats(state.Name, state.Circ == nil, rusage.Utime)
 
 		// Decode syscall.
 		err = proc.decodeSyscall(sys, mpc.Results(result, outputs))
@@ -627,6 +867,12 @@ run:
 		}
 		if len(sys.mem) > 0 {
 			// Store memory only if returned.
+			max := proc.kern.params.MaxMem
+			if max > 0 && len(sys.mem) > max {
+				proc.exitVal = int32(-ENOMEM)
+				return fmt.Errorf("program memory %v exceeds limit %v",
+					len(sys.mem), max)
+			}
 			proc.mem = sys.mem
 		}
 		proc.ktraceCall(sys)
@@ -653,108 +899,115 @@ run:
 			sys.argBuf = nil
 			sys.arg1 = 0
 
-			child, err := proc.kern.Spawn(cmd, args, proc.fds[0].Copy(),
-				proc.fds[1].Copy(), proc.fds[2].Copy())
+			child, err := proc.kern.Spawn(cmd, args, proc.env,
+				proc.fds[0].Inherit(), proc.fds[1].Inherit(),
+				proc.fds[2].Inherit())
 			if err != nil {
-				sys.arg0 = int32(-ENOENT)
+				errno, ok := err.(Errno)
+				if !ok {
+					errno = ENOENT
+				}
+				sys.arg0 = -int32(errno)
 				break
 			}
 			sys.arg0 = int32(child.pid)
+			child.parent = proc.pid.G()
+			child.uid = proc.uid
 			go child.Run()
 
 		case SysDial:
 			addrData, err := sys.argData()
 			if err != nil {
 				sys.SetArg0(mapError(err))
+				proc.sendFD(int(sys.arg0))
 				break
 			}
 			network, address, errno := ParseNetAddress(addrData)
 			if errno != 0 {
 				sys.SetArg0(-int32(errno))
+				proc.sendFD(int(sys.arg0))
 				break
 			}
 			conn, err := net.Dial(network, address)
 			if err != nil {
 				sys.SetArg0(mapError(err))
+				proc.sendFD(int(sys.arg0))
 				break
 			}
-			fd := NewSocketFD(conn)
+			var fd *FD
+			if packetNetworks[network] {
+				fd = NewPacketFD(conn.(net.PacketConn), network, true)
+			} else {
+				fd = NewSocketFD(conn)
+			}
 			sys.SetArg0(proc.AllocFD(fd))
-			// XXX sync fd with evaluator
+
+			// Sync FD with evaluator.
+			err = proc.sendFD(int(sys.arg0))
+			if err != nil {
+				fd.Close()
+				proc.FreeFD(sys.arg0)
+				sys.SetArg0(mapError(err))
+			}
 
 		case SysListen:
+			backlog := ListenBacklog(sys.arg0)
 			addrData, err := sys.argData()
 			if err != nil {
 				sys.SetArg0(mapError(err))
+				proc.sendFD(int(sys.arg0))
 				break
 			}
 			network, address, errno := ParseNetAddress(addrData)
 			if errno != 0 {
 				sys.SetArg0(-int32(errno))
+				proc.sendFD(int(sys.arg0))
 				break
 			}
-			listener, err := net.Listen(network, address)
-			if err != nil {
-				sys.SetArg0(mapError(err))
-				break
-			}
-			fd := NewListenerFD(listener)
-			sys.SetArg0(proc.AllocFD(fd))
-
-		case SysOpen:
-			path, err := sys.argString()
-			if err != nil || len(path) == 0 {
-				sys.SetArg0(int32(-EINVAL))
-				proc.sendFD(int(-EINVAL))
-				break
+			var fd *FD
+			if packetNetworks[network] {
+				var conn net.PacketConn
+				conn, err = net.ListenPacket(network, address)
+				if err == nil {
+					fd = NewPacketFD(conn, network, false)
+				}
+			} else {
+				var listener net.Listener
+				listener, err = net.Listen(network, address)
+				if err == nil {
+					fd = NewListenerFD(listener, backlog)
+				}
 			}
-			path = proc.MakePath(path)
-
-			info, err := os.Stat(path)
 			if err != nil {
 				sys.SetArg0(mapError(err))
 				proc.sendFD(int(sys.arg0))
 				break
 			}
+			sys.SetArg0(proc.AllocFD(fd))
 
-			file, err := os.Open(path)
+			// Sync FD with evaluator.
+			err = proc.sendFD(int(sys.arg0))
 			if err != nil {
+				fd.Close()
+				proc.FreeFD(sys.arg0)
 				sys.SetArg0(mapError(err))
-				proc.sendFD(int(sys.arg0))
-				break
 			}
 
-			// File header for encrypted files.
-			var fileHeader *FileHeader
-			if OpenFlag(sys.arg0)&Encrypt != 0 {
-				var hdr [EncrFileHdrSize]byte
-				_, err = file.Read(hdr[:])
-				if err == nil {
-					fileHeader, err = NewFileHeader(hdr[:])
-				}
-				if err != nil {
-					sys.SetArg0(mapError(err))
-					proc.sendFD(int(sys.arg0))
-					file.Close()
-					break
-				}
-			}
-
-			fd := NewFileFD(file)
-			sys.SetArg0(proc.AllocFD(fd))
+		case SysOpen:
+			proc.open(sys)
 
-			fi, err := NewFileInfo(info, fileHeader)
-			if err != nil {
-				fd.Close()
-				sys.SetArg0(mapError(err))
+		case SysMemfd:
+			errno := proc.memfdSize(sys.arg0)
+			if errno != 0 {
+				sys.SetArg0(-int32(errno))
 				proc.sendFD(int(sys.arg0))
 				break
 			}
-
-			sys.argBuf = fi.Bytes()
+			fd := NewMemFD(int(sys.arg0))
+			sys.SetArg0(proc.AllocFD(fd))
 
 			// Sync FD with evaluator.
-			err = proc.sendFD(int(sys.arg0))
+			err := proc.sendFD(int(sys.arg0))
 			if err != nil {
 				fd.Close()
 				proc.FreeFD(sys.arg0)
@@ -762,27 +1015,42 @@ run:
 			}
 
 		case SysAccept:
-			fd, ok := proc.fds[sys.arg0]
-			if !ok {
-				sys.SetArg0(int32(-EBADF))
+			listenerfd, errno := proc.listenerFD(sys.arg0)
+			if errno != 0 {
+				sys.SetArg0(-int32(errno))
+				proc.sendFD(int(sys.arg0))
 				break
 			}
-			listenerfd, ok := fd.Impl.(*FDListener)
-			if !ok {
-				sys.SetArg0(int32(-ENOTSOCK))
+			flags, errno := ParseSockFlags(sys.arg1)
+			if errno != 0 {
+				sys.SetArg0(-int32(errno))
+				proc.sendFD(int(sys.arg0))
 				break
 			}
-			conn, err := listenerfd.listener.Accept()
+			conn, err := listenerfd.AcceptUntil(proc.kern.Drained())
 			if err != nil {
 				sys.SetArg0(mapError(err))
+				proc.sendFD(int(sys.arg0))
+				break
+			}
+			if !proc.kern.acl.Allowed(conn.RemoteAddr()) {
+				proc.debugf("accept: connection from %s denied\n",
+					conn.RemoteAddr())
+				conn.Close()
+				sys.SetArg0(int32(-ECONNABORTED))
+				proc.sendFD(int(sys.arg0))
 				break
 			}
 
 			cfd := NewSocketFD(conn)
+			SetSockFlags(cfd, flags)
 			sys.SetArg0(proc.AllocFD(cfd))
 
-			// Sync FD with evaluator.
+			// Sync FD and accept queue depth with evaluator.
 			err = proc.conn.SendUint32(int(sys.arg0))
+			if err == nil {
+				err = proc.conn.SendUint32(listenerfd.Pending())
+			}
 			if err == nil {
 				err = proc.conn.Flush()
 			}
@@ -922,23 +1190,16 @@ func (proc *Process) syscall(sys *syscall) error {
 		proc.FreeFD(sys.arg0)
 
 	case SysWait:
-		var pid PartyID
-		if proc.role == RoleGarbler {
-			pid = PID(sys.arg0).G()
-		} else {
-			pid = PID(sys.arg0).E()
-		}
-		child, ok := proc.kern.GetProcess(pid)
-		if !ok {
-			sys.SetArg0(int32(-ECHILD))
-			return nil
-		}
-		child.WaitState(SZOMB)
-		sys.SetArg0(child.exitVal)
-		proc.kern.RemoveProcess(pid)
+		return proc.waitpid(sys, 0)
+
+	case SysWaitpid:
+		return proc.waitpid(sys, sys.arg1)
 
 	case SysTlsserver:
-		proc.tlsServer(sys)
+		return proc.tlsServer(sys)
+
+	case SysConnecttls:
+		return proc.connectTLS(sys)
 
 	case SysTlshs:
 		proc.tlsHandshake(sys)
@@ -946,16 +1207,92 @@ func (proc *Process) syscall(sys *syscall) error {
 	case SysTlsstatus:
 		proc.tlsStatus(sys)
 
-	case SysGetrandom:
-		buf := make([]byte, sys.arg0)
-		n, err := rand.Read(buf)
+	case SysTlsinfo:
+		proc.tlsInfo(sys)
+
+	case SysGetsharedsecret:
+		proc.getSharedSecret(sys)
+
+	case SysTlsctl:
+		return proc.tlsCtl(sys)
+
+	case SysShmalloc:
+		proc.shmAlloc(sys)
+
+	case SysShmread:
+		proc.shmRead(sys)
+
+	case SysShmwrite:
+		proc.shmWrite(sys)
+
+	case SysStatfs:
+		proc.statfs(sys)
+
+	case SysPread, SysPwrite:
+		proc.pread(sys)
+
+	case SysLseek:
+		proc.lseek(sys)
+
+	case SysSendto, SysRecvfrom:
+		proc.sendto(sys)
+
+	case SysGettimeofday, SysClockGettime:
+		proc.clockGettime(sys)
+
+	case SysDup, SysDup2:
+		proc.dup(sys)
+
+	case SysKill:
+		return proc.kill(sys)
+
+	case SysGetenv:
+		return proc.getenv(sys)
+
+	case SysFstat:
+		proc.fstat(sys)
+
+	case SysMkdir, SysUnlink:
+		proc.mkdir(sys)
+
+	case SysReaddir:
+		proc.readdir(sys)
+
+	case SysTruncate, SysFtruncate:
+		proc.truncate(sys)
+
+	case SysChmod:
+		proc.chmod(sys)
+
+	case SysClockNanosleep:
+		proc.clockNanosleep(sys)
+
+	case SysAlarm:
+		proc.alarm(sys)
+
+	case SysSendfile:
+		proc.sendfile(sys)
+
+	case SysPause:
+		// The garbler drives the wakeup and syncs it with evaluator.
+		var err error
+		if proc.role == RoleGarbler {
+			proc.pause()
+			err = proc.conn.SendUint32(int(EINTR))
+			if err == nil {
+				err = proc.conn.Flush()
+			}
+		} else {
+			_, err = proc.conn.ReceiveUint32()
+		}
 		if err != nil {
-			sys.SetArg0(int32(-EFAULT))
+			sys.SetArg0(mapError(err))
 			return nil
 		}
-		sys.arg0 = int32(n)
-		sys.argBuf = buf
-		sys.arg1 = 0
+		sys.SetArg0(int32(-EINTR))
+
+	case SysGetrandom:
+		proc.getrandom(sys)
 
 	case SysContinue:
 		// Clear values.
@@ -963,6 +1300,7 @@ func (proc *Process) syscall(sys *syscall) error {
 
 	case SysYield:
 		// The decodeSyscall has preserved the old values.
+		proc.yield()
 
 	case SysNext:
 		// Use the new values provided for the syscall.
@@ -970,6 +1308,18 @@ func (proc *Process) syscall(sys *syscall) error {
 	case SysGetpid:
 		sys.SetArg0(int32(proc.pid))
 
+	case SysGetcwd:
+		proc.getcwd(sys)
+
+	case SysReboot:
+		proc.reboot(sys)
+
+	case SysGetpriority:
+		sys.SetArg0(proc.Priority())
+
+	case SysSetpriority:
+		sys.SetArg0(mapError(proc.SetPriority(sys.arg0)))
+
 	case SysSendfd:
 		fd, ok := proc.fds[sys.arg0]
 		if !ok {
@@ -1065,6 +1415,18 @@ func (proc *Process) sendFD(fd int) error {
 	return proc.conn.Flush()
 }
 
+func (proc *Process) listenerFD(fd int32) (*FDListener, Errno) {
+	f, ok := proc.fds[fd]
+	if !ok {
+		return nil, EBADF
+	}
+	listenerfd, ok := f.Impl.(*FDListener)
+	if !ok {
+		return nil, ENOTSOCK
+	}
+	return listenerfd, 0
+}
+
 func (proc *Process) recvFD() (int, error) {
 	fd, err := proc.conn.ReceiveUint32()
 	if err != nil {
@@ -1196,23 +1558,84 @@ func (proc *Process) debugSyscall(values []interface{}) {
 	if !proc.kern.params.Trace {
 		return
 	}
+	b := new(bytes.Buffer)
+	defer proc.kern.ktraceWrite(b)
+
 	// Print any additional debug values.
 	for i := 6; i < len(values); i++ {
-		proc.ktracePrefix()
+		if proc.ktraceJSON() {
+			var msg string
+			switch v := values[i].(type) {
+			case []byte:
+				msg = hex.EncodeToString(v)
+			default:
+				msg = fmt.Sprintf("%v", v)
+			}
+			proc.ktraceRecord(&ktraceRecord{
+				Event:   "debug",
+				Message: msg,
+			})
+			continue
+		}
+		proc.ktracePrefix(b)
 		switch v := values[i].(type) {
 		case []byte:
-			fmt.Printf("DBG  %x", v)
+			fmt.Fprintf(b, "DBG  %x", v)
 		default:
-			fmt.Printf("DBG  %v", v)
+			fmt.Fprintf(b, "DBG  %v", v)
+		}
+		fmt.Fprintln(b)
+	}
+}
+
+// baseOT creates a new base OT instance of the kernel's OT protocol.
+func (proc *Process) baseOT() ot.OT {
+	return proc.kern.params.OT.New(proc.kern.params.MPCConfig.GetRandom())
+}
+
+// spdzAdd computes the P-256 point addition with the peer process.
+// The process' SPDZ session is created on the first call and its OT
+// extension setup is reused for all subsequent calls. The additions
+// use the kernel's triple pool when it has triples. Killing the
+// process cancels the addition.
+func (proc *Process) spdzAdd(x, y *big.Int) (*big.Int, *big.Int, error) {
+	if proc.spdzSession == nil {
+		role := spdz.Sender
+		if proc.role == RoleEvaluator {
+			role = spdz.Receiver
+		}
+		session, err := spdz.NewSession(proc.conn, role, proc.baseOT())
+		if err != nil {
+			return nil, nil, err
+		}
+		// Process.terminate closes the connection after closing
+		// the stop channel.
+		session.SetStop(proc.stop, nil)
+		proc.spdzSession = session
+	}
+	err := proc.setTriplePool(proc.spdzSession, spdz.AddTriples)
+	if err != nil {
+		proc.spdzSession = nil
+		return nil, nil, err
+	}
+	x3, y3, err := spdz.P256.AddSession(proc.spdzSession, x, y)
+	if err != nil {
+		// The peers' OT extensions may be out of sync unless the
+		// computation completed with the point at infinity.
+		if !errors.Is(err, spdz.ErrInfinity) {
+			proc.spdzSession = nil
 		}
-		fmt.Println()
+		return nil, nil, err
 	}
+	return x3, y3, nil
 }
 
 func (proc *Process) debugf(format string, a ...interface{}) {
 	if !proc.kern.params.Diagnostics {
 		return
 	}
-	fmt.Printf("%s: ", proc.prog.Name)
-	fmt.Printf(format, a...)
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "%s: ", proc.prog.Name)
+	fmt.Fprintf(b, format, a...)
+	proc.kern.ktraceWrite(b)
 }
@@ -0,0 +1,137 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/markkurossi/ephemelier/eef"
+)
+
+// programCache implements a LRU cache for parsed EEF programs. The
+// programs are keyed by their filename and modification time so
+// modified programs are reloaded automatically. The cached programs
+// are shared between processes and they must not be modified after
+// they are loaded.
+type programCache struct {
+	m       sync.Mutex
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type programCacheEntry struct {
+	file  string
+	mtime time.Time
+	prog  *eef.Program
+}
+
+func newProgramCache(size int) *programCache {
+	return &programCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Load returns the program for the file. If the program is not in
+// the cache or it has been modified, Load parses the program from
+// the file and adds it to the cache.
+func (cache *programCache) Load(file string) (*eef.Program, error) {
+	if cache.size <= 0 {
+		return eef.NewProgram(file)
+	}
+	mtime, err := programModTime(file)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.m.Lock()
+	elem, ok := cache.entries[file]
+	if ok {
+		entry := elem.Value.(*programCacheEntry)
+		if entry.mtime.Equal(mtime) {
+			cache.lru.MoveToFront(elem)
+			cache.m.Unlock()
+			return entry.prog, nil
+		}
+		cache.lru.Remove(elem)
+		delete(cache.entries, file)
+	}
+	cache.m.Unlock()
+
+	prog, err := eef.NewProgram(file)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	elem, ok = cache.entries[file]
+	if ok {
+		// Loaded concurrently by another process.
+		cache.lru.Remove(elem)
+	}
+	cache.entries[file] = cache.lru.PushFront(&programCacheEntry{
+		file:  file,
+		mtime: mtime,
+		prog:  prog,
+	})
+	for cache.lru.Len() > cache.size {
+		elem = cache.lru.Back()
+		cache.lru.Remove(elem)
+		delete(cache.entries, elem.Value.(*programCacheEntry).file)
+	}
+
+	return prog, nil
+}
+
+// Len returns the number of programs in the cache.
+func (cache *programCache) Len() int {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+	return cache.lru.Len()
+}
+
+// Purge removes all programs from the cache.
+func (cache *programCache) Purge() {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	cache.lru.Init()
+	cache.entries = make(map[string]*list.Element)
+}
+
+// programModTime returns the latest modification time of the program
+// directory and its files.
+func programModTime(file string) (time.Time, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	mtime := info.ModTime()
+
+	entries, err := os.ReadDir(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, entry := range entries {
+		info, err := os.Stat(filepath.Join(file, entry.Name()))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(mtime) {
+			mtime = info.ModTime()
+		}
+	}
+	return mtime, nil
+}
@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testSymtab = `// -*- go -*-
+
+package main
+
+// Interned symbols.
+const (
+	Init = 0
+)
+`
+
+func makeTestProgram(t testing.TB, dir, name string) string {
+	file := filepath.Join(dir, name)
+	err := os.Mkdir(file, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(file, "symtab"), []byte(testSymtab),
+		0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(file, "init.dmpcl"),
+		[]byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestProgramCache(t *testing.T) {
+	dir := t.TempDir()
+	file1 := makeTestProgram(t, dir, "prog1")
+	file2 := makeTestProgram(t, dir, "prog2")
+
+	cache := newProgramCache(1)
+
+	p1, err := cache.Load(file1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := cache.Load(file1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != p1 {
+		t.Errorf("cached program not returned")
+	}
+
+	// Modified program is reloaded.
+	mtime := time.Now().Add(time.Minute)
+	err = os.Chtimes(filepath.Join(file1, "init.dmpcl"), mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = cache.Load(file1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == p1 {
+		t.Errorf("modified program not reloaded")
+	}
+	p1 = p
+
+	// Cache size is bounded.
+	_, err = cache.Load(file2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("cache size %v, expected 1", cache.Len())
+	}
+	p, err = cache.Load(file1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == p1 {
+		t.Errorf("evicted program returned from cache")
+	}
+
+	cache.Purge()
+	if cache.Len() != 0 {
+		t.Errorf("cache size %v after purge, expected 0", cache.Len())
+	}
+}
+
+func benchmarkProgramLoad(b *testing.B, size int) {
+	file := makeTestProgram(b, b.TempDir(), "prog")
+	kern := newTestKernel(b, &Params{
+		ProgramCacheSize: size,
+	})
+	for b.Loop() {
+		_, err := kern.LoadProgram(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramLoad(b *testing.B) {
+	benchmarkProgramLoad(b, 0)
+}
+
+func BenchmarkProgramLoadCached(b *testing.B) {
+	benchmarkProgramLoad(b, 16)
+}
@@ -0,0 +1,39 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"crypto/rand"
+)
+
+// RandomMaxSize defines the maximum size of the getrandom syscall
+// result in bytes.
+const RandomMaxSize = 4096
+
+// getrandom implements the getrandom syscall. The random value is
+// secret-shared between the parties: the garbler and evaluator draw
+// their shares independently and the program combines them with XOR
+// into the random value, which neither party learns alone. Both
+// parties validate the size from the same syscall outputs and return
+// equal-sized shares, so the syscall does not communicate with the
+// peer and the inputs of the next state stay identical in shape.
+func (proc *Process) getrandom(sys *syscall) {
+	size := int(sys.arg0)
+	if size < 0 || size > RandomMaxSize {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		sys.SetArg0(int32(-EFAULT))
+		return
+	}
+
+	sys.arg0 = int32(size)
+	sys.argBuf = buf
+	sys.arg1 = 0
+}
@@ -0,0 +1,64 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetrandom(t *testing.T) {
+	garbler := &Process{
+		role: RoleGarbler,
+	}
+	evaluator := &Process{
+		role: RoleEvaluator,
+	}
+
+	tests := []struct {
+		size   int32
+		result int32
+	}{
+		{0, 0},
+		{16, 16},
+		{RandomMaxSize, RandomMaxSize},
+		{-1, -int32(EINVAL)},
+		{RandomMaxSize + 1, -int32(EINVAL)},
+	}
+	for idx, test := range tests {
+		gsys := &syscall{
+			call: SysGetrandom,
+			arg0: test.size,
+		}
+		esys := &syscall{
+			call: SysGetrandom,
+			arg0: test.size,
+		}
+		garbler.getrandom(gsys)
+		evaluator.getrandom(esys)
+
+		if gsys.arg0 != test.result || esys.arg0 != test.result {
+			t.Fatalf("test%d: got %v/%v, expected %v", idx, gsys.arg0,
+				esys.arg0, test.result)
+		}
+		if len(gsys.argBuf) != len(esys.argBuf) || gsys.arg1 != esys.arg1 {
+			t.Errorf("test%d: share sizes differ: %v/%v", idx,
+				len(gsys.argBuf), len(esys.argBuf))
+		}
+		if test.result < 0 {
+			continue
+		}
+		if len(gsys.argBuf) != int(test.size) {
+			t.Errorf("test%d: got %v bytes, expected %v", idx,
+				len(gsys.argBuf), test.size)
+		}
+		// The shares are drawn independently.
+		if test.size >= 16 && bytes.Equal(gsys.argBuf, esys.argBuf) {
+			t.Errorf("test%d: garbler and evaluator shares are equal", idx)
+		}
+	}
+}
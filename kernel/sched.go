@@ -0,0 +1,49 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"runtime"
+)
+
+// Process priorities. The smaller values mean more favorable
+// scheduling.
+const (
+	PrioMin     int32 = 0
+	PrioDefault int32 = 20
+	PrioMax     int32 = 39
+)
+
+// Priority returns the process' scheduling priority.
+func (proc *Process) Priority() int32 {
+	proc.m.Lock()
+	defer proc.m.Unlock()
+	return proc.priority
+}
+
+// SetPriority sets the process' scheduling priority. Both parties
+// execute the setpriority syscall with the same arguments so the
+// garbler and evaluator processes keep identical priorities.
+func (proc *Process) SetPriority(prio int32) error {
+	if prio < PrioMin || prio > PrioMax {
+		return EINVAL
+	}
+	proc.m.Lock()
+	proc.priority = prio
+	proc.m.Unlock()
+	return nil
+}
+
+// yield gives up the processor for other processes. The processes
+// with less favorable priorities than PrioDefault yield the processor
+// multiple times so the other runnable processes are more likely to
+// run their next MPC fragment first.
+func (proc *Process) yield() {
+	for i := PrioDefault; i < proc.Priority(); i++ {
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+// SendfileBlockSize defines the block size the sendfile syscall uses
+// to copy data between file descriptors.
+const SendfileBlockSize = 64 * 1024
+
+// sendfile implements the sendfile syscall. The syscall copies count
+// bytes from the input file to the output file without passing the
+// data through the MPC program. The input fd and count are given as
+// 32-bit big-endian values in argBuf. Only the garbler has the files
+// and sockets so it copies the data and syncs the number of bytes
+// transferred with the evaluator.
+func (proc *Process) sendfile(sys *syscall) {
+	data, err := sys.argData()
+	if err != nil || len(data) != 8 || int32(bo.Uint32(data[4:])) < 0 {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+	out, ok := proc.fds[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+	in, ok := proc.fds[int32(bo.Uint32(data))]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+
+	var result int
+
+	if proc.role == RoleGarbler {
+		result = sendfile(out, in, int(bo.Uint32(data[4:])))
+		err = proc.conn.SendUint32(result)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+	} else {
+		var v int
+		v, err = proc.conn.ReceiveUint32()
+		result = int(int32(v))
+	}
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	sys.SetArg0(int32(result))
+}
+
+// sendfile copies up to count bytes from in to out. It returns the
+// number of bytes copied or -Errno on error. If an error occurs after
+// some data has been copied, sendfile returns the number of bytes
+// copied so far. The encrypted files and TLS connections are
+// encrypted inside the MPC program with secret shared keys so they
+// can't be copied by the kernel.
+func sendfile(out, in *FD, count int) int {
+	if errno := sendfileSource(in.Impl); errno != 0 {
+		return int(-errno)
+	}
+	if errno := sendfileDestination(out.Impl); errno != 0 {
+		return int(-errno)
+	}
+
+	buf := make([]byte, min(count, SendfileBlockSize))
+
+	var total int
+	for total < count {
+		n := in.Read(buf[:min(len(buf), count-total)])
+		if n < 0 {
+			if total > 0 {
+				break
+			}
+			return n
+		}
+		if n == 0 {
+			break
+		}
+		w := out.Write(buf[:n])
+		if w < 0 {
+			if total > 0 {
+				break
+			}
+			return w
+		}
+		total += w
+		if w < n {
+			break
+		}
+	}
+	return total
+}
+
+func sendfileSource(impl FDImpl) Errno {
+	switch impl := impl.(type) {
+	case *FDFile:
+		if impl.hdr != nil {
+			return EOPNOTSUPP
+		}
+		return 0
+
+	case *FDMem:
+		return 0
+
+	default:
+		return EINVAL
+	}
+}
+
+func sendfileDestination(impl FDImpl) Errno {
+	switch impl := impl.(type) {
+	case *FDFile:
+		if impl.hdr != nil {
+			return EOPNOTSUPP
+		}
+		return 0
+
+	case *FDSocket, *FDMem:
+		return 0
+
+	case *FDTLS:
+		return EOPNOTSUPP
+
+	default:
+		return EINVAL
+	}
+}
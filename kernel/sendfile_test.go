@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSendfile(t *testing.T) {
+	data := make([]byte, 3*SendfileBlockSize+100)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "data")
+	err = os.WriteFile(file, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := NewFileFD(f)
+	defer in.Close()
+
+	c0, c1 := net.Pipe()
+	out := NewSocketFD(c0)
+
+	result := make(chan []byte)
+	go func() {
+		received, _ := io.ReadAll(c1)
+		result <- received
+	}()
+
+	// Count is larger than the file.
+	n := sendfile(out, in, len(data)+10)
+	if n != len(data) {
+		t.Errorf("sendfile=%v, expected %v", n, len(data))
+	}
+	out.Close()
+	received := <-result
+	if !bytes.Equal(received, data) {
+		t.Errorf("received %v bytes, expected %v", len(received), len(data))
+	}
+
+	// Copy limited by count.
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemFD(100)
+	n = sendfile(mem, in, 50)
+	if n != 50 {
+		t.Errorf("sendfile=%v, expected 50", n)
+	}
+	if !bytes.Equal(mem.Impl.(*FDMem).buf[:50], data[:50]) {
+		t.Errorf("memfd data mismatch")
+	}
+
+	// Encrypted files and TLS connections are not supported.
+	in.Impl.(*FDFile).hdr = &FileHeader{
+		Magic: EncrFileMagic,
+	}
+	n = sendfile(mem, in, 10)
+	if n != int(-EOPNOTSUPP) {
+		t.Errorf("sendfile(encrypted)=%v, expected %v", n, -EOPNOTSUPP)
+	}
+	n = sendfile(NewTLSFD(nil, nil, nil), mem, 10)
+	if n != int(-EOPNOTSUPP) {
+		t.Errorf("sendfile(tls)=%v, expected %v", n, -EOPNOTSUPP)
+	}
+}
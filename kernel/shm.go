@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+// Shared memory limits.
+const (
+	// ShmMaxSize defines the maximum size of a shared memory region
+	// in bytes.
+	ShmMaxSize = 4096
+	// ShmMaxRegions defines the maximum number of shared memory
+	// regions per process.
+	ShmMaxRegions = 16
+)
+
+// shmRegion implements a shared memory region. The regions extend the
+// process memory with scratch buffers. The program writes a region
+// from its syscall outputs and reads it back as the argBuf input of
+// its next state, so the input assembly of the garbler and evaluator
+// stays unchanged. The MPC outputs are visible to both parties and,
+// like the process memory, the program must encrypt the region data
+// it keeps secret.
+//
+// Both parties process the shared memory syscalls from the same
+// syscall outputs and keep identical copies of the regions, so the
+// syscalls do not communicate with the peer.
+type shmRegion struct {
+	size int
+	data []byte
+}
+
+// shmAlloc implements the shmalloc syscall.
+func (proc *Process) shmAlloc(sys *syscall) {
+	size := int(sys.arg0)
+	if size <= 0 || size > ShmMaxSize {
+		sys.SetArg0(int32(-EINVAL))
+		return
+	}
+	if len(proc.shm) >= ShmMaxRegions {
+		sys.SetArg0(int32(-ENOMEM))
+		return
+	}
+	total := size
+	for _, region := range proc.shm {
+		total += region.size
+	}
+	max := proc.kern.params.MaxProcMem
+	if max > 0 && total > max {
+		sys.SetArg0(int32(-ENOMEM))
+		return
+	}
+	if proc.shm == nil {
+		proc.shm = make(map[int32]*shmRegion)
+	}
+	proc.shmNext++
+	proc.shm[proc.shmNext] = &shmRegion{
+		size: size,
+	}
+	sys.SetArg0(proc.shmNext)
+}
+
+// shmRead implements the shmread syscall.
+func (proc *Process) shmRead(sys *syscall) {
+	region, ok := proc.shm[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+	sys.arg0 = int32(len(region.data))
+	sys.argBuf = append([]byte(nil), region.data...)
+	sys.arg1 = 0
+}
+
+// shmWrite implements the shmwrite syscall.
+func (proc *Process) shmWrite(sys *syscall) {
+	region, ok := proc.shm[sys.arg0]
+	if !ok {
+		sys.SetArg0(int32(-EBADF))
+		return
+	}
+	data, err := sys.argData()
+	if err != nil {
+		sys.SetArg0(mapError(err))
+		return
+	}
+	if len(data) > region.size {
+		sys.SetArg0(int32(-ERANGE))
+		return
+	}
+	region.data = append(region.data[:0], data...)
+	sys.SetArg0(int32(len(data)))
+}
@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+// Signals for the kill syscall. The signal 0 only checks that the
+// caller may signal the process.
+const (
+	SIGKILL int32 = 9
+	SIGTERM int32 = 15
+)
+
+// SignalExit returns the exit value of a process killed by the
+// signal sig.
+func SignalExit(sig int32) int32 {
+	return 128 + sig
+}
+
+// Kill terminates the process with the signal sig. The process'
+// connection and FDs are closed so the process stops at its next
+// circuit evaluation or I/O syscall. A sleeping process is
+// interrupted. The process exits with the value SignalExit(sig).
+func (proc *Process) Kill(sig int32) {
+	if proc.setKilled(sig) {
+		proc.terminate()
+	}
+}
+
+// setKilled marks the process killed by the signal sig. The function
+// returns false if the process has exited or it was already killed.
+func (proc *Process) setKilled(sig int32) bool {
+	proc.m.Lock()
+	defer proc.m.Unlock()
+
+	if proc.state >= SZOMB || proc.killed != 0 {
+		return false
+	}
+	proc.killed = sig
+	return true
+}
+
+// terminate stops the killed process. Closing the stop channel
+// cancels the process' SPDZ computations.
+func (proc *Process) terminate() {
+	proc.m.Lock()
+	proc.intr = true
+	proc.m.Unlock()
+	proc.c.Broadcast()
+
+	if proc.stop != nil {
+		close(proc.stop)
+	}
+	proc.closeConn()
+	proc.closeFDs()
+}
+
+// closeConn closes the process' MPC connection. The connection is
+// closed when the process exits and when it is killed so closeConn
+// closes it only once.
+func (proc *Process) closeConn() {
+	proc.connClose.Do(func() {
+		if proc.conn != nil {
+			proc.conn.Close()
+		}
+	})
+}
+
+// closeFDs closes all file descriptors of the process.
+func (proc *Process) closeFDs() {
+	proc.m.Lock()
+	defer proc.m.Unlock()
+
+	for fd, impl := range proc.fds {
+		if impl != nil {
+			impl.Close()
+		}
+		delete(proc.fds, fd)
+	}
+}
+
+// kill implements the kill syscall. A process can only signal its own
+// children. The garbler checks the target process and syncs the
+// result with the evaluator. The children are connected to each
+// other, so they are marked killed before either is stopped: the
+// garbler marks its child, the evaluator kills its child and
+// acknowledges, and then the garbler stops its child. This way both
+// children exit with the signal's exit value.
+func (proc *Process) kill(sys *syscall) error {
+	sig := sys.arg1
+	if sig != 0 && sig != SIGKILL && sig != SIGTERM {
+		sys.SetArg0(int32(-EINVAL))
+		return nil
+	}
+
+	var result int32
+	if proc.role == RoleGarbler {
+		var killed bool
+		child, ok := proc.kern.GetProcess(PID(sys.arg0).G())
+		if !ok {
+			result = int32(-ESRCH)
+		} else if child.parent != proc.pid.G() {
+			result = int32(-EPERM)
+		} else if sig != 0 {
+			killed = child.setKilled(sig)
+		}
+		err := proc.conn.SendUint32(int(result))
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+		if err == nil && result == 0 && sig != 0 {
+			// Wait for the evaluator to kill its child.
+			_, err = proc.conn.ReceiveUint32()
+		}
+		if killed {
+			child.terminate()
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		v, err := proc.conn.ReceiveUint32()
+		if err != nil {
+			return err
+		}
+		result = int32(v)
+		if result == 0 && sig != 0 {
+			child, ok := proc.kern.GetProcess(PID(sys.arg0).E())
+			if ok {
+				child.Kill(sig)
+			}
+			err = proc.conn.SendUint32(0)
+			if err == nil {
+				err = proc.conn.Flush()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	sys.SetArg0(result)
+
+	return nil
+}
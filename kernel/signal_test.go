@@ -0,0 +1,170 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/crypto/spdz"
+	"github.com/markkurossi/ephemelier/internal/p2ptest"
+)
+
+func TestKill(t *testing.T) {
+	c0, c1, _ := p2ptest.Pipe()
+
+	garbler := &Process{
+		kern: newTestKernel(t, nil),
+		role: RoleGarbler,
+		conn: c0,
+	}
+	garbler.pid.SetG(100)
+
+	evaluator := &Process{
+		kern: newTestKernel(t, nil),
+		role: RoleEvaluator,
+		conn: c1,
+	}
+	evaluator.pid.SetE(100)
+
+	// The garbler's child is paused and the evaluator's child waits
+	// for its peer's setup message until they are killed.
+	c2, c3, _ := p2ptest.Pipe()
+	gchild, err := garbler.kern.CreateProcess(c2, RoleGarbler, nil,
+		NewDevNullFD(), NewDevNullFD(), NewDevNullFD())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gchild.parent = garbler.pid.G()
+	echild, err := evaluator.kern.CreateProcess(c3, RoleEvaluator, nil,
+		NewDevNullFD(), NewDevNullFD(), NewDevNullFD())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gchild.SetState(SRUN)
+	go func() {
+		gchild.pause()
+		gchild.m.Lock()
+		gchild.exitVal = SignalExit(gchild.killed)
+		gchild.m.Unlock()
+		gchild.SetState(SZOMB)
+	}()
+	go echild.Run()
+
+	var pid PID
+	pid.SetG(gchild.pid.G())
+	pid.SetE(echild.pid.E())
+
+	// A process which is not our child.
+	other, err := garbler.kern.CreateProcess(nil, RoleGarbler, nil, nil, nil,
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var otherPID PID
+	otherPID.SetG(other.pid.G())
+
+	call := func(call Syscall, p PID, arg1 int32) (int32, int32) {
+		gsys := &syscall{
+			call: call,
+			arg0: int32(p),
+			arg1: arg1,
+		}
+		esys := &syscall{
+			call: call,
+			arg0: int32(p),
+			arg1: arg1,
+		}
+		var gerr, eerr error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			gerr = garbler.syscall(gsys)
+		})
+		wg.Go(func() {
+			eerr = evaluator.syscall(esys)
+		})
+		wg.Wait()
+		if gerr != nil || eerr != nil {
+			t.Fatalf("%v: garbler=%v, evaluator=%v", call, gerr, eerr)
+		}
+		return gsys.arg0, esys.arg0
+	}
+
+	tests := []struct {
+		pid    PID
+		sig    int32
+		result int32
+	}{
+		{pid, 0, 0},
+		{pid, 3, -int32(EINVAL)},
+		{otherPID, SIGKILL, -int32(EPERM)},
+		{PID(0x7fff7fff), SIGKILL, -int32(ESRCH)},
+	}
+	for idx, test := range tests {
+		g, e := call(SysKill, test.pid, test.sig)
+		if g != test.result || e != test.result {
+			t.Errorf("test%d: got %v/%v, expected %v", idx, g, e, test.result)
+		}
+	}
+	if gchild.State() >= SZOMB || echild.State() >= SZOMB {
+		t.Fatalf("child exited: %v/%v", gchild.State(), echild.State())
+	}
+
+	// Kill the child and reap it.
+	g, e := call(SysKill, pid, SIGTERM)
+	if g != 0 || e != 0 {
+		t.Fatalf("kill: got %v/%v, expected 0", g, e)
+	}
+	g, e = call(SysWait, pid, 0)
+	if g != SignalExit(SIGTERM) || e != SignalExit(SIGTERM) {
+		t.Errorf("wait: got %v/%v, expected %v", g, e, SignalExit(SIGTERM))
+	}
+}
+
+func TestKillSPDZ(t *testing.T) {
+	c0, c1, _ := p2ptest.Pipe()
+
+	proc, err := newTestKernel(t, nil).CreateProcess(c0, RoleGarbler, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The peer accepts the triple pool offset and stops responding
+	// once the garbler has started the SPDZ computation.
+	acked := make(chan error)
+	go func() {
+		_, err := c1.ReceiveUint32()
+		if err == nil {
+			err = c1.SendByte(0)
+		}
+		if err == nil {
+			err = c1.Flush()
+		}
+		if err == nil {
+			_, err = c1.ReceiveByte()
+		}
+		acked <- err
+	}()
+
+	var addErr error
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		params := elliptic.P256().Params()
+		_, _, addErr = proc.spdzAdd(params.Gx, params.Gy)
+	})
+	if err := <-acked; err != nil {
+		t.Fatal(err)
+	}
+	proc.Kill(SIGKILL)
+	wg.Wait()
+
+	if !errors.Is(addErr, spdz.ErrCanceled) {
+		t.Errorf("spdzAdd: got %v, expected %v", addErr, spdz.ErrCanceled)
+	}
+}
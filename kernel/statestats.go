@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// StateKey identifies a program state.
+type StateKey struct {
+	Program string
+	State   string
+}
+
+func (key StateKey) String() string {
+	return fmt.Sprintf("%s:%s", key.Program, key.State)
+}
+
+// StateStats provide statistics about how a program state was
+// executed. Precompiled states run their pre-compiled circuits and
+// streaming states compile their MPCL on every execution. States
+// with high streaming counts and times are good candidates for
+// precompilation.
+type StateStats struct {
+	Precompiled     uint64
+	PrecompiledTime time.Duration
+	Streaming       uint64
+	StreamingTime   time.Duration
+}
+
+// Add adds the execution of a state with the MPC duration d.
+func (stats *StateStats) Add(streaming bool, d time.Duration) {
+	if streaming {
+		stats.Streaming++
+		stats.StreamingTime += d
+	} else {
+		stats.Precompiled++
+		stats.PrecompiledTime += d
+	}
+}
+
+func (stats StateStats) String() string {
+	return fmt.Sprintf("precompiled=%v/%v, streaming=%v/%v",
+		stats.Precompiled, stats.PrecompiledTime,
+		stats.Streaming, stats.StreamingTime)
+}
+
+// StateStats returns the cumulative state statistics of all processes
+// the kernel has run.
+func (kern *Kernel) StateStats() map[StateKey]StateStats {
+	kern.m.Lock()
+	defer kern.m.Unlock()
+
+	result := make(map[StateKey]StateStats)
+	for k, v := range kern.stateStats {
+		result[k] = *v
+	}
+	return result
+}
+
+func (kern *Kernel) addStateStats(key StateKey, streaming bool,
+	d time.Duration) {
+
+	kern.m.Lock()
+	defer kern.m.Unlock()
+
+	stats, ok := kern.stateStats[key]
+	if !ok {
+		stats = new(StateStats)
+		kern.stateStats[key] = stats
+	}
+	stats.Add(streaming, d)
+}
+
+// stateStats records the execution of the program state with the MPC
+// duration d.
+func (proc *Process) stateStats(state string, streaming bool,
+	d time.Duration) {
+
+	stats, ok := proc.states[state]
+	if !ok {
+		stats = new(StateStats)
+		proc.states[state] = stats
+	}
+	stats.Add(streaming, d)
+
+	proc.kern.addStateStats(StateKey{
+		Program: proc.prog.Name,
+		State:   state,
+	}, streaming, d)
+}
+
+// stateNames returns the names of the executed states in sorted
+// order.
+func (proc *Process) stateNames() []string {
+	var names []string
+	for name := range proc.states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
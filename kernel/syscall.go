@@ -46,6 +46,42 @@ const (
 	SysGetpid
 	SysChroot
 	SysOpenkey
+	SysTlsinfo
+	SysFstat
+	SysPause
+	SysTruncate
+	SysFtruncate
+	SysClockNanosleep
+	SysMemfd
+	SysSendfile
+	SysGetpriority
+	SysSetpriority
+	SysReboot
+	SysGetcwd
+	SysConnecttls
+	SysWaitpid
+	SysGetsharedsecret
+	SysTlsctl
+	SysShmalloc
+	SysShmread
+	SysShmwrite
+	SysStatfs
+	SysPread
+	SysPwrite
+	SysMkdir
+	SysUnlink
+	SysReaddir
+	SysLseek
+	SysSendto
+	SysRecvfrom
+	SysGettimeofday
+	SysClockGettime
+	SysDup
+	SysDup2
+	SysKill
+	SysGetenv
+	SysChmod
+	SysAlarm
 )
 
 // Port system calls.
@@ -81,6 +117,44 @@ var syscallNames = map[Syscall]string{
 	SysGetpid:    "getpid",
 	SysChroot:    "chroot",
 	SysOpenkey:   "openkey",
+	SysTlsinfo:   "tlsinfo",
+	SysFstat:     "fstat",
+	SysPause:     "pause",
+	SysTruncate:  "truncate",
+	SysFtruncate: "ftruncate",
+
+	SysClockNanosleep: "clock_nanosleep",
+	SysMemfd:          "memfd",
+	SysSendfile:       "sendfile",
+	SysGetpriority:    "getpriority",
+	SysSetpriority:    "setpriority",
+	SysReboot:         "reboot",
+	SysGetcwd:         "getcwd",
+	SysConnecttls:     "connecttls",
+	SysWaitpid:        "waitpid",
+
+	SysGetsharedsecret: "getsharedsecret",
+	SysTlsctl:          "tlsctl",
+	SysShmalloc:        "shmalloc",
+	SysShmread:         "shmread",
+	SysShmwrite:        "shmwrite",
+	SysStatfs:          "statfs",
+	SysPread:           "pread",
+	SysPwrite:          "pwrite",
+	SysMkdir:           "mkdir",
+	SysUnlink:          "unlink",
+	SysReaddir:         "readdir",
+	SysLseek:           "lseek",
+	SysSendto:          "sendto",
+	SysRecvfrom:        "recvfrom",
+	SysGettimeofday:    "gettimeofday",
+	SysClockGettime:    "clock_gettime",
+	SysDup:             "dup",
+	SysDup2:            "dup2",
+	SysKill:            "kill",
+	SysGetenv:          "getenv",
+	SysChmod:           "chmod",
+	SysAlarm:           "alarm",
 
 	SysGetport:    "getport",
 	SysCreateport: "createport",
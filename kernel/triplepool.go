@@ -0,0 +1,231 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/markkurossi/ephemelier/crypto/spdz"
+)
+
+// triplePool holds the node's preprocessed SPDZ Beaver triples. The
+// pools of the garbler and evaluator nodes are generated together
+// with the triples command. The garbler allocates the triples for its
+// processes and tells the evaluator which triples to use so the peer
+// processes take the matching triples from their pools. Each triple
+// is used only once. The pool's consumption is persisted in the file
+// with the .used suffix as the high-water mark of the used triples.
+// The mark is synced to the file before the triples are handed out
+// so a restarted node does not reuse the triples below the mark.
+type triplePool struct {
+	m       sync.Mutex
+	triples []*spdz.Triple
+	macKey  *big.Int
+	used    []bool
+	next    int
+	mark    int
+	state   *os.File
+}
+
+// tripleStateSize is the size of the pool's consumption state: the
+// high-water mark as a 64-bit big-endian integer.
+const tripleStateSize = 8
+
+// loadTriplePool loads the triple pool from the file. The MAC key
+// share of the pool is read from the file with the .key suffix and
+// the pool's consumption state from the file with the .used suffix.
+// The function fails if the consumption state is missing because
+// without it, the triples could have been used before.
+func loadTriplePool(file string) (*triplePool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	triples, err := spdz.LoadTriples(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	key, err := os.ReadFile(file + ".key")
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s.key: invalid MAC key share", file)
+	}
+
+	state, err := os.OpenFile(file+".used", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	var buf [tripleStateSize]byte
+	n, err := state.ReadAt(buf[:], 0)
+	if n != len(buf) {
+		state.Close()
+		if err == nil || errors.Is(err, io.EOF) {
+			err = fmt.Errorf("%s.used: short consumption state", file)
+		}
+		return nil, err
+	}
+	mark := bo.Uint64(buf[:])
+	if mark > uint64(len(triples)) {
+		state.Close()
+		return nil, fmt.Errorf("%s.used: invalid high-water mark %v",
+			file, mark)
+	}
+
+	pool := &triplePool{
+		triples: triples,
+		macKey:  new(big.Int).SetBytes(key),
+		used:    make([]bool, len(triples)),
+		next:    int(mark),
+		mark:    int(mark),
+		state:   state,
+	}
+	for i := 0; i < pool.mark; i++ {
+		pool.used[i] = true
+	}
+	return pool, nil
+}
+
+// WriteTripleState writes the consumption state of the new triple
+// pool file with no triples used.
+func WriteTripleState(file string) error {
+	var buf [tripleStateSize]byte
+	return os.WriteFile(file+".used", buf[:], 0600)
+}
+
+// alloc allocates n unused triples for the garbler. The function
+// returns the offset of the triples or -1 if the pool does not have n
+// unused triples.
+func (pool *triplePool) alloc(n int) int {
+	pool.m.Lock()
+	defer pool.m.Unlock()
+
+	for pool.next+n <= len(pool.triples) {
+		ofs := pool.next
+		pool.next++
+		if pool.claimLocked(ofs, n) {
+			pool.next = ofs + n
+			return ofs
+		}
+	}
+	return -1
+}
+
+// claim claims the n triples at the offset ofs for the evaluator. The
+// function returns false if the triples are out of the pool's range
+// or if any of them has been used.
+func (pool *triplePool) claim(ofs, n int) bool {
+	pool.m.Lock()
+	defer pool.m.Unlock()
+
+	return pool.claimLocked(ofs, n)
+}
+
+func (pool *triplePool) claimLocked(ofs, n int) bool {
+	if ofs < 0 || n <= 0 || ofs+n > len(pool.triples) {
+		return false
+	}
+	for i := ofs; i < ofs+n; i++ {
+		if pool.used[i] {
+			return false
+		}
+	}
+	if ofs+n > pool.mark {
+		err := pool.syncMark(ofs + n)
+		if err != nil {
+			log.Printf("triple pool: %v", err)
+			return false
+		}
+	}
+	for i := ofs; i < ofs+n; i++ {
+		pool.used[i] = true
+	}
+	return true
+}
+
+// syncMark sets the pool's high-water mark and syncs it to the
+// consumption state file.
+func (pool *triplePool) syncMark(mark int) error {
+	if pool.state != nil {
+		var buf [tripleStateSize]byte
+		bo.PutUint64(buf[:], uint64(mark))
+		_, err := pool.state.WriteAt(buf[:], 0)
+		if err != nil {
+			return err
+		}
+		err = pool.state.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	pool.mark = mark
+	return nil
+}
+
+// setTriplePool sets the kernel's pooled triples for the next point
+// addition of the process' SPDZ session. The garbler allocates the
+// triples and sends their offset to the evaluator which claims the
+// same triples from its pool. If either node has no triples, both
+// sessions generate the triples.
+func (proc *Process) setTriplePool(session *spdz.Session, n int) error {
+	pool := proc.kern.triples
+
+	var ofs int
+	var ok bool
+
+	if proc.role == RoleGarbler {
+		ofs = -1
+		if pool != nil {
+			ofs = pool.alloc(n)
+		}
+		err := proc.conn.SendUint32(ofs)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		ack, err := proc.conn.ReceiveByte()
+		if err != nil {
+			return err
+		}
+		ok = ofs >= 0 && ack != 0
+	} else {
+		v, err := proc.conn.ReceiveUint32()
+		if err != nil {
+			return err
+		}
+		ofs = int(int32(v))
+		ok = ofs >= 0 && pool != nil && pool.claim(ofs, n)
+		var ack byte
+		if ok {
+			ack = 1
+		}
+		err = proc.conn.SendByte(ack)
+		if err == nil {
+			err = proc.conn.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if ok {
+		session.SetTriplePool(pool.triples[ofs:ofs+n], pool.macKey)
+	} else {
+		session.SetTriplePool(nil, nil)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/markkurossi/ephemelier/crypto/spdz"
+	"github.com/markkurossi/mpc/p2p"
+)
+
+func TestTriplePoolClaim(t *testing.T) {
+	pool := &triplePool{
+		triples: make([]*spdz.Triple, 10),
+		used:    make([]bool, 10),
+	}
+	if !pool.claim(2, 3) {
+		t.Errorf("claim(2, 3) failed")
+	}
+	tests := []struct {
+		ofs, n int
+	}{
+		{-1, 1},
+		{0, 0},
+		{4, 1},
+		{1, 2},
+		{8, 3},
+	}
+	for idx, test := range tests {
+		if pool.claim(test.ofs, test.n) {
+			t.Errorf("test%d: claim(%v, %v) succeeded", idx, test.ofs, test.n)
+		}
+	}
+	if ofs := pool.alloc(2); ofs != 0 {
+		t.Errorf("alloc(2) = %v, expected 0", ofs)
+	}
+	if ofs := pool.alloc(4); ofs != 5 {
+		t.Errorf("alloc(4) = %v, expected 5", ofs)
+	}
+	if ofs := pool.alloc(2); ofs != -1 {
+		t.Errorf("alloc(2) = %v, expected -1", ofs)
+	}
+}
+
+// writeTriplePools generates n authenticated triples and writes the
+// garbler's and evaluator's pools to <prefix>0 and <prefix>1.
+func writeTriplePools(t *testing.T, prefix string, n int) {
+	c0, c1 := p2p.Pipe()
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for idx, conn := range []*p2p.Conn{c0, c1} {
+		role := spdz.Sender
+		if idx == 1 {
+			role = spdz.Receiver
+		}
+		wg.Go(func() {
+			session, err := spdz.NewSession(conn, role,
+				spdz.OTInsecure.New(rand.Reader))
+			if err != nil {
+				errs[idx] = err
+				return
+			}
+			params := spdz.P256.WithMACKey(session.MACKey())
+			triples, err := params.GenerateBeaverTriplesSession(session, n)
+			if err != nil {
+				errs[idx] = err
+				return
+			}
+			file := fmt.Sprintf("%s%d", prefix, idx)
+			f, err := os.Create(file)
+			if err != nil {
+				errs[idx] = err
+				return
+			}
+			err = spdz.SaveTriples(f, triples)
+			if err == nil {
+				err = f.Close()
+			}
+			if err != nil {
+				errs[idx] = err
+				return
+			}
+			key := make([]byte, 32)
+			session.MACKey().FillBytes(key)
+			err = os.WriteFile(file+".key", key, 0600)
+			if err != nil {
+				errs[idx] = err
+				return
+			}
+			errs[idx] = WriteTripleState(file)
+		})
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTriplePoolState(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "p256.")
+	writeTriplePools(t, prefix, 4)
+	file := prefix + "0"
+
+	pool, err := loadTriplePool(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ofs := pool.alloc(2); ofs != 0 {
+		t.Errorf("alloc(2) = %v, expected 0", ofs)
+	}
+	pool.state.Close()
+
+	// The restarted node does not reuse the allocated triples.
+	pool, err = loadTriplePool(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.claim(0, 2) {
+		t.Errorf("claim(0, 2) succeeded after restart")
+	}
+	if ofs := pool.alloc(2); ofs != 2 {
+		t.Errorf("alloc(2) = %v, expected 2", ofs)
+	}
+	pool.state.Close()
+
+	pool, err = loadTriplePool(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ofs := pool.alloc(1); ofs != -1 {
+		t.Errorf("alloc(1) = %v, expected -1", ofs)
+	}
+	pool.state.Close()
+
+	// The pool without the consumption state is not loaded.
+	err = os.Remove(file + ".used")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(&Params{
+		TriplePool: file,
+	})
+	if err == nil {
+		t.Errorf("pool without consumption state loaded")
+	}
+
+	// The high-water mark must be within the pool.
+	err = os.WriteFile(file+".used", []byte{0, 0, 0, 0, 0, 0, 0, 5}, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadTriplePool(file)
+	if err == nil {
+		t.Errorf("pool with invalid high-water mark loaded")
+	}
+}
+
+func TestTriplePoolParams(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "p256.")
+	writeTriplePools(t, prefix, spdz.AddTriples)
+
+	c0, c1 := p2p.Pipe()
+	var procs [2]*Process
+	for idx, conn := range []*p2p.Conn{c0, c1} {
+		role := RoleGarbler
+		if idx == 1 {
+			role = RoleEvaluator
+		}
+		kern := newTestKernel(t, &Params{
+			TriplePool: fmt.Sprintf("%s%d", prefix, idx),
+			OT:         spdz.OTInsecure,
+		})
+		if kern.triples == nil {
+			t.Fatalf("triple pool %v not loaded", idx)
+		}
+		proc, err := kern.CreateProcess(conn, role, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		procs[idx] = proc
+	}
+
+	curve := elliptic.P256()
+	var points [2]*ecdsa.PublicKey
+	for i := range points {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		points[i] = &key.PublicKey
+	}
+
+	var xs, ys [2]*big.Int
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, proc := range procs {
+		wg.Go(func() {
+			xs[i], ys[i], errs[i] = proc.spdzAdd(points[i].X, points[i].Y)
+		})
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rx, ry := curve.Add(points[0].X, points[0].Y, points[1].X, points[1].Y)
+	x := new(big.Int).Add(xs[0], xs[1])
+	y := new(big.Int).Add(ys[0], ys[1])
+	if x.Mod(x, curve.Params().P).Cmp(rx) != 0 ||
+		y.Mod(y, curve.Params().P).Cmp(ry) != 0 {
+		t.Errorf("pooled point addition mismatch")
+	}
+	for idx, proc := range procs {
+		if proc.spdzSession.Stats.Setups != 0 {
+			t.Errorf("process %v: %v OT setups, expected 0", idx,
+				proc.spdzSession.Stats.Setups)
+		}
+		if proc.kern.triples.claim(0, 1) {
+			t.Errorf("process %v: pooled triple not consumed", idx)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//
+// Copyright (c) 2026 Markku Rossi
+//
+// All rights reserved.
+//
+
+package kernel
+
+// Options for the waitpid syscall.
+const (
+	// WNOHANG makes waitpid return EAGAIN instead of blocking if the
+	// child has not exited.
+	WNOHANG int32 = 1
+)
+
+// waitpid implements the wait and waitpid syscalls. The options
+// specify the waitpid options. With WNOHANG, the garbler checks its
+// child's state and syncs the result with the evaluator. If the child
+// has exited, both parties reap their children and return the child's
+// exit value. If the child is still running, both parties return
+// -EAGAIN.
+func (proc *Process) waitpid(sys *syscall, options int32) error {
+	if options&^WNOHANG != 0 {
+		sys.SetArg0(int32(-EINVAL))
+		return nil
+	}
+	var pid PartyID
+	if proc.role == RoleGarbler {
+		pid = PID(sys.arg0).G()
+	} else {
+		pid = PID(sys.arg0).E()
+	}
+	child, ok := proc.kern.GetProcess(pid)
+
+	if options&WNOHANG != 0 {
+		var result int32
+		if proc.role == RoleGarbler {
+			if !ok {
+				result = int32(-ECHILD)
+			} else if child.State() < SZOMB {
+				result = int32(-EAGAIN)
+			}
+			err := proc.conn.SendUint32(int(result))
+			if err == nil {
+				err = proc.conn.Flush()
+			}
+			if err != nil {
+				return err
+			}
+		} else {
+			v, err := proc.conn.ReceiveUint32()
+			if err != nil {
+				return err
+			}
+			result = int32(v)
+		}
+		if result != 0 {
+			sys.SetArg0(result)
+			return nil
+		}
+	}
+	if !ok {
+		sys.SetArg0(int32(-ECHILD))
+		return nil
+	}
+	child.WaitState(SZOMB)
+	sys.SetArg0(child.exitVal)
+	proc.kern.RemoveProcess(pid)
+
+	return nil
+}